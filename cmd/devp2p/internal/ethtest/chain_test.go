@@ -34,7 +34,7 @@ func TestEthProtocolNegotiation(t *testing.T) {
 		expected uint32
 	}{
 		{
-			conn: &Conn{},
+			conn: &Conn{ourHighestProtoVersion: 65},
 			caps: []p2p.Cap{
 				{Name: "eth", Version: 63},
 				{Name: "eth", Version: 64},
@@ -43,7 +43,7 @@ func TestEthProtocolNegotiation(t *testing.T) {
 			expected: uint32(65),
 		},
 		{
-			conn: &Conn{},
+			conn: &Conn{ourHighestProtoVersion: 65},
 			caps: []p2p.Cap{
 				{Name: "eth", Version: 0},
 				{Name: "eth", Version: 89},
@@ -52,7 +52,7 @@ func TestEthProtocolNegotiation(t *testing.T) {
 			expected: uint32(65),
 		},
 		{
-			conn: &Conn{},
+			conn: &Conn{ourHighestProtoVersion: 65},
 			caps: []p2p.Cap{
 				{Name: "eth", Version: 63},
 				{Name: "eth", Version: 64},
@@ -60,6 +60,15 @@ func TestEthProtocolNegotiation(t *testing.T) {
 			},
 			expected: uint32(64),
 		},
+		{
+			conn: &Conn{ourHighestProtoVersion: 66},
+			caps: []p2p.Cap{
+				{Name: "eth", Version: 64},
+				{Name: "eth", Version: 65},
+				{Name: "eth", Version: 66},
+			},
+			expected: uint32(66),
+		},
 	}
 
 	for i, tt := range tests {
@@ -0,0 +1,258 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/rlpx"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStatus_66 attempts to connect to the given node and exchange
+// a status message with it on the eth66 protocol.
+func (s *Suite) TestStatus_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	if conn.ethProtocolVersion != 66 {
+		t.Fatalf("wrong eth protocol version negotiated: have %d, want 66", conn.ethProtocolVersion)
+	}
+}
+
+// TestGetBlockHeaders_66 tests whether the given node can respond to
+// an eth66 `GetBlockHeaders` request and that the response is accurate.
+func (s *Suite) TestGetBlockHeaders_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+
+	req := &GetBlockHeaders66{
+		RequestId: 3,
+		Query: &GetBlockHeaders{
+			Origin:  hashOrNumber{Hash: s.chain.blocks[1].Hash()},
+			Amount:  2,
+			Skip:    1,
+			Reverse: false,
+		},
+	}
+	headers := s.getBlockHeaders66(t, conn, req)
+	s.checkHeaders(t, req.Query, headers)
+}
+
+// TestSimultaneousRequests_66 sends two eth66 header requests with different
+// request IDs at the same time and checks that the node answers both, each
+// with the response belonging to the request.
+func (s *Suite) TestSimultaneousRequests_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+
+	reqs := []*GetBlockHeaders66{
+		{
+			RequestId: 111,
+			Query: &GetBlockHeaders{
+				Origin:  hashOrNumber{Hash: s.chain.blocks[1].Hash()},
+				Amount:  2,
+				Skip:    1,
+				Reverse: false,
+			},
+		},
+		{
+			RequestId: 222,
+			Query: &GetBlockHeaders{
+				Origin:  hashOrNumber{Hash: s.chain.blocks[1].Hash()},
+				Amount:  4,
+				Skip:    1,
+				Reverse: false,
+			},
+		},
+	}
+	for _, req := range reqs {
+		if err := conn.Write(req); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+	}
+	pending := map[uint64]*GetBlockHeaders{
+		reqs[0].RequestId: reqs[0].Query,
+		reqs[1].RequestId: reqs[1].Query,
+	}
+	for len(pending) > 0 {
+		switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+		case *BlockHeaders66:
+			query, ok := pending[msg.RequestId]
+			if !ok {
+				t.Fatalf("response to unknown or already answered request %d", msg.RequestId)
+			}
+			delete(pending, msg.RequestId)
+			s.checkHeaders(t, query, msg.Headers)
+		default:
+			t.Fatalf("unexpected: %s", pretty.Sdump(msg))
+		}
+	}
+}
+
+// TestSameRequestID_66 sends two eth66 header requests with the same request
+// ID and checks that the node answers both of them.
+func (s *Suite) TestSameRequestID_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+
+	reqs := []*GetBlockHeaders66{
+		{
+			RequestId: 1111,
+			Query: &GetBlockHeaders{
+				Origin:  hashOrNumber{Number: 1},
+				Amount:  2,
+				Skip:    1,
+				Reverse: false,
+			},
+		},
+		{
+			RequestId: 1111,
+			Query: &GetBlockHeaders{
+				Origin:  hashOrNumber{Number: 33},
+				Amount:  2,
+				Skip:    1,
+				Reverse: false,
+			},
+		},
+	}
+	for _, req := range reqs {
+		if err := conn.Write(req); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+	}
+	// Requests on a single connection are served in order
+	for _, req := range reqs {
+		switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+		case *BlockHeaders66:
+			if msg.RequestId != req.RequestId {
+				t.Fatalf("request ID mismatch: have %d, want %d", msg.RequestId, req.RequestId)
+			}
+			s.checkHeaders(t, req.Query, msg.Headers)
+		default:
+			t.Fatalf("unexpected: %s", pretty.Sdump(msg))
+		}
+	}
+}
+
+// TestGetBlockBodies_66 tests whether the given node can respond to
+// an eth66 `GetBlockBodies` request and that the response is accurate.
+func (s *Suite) TestGetBlockBodies_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+
+	req := &GetBlockBodies66{
+		RequestId: 55,
+		Hashes:    GetBlockBodies{s.chain.blocks[54].Hash(), s.chain.blocks[75].Hash()},
+	}
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+	case *BlockBodies66:
+		if msg.RequestId != req.RequestId {
+			t.Fatalf("request ID mismatch: have %d, want %d", msg.RequestId, req.RequestId)
+		}
+		if len(msg.Bodies) != len(req.Hashes) {
+			t.Fatalf("wrong number of block bodies: have %d, want %d", len(msg.Bodies), len(req.Hashes))
+		}
+		t.Logf("received %d block bodies", len(msg.Bodies))
+	default:
+		t.Fatalf("unexpected: %s", pretty.Sdump(msg))
+	}
+}
+
+// TestBroadcast_66 tests whether a block announcement is correctly
+// propagated to the given node's eth66 peer(s).
+func (s *Suite) TestBroadcast_66(t *utesting.T) {
+	sendConn, receiveConn := s.setupConnection66(t), s.setupConnection66(t)
+	nextBlock := len(s.chain.blocks)
+	blockAnnouncement := &NewBlock{
+		Block: s.fullChain.blocks[nextBlock],
+		TD:    s.fullChain.TD(nextBlock + 1),
+	}
+	s.testAnnounce(t, sendConn, receiveConn, blockAnnouncement)
+	// update test suite chain
+	s.chain.blocks = append(s.chain.blocks, s.fullChain.blocks[nextBlock])
+	// wait for client to update its chain
+	if err := receiveConn.waitForBlock(s.chain.Head()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getBlockHeaders66 sends the given eth66 header request and waits for the
+// response carrying the same request ID.
+func (s *Suite) getBlockHeaders66(t *utesting.T, conn *Conn, req *GetBlockHeaders66) BlockHeaders {
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+	case *BlockHeaders66:
+		if msg.RequestId != req.RequestId {
+			t.Fatalf("request ID mismatch: have %d, want %d", msg.RequestId, req.RequestId)
+		}
+		return msg.Headers
+	default:
+		t.Fatalf("unexpected: %s", pretty.Sdump(msg))
+		return nil
+	}
+}
+
+// checkHeaders verifies that the headers received from the node match the ones
+// the query should have returned from the local chain.
+func (s *Suite) checkHeaders(t *utesting.T, query *GetBlockHeaders, headers BlockHeaders) {
+	expected, err := s.chain.GetHeaders(*query)
+	if err != nil {
+		t.Fatalf("failed to get headers for query: %v", err)
+	}
+	assert.Equal(t, expected, headers)
+}
+
+// setupConnection66 dials the node and performs the protocol handshake and
+// status exchange on the eth66 protocol.
+func (s *Suite) setupConnection66(t *utesting.T) *Conn {
+	conn, err := s.dial66()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	conn.handshake(t)
+	conn.statusExchange(t, s.chain, nil)
+	return conn
+}
+
+// dial66 attempts to dial the given node and perform an encryption handshake,
+// advertising the eth66 capability on top of the older ones.
+func (s *Suite) dial66() (*Conn, error) {
+	var conn Conn
+
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", s.Dest.IP(), s.Dest.TCP()))
+	if err != nil {
+		return nil, err
+	}
+	conn.Conn = rlpx.NewConn(fd, s.Dest.Pubkey())
+	conn.caps = []p2p.Cap{
+		{Name: "eth", Version: 64},
+		{Name: "eth", Version: 65},
+		{Name: "eth", Version: 66},
+	}
+	conn.ourHighestProtoVersion = 66
+
+	// do encHandshake
+	conn.ourKey, _ = crypto.GenerateKey()
+	if _, err = conn.Handshake(conn.ourKey); err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
@@ -73,6 +73,15 @@ func (s *Suite) AllTests() []utesting.Test {
 		{Name: "TestLargeAnnounce", Fn: s.TestLargeAnnounce},
 		{Name: "TestMaliciousHandshake", Fn: s.TestMaliciousHandshake},
 		{Name: "TestMaliciousStatus", Fn: s.TestMaliciousStatus},
+		// test eth66
+		{Name: "Status_66", Fn: s.TestStatus_66},
+		{Name: "GetBlockHeaders_66", Fn: s.TestGetBlockHeaders_66},
+		{Name: "TestSimultaneousRequests_66", Fn: s.TestSimultaneousRequests_66},
+		{Name: "TestSameRequestID_66", Fn: s.TestSameRequestID_66},
+		{Name: "GetBlockBodies_66", Fn: s.TestGetBlockBodies_66},
+		{Name: "Broadcast_66", Fn: s.TestBroadcast_66},
+		// transaction tests leave pooled transactions behind, which get
+		// announced to every new connection, so they must run last
 		{Name: "TestTransactions", Fn: s.TestTransaction},
 		{Name: "TestMaliciousTransactions", Fn: s.TestMaliciousTx},
 	}
@@ -389,6 +398,11 @@ func (s *Suite) dial() (*Conn, error) {
 		return nil, err
 	}
 	conn.Conn = rlpx.NewConn(fd, s.Dest.Pubkey())
+	conn.caps = []p2p.Cap{
+		{Name: "eth", Version: 64},
+		{Name: "eth", Version: 65},
+	}
+	conn.ourHighestProtoVersion = 65
 
 	// do encHandshake
 	conn.ourKey, _ = crypto.GenerateKey()
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"math/rand"
 	"reflect"
 	"time"
 
@@ -141,6 +142,39 @@ type NewPooledTransactionHashes [][32]byte
 
 func (nb NewPooledTransactionHashes) Code() int { return 24 }
 
+// GetBlockHeaders66 is the eth/66 version of GetBlockHeaders, wrapping the
+// query together with a request ID.
+type GetBlockHeaders66 struct {
+	RequestId uint64
+	Query     *GetBlockHeaders
+}
+
+func (g GetBlockHeaders66) Code() int { return 19 }
+
+// BlockHeaders66 is the eth/66 version of BlockHeaders.
+type BlockHeaders66 struct {
+	RequestId uint64
+	Headers   BlockHeaders
+}
+
+func (bh BlockHeaders66) Code() int { return 20 }
+
+// GetBlockBodies66 is the eth/66 version of GetBlockBodies.
+type GetBlockBodies66 struct {
+	RequestId uint64
+	Hashes    GetBlockBodies
+}
+
+func (gbb GetBlockBodies66) Code() int { return 21 }
+
+// BlockBodies66 is the eth/66 version of BlockBodies.
+type BlockBodies66 struct {
+	RequestId uint64
+	Bodies    BlockBodies
+}
+
+func (bb BlockBodies66) Code() int { return 22 }
+
 // HashOrNumber is a combined field for specifying an origin block.
 type hashOrNumber struct {
 	Hash   common.Hash // Block hash from which to retrieve headers (excludes Number)
@@ -180,8 +214,10 @@ func (hn *hashOrNumber) DecodeRLP(s *rlp.Stream) error {
 // Conn represents an individual connection with a peer
 type Conn struct {
 	*rlpx.Conn
-	ourKey             *ecdsa.PrivateKey
-	ethProtocolVersion uint
+	ourKey                 *ecdsa.PrivateKey
+	caps                   []p2p.Cap
+	ourHighestProtoVersion uint
+	ethProtocolVersion     uint
 }
 
 func (c *Conn) Read() Message {
@@ -203,13 +239,29 @@ func (c *Conn) Read() Message {
 	case (Status{}).Code():
 		msg = new(Status)
 	case (GetBlockHeaders{}).Code():
-		msg = new(GetBlockHeaders)
+		if c.ethProtocolVersion >= 66 {
+			msg = new(GetBlockHeaders66)
+		} else {
+			msg = new(GetBlockHeaders)
+		}
 	case (BlockHeaders{}).Code():
-		msg = new(BlockHeaders)
+		if c.ethProtocolVersion >= 66 {
+			msg = new(BlockHeaders66)
+		} else {
+			msg = new(BlockHeaders)
+		}
 	case (GetBlockBodies{}).Code():
-		msg = new(GetBlockBodies)
+		if c.ethProtocolVersion >= 66 {
+			msg = new(GetBlockBodies66)
+		} else {
+			msg = new(GetBlockBodies)
+		}
 	case (BlockBodies{}).Code():
-		msg = new(BlockBodies)
+		if c.ethProtocolVersion >= 66 {
+			msg = new(BlockBodies66)
+		} else {
+			msg = new(BlockBodies)
+		}
 	case (NewBlock{}).Code():
 		msg = new(NewBlock)
 	case (NewBlockHashes{}).Code():
@@ -248,6 +300,14 @@ func (c *Conn) ReadAndServe(chain *Chain, timeout time.Duration) Message {
 			if err := c.Write(headers); err != nil {
 				return errorf("could not write to connection: %v", err)
 			}
+		case *GetBlockHeaders66:
+			headers, err := chain.GetHeaders(*msg.Query)
+			if err != nil {
+				return errorf("could not get headers for inbound header request: %v", err)
+			}
+			if err := c.Write(BlockHeaders66{RequestId: msg.RequestId, Headers: headers}); err != nil {
+				return errorf("could not write to connection: %v", err)
+			}
 		default:
 			return msg
 		}
@@ -273,11 +333,8 @@ func (c *Conn) handshake(t *utesting.T) Message {
 	pub0 := crypto.FromECDSAPub(&c.ourKey.PublicKey)[1:]
 	ourHandshake := &Hello{
 		Version: 5,
-		Caps: []p2p.Cap{
-			{Name: "eth", Version: 64},
-			{Name: "eth", Version: 65},
-		},
-		ID: pub0,
+		Caps:    c.caps,
+		ID:      pub0,
 	}
 	if err := c.Write(ourHandshake); err != nil {
 		t.Fatalf("could not write to connection: %v", err)
@@ -301,14 +358,14 @@ func (c *Conn) handshake(t *utesting.T) Message {
 }
 
 // negotiateEthProtocol sets the Conn's eth protocol version
-// to highest advertised capability from peer
+// to highest capability advertised by both the peer and us
 func (c *Conn) negotiateEthProtocol(caps []p2p.Cap) {
 	var highestEthVersion uint
 	for _, capability := range caps {
 		if capability.Name != "eth" {
 			continue
 		}
-		if capability.Version > highestEthVersion && capability.Version <= 65 {
+		if capability.Version > highestEthVersion && capability.Version <= c.ourHighestProtoVersion {
 			highestEthVersion = capability.Version
 		}
 	}
@@ -378,7 +435,10 @@ func (c *Conn) waitForBlock(block *types.Block) error {
 	timeout := time.Now().Add(20 * time.Second)
 	c.SetReadDeadline(timeout)
 	for {
-		req := &GetBlockHeaders{Origin: hashOrNumber{Hash: block.Hash()}, Amount: 1}
+		var req Message = &GetBlockHeaders{Origin: hashOrNumber{Hash: block.Hash()}, Amount: 1}
+		if c.ethProtocolVersion >= 66 {
+			req = &GetBlockHeaders66{RequestId: rand.Uint64(), Query: req.(*GetBlockHeaders)}
+		}
 		if err := c.Write(req); err != nil {
 			return err
 		}
@@ -388,6 +448,11 @@ func (c *Conn) waitForBlock(block *types.Block) error {
 				return nil
 			}
 			time.Sleep(100 * time.Millisecond)
+		case *BlockHeaders66:
+			if len(msg.Headers) > 0 {
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
 		default:
 			return fmt.Errorf("invalid message: %s", pretty.Sdump(msg))
 		}
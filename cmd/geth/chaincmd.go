@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/event"
@@ -199,7 +200,8 @@ Remove blockchain and state databases`,
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 The arguments are interpreted as block numbers or hashes.
-Use "ethereum dump 0" to dump the genesis block.`,
+Use "ethereum dump 0" to dump the genesis block. The states covered by the
+state snapshot are read straight from it instead of the trie.`,
 	}
 	inspectCommand = cli.Command{
 		Action:    utils.MigrateFlags(inspect),
@@ -209,6 +211,7 @@ Use "ethereum dump 0" to dump the genesis block.`,
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.RopstenFlag,
 			utils.RinkebyFlag,
@@ -463,7 +466,12 @@ func copyDb(ctx *cli.Context) error {
 	dl := downloader.New(0, chainDb, syncBloom, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
-	db, err := rawdb.NewLevelDBDatabaseWithFreezer(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "")
+	db, err := rawdb.Open(rawdb.OpenOptions{
+		Directory:         ctx.Args().First(),
+		AncientsDirectory: ctx.Args().Get(1),
+		Cache:             ctx.GlobalInt(utils.CacheFlag.Name) / 2,
+		Handles:           256,
+	})
 	if err != nil {
 		return err
 	}
@@ -563,6 +571,18 @@ func dump(ctx *cli.Context) error {
 
 	chain, chainDb := utils.MakeChain(ctx, stack, true)
 	defer chainDb.Close()
+
+	// Dump the accounts straight from the snapshot if the database has a usable
+	// one, falling back to the trie for the states it doesn't cover. The snapshot
+	// is only loaded, never regenerated.
+	var snaptree *snapshot.Tree
+	if rawdb.ReadSnapshotRoot(chainDb) != (common.Hash{}) {
+		var err error
+		if snaptree, err = snapshot.Load(chainDb, trie.NewDatabase(chainDb), 256, chain.CurrentBlock().Root()); err != nil {
+			log.Warn("Snapshot unusable, dumping from the trie", "err", err)
+			snaptree = nil
+		}
+	}
 	for _, arg := range ctx.Args() {
 		var block *types.Block
 		if hashish(arg) {
@@ -575,7 +595,7 @@ func dump(ctx *cli.Context) error {
 			fmt.Println("{}")
 			utils.Fatalf("block not found")
 		} else {
-			state, err := state.New(block.Root(), state.NewDatabase(chainDb), nil)
+			state, err := state.New(block.Root(), state.NewDatabase(chainDb), snaptree)
 			if err != nil {
 				utils.Fatalf("could not create new state: %v", err)
 			}
@@ -0,0 +1,691 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	freezerTruncateFlag = cli.BoolFlag{
+		Name:  "truncate",
+		Usage: "Rewind the ancient store and the key-value store to the last consistent block",
+	}
+	dbIterateLimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of entries to list (0 = unlimited)",
+		Value: 100,
+	}
+	freezerWritableFlag = cli.BoolFlag{
+		Name:  "writable",
+		Usage: "Permit the client to modify the served ancient store",
+	}
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			dbStatCmd,
+			dbCompactCmd,
+			dbGetCmd,
+			dbPutCmd,
+			dbDeleteCmd,
+			dbIterateCmd,
+			dbFreezerCheckCmd,
+			dbFreezerServeCmd,
+		},
+		Description: `
+The db commands operate on the key-value store of a stopped node. Keys and values
+are given as 0x-prefixed hex strings, anything else is taken as a raw string (e.g.
+"LastHeader"). Entries matching the known database schema are decoded into a
+human readable form.`,
+	}
+	dbStatCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbStats),
+		Name:      "stats",
+		Usage:     "Print the internal statistics of the database",
+		ArgsUsage: "[<property>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+		},
+		Description: `
+geth db stats [<property>]
+prints the given internal property of the database, by default the compaction
+statistics ("leveldb.stats"). For leveldb, other available properties include
+"leveldb.iostats", "leveldb.writedelay", "leveldb.sstables" and
+"leveldb.blockpool". Pebble doesn't support properties and always prints its
+full metrics report.`,
+	}
+	dbCompactCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbCompact),
+		Name:      "compact",
+		Usage:     "Compact the database, or a key range of it",
+		ArgsUsage: "[<start> [<limit>]]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.CacheFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+		},
+		Description: `
+geth db compact [<start> [<limit>]]
+flattens the key range [start, limit) of the database, discarding deleted and
+overwritten entries. Without a limit, the range extends to the end of the key
+space. Without any arguments, the entire database is compacted piecewise.`,
+	}
+	dbGetCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbGet),
+		Name:      "get",
+		Usage:     "Show the value of a database key",
+		ArgsUsage: "<key>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+		},
+		Description: `
+geth db get <key>
+prints the raw value stored under the given key, along with its decoded form if
+the key belongs to a known data type.`,
+	}
+	dbPutCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbPut),
+		Name:      "put",
+		Usage:     "Set the value of a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<key> <value>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+		},
+		Description: `
+geth db put <key> <value>
+stores the given value under the given key, printing the previous value, if any.
+This is a low level operation bypassing every consistency check, use with care.`,
+	}
+	dbDeleteCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbDelete),
+		Name:      "delete",
+		Usage:     "Delete a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<key>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+		},
+		Description: `
+geth db delete <key>
+removes the given key from the database, printing the deleted value, if any.
+This is a low level operation bypassing every consistency check, use with care.`,
+	}
+	dbIterateCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbIterate),
+		Name:      "iterate",
+		Usage:     "List the database entries with a given key prefix",
+		ArgsUsage: "<prefix> [<start>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.SyncModeFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+			dbIterateLimitFlag,
+		},
+		Description: `
+geth db iterate <prefix> [<start>]
+lists the entries whose key starts with the given prefix, in key order. If a
+start is given, the listing begins at prefix+start. Known keys are annotated
+with their data type and decoded fields, e.g. 'geth db iterate h' lists headers,
+total difficulties and canonical hashes.`,
+	}
+	dbFreezerCheckCmd = cli.Command{
+		Action:    utils.MigrateFlags(freezerCheck),
+		Name:      "freezer-check",
+		Usage:     "Check the integrity of the ancient chain segments",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
+			utils.CacheFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+			freezerTruncateFlag,
+		},
+		Description: `
+geth db freezer-check [--truncate]
+checks that every index entry of the ancient store points into its data file,
+then reads back every block, recomputing the header hashes, transaction and
+uncle hashes, receipt roots and total difficulties, validating them against
+the stored hashes and headers. The first bad block is reported.
+
+With --truncate, both the ancient store and the key-value store are rewound to
+the last block preceding the bad one. The missing blocks will be downloaded
+again by the next sync.`,
+	}
+	dbFreezerServeCmd = cli.Command{
+		Action:    utils.MigrateFlags(freezerServe),
+		Name:      "freezer-serve",
+		Usage:     "Serve the ancient chain segments to other nodes",
+		ArgsUsage: "<endpoint>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV2Flag,
+			freezerWritableFlag,
+		},
+		Description: `
+geth db freezer-serve <endpoint>
+serves the ancient store on the given endpoint, either an IPC socket given as
+ipc:///path/to/freezer.ipc, or an HTTP listening address given as
+http://127.0.0.1:8550. Nodes can share the served ancient store by setting
+--datadir.ancient to the endpoint. The ancient store can't be used by a node
+directly while it's served.
+
+The ancient store is served read-only, unless --writable is given, in which
+case a single node may modify it.`,
+	}
+)
+
+// dbStats prints an internal statistic of the chain database.
+func dbStats(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return fmt.Errorf("invalid arguments: %v", ctx.Args())
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	property := "leveldb.stats"
+	if ctx.NArg() == 1 {
+		if property = ctx.Args().First(); !strings.HasPrefix(property, "leveldb.") {
+			property = "leveldb." + property
+		}
+	}
+	stats, err := db.Stat(property)
+	if err != nil {
+		return err
+	}
+	fmt.Println(stats)
+	return nil
+}
+
+// dbCompact flattens the chain database, or a key range of it.
+func dbCompact(ctx *cli.Context) error {
+	if ctx.NArg() > 2 {
+		return fmt.Errorf("invalid arguments: %v", ctx.Args())
+	}
+	var start, limit []byte
+	if ctx.NArg() > 0 {
+		var err error
+		if start, err = parseDatabaseKey(ctx.Args().Get(0)); err != nil {
+			return err
+		}
+		if ctx.NArg() > 1 {
+			if limit, err = parseDatabaseKey(ctx.Args().Get(1)); err != nil {
+				return err
+			}
+		}
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	begin := time.Now()
+	if ctx.NArg() > 0 {
+		log.Info("Compacting database", "start", hexutil.Bytes(start), "limit", hexutil.Bytes(limit))
+		if err := db.Compact(start, limit); err != nil {
+			return err
+		}
+	} else {
+		// Compact the entire database in chunks, so progress can be reported
+		for b := 0; b <= 0xff; b++ {
+			start, limit := []byte{byte(b)}, []byte{byte(b + 1)}
+			if b == 0xff {
+				limit = nil
+			}
+			log.Info("Compacting database", "range", fmt.Sprintf("0x%0.2X-0x%0.2X", b, b+1), "elapsed", common.PrettyDuration(time.Since(begin)))
+			if err := db.Compact(start, limit); err != nil {
+				return err
+			}
+		}
+	}
+	log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
+
+// dbGet prints the value stored under a key in the chain database.
+func dbGet(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("invalid arguments: %v", ctx.Args())
+	}
+	key, err := parseDatabaseKey(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	value, err := db.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve key %#x: %v", key, err)
+	}
+	printDatabaseEntry(key, value)
+	return nil
+}
+
+// dbPut stores a value under a key in the chain database.
+func dbPut(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("invalid arguments: %v", ctx.Args())
+	}
+	key, err := parseDatabaseKey(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	value, err := parseDatabaseKey(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	if prev, err := db.Get(key); err == nil {
+		fmt.Println("Previous value:")
+		printDatabaseEntry(key, prev)
+	}
+	if err := db.Put(key, value); err != nil {
+		return err
+	}
+	fmt.Println("New value:")
+	printDatabaseEntry(key, value)
+	return nil
+}
+
+// dbDelete removes a key from the chain database.
+func dbDelete(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("invalid arguments: %v", ctx.Args())
+	}
+	key, err := parseDatabaseKey(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	prev, err := db.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve key %#x: %v", key, err)
+	}
+	if err := db.Delete(key); err != nil {
+		return err
+	}
+	fmt.Println("Deleted value:")
+	printDatabaseEntry(key, prev)
+	return nil
+}
+
+// dbIterate lists the entries of the chain database with a given key prefix.
+func dbIterate(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return fmt.Errorf("invalid arguments: %v", ctx.Args())
+	}
+	prefix, err := parseDatabaseKey(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	var start []byte
+	if ctx.NArg() > 1 {
+		if start, err = parseDatabaseKey(ctx.Args().Get(1)); err != nil {
+			return err
+		}
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	it := db.NewIterator(prefix, start)
+	defer it.Release()
+
+	var (
+		limit = ctx.Int(dbIterateLimitFlag.Name)
+		count int
+	)
+	for it.Next() {
+		if limit > 0 && count >= limit {
+			fmt.Printf("... (listing stopped after %d entries, see --%s)\n", limit, dbIterateLimitFlag.Name)
+			break
+		}
+		fmt.Printf("%#x: %#x\n", it.Key(), it.Value())
+		if entry := rawdb.DescribeEntry(it.Key(), nil); entry.Kind != "" {
+			fmt.Printf("  %s (%s)\n", entry.Kind, entry.Key)
+		}
+		count++
+	}
+	return it.Error()
+}
+
+// parseDatabaseKey parses a database key or value given on the command line,
+// which is either a 0x-prefixed hex string or a raw string.
+func parseDatabaseKey(arg string) ([]byte, error) {
+	if !strings.HasPrefix(arg, "0x") && !strings.HasPrefix(arg, "0X") {
+		return []byte(arg), nil
+	}
+	blob, err := hex.DecodeString(arg[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex string %q: %v", arg, err)
+	}
+	return blob, nil
+}
+
+// printDatabaseEntry prints a raw database entry along with its interpretation
+// based on the known database schema.
+func printDatabaseEntry(key, value []byte) {
+	entry := rawdb.DescribeEntry(key, value)
+
+	fmt.Printf("key:   %#x\n", key)
+	if entry.Kind != "" {
+		fmt.Printf("type:  %s (%s)\n", entry.Kind, entry.Key)
+	}
+	fmt.Printf("value: %#x\n", value)
+	if entry.Value != "" {
+		fmt.Printf("decoded:\n%s\n", entry.Value)
+	}
+}
+
+// freezerCheck verifies the integrity of the ancient store, optionally rewinding
+// the chain to the last consistent block if a corruption is found.
+func freezerCheck(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	var (
+		ancient  = resolveAncientPath(ctx, stack)
+		verifier = new(ancientVerifier)
+		start    = time.Now()
+	)
+	if rawdb.IsRemoteFreezer(ancient) {
+		return errors.New("remote ancient store must be checked on its server")
+	}
+	log.Info("Checking ancient database", "path", ancient)
+	result, err := rawdb.CheckFreezer(ancient, verifier.verify)
+	if err != nil {
+		return err
+	}
+	if result.Err == nil {
+		log.Info("Ancient database is consistent", "blocks", result.Items, "elapsed", common.PrettyDuration(time.Since(start)))
+		return nil
+	}
+	if result.Table != "" {
+		log.Error("Corrupted ancient table", "table", result.Table, "number", result.Valid, "err", result.Err)
+	} else {
+		log.Error("Corrupted ancient block", "number", result.Valid, "err", result.Err)
+	}
+	if !ctx.Bool(freezerTruncateFlag.Name) {
+		return fmt.Errorf("ancient block #%d is corrupted, rerun with --%s to rewind the chain to #%d", result.Valid, freezerTruncateFlag.Name, int64(result.Valid)-1)
+	}
+	if result.Valid == 0 || verifier.lastHash == (common.Hash{}) {
+		return errors.New("no consistent ancient block to rewind to, the chain needs to be resynced")
+	}
+	return rewindChain(ctx, stack, ancient, result.Valid, verifier.lastHash)
+}
+
+// ancientVerifier validates the content of consecutive ancient blocks against
+// their headers and their predecessors.
+type ancientVerifier struct {
+	lastHash common.Hash // Hash of the last successfully verified block
+	lastTd   *big.Int    // Total difficulty of the last successfully verified block
+}
+
+// verify checks the hash, header, body, receipts and total difficulty of the
+// ancient block with the given number, as retrieved from the ancient store. The
+// body and receipts are skipped if they were pruned.
+func (v *ancientVerifier) verify(number uint64, hashBlob, headerBlob, bodyBlob, receiptsBlob, tdBlob []byte) error {
+	hash := common.BytesToHash(hashBlob)
+	if have := crypto.Keccak256Hash(headerBlob); have != hash {
+		return fmt.Errorf("header hash mismatch: have %x, want %x", have, hash)
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(headerBlob, header); err != nil {
+		return fmt.Errorf("invalid header: %v", err)
+	}
+	if header.Number.Uint64() != number {
+		return fmt.Errorf("header number mismatch: have %v, want %d", header.Number, number)
+	}
+	if v.lastHash != (common.Hash{}) && header.ParentHash != v.lastHash {
+		return fmt.Errorf("parent hash mismatch: have %x, want %x", header.ParentHash, v.lastHash)
+	}
+	if bodyBlob != nil {
+		body := new(types.Body)
+		if err := rlp.DecodeBytes(bodyBlob, body); err != nil {
+			return fmt.Errorf("invalid body: %v", err)
+		}
+		if have := types.DeriveSha(types.Transactions(body.Transactions), trie.NewStackTrie(nil)); have != header.TxHash {
+			return fmt.Errorf("transaction root mismatch: have %x, want %x", have, header.TxHash)
+		}
+		if have := types.CalcUncleHash(body.Uncles); have != header.UncleHash {
+			return fmt.Errorf("uncle hash mismatch: have %x, want %x", have, header.UncleHash)
+		}
+	}
+	if receiptsBlob != nil {
+		var storage []*types.ReceiptForStorage
+		if err := rlp.DecodeBytes(receiptsBlob, &storage); err != nil {
+			return fmt.Errorf("invalid receipts: %v", err)
+		}
+		receipts := make(types.Receipts, len(storage))
+		for i, receipt := range storage {
+			receipts[i] = (*types.Receipt)(receipt)
+		}
+		if have := types.DeriveSha(receipts, trie.NewStackTrie(nil)); have != header.ReceiptHash {
+			return fmt.Errorf("receipt root mismatch: have %x, want %x", have, header.ReceiptHash)
+		}
+	}
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(tdBlob, td); err != nil {
+		return fmt.Errorf("invalid total difficulty: %v", err)
+	}
+	if v.lastTd != nil {
+		if want := new(big.Int).Add(v.lastTd, header.Difficulty); td.Cmp(want) != 0 {
+			return fmt.Errorf("total difficulty mismatch: have %v, want %v", td, want)
+		}
+	}
+	v.lastHash, v.lastTd = hash, td
+	return nil
+}
+
+// rewindChain discards every block from the given number onwards from both the
+// key-value store and the ancient store, setting the chain head to the parent.
+func rewindChain(ctx *cli.Context, stack *node.Node, ancient string, number uint64, parent common.Hash) error {
+	db := utils.MakeChainKeyValueDatabase(ctx, stack)
+	defer db.Close()
+
+	// Rewind the key-value store first, so that an interruption leaves the chain
+	// head below the ancient store and the rewind can be resumed by a rerun
+	if head := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadHeaderHash(db)); head != nil && *head >= number {
+		log.Info("Rewinding key-value store", "from", *head, "to", number-1)
+
+		batch := db.NewBatch()
+		for n := number; n <= *head; n++ {
+			if hash := rawdb.ReadCanonicalHash(db, n); hash != (common.Hash{}) {
+				rawdb.DeleteBlock(batch, hash, n)
+				rawdb.DeleteCanonicalHash(batch, n)
+			}
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		rawdb.WriteHeadHeaderHash(batch, parent)
+		rawdb.WriteHeadFastBlockHash(batch, parent)
+		rawdb.WriteHeadBlockHash(batch, parent)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+	log.Info("Truncating ancient database", "items", number)
+	if err := rawdb.TruncateFreezer(ancient, number); err != nil {
+		return err
+	}
+	log.Info("Rewound chain", "head", number-1, "hash", parent)
+	return nil
+}
+
+// resolveAncientPath returns the location of the ancient store of the chain
+// database, the same way the node resolves it when opening the database.
+func resolveAncientPath(ctx *cli.Context, stack *node.Node) string {
+	ancient := utils.MakeAncientLocation(ctx)
+	switch {
+	case ancient == "":
+		return filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case rawdb.IsRemoteFreezer(ancient):
+		return ancient
+	case !filepath.IsAbs(ancient):
+		return stack.ResolvePath(ancient)
+	}
+	return ancient
+}
+
+// freezerServe exposes the ancient store to other nodes until interrupted.
+func freezerServe(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("endpoint argument required")
+	}
+	endpoint, err := url.Parse(ctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	ancient := resolveAncientPath(ctx, stack)
+	if rawdb.IsRemoteFreezer(ancient) {
+		return errors.New("ancient store is served remotely already")
+	}
+	readonly := !ctx.Bool(freezerWritableFlag.Name)
+	server, err := rawdb.NewFreezerServer(ancient, "", readonly)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	switch endpoint.Scheme {
+	case "ipc":
+		path := endpoint.Host + endpoint.Path
+		os.Remove(path) // Stale socket of a previous run
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(path)
+		go http.Serve(listener, server)
+
+	case "http":
+		listener, err := net.Listen("tcp", endpoint.Host)
+		if err != nil {
+			return err
+		}
+		go http.Serve(listener, server)
+
+	default:
+		return fmt.Errorf("unsupported endpoint scheme %q", endpoint.Scheme)
+	}
+	log.Info("Serving ancient database", "path", ancient, "endpoint", endpoint, "readonly", readonly)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	<-sigc
+
+	log.Info("Stopping ancient database server")
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newAncientChain generates a chain with transactions and writes it into a new
+// ancient store, optionally tampering with the receipts of one block.
+func newAncientChain(t *testing.T, blocks int, tamper int) string {
+	var (
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(1000000000000000000)}},
+		}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.HomesteadSigner{}
+	)
+	chain, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, blocks, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0x01}, big.NewInt(1), params.TxGas, nil, nil), signer, key)
+		b.AddTx(tx)
+	})
+	dir, err := ioutil.TempDir("", "ancient")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	frdb, err := rawdb.NewDatabaseWithFreezer(memorydb.New(), dir, "")
+	if err != nil {
+		t.Fatalf("failed to create ancient store: %v", err)
+	}
+	defer frdb.Close()
+
+	td := new(big.Int).Set(genesis.Difficulty())
+	rawdb.WriteAncientBlock(frdb, genesis, nil, td)
+	for i, block := range chain {
+		td.Add(td, block.Difficulty())
+		if i == tamper {
+			receipts[i] = nil
+		}
+		rawdb.WriteAncientBlock(frdb, block, receipts[i], td)
+	}
+	return dir
+}
+
+// Tests that the ancient block verifier accepts a valid chain and rejects the
+// first block with content not matching its header.
+func TestAncientVerifier(t *testing.T) {
+	dir := newAncientChain(t, 16, -1)
+	defer os.RemoveAll(dir)
+
+	result, err := rawdb.CheckFreezer(dir, new(ancientVerifier).verify)
+	if err != nil {
+		t.Fatalf("failed to check ancient store: %v", err)
+	}
+	if result.Items != 17 || result.Valid != 17 || result.Err != nil {
+		t.Fatalf("check result mismatch: have %+v, want 17 valid blocks", result)
+	}
+	// Drop the receipts of a block and ensure it's detected
+	tampered := newAncientChain(t, 16, 9)
+	defer os.RemoveAll(tampered)
+
+	if result, err = rawdb.CheckFreezer(tampered, new(ancientVerifier).verify); err != nil {
+		t.Fatalf("failed to check ancient store: %v", err)
+	}
+	if result.Valid != 10 || result.Err == nil {
+		t.Fatalf("check result mismatch: have %+v, want block 10 rejected", result)
+	}
+}
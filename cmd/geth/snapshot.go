@@ -0,0 +1,386 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	snapshotCommand = cli.Command{
+		Name:        "snapshot",
+		Usage:       "A set of commands based on the snapshot",
+		Category:    "MISCELLANEOUS COMMANDS",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Prune stale ethereum state data based on the snapshot",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(pruneState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV2Flag,
+					utils.CacheTrieJournalFlag,
+					utils.BloomFilterSizeFlag,
+				},
+				Description: `
+geth snapshot prune-state <state-root>
+will prune historical state data with the help of the state snapshot.
+All trie nodes and contract codes that do not belong to the specified
+version state will be deleted from the database. After pruning, only
+two version states are available: genesis and the specific one.
+
+The default pruning target is the HEAD-127 state.
+
+The pruning can be interrupted at any time. Once the retained state is
+recorded, an interrupted pruning is resumed by the next run of either
+this command or geth itself.
+
+WARNING: It's necessary to delete the trie clean cache after the pruning.
+If you specify another directory for the trie clean cache via "--cache.trie.journal"
+during the use of Geth, please also specify it here for correct deletion. Otherwise
+the trie clean cache with default directory will be deleted.
+`,
+			},
+			{
+				Name:      "verify-state",
+				Usage:     "Recalculate state hash based on the snapshot for verification",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(verifyState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV2Flag,
+				},
+				Description: `
+geth snapshot verify-state <state-root>
+will traverse the whole accounts and storages set based on the specified
+snapshot and recalculate the root hash of state for verification.
+In other words, this command does the snapshot to trie conversion.
+`,
+			},
+			{
+				Name:      "traverse-state",
+				Usage:     "Traverse the state with given root hash for verification",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(traverseState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV2Flag,
+				},
+				Description: `
+geth snapshot traverse-state <state-root>
+will traverse the whole state from the given state root, checking that every
+trie node (account and storage) and contract code it references is present
+in the database, and report the first missing one.
+If no state root is specified, the state of the head block is used.
+`,
+			},
+			{
+				Name:      "dump",
+				Usage:     "Dump a specific state straight from the snapshot",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(dumpState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV2Flag,
+					utils.ExcludeCodeFlag,
+					utils.ExcludeStorageFlag,
+					utils.IncludeIncompletesFlag,
+				},
+				Description: `
+geth snapshot dump <state-root>
+will dump the accounts of the given state as JSON objects delimited by
+newlines, reading them straight from the snapshot instead of the trie.
+The state must be covered by the snapshot, by default the state of the
+head block is dumped.
+`,
+			},
+		},
+	}
+)
+
+func pruneState(ctx *cli.Context) error {
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	if ctx.NArg() > 1 {
+		log.Error("Too many arguments given")
+		return errors.New("too many arguments")
+	}
+	var (
+		targetRoot common.Hash
+		err        error
+	)
+	if ctx.NArg() == 1 {
+		targetRoot, err = parseRoot(ctx.Args()[0])
+		if err != nil {
+			log.Error("Failed to resolve state root", "err", err)
+			return err
+		}
+	}
+	pruner, err := pruner.NewPruner(chaindb, stack.ResolvePath(""), stack.ResolvePath(config.Eth.TrieCleanCacheJournal), ctx.GlobalUint64(utils.BloomFilterSizeFlag.Name))
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	if err = pruner.Prune(targetRoot); err != nil {
+		log.Error("Failed to prune state", "err", err)
+		return err
+	}
+	return nil
+}
+
+// resolveRoot returns the state root given as the single optional argument of
+// the command, or the state root of the head block if none was given.
+func resolveRoot(ctx *cli.Context, headBlock *types.Block) (common.Hash, error) {
+	switch ctx.NArg() {
+	case 0:
+		return headBlock.Root(), nil
+	case 1:
+		return parseRoot(ctx.Args()[0])
+	default:
+		return common.Hash{}, errors.New("too many arguments")
+	}
+}
+
+// openSnapshot loads the snapshot tree of the given database without modifying
+// it. A missing, stale or partially generated snapshot is reported as an error
+// rather than being regenerated.
+func openSnapshot(chaindb ethdb.Database, headBlock *types.Block) (*snapshot.Tree, error) {
+	if rawdb.ReadSnapshotRoot(chaindb) == (common.Hash{}) {
+		return nil, errors.New("state snapshot not available")
+	}
+	return snapshot.Load(chaindb, trie.NewDatabase(chaindb), 256, headBlock.Root())
+}
+
+func verifyState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	root, err := resolveRoot(ctx, headBlock)
+	if err != nil {
+		log.Error("Failed to resolve state root", "err", err)
+		return err
+	}
+	snaptree, err := openSnapshot(chaindb, headBlock)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	if err := snapshot.VerifyState(snaptree, root); err != nil {
+		log.Error("Failed to verify state", "root", root, "err", err)
+		return err
+	}
+	log.Info("Verified the state", "root", root)
+	return nil
+}
+
+// traverseState is a helper function used for pruning verification. It walks
+// all the trie nodes of the given state, ensuring that each of them, as well as
+// the referenced contract codes, is present in the database.
+func traverseState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	root, err := resolveRoot(ctx, headBlock)
+	if err != nil {
+		log.Error("Failed to resolve state root", "err", err)
+		return err
+	}
+	log.Info("Start traversing the state", "root", root)
+
+	triedb := trie.NewDatabase(chaindb)
+	t, err := trie.NewSecure(root, triedb)
+	if err != nil {
+		log.Error("Failed to open trie", "root", root, "err", err)
+		return err
+	}
+	var (
+		nodes      int
+		accounts   int
+		slots      int
+		codes      int
+		lastReport time.Time
+		start      = time.Now()
+	)
+	// checkNode ensures the presence of a trie node, embedded nodes don't
+	// have a hash of their own.
+	checkNode := func(hash common.Hash, kind string) error {
+		nodes++
+		if hash == (common.Hash{}) {
+			return nil
+		}
+		if blob := rawdb.ReadTrieNode(chaindb, hash); len(blob) == 0 {
+			log.Error("Missing trie node", "kind", kind, "hash", hash)
+			return fmt.Errorf("missing %s trie node %x", kind, hash)
+		}
+		return nil
+	}
+	accIter := t.NodeIterator(nil)
+	for accIter.Next(true) {
+		if err := checkNode(accIter.Hash(), "account"); err != nil {
+			return err
+		}
+		if accIter.Leaf() {
+			accounts++
+
+			var acc state.Account
+			if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
+				log.Error("Invalid account encountered during traversal", "err", err)
+				return err
+			}
+			if acc.Root != types.EmptyRootHash {
+				storageTrie, err := trie.NewSecure(acc.Root, triedb)
+				if err != nil {
+					log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
+					return err
+				}
+				storageIter := storageTrie.NodeIterator(nil)
+				for storageIter.Next(true) {
+					if err := checkNode(storageIter.Hash(), "storage"); err != nil {
+						return err
+					}
+					if storageIter.Leaf() {
+						slots++
+					}
+				}
+				if err := storageIter.Error(); err != nil {
+					log.Error("Failed to traverse storage trie", "root", acc.Root, "err", err)
+					return err
+				}
+			}
+			if !bytes.Equal(acc.CodeHash, types.EmptyCodeHash.Bytes()) {
+				if code := rawdb.ReadCode(chaindb, common.BytesToHash(acc.CodeHash)); len(code) == 0 {
+					log.Error("Missing contract code", "account", common.BytesToHash(accIter.LeafKey()), "hash", common.BytesToHash(acc.CodeHash))
+					return errors.New("missing contract code")
+				}
+				codes++
+			}
+		}
+		if time.Since(lastReport) > time.Second*8 {
+			log.Info("Traversing state", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
+			lastReport = time.Now()
+		}
+	}
+	if err := accIter.Error(); err != nil {
+		log.Error("Failed to traverse state trie", "root", root, "err", err)
+		return err
+	}
+	log.Info("State is complete", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// dumpState dumps the accounts of the given state, reading them from the snapshot
+// if it covers the state and falling back to the trie otherwise.
+func dumpState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	root, err := resolveRoot(ctx, headBlock)
+	if err != nil {
+		log.Error("Failed to resolve state root", "err", err)
+		return err
+	}
+	snaptree, err := openSnapshot(chaindb, headBlock)
+	if err != nil {
+		log.Warn("Snapshot unusable, dumping from the trie", "err", err)
+		snaptree = nil
+	} else if snaptree.Snapshot(root) == nil {
+		log.Warn("State not covered by the snapshot, dumping from the trie", "root", root)
+		snaptree = nil
+	}
+	statedb, err := state.New(root, state.NewDatabase(chaindb), snaptree)
+	if err != nil {
+		log.Error("Failed to open state", "root", root, "err", err)
+		return err
+	}
+	start := time.Now()
+	statedb.IterativeDump(ctx.Bool(utils.ExcludeCodeFlag.Name), ctx.Bool(utils.ExcludeStorageFlag.Name), !ctx.Bool(utils.IncludeIncompletesFlag.Name), json.NewEncoder(os.Stdout))
+	log.Info("Dumped the state", "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// parseRoot parses a state root given as a hex string.
+func parseRoot(input string) (common.Hash, error) {
+	var h common.Hash
+	if err := h.UnmarshalText([]byte(input)); err != nil {
+		return h, err
+	}
+	return h, nil
+}
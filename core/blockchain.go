@@ -130,6 +130,7 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	StateHistory        bool          // Whether to record reverse state diffs for serving historical state
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -190,6 +191,7 @@ type BlockChain struct {
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
+	history       *state.History // Historical state rolled back from the snapshot (nil if disabled)
 	bodyCache     *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache  *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	receiptsCache *lru.Cache     // Cache for the most recent receipts per block
@@ -221,6 +223,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
+	// Historical state is rolled back from the snapshot, so it needs one
+	if cacheConfig.StateHistory && cacheConfig.SnapshotLimit == 0 {
+		return nil, errors.New("state history requires snapshots")
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	receiptsCache, _ := lru.New(receiptsCacheLimit)
@@ -378,6 +384,15 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		}
 		bc.snaps = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, head.Root(), !bc.cacheConfig.SnapshotWait, recover)
 	}
+	if bc.cacheConfig.StateHistory {
+		bc.history = state.NewHistory(bc.db, bc.snaps)
+
+		// If the head was processed without recording its reverse diff (e.g. the
+		// history was just enabled), the states before it can't be rolled back to
+		if head := bc.CurrentBlock(); head.NumberU64() > 0 && !bc.history.HasDiff(head.Hash(), head.NumberU64()) {
+			bc.history.MarkMissing(head.NumberU64())
+		}
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	if txLookupLimit != nil {
@@ -592,11 +607,12 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 			// Remove the hash <-> number mapping from the active store.
 			rawdb.DeleteHeaderNumber(db, hash)
 		} else {
-			// Remove relative body and receipts from the active store.
-			// The header, total difficulty and canonical hash will be
+			// Remove relative body, receipts and state diff from the active
+			// store. The header, total difficulty and canonical hash will be
 			// removed in the hc.SetHead function.
 			rawdb.DeleteBody(db, hash, num)
 			rawdb.DeleteReceipts(db, hash, num)
+			rawdb.DeleteStateDiff(db, hash, num)
 		}
 		// Todo(rjl493456442) txlookup, bloombits, etc
 	}
@@ -694,6 +710,16 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache, bc.snaps)
 }
 
+// HistoricState returns a read-only state view after a particular canonical block,
+// rolled back from the current head state through the recorded reverse state
+// diffs. It's meant for blocks whose state tries were already garbage collected.
+func (bc *BlockChain) HistoricState(header *types.Header) (*state.StateDB, error) {
+	if bc.history == nil {
+		return nil, errors.New("state history disabled")
+	}
+	return bc.history.StateAt(bc.stateCache, header, bc.CurrentBlock().Header())
+}
+
 // StateCache returns the caching database underpinning the blockchain instance.
 func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
@@ -866,6 +892,12 @@ func (bc *BlockChain) HasFastBlock(hash common.Hash, number uint64) bool {
 	return rawdb.HasReceipts(bc.db, hash, number)
 }
 
+// IsHistoryPruned reports whether the body and receipts of the block with the
+// given number were pruned from the ancient store and can't be served anymore.
+func (bc *BlockChain) IsHistoryPruned(number uint64) bool {
+	return rawdb.IsHistoryPruned(bc.db, number)
+}
+
 // HasState checks if state trie is fully present in the database or not.
 func (bc *BlockChain) HasState(hash common.Hash) bool {
 	_, err := bc.stateCache.OpenTrie(hash)
@@ -1494,13 +1526,46 @@ func (bc *BlockChain) writeKnownBlock(block *types.Block) error {
 }
 
 // WriteBlockWithState writes the block and all associated state to the database.
+//
+// The block was executed outside of the chain import (e.g. mined locally), so if
+// a live tracer is configured, the block is reprocessed for it to be reported
+// just like an imported one.
 func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
+	if bc.vmConfig.LiveTracer != nil {
+		if err := bc.traceExternalBlock(block); err != nil {
+			return NonStatTy, err
+		}
+		defer func() { bc.traceBlockEnd(err) }()
+	}
 	return bc.writeBlockWithState(block, receipts, logs, state, emitHeadEvent)
 }
 
+// traceExternalBlock reprocesses a block executed outside of the chain import on
+// top of its parent state, notifying the live tracer about the start of the block
+// and all the transactions and state changes within. The resulting state is
+// discarded, the caller is responsible for ending the block trace.
+func (bc *BlockChain) traceExternalBlock(block *types.Block) error {
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := state.New(parent.Root, bc.stateCache, bc.snaps)
+	if err != nil {
+		return err
+	}
+	statedb.SetLogger(bc.vmConfig.LiveTracer)
+	bc.vmConfig.LiveTracer.OnBlockStart(block)
+
+	if _, _, _, err := bc.processor.Process(block, statedb, bc.vmConfig); err != nil {
+		bc.traceBlockEnd(err)
+		return err
+	}
+	return nil
+}
+
 // writeBlockWithState writes the block and all associated state to the database,
 // but is expects the chain mutex to be held.
 func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
@@ -1530,10 +1595,25 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		log.Crit("Failed to write block into disk", "err", err)
 	}
 	// Commit all cached state changes into underlying memory database.
+	if bc.cacheConfig.StateHistory {
+		state.RecordReverseDiff()
+	}
 	root, err := state.Commit(bc.chainConfig.IsEIP158(block.Number()))
 	if err != nil {
 		return NonStatTy, err
 	}
+	if bc.history != nil {
+		// A block without reverse diff cuts the history short, so the states
+		// before it are not rolled back to across a gap
+		if diff := state.ReverseDiff(); diff != nil {
+			if err := bc.history.WriteDiff(block.Hash(), block.NumberU64(), diff); err != nil {
+				return NonStatTy, err
+			}
+		} else {
+			log.Warn("State history interrupted", "number", block.Number(), "hash", block.Hash())
+			bc.history.MarkMissing(block.NumberU64())
+		}
+	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -1868,6 +1948,10 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		if err != nil {
 			return it.index, err
 		}
+		if tracer := bc.vmConfig.LiveTracer; tracer != nil {
+			statedb.SetLogger(tracer)
+			tracer.OnBlockStart(block)
+		}
 		// If we have a followup block, run that against the current state to pre-cache
 		// transactions and probabilistically some of the account/storage trie nodes.
 		var followupInterrupt uint32
@@ -1890,6 +1974,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
+			bc.traceBlockEnd(err)
 			return it.index, err
 		}
 		// Update the metrics touched during block processing
@@ -1911,6 +1996,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
 			bc.reportBlock(block, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
+			bc.traceBlockEnd(err)
 			return it.index, err
 		}
 		proctime := time.Since(start)
@@ -1925,6 +2011,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		substart = time.Now()
 		status, err := bc.writeBlockWithState(block, receipts, logs, statedb, false)
 		atomic.StoreUint32(&followupInterrupt, 1)
+		bc.traceBlockEnd(err)
 		if err != nil {
 			return it.index, err
 		}
@@ -2305,6 +2392,12 @@ func (bc *BlockChain) update() {
 func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 	defer bc.wg.Done()
 
+	// Transactions below the history tail can't be indexed as their bodies were
+	// pruned from the ancient store, never try to reach beneath it.
+	var pruned uint64
+	if tail, err := bc.db.AncientTail(); err == nil {
+		pruned = tail
+	}
 	// Before starting the actual maintenance, we need to handle a special case,
 	// where user might init Geth with an external ancient database. If so, we
 	// need to reindex all necessary transactions before starting to process any
@@ -2314,7 +2407,12 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 		if bc.txLookupLimit != 0 && ancients > bc.txLookupLimit {
 			from = ancients - bc.txLookupLimit
 		}
-		rawdb.IndexTransactions(bc.db, from, ancients, bc.quit)
+		if from < pruned {
+			from = pruned
+		}
+		if from < ancients {
+			rawdb.IndexTransactions(bc.db, from, ancients, bc.quit)
+		}
 	}
 	// indexBlocks reindexes or unindexes transactions depending on user configuration
 	indexBlocks := func(tail *uint64, head uint64, done chan struct{}) {
@@ -2334,15 +2432,19 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 		}
 		// If a previous indexing existed, make sure that we fill in any missing entries
 		if bc.txLookupLimit == 0 || head < bc.txLookupLimit {
-			if *tail > 0 {
-				rawdb.IndexTransactions(bc.db, 0, *tail, bc.quit)
+			if *tail > pruned {
+				rawdb.IndexTransactions(bc.db, pruned, *tail, bc.quit)
 			}
 			return
 		}
 		// Update the transaction index to the new chain state
 		if head-bc.txLookupLimit+1 < *tail {
 			// Reindex a part of missing indices and rewind index tail to HEAD-limit
-			rawdb.IndexTransactions(bc.db, head-bc.txLookupLimit+1, *tail, bc.quit)
+			if from := head - bc.txLookupLimit + 1; from >= pruned {
+				rawdb.IndexTransactions(bc.db, from, *tail, bc.quit)
+			} else if *tail > pruned {
+				rawdb.IndexTransactions(bc.db, pruned, *tail, bc.quit)
+			}
 		} else {
 			// Unindex a part of stale indices and forward index tail to HEAD-limit
 			rawdb.UnindexTransactions(bc.db, *tail, head-bc.txLookupLimit+1, bc.quit)
@@ -2395,6 +2497,14 @@ func (bc *BlockChain) addBadBlock(block *types.Block) {
 	bc.badBlocks.Add(block.Hash(), block)
 }
 
+// traceBlockEnd notifies the live tracer, if any, that the processing of the
+// current block finished, either successfully or with the given error.
+func (bc *BlockChain) traceBlockEnd(err error) {
+	if bc.vmConfig.LiveTracer != nil {
+		bc.vmConfig.LiveTracer.OnBlockEnd(err)
+	}
+}
+
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
 	bc.addBadBlock(block)
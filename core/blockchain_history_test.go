@@ -0,0 +1,372 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the historical state rolled back through the reverse state diffs
+// matches the state retained by an archive node, including across the deletion
+// and recreation of an account with storage.
+func TestHistoricState(t *testing.T) {
+	var (
+		aa = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+
+		engine  = ethash.NewFaker()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000000000)},
+				// The address 0xAAAA records the block number in its storage and
+				// selfdestructs if called with data
+				aa: {
+					Code: []byte{
+						byte(vm.NUMBER), byte(vm.PUSH1), 0x00, byte(vm.SSTORE), // slot[0] = number
+						byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE), // slot[number] = number
+						byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x0c, byte(vm.JUMPI),
+						byte(vm.STOP),
+						byte(vm.JUMPDEST), byte(vm.CALLER), byte(vm.SELFDESTRUCT),
+					},
+					Storage: map[common.Hash]common.Hash{{0xff}: {0x01}},
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 20, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		if i%7 == 6 {
+			return // Leave some blocks empty
+		}
+		// Fund a new account in every block and poke the contract, destructing
+		// it midway, after which it's recreated by the value transfers
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0x10, byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		b.AddTx(tx)
+
+		var data []byte
+		if i == 9 {
+			data = []byte{0x01}
+		}
+		tx, _ = types.SignTx(types.NewTransaction(b.TxNonce(address), aa, big.NewInt(1), 100000, big.NewInt(1), data), signer, key)
+		b.AddTx(tx)
+	})
+	// Import the chain into an archive node also recording state history
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, newHistoryCacheConfig(true), params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	addrs := []common.Address{address, aa, {1}}
+	for i := range blocks {
+		addrs = append(addrs, common.Address{0x10, byte(i)})
+	}
+	slots := []common.Hash{{0xff}}
+	for i := 0; i <= len(blocks); i++ {
+		slots = append(slots, common.BigToHash(big.NewInt(int64(i))))
+	}
+	for number := uint64(0); number <= uint64(len(blocks)); number++ {
+		checkHistoricState(t, chain, number, addrs, slots)
+	}
+	// Drop a state diff and ensure reads needing it are reported unavailable, but
+	// the ones skipping over it are not, recreating the history server to drop
+	// any cached diffs
+	rawdb.DeleteStateDiff(diskdb, blocks[9].Hash(), blocks[9].NumberU64())
+	chain.history = state.NewHistory(diskdb, chain.snaps)
+
+	have, err := chain.HistoricState(blocks[4].Header())
+	if err != nil {
+		t.Fatalf("failed to open historical state: %v", err)
+	}
+	have.GetBalance(common.Address{0x10, 9})
+	if err := have.Error(); err == nil || !strings.Contains(err.Error(), state.ErrStateHistoryUnavailable.Error()) {
+		t.Fatalf("read through missing diff error mismatch: have %v, want %v", err, state.ErrStateHistoryUnavailable)
+	}
+	if have, err = chain.HistoricState(blocks[4].Header()); err != nil {
+		t.Fatalf("failed to open historical state: %v", err)
+	}
+	have.GetBalance(common.Address{0x10, 15})
+	if err := have.Error(); err != nil {
+		t.Fatalf("read skipping missing diff failed: %v", err)
+	}
+	if have, err = chain.HistoricState(blocks[9].Header()); err != nil {
+		t.Fatalf("failed to open historical state: %v", err)
+	}
+	have.GetBalance(common.Address{0x10, 9})
+	if err := have.Error(); err != nil {
+		t.Fatalf("read above missing diff failed: %v", err)
+	}
+}
+
+// Tests that historical state is served correctly across far more blocks than
+// the reverse state diff cache holds, and that a lookup only needs the diffs of
+// the blocks modifying the requested account.
+func TestHistoricStateLongRange(t *testing.T) {
+	var (
+		aa = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+
+		engine  = ethash.NewFaker()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000000000)},
+				// The address 0xAAAA records the block number in its storage
+				aa: {
+					Code: []byte{
+						byte(vm.NUMBER), byte(vm.PUSH1), 0x00, byte(vm.SSTORE), // slot[0] = number
+						byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE), // slot[number] = number
+					},
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 1200, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{1})
+
+		// Poke the contract in every block, but only fund a new account rarely
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), aa, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
+		b.AddTx(tx)
+
+		if i%100 == 50 {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0x20, byte(i / 100)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, newHistoryCacheConfig(true), params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	addrs := []common.Address{address, aa, {1}}
+	for i := 0; i < len(blocks)/100; i++ {
+		addrs = append(addrs, common.Address{0x20, byte(i)})
+	}
+	slots := []common.Hash{{}, common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(51)), common.BigToHash(big.NewInt(1024)), common.BigToHash(big.NewInt(1200))}
+
+	for _, number := range []uint64{0, 1, 50, 51, 52, 600, 1023, 1024, 1151, 1199, 1200} {
+		checkHistoricState(t, chain, number, addrs, slots)
+	}
+	// Drop all the state diffs, except the one of the block funding the first
+	// rare account, and ensure its history is still served
+	for _, block := range blocks {
+		if block.NumberU64() != 51 {
+			rawdb.DeleteStateDiff(diskdb, block.Hash(), block.NumberU64())
+		}
+	}
+	chain.history = state.NewHistory(diskdb, chain.snaps)
+
+	for number, want := range map[uint64]int64{1: 0, 50: 0, 51: 1000} {
+		have, err := chain.HistoricState(blocks[number-1].Header())
+		if err != nil {
+			t.Fatalf("block %d: failed to open historical state: %v", number, err)
+		}
+		if balance := have.GetBalance(common.Address{0x20, 0}); balance.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("block %d: balance mismatch: have %v, want %v", number, balance, want)
+		}
+		if err := have.Error(); err != nil {
+			t.Fatalf("block %d: historical state read failed: %v", number, err)
+		}
+	}
+}
+
+// Tests that blocks processed without recording their reverse state diffs, be it
+// because collecting it failed or the history was disabled, cut the history
+// short instead of silently serving wrong state across the gap.
+func TestHistoricStateGap(t *testing.T) {
+	var (
+		engine  = ethash.NewFaker()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 40, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{1})
+
+		// Fund a new account and top up a shared one in every block
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0x10, byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		b.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0x30}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		b.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, newHistoryCacheConfig(true), params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks[:10]); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	// Process block 11, but flatten the snapshot layers before committing it so
+	// collecting its reverse diff fails, and import the rest of the chain on top
+	block, parent := blocks[10], chain.CurrentBlock()
+	statedb, err := state.New(parent.Root(), chain.stateCache, chain.snaps)
+	if err != nil {
+		t.Fatalf("failed to open parent state: %v", err)
+	}
+	receipts, logs, _, err := chain.Processor().Process(block, statedb, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if err := chain.snaps.Cap(parent.Root(), 0); err != nil {
+		t.Fatalf("failed to flatten snapshot: %v", err)
+	}
+	if _, err := chain.WriteBlockWithState(block, receipts, logs, statedb, true); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks[11:30]); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	addrs := []common.Address{address, {1}, {0x30}}
+	for i := range blocks {
+		addrs = append(addrs, common.Address{0x10, byte(i)})
+	}
+	checkHistoricStateGap(t, chain, 11, addrs)
+
+	// Import some blocks with the history disabled and ensure it's cut short at
+	// the head when enabled again
+	chain.Stop()
+	if chain, err = NewBlockChain(diskdb, newHistoryCacheConfig(false), params.TestChainConfig, engine, vm.Config{}, nil, nil); err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks[30:35]); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	chain.Stop()
+	if chain, err = NewBlockChain(diskdb, newHistoryCacheConfig(true), params.TestChainConfig, engine, vm.Config{}, nil, nil); err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks[35:]); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	checkHistoricStateGap(t, chain, 35, addrs)
+}
+
+// checkHistoricStateGap verifies that the historical state of the blocks before
+// the gap is reported unavailable, but the ones from it onwards are served.
+func checkHistoricStateGap(t *testing.T, chain *BlockChain, gap uint64, addrs []common.Address) {
+	t.Helper()
+
+	for number := uint64(0); number < gap; number++ {
+		if _, err := chain.HistoricState(chain.GetHeaderByNumber(number)); !errors.Is(err, state.ErrStateHistoryUnavailable) {
+			t.Errorf("block %d: historical state error mismatch: have %v, want %v", number, err, state.ErrStateHistoryUnavailable)
+		}
+	}
+	for number := gap; number <= chain.CurrentBlock().NumberU64(); number++ {
+		checkHistoricState(t, chain, number, addrs, nil)
+	}
+}
+
+// newHistoryCacheConfig creates an archive cache configuration, optionally also
+// recording the state history.
+func newHistoryCacheConfig(history bool) *CacheConfig {
+	return &CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		TrieDirtyDisabled: true,
+		TrieTimeLimit:     5 * time.Minute,
+		SnapshotLimit:     256,
+		SnapshotWait:      true,
+		StateHistory:      history,
+	}
+}
+
+// checkHistoricState verifies that the historical state of a canonical block
+// matches the state retained by the archive node for the given accounts and
+// storage slots.
+func checkHistoricState(t *testing.T, chain *BlockChain, number uint64, addrs []common.Address, slots []common.Hash) {
+	t.Helper()
+
+	header := chain.GetHeaderByNumber(number)
+	want, err := chain.StateAt(header.Root)
+	if err != nil {
+		t.Fatalf("block %d: failed to open archive state: %v", number, err)
+	}
+	have, err := chain.HistoricState(header)
+	if err != nil {
+		t.Fatalf("block %d: failed to open historical state: %v", number, err)
+	}
+	for _, addr := range addrs {
+		if have.Exist(addr) != want.Exist(addr) {
+			t.Errorf("block %d, account %x: existence mismatch: have %v, want %v", number, addr, have.Exist(addr), want.Exist(addr))
+		}
+		if have.GetBalance(addr).Cmp(want.GetBalance(addr)) != 0 {
+			t.Errorf("block %d, account %x: balance mismatch: have %v, want %v", number, addr, have.GetBalance(addr), want.GetBalance(addr))
+		}
+		if have.GetNonce(addr) != want.GetNonce(addr) {
+			t.Errorf("block %d, account %x: nonce mismatch: have %d, want %d", number, addr, have.GetNonce(addr), want.GetNonce(addr))
+		}
+		if have.GetCodeHash(addr) != want.GetCodeHash(addr) {
+			t.Errorf("block %d, account %x: code hash mismatch: have %x, want %x", number, addr, have.GetCodeHash(addr), want.GetCodeHash(addr))
+		}
+		for _, slot := range slots {
+			if have.GetState(addr, slot) != want.GetState(addr, slot) {
+				t.Errorf("block %d, account %x, slot %x: value mismatch: have %x, want %x", number, addr, slot, have.GetState(addr, slot), want.GetState(addr, slot))
+			}
+		}
+	}
+	if err := have.Error(); err != nil {
+		t.Fatalf("block %d: historical state read failed: %v", number, err)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"math/big"
 	"math/rand"
 	"os"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -32,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -3030,3 +3032,232 @@ func TestInitThenFailCreateContract(t *testing.T) {
 		}
 	}
 }
+
+// TestEIP2718Transition tests that an EIP-2718 access list transaction is
+// accepted after the fork, that its access list is charged and pre-warmed, and
+// that a typed receipt is produced for it.
+func TestEIP2718Transition(t *testing.T) {
+	var (
+		aa = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+
+		// Generate a canonical chain to act as the main dataset
+		engine = ethash.NewFaker()
+		db     = rawdb.NewMemoryDatabase()
+
+		// A sender who makes transactions, has some funds
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000)
+		gspec   = &Genesis{
+			Config: params.YoloV2ChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: funds},
+				// The address 0xAAAA sloads 0x00 and 0x01
+				aa: {
+					Code: []byte{
+						byte(vm.PC),
+						byte(vm.PC),
+						byte(vm.SLOAD),
+						byte(vm.SLOAD),
+					},
+					Nonce:   0,
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{1})
+
+		// One transaction to 0xAAAA
+		signer := types.LatestSigner(gspec.Config)
+		tx, _ := types.SignNewTx(key, signer, &types.AccessListTx{
+			ChainID:  gspec.Config.ChainID,
+			Nonce:    0,
+			To:       &aa,
+			Gas:      30000,
+			GasPrice: big.NewInt(1),
+			AccessList: types.AccessList{{
+				Address:     aa,
+				StorageKeys: []common.Hash{{0}},
+			}},
+		})
+		b.AddTx(tx)
+	})
+	// Import the canonical chain
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	block := chain.GetBlockByNumber(1)
+
+	// Expected gas is intrinsic + 2 * pc + hot load + cold load, since only one load is in the access list
+	expected := params.TxGas + params.TxAccessListAddressGas + params.TxAccessListStorageKeyGas +
+		vm.GasQuickStep*2 + vm.WarmStorageReadCostEIP2929 + vm.ColdSloadCostEIP2929
+	if block.GasUsed() != expected {
+		t.Fatalf("incorrect amount of gas spent: expected %d, got %d", expected, block.GasUsed())
+	}
+	receipts := chain.GetReceiptsByHash(block.Hash())
+	if len(receipts) != 1 || receipts[0].Type != types.AccessListTxType {
+		t.Fatalf("expected a single access list receipt, got %v", receipts)
+	}
+	if have, want := types.DeriveSha(receipts, new(trie.Trie)), block.ReceiptHash(); have != want {
+		t.Fatalf("receipt root mismatch: have %x, want %x", have, want)
+	}
+}
+
+// liveTracerRecorder is a tracing.LiveTracer recording the block and transaction
+// hooks, along with the reasons of all the balance changes.
+type liveTracerRecorder struct {
+	events []string
+}
+
+func (r *liveTracerRecorder) OnBalanceChange(addr common.Address, prev, new *big.Int, reason tracing.BalanceChangeReason) {
+	r.events = append(r.events, reason.String())
+}
+
+func (r *liveTracerRecorder) OnNonceChange(addr common.Address, prev, new uint64) {}
+
+func (r *liveTracerRecorder) OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+}
+
+func (r *liveTracerRecorder) OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+}
+
+func (r *liveTracerRecorder) OnAccountDeleted(addr common.Address) {
+	r.events = append(r.events, fmt.Sprintf("deleted %x", addr[:1]))
+}
+
+func (r *liveTracerRecorder) OnBlockStart(block *types.Block) {
+	r.events = append(r.events, fmt.Sprintf("block-start %d", block.NumberU64()))
+}
+
+func (r *liveTracerRecorder) OnBlockEnd(err error) {
+	r.events = append(r.events, fmt.Sprintf("block-end %v", err))
+}
+
+func (r *liveTracerRecorder) OnTxStart(tx *types.Transaction, from common.Address) {
+	r.events = append(r.events, fmt.Sprintf("tx-start %d", tx.Nonce()))
+}
+
+func (r *liveTracerRecorder) OnTxEnd(receipt *types.Receipt, err error) {
+	r.events = append(r.events, fmt.Sprintf("tx-end %d %v", receipt.Status, err))
+}
+
+// newLiveTracerTestChain creates a chain of two blocks for the live tracer tests:
+// the first one transferring some ether, the second one touching its empty
+// coinbase with a zero fee before rewarding it, which deletes it in between.
+func newLiveTracerTestChain() (*Genesis, consensus.Engine, []*types.Block) {
+	var (
+		engine  = ethash.NewFaker()
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, b *BlockGen) {
+		switch i {
+		case 0:
+			b.SetCoinbase(common.Address{1})
+			tx, _ := types.SignTx(types.NewTransaction(0, common.Address{2}, big.NewInt(1000), params.TxGas+1000, big.NewInt(1), nil), signer, key)
+			b.AddTx(tx)
+		case 1:
+			b.SetCoinbase(common.Address{3})
+			tx, _ := types.SignTx(types.NewTransaction(1, common.Address{2}, new(big.Int), params.TxGas, new(big.Int), nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	return gspec, engine, blocks
+}
+
+// liveTracerTestEvents are the notifications expected for newLiveTracerTestChain.
+var liveTracerTestEvents = []string{
+	"block-start 1",
+	"tx-start 0",
+	"gas-buy", "transfer", "transfer", "gas-return", "reward-transaction-fee",
+	"tx-end 1 <nil>",
+	"reward-mine-block",
+	"block-end <nil>",
+	"block-start 2",
+	"tx-start 1",
+	"deleted 03",
+	"tx-end 1 <nil>",
+	"reward-mine-block",
+	"block-end <nil>",
+}
+
+// Tests that a live tracer is notified about the blocks and transactions being
+// imported into the chain, along with the state changes they make.
+func TestLiveTracer(t *testing.T) {
+	gspec, engine, blocks := newLiveTracerTestChain()
+
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	recorder := new(liveTracerRecorder)
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{LiveTracer: recorder}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	if !reflect.DeepEqual(recorder.events, liveTracerTestEvents) {
+		t.Fatalf("event mismatch:\nhave %q\nwant %q", recorder.events, liveTracerTestEvents)
+	}
+}
+
+// Tests that a live tracer is notified about blocks executed outside of the
+// chain import and written directly along with their state, as done by the
+// miner, just like about imported ones.
+func TestLiveTracerWrittenBlocks(t *testing.T) {
+	gspec, engine, blocks := newLiveTracerTestChain()
+
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	recorder := new(liveTracerRecorder)
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{LiveTracer: recorder}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		// Execute the block without any tracing, like the miner does
+		parent := chain.GetHeaderByHash(block.ParentHash())
+		statedb, err := state.New(parent.Root, chain.stateCache, nil)
+		if err != nil {
+			t.Fatalf("failed to open parent state: %v", err)
+		}
+		receipts, logs, _, err := chain.Processor().Process(block, statedb, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block %d: %v", block.NumberU64(), err)
+		}
+		if _, err := chain.WriteBlockWithState(block, receipts, logs, statedb, true); err != nil {
+			t.Fatalf("failed to write block %d: %v", block.NumberU64(), err)
+		}
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 2 {
+		t.Fatalf("head mismatch: have %d, want 2", head)
+	}
+	if !reflect.DeepEqual(recorder.events, liveTracerTestEvents) {
+		t.Fatalf("event mismatch:\nhave %q\nwant %q", recorder.events, liveTracerTestEvents)
+	}
+}
@@ -528,6 +528,14 @@ func HasReceipts(db ethdb.Reader, hash common.Hash, number uint64) bool {
 	return true
 }
 
+// IsHistoryPruned reports whether the body and receipts of the block with the
+// given number were pruned from the ancient store. Note, HasBody and HasReceipts
+// still report pruned blocks as present, as they are part of the local chain.
+func IsHistoryPruned(db ethdb.AncientReader, number uint64) bool {
+	tail, err := db.AncientTail()
+	return err == nil && number < tail
+}
+
 // ReadReceiptsRLP retrieves all the transaction receipts belonging to a block in RLP encoding.
 func ReadReceiptsRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
@@ -648,6 +656,19 @@ func ReadBlock(db ethdb.Reader, hash common.Hash, number uint64) *types.Block {
 	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
 }
 
+// ReadHeadBlock retrieves the current canonical head block.
+func ReadHeadBlock(db ethdb.Reader) *types.Block {
+	hash := ReadHeadBlockHash(db)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	number := ReadHeaderNumber(db, hash)
+	if number == nil {
+		return nil
+	}
+	return ReadBlock(db, hash, *number)
+}
+
 // WriteBlock serializes a block into the database, header and body separately.
 func WriteBlock(db ethdb.KeyValueWriter, block *types.Block) {
 	WriteBody(db, block.Hash(), block.NumberU64(), block.Body())
@@ -691,6 +712,7 @@ func DeleteBlock(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	DeleteHeader(db, hash, number)
 	DeleteBody(db, hash, number)
 	DeleteTd(db, hash, number)
+	DeleteStateDiff(db, hash, number)
 }
 
 // DeleteBlockWithoutNumber removes all block data associated with a hash, except
@@ -700,6 +722,7 @@ func DeleteBlockWithoutNumber(db ethdb.KeyValueWriter, hash common.Hash, number
 	deleteHeaderWithoutNumber(db, hash, number)
 	DeleteBody(db, hash, number)
 	DeleteTd(db, hash, number)
+	DeleteStateDiff(db, hash, number)
 }
 
 // FindCommonAncestor returns the last common ancestor of two block headers
@@ -52,6 +52,20 @@ func WriteDatabaseVersion(db ethdb.KeyValueWriter, version uint64) {
 	}
 }
 
+// ReadDatabaseEngine retrieves the name of the key-value engine the database was
+// created with, or an empty string if it was never recorded.
+func ReadDatabaseEngine(db ethdb.KeyValueReader) string {
+	enc, _ := db.Get(databaseEngineKey)
+	return string(enc)
+}
+
+// WriteDatabaseEngine stores the name of the key-value engine backing the database.
+func WriteDatabaseEngine(db ethdb.KeyValueWriter, engine string) {
+	if err := db.Put(databaseEngineKey, []byte(engine)); err != nil {
+		log.Crit("Failed to store the database engine", "err", err)
+	}
+}
+
 // ReadChainConfig retrieves the consensus settings based on the given genesis hash.
 func ReadChainConfig(db ethdb.KeyValueReader, hash common.Hash) *params.ChainConfig {
 	data, _ := db.Get(configKey(hash))
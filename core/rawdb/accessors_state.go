@@ -17,9 +17,12 @@
 package rawdb
 
 import (
+	"encoding/binary"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // ReadPreimage retrieves a single preimage of the provided hash.
@@ -61,6 +64,16 @@ func ReadCodeWithPrefix(db ethdb.KeyValueReader, hash common.Hash) []byte {
 	return data
 }
 
+// HasCode checks if the contract code corresponding to the provided code hash
+// is present in the database, under either the legacy or the current scheme.
+func HasCode(db ethdb.KeyValueReader, hash common.Hash) bool {
+	if ok, _ := db.Has(hash[:]); ok {
+		return true
+	}
+	ok, _ := db.Has(codeKey(hash))
+	return ok
+}
+
 // WriteCode writes the provided contract code database.
 func WriteCode(db ethdb.KeyValueWriter, hash common.Hash, code []byte) {
 	if err := db.Put(codeKey(hash), code); err != nil {
@@ -81,6 +94,13 @@ func ReadTrieNode(db ethdb.KeyValueReader, hash common.Hash) []byte {
 	return data
 }
 
+// HasTrieNode checks if the trie node with the provided hash is present in the
+// database.
+func HasTrieNode(db ethdb.KeyValueReader, hash common.Hash) bool {
+	ok, _ := db.Has(hash.Bytes())
+	return ok
+}
+
 // WriteTrieNode writes the provided trie node database.
 func WriteTrieNode(db ethdb.KeyValueWriter, hash common.Hash, node []byte) {
 	if err := db.Put(hash.Bytes(), node); err != nil {
@@ -94,3 +114,111 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+// ReadStateDiffRLP retrieves the reverse state diff of a block in RLP encoding,
+// or nil if none was recorded.
+func ReadStateDiffRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue {
+	// First try to look up the data in ancient database. Extra hash
+	// comparison is necessary since ancient database only maintains
+	// the canonical data.
+	data, _ := db.Ancient(freezerStateDiffTable, number)
+	if len(data) > 0 {
+		h, _ := db.Ancient(freezerHashTable, number)
+		if common.BytesToHash(h) == hash {
+			return data
+		}
+	}
+	// Then try to look up the data in leveldb.
+	data, _ = db.Get(stateDiffKey(number, hash))
+	if len(data) > 0 {
+		return data
+	}
+	// In the background freezer is moving data from leveldb to flatten files.
+	// So during the first check for ancient db, the data is not yet in there,
+	// but when we reach into leveldb, the data was already moved. That would
+	// result in a not found error.
+	data, _ = db.Ancient(freezerStateDiffTable, number)
+	if len(data) > 0 {
+		h, _ := db.Ancient(freezerHashTable, number)
+		if common.BytesToHash(h) == hash {
+			return data
+		}
+	}
+	return nil // Can't find the data anywhere.
+}
+
+// WriteStateDiffRLP stores the RLP encoded reverse state diff of a block.
+func WriteStateDiffRLP(db ethdb.KeyValueWriter, hash common.Hash, number uint64, diff rlp.RawValue) {
+	if err := db.Put(stateDiffKey(number, hash), diff); err != nil {
+		log.Crit("Failed to store state diff", "err", err)
+	}
+}
+
+// DeleteStateDiff removes the reverse state diff of a block.
+func DeleteStateDiff(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state diff", "err", err)
+	}
+}
+
+// WriteAccountChange indexes that the reverse state diff of the block with the
+// given number holds the original value of an account.
+func WriteAccountChange(db ethdb.KeyValueWriter, account common.Hash, number uint64) {
+	if err := db.Put(accountChangeKey(account, number), nil); err != nil {
+		log.Crit("Failed to store account change index", "err", err)
+	}
+}
+
+// WriteStorageChange indexes that the reverse state diff of the block with the
+// given number holds the original value of a storage slot.
+func WriteStorageChange(db ethdb.KeyValueWriter, account common.Hash, slot common.Hash, number uint64) {
+	if err := db.Put(storageChangeKey(account, slot, number), nil); err != nil {
+		log.Crit("Failed to store storage change index", "err", err)
+	}
+}
+
+// ReadAccountChange retrieves the number of the first block from the given one
+// onwards whose reverse state diff was indexed to hold the original value of an
+// account. Note, the block is not necessarily canonical.
+func ReadAccountChange(db ethdb.Iteratee, account common.Hash, from uint64) (uint64, bool) {
+	return readChange(db, append(accountChangePrefix, account.Bytes()...), from)
+}
+
+// ReadStorageChange retrieves the number of the first block from the given one
+// onwards whose reverse state diff was indexed to hold the original value of a
+// storage slot. Note, the block is not necessarily canonical.
+func ReadStorageChange(db ethdb.Iteratee, account common.Hash, slot common.Hash, from uint64) (uint64, bool) {
+	return readChange(db, append(append(storageChangePrefix, account.Bytes()...), slot.Bytes()...), from)
+}
+
+// readChange retrieves the first block number indexed under the given prefix,
+// starting from the given one.
+func readChange(db ethdb.Iteratee, prefix []byte, from uint64) (uint64, bool) {
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+8 {
+			return binary.BigEndian.Uint64(key[len(prefix):]), true
+		}
+	}
+	return 0, false
+}
+
+// ReadStateHistoryTail retrieves the number of the oldest block whose state can
+// be rolled back to through the reverse state diffs.
+func ReadStateHistoryTail(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(stateHistoryTailKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteStateHistoryTail stores the number of the oldest block whose state can be
+// rolled back to through the reverse state diffs.
+func WriteStateHistoryTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(stateHistoryTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the state history tail", "err", err)
+	}
+}
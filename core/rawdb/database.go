@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -32,6 +33,18 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
+const (
+	// DBLeveldb is the identifier of the leveldb backed key-value store.
+	DBLeveldb = "leveldb"
+
+	// DBPebble is the identifier of the pebble backed key-value store.
+	DBPebble = "pebble"
+)
+
+// errEngineMismatch is returned if a database is opened with a different key-
+// value engine than the one it was created with.
+var errEngineMismatch = errors.New("database engine mismatch")
+
 // freezerdb is a database wrapper that enabled freezer data retrievals.
 type freezerdb struct {
 	ethdb.KeyValueStore
@@ -90,6 +103,11 @@ func (db *nofreezedb) Ancients() (uint64, error) {
 	return 0, errNotSupported
 }
 
+// AncientTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) AncientTail() (uint64, error) {
+	return 0, errNotSupported
+}
+
 // AncientSize returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) AncientSize(kind string) (uint64, error) {
 	return 0, errNotSupported
@@ -105,6 +123,11 @@ func (db *nofreezedb) TruncateAncients(items uint64) error {
 	return errNotSupported
 }
 
+// PruneAncients returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) PruneAncients(items uint64) error {
+	return errNotSupported
+}
+
 // Sync returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) Sync() error {
 	return errNotSupported
@@ -120,10 +143,19 @@ func NewDatabase(db ethdb.KeyValueStore) ethdb.Database {
 
 // NewDatabaseWithFreezer creates a high level database on top of a given key-
 // value data store with a freezer moving immutable chain segments into cold
-// storage.
-func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string) (ethdb.Database, error) {
-	// Create the idle freezer instance
-	frdb, err := newFreezer(freezer, namespace)
+// storage. If the ancient location is the URL of a remote freezer server, it is
+// used as is, without moving anything into it.
+func NewDatabaseWithFreezer(db ethdb.KeyValueStore, ancient string, namespace string) (ethdb.Database, error) {
+	// Create the idle freezer instance, or connect to the remote one
+	var (
+		frdb ethdb.AncientStore
+		err  error
+	)
+	if IsRemoteFreezer(ancient) {
+		frdb, err = newRemoteFreezer(ancient)
+	} else {
+		frdb, err = newFreezer(ancient, namespace)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +224,13 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 		}
 	}
 	// Freezer is consistent with the key-value database, permit combining the two
-	go frdb.freeze(db)
+	if frdb, ok := frdb.(*freezer); ok {
+		frdb.wg.Add(1)
+		go func() {
+			frdb.freeze(db)
+			frdb.wg.Done()
+		}()
+	}
 
 	return &freezerdb{
 		KeyValueStore: db,
@@ -216,7 +254,7 @@ func NewMemoryDatabaseWithCap(size int) ethdb.Database {
 // NewLevelDBDatabase creates a persistent key-value database without a freezer
 // moving immutable chain segments into cold storage.
 func NewLevelDBDatabase(file string, cache int, handles int, namespace string) (ethdb.Database, error) {
-	db, err := leveldb.New(file, cache, handles, namespace)
+	db, err := openKeyValueStore(DBLeveldb, file, cache, handles, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -226,7 +264,7 @@ func NewLevelDBDatabase(file string, cache int, handles int, namespace string) (
 // NewLevelDBDatabaseWithFreezer creates a persistent key-value database with a
 // freezer moving immutable chain segments into cold storage.
 func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string) (ethdb.Database, error) {
-	kvdb, err := leveldb.New(file, cache, handles, namespace)
+	kvdb, err := openKeyValueStore(DBLeveldb, file, cache, handles, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -238,6 +276,120 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+// NewPebbleDBDatabase creates a persistent key-value database without a freezer
+// moving immutable chain segments into cold storage.
+func NewPebbleDBDatabase(file string, cache int, handles int, namespace string) (ethdb.Database, error) {
+	db, err := openKeyValueStore(DBPebble, file, cache, handles, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(db), nil
+}
+
+// NewPebbleDBDatabaseWithFreezer creates a persistent key-value database with a
+// freezer moving immutable chain segments into cold storage.
+func NewPebbleDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string) (ethdb.Database, error) {
+	kvdb, err := openKeyValueStore(DBPebble, file, cache, handles, namespace)
+	if err != nil {
+		return nil, err
+	}
+	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
+// OpenOptions contains the parameters for opening a persistent database.
+type OpenOptions struct {
+	Type              string // Key-value engine to use, empty to reuse the existing one (or leveldb for new databases)
+	Directory         string // Path to the key-value database
+	AncientsDirectory string // Path to the chain freezer, empty to run without one
+	Namespace         string // Prefix for the metrics reporting of internal stats
+	Cache             int    // Memory allowance in megabytes for database caching
+	Handles           int    // Number of file handles to allocate to the database
+}
+
+// Open opens both a disk-based key-value database and, if requested, a chain
+// freezer attached to it. If no engine is explicitly requested, the one found in
+// the directory is used, falling back to leveldb for brand new databases.
+func Open(o OpenOptions) (ethdb.Database, error) {
+	engine := o.Type
+	if engine == "" {
+		engine = preexistingEngine(o.Directory)
+	}
+	if engine == "" {
+		engine = DBLeveldb
+	}
+	switch engine {
+	case DBLeveldb:
+		if o.AncientsDirectory == "" {
+			return NewLevelDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace)
+		}
+		return NewLevelDBDatabaseWithFreezer(o.Directory, o.Cache, o.Handles, o.AncientsDirectory, o.Namespace)
+	case DBPebble:
+		if o.AncientsDirectory == "" {
+			return NewPebbleDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace)
+		}
+		return NewPebbleDBDatabaseWithFreezer(o.Directory, o.Cache, o.Handles, o.AncientsDirectory, o.Namespace)
+	default:
+		return nil, fmt.Errorf("unknown database engine %q", engine)
+	}
+}
+
+// preexistingEngine checks the given directory whether a database is already
+// instantiated at that location, and if so, returns the engine it was created
+// with. An empty string is returned if there is no database yet.
+//
+// Both engines maintain a CURRENT file pointing to their manifest, but only
+// pebble writes OPTIONS files, so the two can be told apart without opening them.
+func preexistingEngine(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return ""
+	}
+	if matches, _ := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 {
+		return DBPebble
+	}
+	return DBLeveldb
+}
+
+// openKeyValueStore opens a disk-based key-value store with the requested engine,
+// refusing to do so if the database was created with a different one. Databases
+// that predate the engine being recorded get stamped on first open.
+func openKeyValueStore(engine string, file string, cache int, handles int, namespace string) (ethdb.KeyValueStore, error) {
+	// Reject a mismatching engine before opening, some engines happily create
+	// their own files in a foreign directory, corrupting it in the process
+	if existing := preexistingEngine(file); existing != "" && existing != engine {
+		return nil, fmt.Errorf("%w: requested %s, found %s", errEngineMismatch, engine, existing)
+	}
+	var (
+		db  ethdb.KeyValueStore
+		err error
+	)
+	switch engine {
+	case DBLeveldb:
+		db, err = leveldb.New(file, cache, handles, namespace)
+	case DBPebble:
+		db, err = newPebble(file, cache, handles, namespace)
+	default:
+		err = fmt.Errorf("unknown database engine %q", engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The files on disk matched, cross check with the engine recorded inside
+	switch recorded := ReadDatabaseEngine(db); recorded {
+	case engine:
+	case "":
+		WriteDatabaseEngine(db, engine)
+	default:
+		db.Close()
+		return nil, fmt.Errorf("%w: requested %s, recorded %s", errEngineMismatch, engine, recorded)
+	}
+	return db, nil
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -283,6 +435,8 @@ func InspectDatabase(db ethdb.Database) error {
 		headers         stat
 		bodies          stat
 		receipts        stat
+		stateDiffs      stat
+		stateChanges    stat
 		tds             stat
 		numHashPairings stat
 		hashNumPairings stat
@@ -296,11 +450,12 @@ func InspectDatabase(db ethdb.Database) error {
 		cliqueSnaps     stat
 
 		// Ancient store statistics
-		ancientHeadersSize  common.StorageSize
-		ancientBodiesSize   common.StorageSize
-		ancientReceiptsSize common.StorageSize
-		ancientTdsSize      common.StorageSize
-		ancientHashesSize   common.StorageSize
+		ancientHeadersSize    common.StorageSize
+		ancientBodiesSize     common.StorageSize
+		ancientReceiptsSize   common.StorageSize
+		ancientTdsSize        common.StorageSize
+		ancientHashesSize     common.StorageSize
+		ancientStateDiffsSize common.StorageSize
 
 		// Les statistic
 		chtTrieNodes   stat
@@ -327,6 +482,12 @@ func InspectDatabase(db ethdb.Database) error {
 			bodies.Add(size)
 		case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
 			receipts.Add(size)
+		case bytes.HasPrefix(key, stateDiffPrefix) && len(key) == (len(stateDiffPrefix)+8+common.HashLength):
+			stateDiffs.Add(size)
+		case bytes.HasPrefix(key, accountChangePrefix) && len(key) == (len(accountChangePrefix)+common.HashLength+8):
+			stateChanges.Add(size)
+		case bytes.HasPrefix(key, storageChangePrefix) && len(key) == (len(storageChangePrefix)+2*common.HashLength+8):
+			stateChanges.Add(size)
 		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix):
 			tds.Add(size)
 		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix):
@@ -355,7 +516,7 @@ func InspectDatabase(db ethdb.Database) error {
 			bloomTrieNodes.Add(size)
 		default:
 			var accounted bool
-			for _, meta := range [][]byte{databaseVerisionKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey} {
+			for _, meta := range [][]byte{databaseVerisionKey, databaseEngineKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey, stateHistoryTailKey} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
 					accounted = true
@@ -373,8 +534,8 @@ func InspectDatabase(db ethdb.Database) error {
 		}
 	}
 	// Inspect append-only file store then.
-	ancientSizes := []*common.StorageSize{&ancientHeadersSize, &ancientBodiesSize, &ancientReceiptsSize, &ancientHashesSize, &ancientTdsSize}
-	for i, category := range []string{freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerHashTable, freezerDifficultyTable} {
+	ancientSizes := []*common.StorageSize{&ancientHeadersSize, &ancientBodiesSize, &ancientReceiptsSize, &ancientHashesSize, &ancientTdsSize, &ancientStateDiffsSize}
+	for i, category := range []string{freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerHashTable, freezerDifficultyTable, freezerStateDiffTable} {
 		if size, err := db.AncientSize(category); err == nil {
 			*ancientSizes[i] += common.StorageSize(size)
 			total += common.StorageSize(size)
@@ -391,6 +552,8 @@ func InspectDatabase(db ethdb.Database) error {
 		{"Key-Value store", "Bodies", bodies.Size(), bodies.Count()},
 		{"Key-Value store", "Receipt lists", receipts.Size(), receipts.Count()},
 		{"Key-Value store", "Difficulties", tds.Size(), tds.Count()},
+		{"Key-Value store", "State diffs", stateDiffs.Size(), stateDiffs.Count()},
+		{"Key-Value store", "State change index", stateChanges.Size(), stateChanges.Count()},
 		{"Key-Value store", "Block number->hash", numHashPairings.Size(), numHashPairings.Count()},
 		{"Key-Value store", "Block hash->number", hashNumPairings.Size(), hashNumPairings.Count()},
 		{"Key-Value store", "Transaction index", txLookups.Size(), txLookups.Count()},
@@ -407,6 +570,7 @@ func InspectDatabase(db ethdb.Database) error {
 		{"Ancient store", "Receipt lists", ancientReceiptsSize.String(), ancients.String()},
 		{"Ancient store", "Difficulties", ancientTdsSize.String(), ancients.String()},
 		{"Ancient store", "Block number->hash", ancientHashesSize.String(), ancients.String()},
+		{"Ancient store", "State diffs", ancientStateDiffsSize.String(), ancients.String()},
 		{"Light client", "CHT trie nodes", chtTrieNodes.Size(), chtTrieNodes.Count()},
 		{"Light client", "Bloom trie nodes", bloomTrieNodes.Size(), bloomTrieNodes.Count()},
 	}
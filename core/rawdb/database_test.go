@@ -0,0 +1,98 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+// Tests that the key-value engine is recorded on first open and that reopening
+// the database with a different engine is refused.
+func TestDatabaseEngineMismatch(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("pebble is not supported on this platform")
+	}
+	for _, engines := range [][2]string{{DBLeveldb, DBPebble}, {DBPebble, DBLeveldb}} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		db, err := Open(OpenOptions{Type: engines[0], Directory: dir})
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engines[0], err)
+		}
+		if engine := ReadDatabaseEngine(db); engine != engines[0] {
+			t.Errorf("%s: recorded engine mismatch: have %q", engines[0], engine)
+		}
+		db.Close()
+
+		// Reopening with the same engine, or letting it be detected, should work
+		for _, engine := range []string{engines[0], ""} {
+			db, err := Open(OpenOptions{Type: engine, Directory: dir})
+			if err != nil {
+				t.Fatalf("%s: failed to reopen database with %q: %v", engines[0], engine, err)
+			}
+			db.Close()
+		}
+		// Reopening with the other engine must be refused
+		if _, err := Open(OpenOptions{Type: engines[1], Directory: dir}); !errors.Is(err, errEngineMismatch) {
+			t.Fatalf("%s: opening with %s error mismatch: have %v, want %v", engines[0], engines[1], err, errEngineMismatch)
+		}
+	}
+}
+
+// Tests that databases created before the engine was recorded are accepted by
+// their own engine and get stamped, while a mismatching recorded engine is
+// refused even if the files on disk look right.
+func TestDatabaseEngineRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create a legacy database without the engine marker
+	db, err := NewLevelDBDatabase(dir, 0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Delete(databaseEngineKey); err != nil {
+		t.Fatalf("failed to delete engine marker: %v", err)
+	}
+	db.Close()
+
+	db, err = NewLevelDBDatabase(dir, 0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to reopen legacy database: %v", err)
+	}
+	if engine := ReadDatabaseEngine(db); engine != DBLeveldb {
+		t.Errorf("legacy database not stamped: have %q, want %q", engine, DBLeveldb)
+	}
+	// Tamper with the marker and ensure it's enforced
+	WriteDatabaseEngine(db, "rocksdb")
+	db.Close()
+
+	if _, err := NewLevelDBDatabase(dir, 0, 0, ""); !errors.Is(err, errEngineMismatch) {
+		t.Fatalf("error mismatch: have %v, want %v", err, errEngineMismatch)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Entry is a human readable interpretation of a raw key-value database entry.
+type Entry struct {
+	Kind  string // Data type stored in the entry, empty if unrecognised
+	Key   string // Decoded fields of the key
+	Value string // Decoded value, empty if the raw value is all there is to show
+}
+
+// DescribeEntry interprets a raw database entry based on the known schema. The
+// value may be nil, in which case only the key is interpreted. Values that fail
+// to decode are reported instead of being silently dropped.
+func DescribeEntry(key, value []byte) Entry {
+	var (
+		entry  Entry
+		decode func([]byte) (string, error)
+	)
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
+		entry.Kind, entry.Key = "header", describeNumberHash(key[len(headerPrefix):])
+		decode = decodeJSON(new(types.Header))
+	case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
+		entry.Kind, entry.Key = "block body", describeNumberHash(key[len(blockBodyPrefix):])
+		decode = decodeJSON(new(types.Body))
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
+		entry.Kind, entry.Key = "block receipts", describeNumberHash(key[len(blockReceiptsPrefix):])
+		decode = decodeReceipts
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength+len(headerTDSuffix)) && bytes.HasSuffix(key, headerTDSuffix):
+		entry.Kind, entry.Key = "total difficulty", describeNumberHash(key[len(headerPrefix):len(key)-len(headerTDSuffix)])
+		decode = decodeJSON(new(big.Int))
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+len(headerHashSuffix)) && bytes.HasSuffix(key, headerHashSuffix):
+		entry.Kind, entry.Key = "canonical hash", fmt.Sprintf("number=%d", binary.BigEndian.Uint64(key[len(headerPrefix):]))
+		decode = decodeHash
+	case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
+		entry.Kind, entry.Key = "header number", fmt.Sprintf("hash=%x", key[len(headerNumberPrefix):])
+		decode = decodeNumber
+	case len(key) == common.HashLength:
+		entry.Kind, entry.Key = "trie node", fmt.Sprintf("hash=%x", key)
+	case bytes.HasPrefix(key, codePrefix) && len(key) == len(codePrefix)+common.HashLength:
+		entry.Kind, entry.Key = "contract code", fmt.Sprintf("hash=%x", key[len(codePrefix):])
+	case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
+		entry.Kind, entry.Key = "transaction lookup", fmt.Sprintf("hash=%x", key[len(txLookupPrefix):])
+		decode = decodeTxLookup
+	case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
+		entry.Kind, entry.Key = "snapshot account", fmt.Sprintf("account=%x", key[len(SnapshotAccountPrefix):])
+		decode = decodeSnapshotAccount
+	case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
+		entry.Kind = "snapshot storage"
+		entry.Key = fmt.Sprintf("account=%x slot=%x", key[len(SnapshotStoragePrefix):len(SnapshotStoragePrefix)+common.HashLength], key[len(SnapshotStoragePrefix)+common.HashLength:])
+		decode = decodeSnapshotSlot
+	case bytes.HasPrefix(key, preimagePrefix) && len(key) == (len(preimagePrefix)+common.HashLength):
+		entry.Kind, entry.Key = "preimage", fmt.Sprintf("hash=%x", key[len(preimagePrefix):])
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
+		rest := key[len(bloomBitsPrefix):]
+		entry.Kind = "bloom bits"
+		entry.Key = fmt.Sprintf("bit=%d section=%d head=%x", binary.BigEndian.Uint16(rest), binary.BigEndian.Uint64(rest[2:]), rest[10:])
+	case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
+		entry.Kind, entry.Key = "chain config", fmt.Sprintf("genesis=%x", key[len(configPrefix):])
+	case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
+		entry.Kind, entry.Key = "clique snapshot", fmt.Sprintf("hash=%x", key[7:])
+	case bytes.HasPrefix(key, []byte("cht-")) && len(key) == 4+common.HashLength:
+		entry.Kind, entry.Key = "cht trie node", fmt.Sprintf("hash=%x", key[4:])
+	case bytes.HasPrefix(key, []byte("blt-")) && len(key) == 4+common.HashLength:
+		entry.Kind, entry.Key = "bloom trie node", fmt.Sprintf("hash=%x", key[4:])
+	default:
+		switch string(key) {
+		case string(headHeaderKey), string(headBlockKey), string(headFastBlockKey), string(snapshotRootKey):
+			entry.Kind, decode = "metadata", decodeHash
+		case string(databaseVerisionKey), string(lastPivotKey):
+			entry.Kind, decode = "metadata", decodeRLPNumber
+		case string(txIndexTailKey), string(fastTxLookupLimitKey):
+			entry.Kind, decode = "metadata", decodeNumber
+		case string(fastTrieProgressKey):
+			entry.Kind, decode = "metadata", decodeBigNumber
+		case string(databaseEngineKey):
+			entry.Kind, decode = "metadata", decodeString
+		case string(snapshotJournalKey), string(snapshotGeneratorKey), string(snapshotRecoveryKey):
+			entry.Kind = "metadata"
+		default:
+			return entry
+		}
+		entry.Key = string(key)
+	}
+	if value != nil && decode != nil {
+		dec, err := decode(value)
+		if err != nil {
+			dec = fmt.Sprintf("invalid %s: %v", entry.Kind, err)
+		}
+		entry.Value = dec
+	}
+	return entry
+}
+
+// describeNumberHash renders the block number and hash fields of a key.
+func describeNumberHash(key []byte) string {
+	return fmt.Sprintf("number=%d hash=%x", binary.BigEndian.Uint64(key[:8]), key[8:8+common.HashLength])
+}
+
+// decodeJSON returns a decoder which parses an RLP encoded value into the given
+// object, rendering it as JSON.
+func decodeJSON(obj interface{}) func([]byte) (string, error) {
+	return func(value []byte) (string, error) {
+		if err := rlp.DecodeBytes(value, obj); err != nil {
+			return "", err
+		}
+		out, err := json.MarshalIndent(obj, "", "  ")
+		return string(out), err
+	}
+}
+
+// decodeReceipts renders the storage encoding of a block's receipts as JSON.
+func decodeReceipts(value []byte) (string, error) {
+	var storage []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(value, &storage); err != nil {
+		return "", err
+	}
+	receipts := make([]*types.Receipt, len(storage))
+	for i, receipt := range storage {
+		receipts[i] = (*types.Receipt)(receipt)
+	}
+	out, err := json.MarshalIndent(receipts, "", "  ")
+	return string(out), err
+}
+
+// decodeHash renders a raw hash value.
+func decodeHash(value []byte) (string, error) {
+	if len(value) != common.HashLength {
+		return "", fmt.Errorf("invalid hash length %d", len(value))
+	}
+	return common.BytesToHash(value).Hex(), nil
+}
+
+// decodeNumber renders a big endian uint64 value.
+func decodeNumber(value []byte) (string, error) {
+	if len(value) != 8 {
+		return "", fmt.Errorf("invalid number length %d", len(value))
+	}
+	return fmt.Sprint(binary.BigEndian.Uint64(value)), nil
+}
+
+// decodeBigNumber renders a big endian arbitrary length number.
+func decodeBigNumber(value []byte) (string, error) {
+	return new(big.Int).SetBytes(value).String(), nil
+}
+
+// decodeRLPNumber renders an RLP encoded uint64 value.
+func decodeRLPNumber(value []byte) (string, error) {
+	var number uint64
+	if err := rlp.DecodeBytes(value, &number); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(number), nil
+}
+
+// decodeString renders a plain text value.
+func decodeString(value []byte) (string, error) {
+	return string(value), nil
+}
+
+// decodeTxLookup renders a transaction lookup entry in any of its historical
+// encodings (see ReadTxLookupEntry).
+func decodeTxLookup(value []byte) (string, error) {
+	switch {
+	case len(value) <= 8:
+		return fmt.Sprintf("block=%d", new(big.Int).SetBytes(value).Uint64()), nil
+	case len(value) == common.HashLength:
+		return fmt.Sprintf("block=%x", value), nil
+	}
+	var entry LegacyTxLookupEntry
+	if err := rlp.DecodeBytes(value, &entry); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("block=%x blockIndex=%d index=%d", entry.BlockHash, entry.BlockIndex, entry.Index), nil
+}
+
+// decodeSnapshotAccount renders an account in the slim snapshot encoding.
+func decodeSnapshotAccount(value []byte) (string, error) {
+	var account struct {
+		Nonce    uint64
+		Balance  *big.Int
+		Root     []byte
+		CodeHash []byte
+	}
+	if err := rlp.DecodeBytes(value, &account); err != nil {
+		return "", err
+	}
+	root, codeHash := "empty", "empty"
+	if len(account.Root) > 0 {
+		root = hexutil.Encode(account.Root)
+	}
+	if len(account.CodeHash) > 0 {
+		codeHash = hexutil.Encode(account.CodeHash)
+	}
+	return fmt.Sprintf("nonce=%d balance=%v root=%s codehash=%s", account.Nonce, account.Balance, root, codeHash), nil
+}
+
+// decodeSnapshotSlot renders an RLP encoded storage slot value.
+func decodeSnapshotSlot(value []byte) (string, error) {
+	var slot []byte
+	if err := rlp.DecodeBytes(value, &slot); err != nil {
+		return "", err
+	}
+	return hexutil.Encode(slot), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that database entries written by the accessors are recognised and
+// decoded into readable form.
+func TestDescribeEntry(t *testing.T) {
+	db := memorydb.New()
+
+	header := &types.Header{Number: big.NewInt(42), Extra: []byte("test header")}
+	WriteHeader(db, header)
+	WriteCanonicalHash(db, header.Hash(), 42)
+	WriteTd(db, header.Hash(), 42, big.NewInt(1337))
+	WriteHeadHeaderHash(db, header.Hash())
+
+	account, _ := rlp.EncodeToBytes([]interface{}{uint64(7), big.NewInt(100), []byte{}, []byte{}})
+	WriteAccountSnapshot(db, common.Hash{0xaa}, account)
+
+	tests := []struct {
+		key   []byte
+		kind  string
+		key2  string
+		value string
+	}{
+		{headerKey(42, header.Hash()), "header", "number=42", `"number": "0x2a"`},
+		{headerHashKey(42), "canonical hash", "number=42", header.Hash().Hex()},
+		{headerTDKey(42, header.Hash()), "total difficulty", "number=42", "1337"},
+		{headerNumberKey(header.Hash()), "header number", "hash=", "42"},
+		{headHeaderKey, "metadata", "LastHeader", header.Hash().Hex()},
+		{accountSnapshotKey(common.Hash{0xaa}), "snapshot account", "account=aa", "nonce=7 balance=100 root=empty codehash=empty"},
+	}
+	for i, tt := range tests {
+		value, err := db.Get(tt.key)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve key %x: %v", i, tt.key, err)
+		}
+		entry := DescribeEntry(tt.key, value)
+		if entry.Kind != tt.kind {
+			t.Errorf("test %d: kind mismatch: have %q, want %q", i, entry.Kind, tt.kind)
+		}
+		if !strings.Contains(entry.Key, tt.key2) {
+			t.Errorf("test %d: key mismatch: have %q, want %q", i, entry.Key, tt.key2)
+		}
+		if !strings.Contains(entry.Value, tt.value) {
+			t.Errorf("test %d: value mismatch: have %q, want %q", i, entry.Value, tt.value)
+		}
+	}
+	// Unknown keys should not be interpreted
+	if entry := DescribeEntry([]byte("unknown"), []byte{0x01}); entry != (Entry{}) {
+		t.Errorf("unknown key interpreted: %+v", entry)
+	}
+}
@@ -17,8 +17,10 @@
 package rawdb
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
@@ -46,6 +48,14 @@ var (
 	// errSymlinkDatadir is returned if the ancient directory specified by user
 	// is a symbolic link.
 	errSymlinkDatadir = errors.New("symbolic link datadir is not supported")
+
+	// errTruncateBelowTail is returned if the user attempts to truncate the freezer
+	// below its history tail, which would leave the pruned tables empty.
+	errTruncateBelowTail = errors.New("truncating below the history tail")
+
+	// ErrAncientPruned is returned if the user attempts to read block bodies or
+	// receipts below the history tail, which were discarded from the freezer.
+	ErrAncientPruned = errors.New("ancient history pruned")
 )
 
 const (
@@ -57,6 +67,10 @@ const (
 	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
 	// before doing an fsync and deleting it from the key-value store.
 	freezerBatchLimit = 30000
+
+	// freezerTailFile is the name of the file persisting the history tail of the
+	// freezer, below which the prunable tables were discarded.
+	freezerTailFile = "TAIL"
 )
 
 // freezer is an memory mapped append-only database to store immutable chain data
@@ -71,14 +85,17 @@ type freezer struct {
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	frozen    uint64 // Number of blocks already frozen
+	tail      uint64 // Number of the first block with bodies and receipts retained
 	threshold uint64 // Number of recent blocks not to freeze (params.FullImmutabilityThreshold apart from tests)
 
+	datadir      string                   // Directory holding the data tables
 	tables       map[string]*freezerTable // Data tables for storing everything
 	instanceLock fileutil.Releaser        // File-system lock to prevent double opens
 
 	trigger chan chan struct{} // Manual blocking freeze trigger, test determinism
 
 	quit      chan struct{}
+	wg        sync.WaitGroup // Tracks the background freezing routine, if any
 	closeOnce sync.Once
 }
 
@@ -107,6 +124,7 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 	// Open all the supported data tables
 	freezer := &freezer{
 		threshold:    params.FullImmutabilityThreshold,
+		datadir:      datadir,
 		tables:       make(map[string]*freezerTable),
 		instanceLock: lock,
 		trigger:      make(chan chan struct{}),
@@ -130,7 +148,22 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 		lock.Release()
 		return nil, err
 	}
-	log.Info("Opened ancient database", "database", datadir)
+	tail, err := readFreezerTail(datadir)
+	if err != nil {
+		for _, table := range freezer.tables {
+			table.Close()
+		}
+		lock.Release()
+		return nil, err
+	}
+	for name := range freezerPrunable {
+		if offset := uint64(freezer.tables[name].itemOffset); offset > tail {
+			tail = offset
+		}
+	}
+	freezer.tail = tail
+
+	log.Info("Opened ancient database", "database", datadir, "tail", tail)
 	return freezer, nil
 }
 
@@ -138,7 +171,9 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 func (f *freezer) Close() error {
 	var errs []error
 	f.closeOnce.Do(func() {
-		f.quit <- struct{}{}
+		close(f.quit)
+		f.wg.Wait()
+
 		for _, table := range f.tables {
 			if err := table.Close(); err != nil {
 				errs = append(errs, err)
@@ -157,6 +192,9 @@ func (f *freezer) Close() error {
 // HasAncient returns an indicator whether the specified ancient data exists
 // in the freezer.
 func (f *freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if freezerPrunable[kind] && number < atomic.LoadUint64(&f.tail) {
+		return false, nil
+	}
 	if table := f.tables[kind]; table != nil {
 		return table.has(number), nil
 	}
@@ -165,6 +203,9 @@ func (f *freezer) HasAncient(kind string, number uint64) (bool, error) {
 
 // Ancient retrieves an ancient binary blob from the append-only immutable files.
 func (f *freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if freezerPrunable[kind] && number < atomic.LoadUint64(&f.tail) {
+		return nil, ErrAncientPruned
+	}
 	if table := f.tables[kind]; table != nil {
 		return table.Retrieve(number)
 	}
@@ -176,6 +217,12 @@ func (f *freezer) Ancients() (uint64, error) {
 	return atomic.LoadUint64(&f.frozen), nil
 }
 
+// AncientTail returns the number of the first block whose bodies and receipts
+// are retained in the freezer.
+func (f *freezer) AncientTail() (uint64, error) {
+	return atomic.LoadUint64(&f.tail), nil
+}
+
 // AncientSize returns the ancient size of the specified category.
 func (f *freezer) AncientSize(kind string) (uint64, error) {
 	if table := f.tables[kind]; table != nil {
@@ -190,7 +237,14 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 // Notably, this function is lock free but kind of thread-safe. All out-of-order
 // injection will be rejected. But if two injections with same number happen at
 // the same time, we can get into the trouble.
-func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
+func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	return f.appendAncient(number, hash, header, body, receipts, td, nil)
+}
+
+// appendAncient injects all binary blobs belong to block at the end of the
+// append-only immutable table files, along with the block's reverse state diff
+// if one was recorded.
+func (f *freezer) appendAncient(number uint64, hash, header, body, receipts, td, diff []byte) (err error) {
 	// Ensure the binary blobs we are appending is continuous with freezer.
 	if atomic.LoadUint64(&f.frozen) != number {
 		return errOutOrderInsertion
@@ -227,6 +281,10 @@ func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td
 		log.Error("Failed to append ancient difficulty", "number", f.frozen, "hash", hash, "err", err)
 		return err
 	}
+	if err := f.tables[freezerStateDiffTable].Append(f.frozen, diff); err != nil {
+		log.Error("Failed to append ancient state diff", "number", f.frozen, "hash", hash, "err", err)
+		return err
+	}
 	atomic.AddUint64(&f.frozen, 1) // Only modify atomically
 	return nil
 }
@@ -236,8 +294,11 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	if atomic.LoadUint64(&f.frozen) <= items {
 		return nil
 	}
-	for _, table := range f.tables {
-		if err := table.truncate(items); err != nil {
+	if items < atomic.LoadUint64(&f.tail) {
+		return errTruncateBelowTail
+	}
+	for name, table := range f.tables {
+		if err := truncateTable(name, table, items); err != nil {
 			return err
 		}
 	}
@@ -245,6 +306,30 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// PruneAncients discards the bodies and receipts of all the blocks below the
+// provided threshold number, retaining their hashes, headers and difficulties.
+// Pruning is resumed if a previous run was interrupted.
+func (f *freezer) PruneAncients(tail uint64) error {
+	if tail > atomic.LoadUint64(&f.tail) {
+		if frozen := atomic.LoadUint64(&f.frozen); tail > frozen {
+			return fmt.Errorf("pruning above the frozen items: tail %d, frozen %d", tail, frozen)
+		}
+		// Persist the new tail before deleting anything, hiding the pruned items
+		// even if the data files can't all be removed
+		if err := writeFreezerTail(f.datadir, tail); err != nil {
+			return err
+		}
+		atomic.StoreUint64(&f.tail, tail)
+	}
+	tail = atomic.LoadUint64(&f.tail)
+	for name := range freezerPrunable {
+		if err := f.tables[name].truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -362,9 +447,12 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 				log.Error("Total difficulty missing, can't freeze", "number", f.frozen, "hash", hash)
 				break
 			}
+			// Reverse state diffs are optional, only recorded if state history is enabled
+			diff := ReadStateDiffRLP(nfdb, hash, f.frozen)
+
 			log.Trace("Deep froze ancient block", "number", f.frozen, "hash", hash)
 			// Inject all the components into the relevant data tables
-			if err := f.AppendAncient(f.frozen, hash[:], header, body, receipts, td); err != nil {
+			if err := f.appendAncient(f.frozen, hash[:], header, body, receipts, td, diff); err != nil {
 				break
 			}
 			ancients = append(ancients, hash)
@@ -453,20 +541,74 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 	}
 }
 
-// repair truncates all data tables to the same length.
+// repair truncates all data tables to the same length. An empty state diff table
+// doesn't drag the others down, it's restarted at their length instead.
 func (f *freezer) repair() error {
 	min := uint64(math.MaxUint64)
-	for _, table := range f.tables {
+	for name, table := range f.tables {
 		items := atomic.LoadUint64(&table.items)
+		if name == freezerStateDiffTable && items == uint64(table.itemOffset) {
+			continue
+		}
 		if min > items {
 			min = items
 		}
 	}
-	for _, table := range f.tables {
-		if err := table.truncate(min); err != nil {
+	for name, table := range f.tables {
+		if err := truncateTable(name, table, min); err != nil {
 			return err
 		}
 	}
 	atomic.StoreUint64(&f.frozen, min)
 	return nil
 }
+
+// truncateTable discards any data above the provided threshold number from a
+// table. The state diff table is restarted at the threshold instead if it would
+// be left empty, since it doesn't necessarily hold data for the older blocks.
+func truncateTable(name string, table *freezerTable, items uint64) error {
+	if name == freezerStateDiffTable && (items < uint64(table.itemOffset) || atomic.LoadUint64(&table.items) == uint64(table.itemOffset)) {
+		return table.resetTail(items)
+	}
+	return table.truncate(items)
+}
+
+// readFreezerTail retrieves the history tail persisted in the freezer directory,
+// or zero if nothing was ever pruned.
+func readFreezerTail(datadir string) (uint64, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(datadir, freezerTailFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(blob) != 8 {
+		return 0, fmt.Errorf("invalid history tail file size: %d", len(blob))
+	}
+	return binary.BigEndian.Uint64(blob), nil
+}
+
+// writeFreezerTail atomically persists the history tail into the freezer directory.
+func writeFreezerTail(datadir string, tail uint64) error {
+	blob := make([]byte, 8)
+	binary.BigEndian.PutUint64(blob, tail)
+
+	path := filepath.Join(datadir, freezerTailFile)
+	file, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(blob); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,274 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// freezerCheckBatch is the number of index entries to load into memory at once
+// when verifying a freezer table index.
+const freezerCheckBatch = 16384
+
+// FreezerCheckResult is the outcome of a chain freezer integrity check.
+type FreezerCheckResult struct {
+	Items uint64 // Number of blocks stored in the freezer (shortest table)
+	Valid uint64 // Number of leading blocks that passed all the checks
+	Table string // Table containing the first bad item (empty if rejected by the verifier)
+	Err   error  // Reason the first bad item was rejected, nil if all items passed
+}
+
+// CheckFreezer verifies the integrity of the chain freezer in the given directory
+// without modifying it. Every index entry is checked to point into its data file,
+// every item is read back from its table and the items belonging to the same
+// block are handed to verify for content validation. The check stops at the first
+// bad item. The body and receipts of blocks whose history was pruned from the
+// freezer are handed to verify as nil.
+//
+// Note, the repair mechanism that is run when the freezer is opened normally only
+// reconciles the head of the index and data files, it doesn't detect corruption
+// within the tables.
+func CheckFreezer(datadir string, verify func(number uint64, hash, header, body, receipts, td []byte) error) (*FreezerCheckResult, error) {
+	// Prevent checking a freezer that's being written concurrently
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	// Open all the tables without touching the files on disk
+	tables := make(map[string]*freezerTable)
+	defer func() {
+		for _, table := range tables {
+			table.Close()
+		}
+	}()
+	for name, disableSnappy := range freezerNoSnappy {
+		// State diffs are optional and only recorded since some block, skip them
+		if name == freezerStateDiffTable {
+			continue
+		}
+		table, err := newReadonlyTable(datadir, name, disableSnappy)
+		if err != nil {
+			return nil, err
+		}
+		tables[name] = table
+	}
+	// Walk the indexes and find the first item which doesn't point into its data file
+	var (
+		result = &FreezerCheckResult{Items: ^uint64(0)}
+		tail   uint64
+	)
+	for name, table := range tables {
+		if table.items < result.Items {
+			result.Items = table.items
+		}
+		if !freezerPrunable[name] && uint64(table.itemOffset) > tail {
+			tail = uint64(table.itemOffset)
+		}
+		valid, err := table.verifyIndex()
+		if err != nil && (result.Err == nil || valid < result.Valid) {
+			result.Valid, result.Table, result.Err = valid, name, err
+		}
+	}
+	limit := result.Items
+	if result.Err != nil && result.Valid < limit {
+		limit = result.Valid
+	} else {
+		result.Table, result.Err = "", nil
+	}
+	// Read back all the items within the sound index range and validate them
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	result.Valid = limit
+	for number := tail; number < limit; number++ {
+		var blobs [5][]byte
+		for i, name := range []string{freezerHashTable, freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable} {
+			if freezerPrunable[name] && number < uint64(tables[name].itemOffset) {
+				continue // History pruned, nothing to check
+			}
+			if blobs[i], err = tables[name].Retrieve(number); err != nil {
+				result.Valid, result.Table, result.Err = number, name, err
+				return result, nil
+			}
+		}
+		if verify != nil {
+			if err := verify(number, blobs[0], blobs[1], blobs[2], blobs[3], blobs[4]); err != nil {
+				result.Valid, result.Err = number, err
+				return result, nil
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Checking ancient database", "checked", number, "total", limit, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return result, nil
+}
+
+// TruncateFreezer discards all the blocks above the given threshold from the chain
+// freezer in the given directory.
+func TruncateFreezer(datadir string, items uint64) error {
+	frdb, err := newFreezer(datadir, "")
+	if err != nil {
+		return err
+	}
+	defer frdb.Close()
+
+	if err := frdb.TruncateAncients(items); err != nil {
+		return err
+	}
+	return frdb.Sync()
+}
+
+// newReadonlyTable opens an existing freezer table for reading only. As opposed
+// to newTable, no repair is attempted, so the data and index files are left
+// untouched even if they are out of sync.
+func newReadonlyTable(path string, name string, noCompression bool) (*freezerTable, error) {
+	idxName := fmt.Sprintf("%s.cidx", name)
+	if noCompression {
+		idxName = fmt.Sprintf("%s.ridx", name)
+	}
+	offsets, err := openFreezerFileForReadOnly(filepath.Join(path, idxName))
+	if err != nil {
+		return nil, err
+	}
+	tab := &freezerTable{
+		index:         offsets,
+		files:         make(map[uint32]*os.File),
+		readMeter:     metrics.NilMeter{},
+		writeMeter:    metrics.NilMeter{},
+		sizeGauge:     metrics.NilGauge{},
+		name:          name,
+		path:          path,
+		logger:        log.New("database", path, "table", name),
+		noCompression: noCompression,
+	}
+	stat, err := offsets.Stat()
+	if err != nil {
+		tab.Close()
+		return nil, err
+	}
+	entries := stat.Size() / indexEntrySize
+	if entries == 0 {
+		tab.Close()
+		return nil, fmt.Errorf("table %s: empty index", name)
+	}
+	// Read the first and last index entries to determine the file range
+	var (
+		buffer      = make([]byte, indexEntrySize)
+		first, last indexEntry
+	)
+	if _, err := offsets.ReadAt(buffer, 0); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	first.unmarshalBinary(buffer)
+	if _, err := offsets.ReadAt(buffer, (entries-1)*indexEntrySize); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	last.unmarshalBinary(buffer)
+
+	tab.tailId, tab.itemOffset = first.filenum, first.offset
+	tab.headId, tab.headBytes = last.filenum, last.offset
+	tab.items = uint64(tab.itemOffset) + uint64(entries-1)
+
+	// Open whatever data files exist, missing ones will be reported by the index
+	// verification, which will also prevent reading from them
+	for i := tab.tailId; i <= tab.headId; i++ {
+		if _, err := tab.openFile(i, openFreezerFileForReadOnly); err != nil && !os.IsNotExist(err) {
+			tab.Close()
+			return nil, err
+		}
+	}
+	tab.head = tab.files[tab.headId]
+	return tab, nil
+}
+
+// verifyIndex checks that every entry in the index of the table points into its
+// data file. The number of items that passed the checks is returned, along with
+// the reason the first bad item was rejected, if any.
+func (t *freezerTable) verifyIndex() (uint64, error) {
+	// Gather the sizes of all the data files to check the offsets against
+	sizes := make(map[uint32]int64)
+	for num, file := range t.files {
+		stat, err := file.Stat()
+		if err != nil {
+			return uint64(t.itemOffset), err
+		}
+		sizes[num] = stat.Size()
+	}
+	if t.head == nil {
+		return uint64(t.itemOffset), errors.New("missing head data file")
+	}
+	// Iterate over the index entries in batches, skipping the first one which
+	// only carries the tail file and item offset
+	var (
+		buffer = make([]byte, freezerCheckBatch*indexEntrySize)
+		pos    = int64(indexEntrySize)
+		item   = uint64(t.itemOffset)
+
+		prevFile   = t.tailId
+		prevOffset = uint32(0)
+	)
+	for item < t.items {
+		n, err := t.index.ReadAt(buffer, pos)
+		if err != nil && err != io.EOF {
+			return item, err
+		}
+		if n < indexEntrySize {
+			return item, errors.New("index entry missing")
+		}
+		for i := 0; i+indexEntrySize <= n && item < t.items; i += indexEntrySize {
+			var entry indexEntry
+			entry.unmarshalBinary(buffer[i : i+indexEntrySize])
+
+			switch {
+			case entry.filenum == prevFile+1:
+				prevOffset = 0 // Item was moved to the next data file wholesale
+			case entry.filenum != prevFile:
+				return item, fmt.Errorf("index entry points to data file %d after %d", entry.filenum, prevFile)
+			case entry.offset < prevOffset:
+				return item, fmt.Errorf("index entry offset %d before previous offset %d", entry.offset, prevOffset)
+			}
+			size, ok := sizes[entry.filenum]
+			if !ok {
+				return item, fmt.Errorf("missing data file %d", entry.filenum)
+			}
+			if int64(entry.offset) > size {
+				return item, fmt.Errorf("index entry offset %d beyond data file %d size %d", entry.offset, entry.filenum, size)
+			}
+			prevFile, prevOffset = entry.filenum, entry.offset
+			item++
+		}
+		pos += int64(n - n%indexEntrySize)
+	}
+	return item, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newTestFreezer creates a chain freezer in a temporary directory with the given
+// number of items, where each item's hash is the hash of its header.
+func newTestFreezer(t *testing.T, items int) string {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	f, err := newFreezer(dir, "")
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	for i := 0; i < items; i++ {
+		header := []byte(fmt.Sprintf("header-%d", i))
+		if err := f.AppendAncient(uint64(i), crypto.Keccak256(header), header, []byte{byte(i)}, []byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close freezer: %v", err)
+	}
+	return dir
+}
+
+// verifyTestItem is a freezer item verifier checking the items created by the
+// test freezer.
+func verifyTestItem(number uint64, hash, header, body, receipts, td []byte) error {
+	if !bytes.Equal(crypto.Keccak256(header), hash) {
+		return errors.New("header hash mismatch")
+	}
+	return nil
+}
+
+// Tests that a sound freezer passes the integrity check.
+func TestFreezerCheck(t *testing.T) {
+	dir := newTestFreezer(t, 100)
+	defer os.RemoveAll(dir)
+
+	result, err := CheckFreezer(dir, verifyTestItem)
+	if err != nil {
+		t.Fatalf("failed to check freezer: %v", err)
+	}
+	if result.Items != 100 || result.Valid != 100 || result.Err != nil {
+		t.Fatalf("check result mismatch: have %+v, want 100 valid items", result)
+	}
+}
+
+// Tests that index entries pointing outside of the data file are detected and
+// that the check itself doesn't modify the freezer.
+func TestFreezerCheckCorruptIndex(t *testing.T) {
+	dir := newTestFreezer(t, 100)
+	defer os.RemoveAll(dir)
+
+	// Corrupt the index entry of item 42 in the bodies table
+	idx, err := os.OpenFile(filepath.Join(dir, "bodies.cidx"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("failed to open index: %v", err)
+	}
+	entry := indexEntry{filenum: 0, offset: 1 << 20}
+	if _, err := idx.WriteAt(entry.marshallBinary(), 43*indexEntrySize); err != nil {
+		t.Fatalf("failed to corrupt index: %v", err)
+	}
+	idx.Close()
+
+	stat, _ := os.Stat(filepath.Join(dir, "bodies.cidx"))
+	result, err := CheckFreezer(dir, verifyTestItem)
+	if err != nil {
+		t.Fatalf("failed to check freezer: %v", err)
+	}
+	if result.Valid != 42 || result.Table != freezerBodiesTable || result.Err == nil {
+		t.Fatalf("check result mismatch: have %+v, want item 42 of %s bad", result, freezerBodiesTable)
+	}
+	if after, _ := os.Stat(filepath.Join(dir, "bodies.cidx")); after.Size() != stat.Size() {
+		t.Fatalf("index modified by check: size %d -> %d", stat.Size(), after.Size())
+	}
+	// Truncate the freezer below the corruption and ensure it's sound again
+	if err := TruncateFreezer(dir, result.Valid); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	if result, err = CheckFreezer(dir, verifyTestItem); err != nil {
+		t.Fatalf("failed to check freezer: %v", err)
+	}
+	if result.Items != 42 || result.Valid != 42 || result.Err != nil {
+		t.Fatalf("check result mismatch after truncation: have %+v, want 42 valid items", result)
+	}
+}
+
+// Tests that corrupted data is detected by the verifier.
+func TestFreezerCheckCorruptData(t *testing.T) {
+	dir := newTestFreezer(t, 100)
+	defer os.RemoveAll(dir)
+
+	// Overwrite the raw hash of item 13, the header itself stays intact
+	data, err := os.OpenFile(filepath.Join(dir, "hashes.0000.rdat"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("failed to open data file: %v", err)
+	}
+	if _, err := data.WriteAt([]byte{0xff}, 13*32); err != nil {
+		t.Fatalf("failed to corrupt data: %v", err)
+	}
+	data.Close()
+
+	result, err := CheckFreezer(dir, verifyTestItem)
+	if err != nil {
+		t.Fatalf("failed to check freezer: %v", err)
+	}
+	if result.Valid != 13 || result.Table != "" || result.Err == nil {
+		t.Fatalf("check result mismatch: have %+v, want item 13 rejected by verifier", result)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// errReadonlyFreezer is returned if a remote client attempts to modify a chain
+// freezer that is served read-only.
+var errReadonlyFreezer = errors.New("freezer is served read-only")
+
+// remoteFreezerErrors are the freezer errors recognised by the remote client, so
+// that the same sentinels are reported as by a local freezer.
+var remoteFreezerErrors = []error{
+	errUnknownTable, errOutOrderInsertion, errTruncateBelowTail, ErrAncientPruned,
+	errOutOfBounds, errClosed, errReadonlyFreezer,
+}
+
+// freezerAncientPath is the HTTP path prefix under which the freezer server
+// serves raw ancient blobs, avoiding the overhead of hex encoding them in JSON.
+// Items are addressed as <prefix><kind>/<number>.
+const freezerAncientPath = "/ancient/"
+
+// IsRemoteFreezer reports whether the given ancient store location is the URL of
+// a remote freezer server instead of a local directory. Servers are reachable via
+// ipc:// or http(s):// endpoints.
+func IsRemoteFreezer(location string) bool {
+	u, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "ipc", "http", "https":
+		return true
+	}
+	return false
+}
+
+// remoteFreezer is an ancient store backed by a chain freezer in another process,
+// served by a FreezerServer. Ancient blobs are retrieved as raw bytes over HTTP,
+// everything else is accessed through the RPC API of the server. IPC endpoints
+// are spoken to over HTTP too, just on a unix socket.
+type remoteFreezer struct {
+	client   *rpc.Client  // RPC client for the freezer metadata and modifications
+	http     *http.Client // HTTP client for the raw ancient blob retrievals
+	endpoint string       // HTTP endpoint of the freezer server
+}
+
+// newRemoteFreezer connects to the remote freezer server at the given URL.
+func newRemoteFreezer(location string) (*remoteFreezer, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	f := &remoteFreezer{http: new(http.Client), endpoint: strings.TrimSuffix(location, "/")}
+	if u.Scheme == "ipc" {
+		path := u.Host + u.Path
+		f.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		}
+		// The host is irrelevant, all connections are made to the socket
+		f.endpoint = "http://freezer"
+	}
+	if f.client, err = rpc.DialHTTPWithClient(f.endpoint, f.http); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// call invokes the given method of the remote freezer, mapping the errors it
+// returns back to the freezer ones.
+func (f *remoteFreezer) call(result interface{}, method string, args ...interface{}) error {
+	err := f.client.Call(result, "freezer_"+method, args...)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(rpc.Error); ok {
+		for _, known := range remoteFreezerErrors {
+			if err.Error() == known.Error() {
+				return known
+			}
+		}
+	}
+	return err
+}
+
+// Close terminates the connection to the remote freezer.
+func (f *remoteFreezer) Close() error {
+	f.client.Close()
+	f.http.CloseIdleConnections()
+	return nil
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists
+// in the remote freezer.
+func (f *remoteFreezer) HasAncient(kind string, number uint64) (bool, error) {
+	var has bool
+	err := f.call(&has, "hasAncient", kind, number)
+	return has, err
+}
+
+// Ancient retrieves an ancient binary blob from the remote freezer.
+func (f *remoteFreezer) Ancient(kind string, number uint64) ([]byte, error) {
+	res, err := f.http.Get(f.endpoint + freezerAncientPath + url.PathEscape(kind) + "/" + strconv.FormatUint(number, 10))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	blob, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		// Failed retrievals carry the error message, map it back to the freezer one
+		msg := strings.TrimSpace(string(blob))
+		for _, known := range remoteFreezerErrors {
+			if msg == known.Error() {
+				return nil, known
+			}
+		}
+		return nil, fmt.Errorf("ancient retrieval failed: %s: %s", res.Status, msg)
+	}
+	return blob, nil
+}
+
+// Ancients returns the length of the frozen items.
+func (f *remoteFreezer) Ancients() (uint64, error) {
+	var items uint64
+	err := f.call(&items, "ancients")
+	return items, err
+}
+
+// AncientTail returns the number of the first block whose bodies and receipts
+// are retained in the remote freezer.
+func (f *remoteFreezer) AncientTail() (uint64, error) {
+	var tail uint64
+	err := f.call(&tail, "ancientTail")
+	return tail, err
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *remoteFreezer) AncientSize(kind string) (uint64, error) {
+	var size uint64
+	err := f.call(&size, "ancientSize", kind)
+	return size, err
+}
+
+// AppendAncient injects all binary blobs belong to block at the end of the
+// remote freezer.
+func (f *remoteFreezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	return f.call(nil, "appendAncient", number, hexutil.Bytes(hash), hexutil.Bytes(header), hexutil.Bytes(body), hexutil.Bytes(receipts), hexutil.Bytes(td))
+}
+
+// TruncateAncients discards any recent data above the provided threshold number.
+func (f *remoteFreezer) TruncateAncients(items uint64) error {
+	return f.call(nil, "truncateAncients", items)
+}
+
+// PruneAncients discards the bodies and receipts of all the blocks below the
+// provided threshold number.
+func (f *remoteFreezer) PruneAncients(tail uint64) error {
+	return f.call(nil, "pruneAncients", tail)
+}
+
+// Sync flushes all data tables of the remote freezer to disk.
+func (f *remoteFreezer) Sync() error {
+	return f.call(nil, "sync")
+}
+
+// FreezerServer exposes a chain freezer to remote clients over HTTP. Ancient
+// blobs are served raw, the rest of the freezer through the RPC API in the
+// "freezer" namespace. A read-only server can be shared by any number of nodes,
+// a writable one should only have a single client.
+type FreezerServer struct {
+	rpc     *rpc.Server
+	freezer *freezer
+}
+
+// NewFreezerServer opens the chain freezer in the given directory and creates
+// an HTTP handler exposing it. The server needs to be attached to a listener,
+// either a TCP or a unix socket one.
+func NewFreezerServer(datadir string, namespace string, readonly bool) (*FreezerServer, error) {
+	frdb, err := newFreezer(datadir, namespace)
+	if err != nil {
+		return nil, err
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("freezer", &freezerAPI{freezer: frdb, readonly: readonly}); err != nil {
+		frdb.Close()
+		return nil, err
+	}
+	return &FreezerServer{rpc: server, freezer: frdb}, nil
+}
+
+// ServeHTTP implements http.Handler, serving the raw ancient blobs and passing
+// any other request to the RPC server.
+func (s *FreezerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, freezerAncientPath) {
+		s.rpc.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, freezerAncientPath), "/")
+	if len(parts) != 2 {
+		http.Error(w, "invalid ancient path", http.StatusNotFound)
+		return
+	}
+	number, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid ancient number", http.StatusBadRequest)
+		return
+	}
+	blob, err := s.freezer.Ancient(parts[0], number)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(blob)
+}
+
+// Close stops serving requests and closes the chain freezer.
+func (s *FreezerServer) Close() error {
+	s.rpc.Stop()
+	return s.freezer.Close()
+}
+
+// freezerAPI is the RPC API of a chain freezer served to remote clients.
+type freezerAPI struct {
+	freezer  ethdb.AncientStore
+	readonly bool
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists.
+func (api *freezerAPI) HasAncient(kind string, number uint64) (bool, error) {
+	return api.freezer.HasAncient(kind, number)
+}
+
+// Ancients returns the length of the frozen items.
+func (api *freezerAPI) Ancients() (uint64, error) {
+	return api.freezer.Ancients()
+}
+
+// AncientTail returns the number of the first block whose bodies and receipts
+// are retained.
+func (api *freezerAPI) AncientTail() (uint64, error) {
+	return api.freezer.AncientTail()
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (api *freezerAPI) AncientSize(kind string) (uint64, error) {
+	return api.freezer.AncientSize(kind)
+}
+
+// AppendAncient injects all binary blobs belong to block at the end of the
+// freezer, unless it's served read-only.
+func (api *freezerAPI) AppendAncient(number uint64, hash, header, body, receipts, td hexutil.Bytes) error {
+	if api.readonly {
+		return errReadonlyFreezer
+	}
+	return api.freezer.AppendAncient(number, hash, header, body, receipts, td)
+}
+
+// TruncateAncients discards any recent data above the provided threshold number,
+// unless the freezer is served read-only.
+func (api *freezerAPI) TruncateAncients(items uint64) error {
+	if api.readonly {
+		return errReadonlyFreezer
+	}
+	return api.freezer.TruncateAncients(items)
+}
+
+// PruneAncients discards the bodies and receipts of all the blocks below the
+// provided threshold number, unless the freezer is served read-only.
+func (api *freezerAPI) PruneAncients(tail uint64) error {
+	if api.readonly {
+		return errReadonlyFreezer
+	}
+	return api.freezer.PruneAncients(tail)
+}
+
+// Sync flushes all data tables to disk, unless the freezer is served read-only.
+func (api *freezerAPI) Sync() error {
+	if api.readonly {
+		return errReadonlyFreezer
+	}
+	return api.freezer.Sync()
+}
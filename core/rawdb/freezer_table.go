@@ -23,6 +23,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -237,6 +238,10 @@ func (t *freezerTable) repair() error {
 
 	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 	lastIndex.unmarshalBinary(buffer)
+	if offsetsSize == indexEntrySize {
+		// The first index entry carries the item offset, not a data offset
+		lastIndex.offset = 0
+	}
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
 	if err != nil {
 		return err
@@ -268,6 +273,9 @@ func (t *freezerTable) repair() error {
 			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
+			if offsetsSize == indexEntrySize {
+				newLastIndex.offset = 0
+			}
 			// We might have slipped back into an earlier head-file here
 			if newLastIndex.filenum != lastIndex.filenum {
 				// Release earlier opened file
@@ -345,16 +353,26 @@ func (t *freezerTable) truncate(items uint64) error {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+
+	// Items below the tail are gone, the index can only be cut above it
+	if items < uint64(t.itemOffset) {
+		return fmt.Errorf("truncating below the table tail: limit %d, tail %d", items, t.itemOffset)
+	}
+	entries := items - uint64(t.itemOffset)
+	if err := truncateFreezerFile(t.index, int64(entries+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	if _, err := t.index.ReadAt(buffer, int64(entries*indexEntrySize)); err != nil {
 		return err
 	}
 	var expected indexEntry
 	expected.unmarshalBinary(buffer)
+	if entries == 0 {
+		// The first index entry carries the item offset, not a data offset
+		expected.offset = 0
+	}
 
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
@@ -388,6 +406,175 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards the data files holding only items below the provided
+// threshold number and rewrites the index to start at the first retained file.
+// Since deletion is done by files, items below the threshold sharing a data file
+// with retained ones are kept, hiding them is up to the caller.
+func (t *freezerTable) truncateTail(tail uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table is still accessible and there's something to delete
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if tail <= uint64(t.itemOffset) {
+		return nil
+	}
+	items := atomic.LoadUint64(&t.items)
+	if tail > items {
+		tail = items
+	}
+	// Find the data file holding the new tail item, or the head if all go
+	buffer := make([]byte, indexEntrySize)
+	newTailId := t.headId
+	if tail < items {
+		if _, err := t.index.ReadAt(buffer, int64(tail-uint64(t.itemOffset)+1)*indexEntrySize); err != nil {
+			return err
+		}
+		var entry indexEntry
+		entry.unmarshalBinary(buffer)
+		newTailId = entry.filenum
+	}
+	if newTailId == t.tailId {
+		return nil
+	}
+	// Find the first item stored in the new tail file, as the index entries are
+	// ordered by file, a binary search will do
+	var (
+		entries = int(items - uint64(t.itemOffset))
+		readErr error
+	)
+	first := sort.Search(entries, func(i int) bool {
+		if _, err := t.index.ReadAt(buffer, int64(i+1)*indexEntrySize); err != nil {
+			readErr = err
+			return true
+		}
+		var entry indexEntry
+		entry.unmarshalBinary(buffer)
+		return entry.filenum >= newTailId
+	})
+	if readErr != nil {
+		return readErr
+	}
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	newItemOffset := t.itemOffset + uint32(first)
+	t.logger.Info("Truncating freezer table tail", "items", items, "tail", newItemOffset, "files", newTailId-t.tailId)
+
+	// Write the new index into a temporary file and atomically replace the old
+	// one, so that a crash can't leave it pointing into deleted data files
+	name := t.index.Name()
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	index, err := openFreezerFileTruncated(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	head := indexEntry{filenum: newTailId, offset: newItemOffset}
+	if _, err := index.Write(head.marshallBinary()); err != nil {
+		index.Close()
+		return err
+	}
+	offset := int64(first+1) * indexEntrySize
+	if _, err := io.Copy(index, io.NewSectionReader(t.index, offset, stat.Size()-offset)); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Sync(); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	t.index.Close()
+	if t.index, err = openFreezerFileForAppend(name); err != nil {
+		return err
+	}
+	// The index is swapped out, delete the data files no longer referenced
+	for num := t.tailId; num < newTailId; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(filepath.Join(t.path, t.fileName(num))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	t.tailId = newTailId
+	t.itemOffset = newItemOffset
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+
+	return nil
+}
+
+// resetTail discards all the items of the table and restarts it empty at the
+// provided item number. It's meant for tables which don't hold data for the
+// entire chain, but only from some point onward.
+func (t *freezerTable) resetTail(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table is still accessible and there's something to reset
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) == items && uint64(t.itemOffset) == items {
+		return nil
+	}
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.logger.Info("Resetting freezer table", "items", t.items, "tail", t.itemOffset, "start", items)
+
+	// Cut the index to a single entry carrying the new item offset first, so a
+	// crash can't leave it pointing into deleted data files
+	if err := truncateFreezerFile(t.index, 0); err != nil {
+		return err
+	}
+	head := indexEntry{filenum: 0, offset: uint32(items)}
+	if _, err := t.index.Write(head.marshallBinary()); err != nil {
+		return err
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	for num := t.tailId; num <= t.headId; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(filepath.Join(t.path, t.fileName(num))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if t.head, err = t.openFile(0, openFreezerFileTruncated); err != nil {
+		return err
+	}
+	t.tailId, t.itemOffset = 0, uint32(items)
+	atomic.StoreUint32(&t.headId, 0)
+	atomic.StoreUint32(&t.headBytes, 0)
+	atomic.StoreUint64(&t.items, items)
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+
+	return nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -416,13 +603,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(filepath.Join(t.path, t.fileName(num)))
 		if err != nil {
 			return nil, err
 		}
@@ -431,6 +612,14 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the name of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -600,7 +789,10 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return atomic.LoadUint64(&t.items) > number && uint64(t.itemOffset) <= number
 }
 
 // size returns the total data size in the freezer table.
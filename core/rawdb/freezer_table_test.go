@@ -640,3 +640,78 @@ func TestOffset(t *testing.T) {
 // However, all 'normal' failure modes arising due to failing to sync() or save a file should be
 // handled already, and the case described above can only (?) happen if an external process/user
 // deletes files from the filesystem.
+
+// TestFreezerTruncateTail tests that deleting items from the tail removes whole
+// data files only and that the new tail survives a reopen.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncatetail-%d", rand.Uint64())
+
+	{ // Fill table, 3 items per file
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 30; x++ {
+			f.Append(uint64(x), getChunk(15, x))
+		}
+		// Item 10 lives in the 4th file, only the first 3 can go
+		if err := f.truncateTail(10); err != nil {
+			t.Fatal(err)
+		}
+		if f.tailId != 3 || f.itemOffset != 9 {
+			t.Fatalf("tail mismatch: have file %d offset %d, want file 3 offset 9", f.tailId, f.itemOffset)
+		}
+		f.Close()
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.%04d.rdat", fname, i))); !os.IsNotExist(err) {
+			t.Fatalf("data file %d not deleted: %v", i, err)
+		}
+	}
+	// Reopen and check that the retained items are intact
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.items != 30 || f.itemOffset != 9 {
+		t.Fatalf("table mismatch: have %d items, offset %d, want 30 items, offset 9", f.items, f.itemOffset)
+	}
+	if _, err := f.Retrieve(8); err != errOutOfBounds {
+		t.Fatalf("deleted item retrieved: %v", err)
+	}
+	if f.has(8) {
+		t.Fatalf("deleted item reported present")
+	}
+	for y := 9; y < 30; y++ {
+		got, err := f.Retrieve(uint64(y))
+		if err != nil {
+			t.Fatalf("item %d: %v", y, err)
+		}
+		if !bytes.Equal(got, getChunk(15, y)) {
+			t.Fatalf("item %d mismatch: have %x, want %x", y, got, getChunk(15, y))
+		}
+	}
+	// Truncating the head must respect the tail
+	if err := f.truncate(8); err == nil {
+		t.Fatalf("truncated below the tail")
+	}
+	if err := f.truncate(9); err != nil {
+		t.Fatal(err)
+	}
+	if f.items != 9 || f.headBytes != 0 {
+		t.Fatalf("truncated table mismatch: have %d items, %d head bytes, want 9 items, 0 head bytes", f.items, f.headBytes)
+	}
+	// Appending continues after the tail
+	for x := 9; x < 12; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := f.Retrieve(11); err != nil || !bytes.Equal(got, getChunk(15, 11)) {
+		t.Fatalf("appended item mismatch: have %x, %v", got, err)
+	}
+}
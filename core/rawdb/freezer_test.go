@@ -0,0 +1,393 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// testAncientStores are the constructors of the ancient stores the freezer tests
+// are run against, opening the chain freezer in the given directory.
+var testAncientStores = map[string]func(t *testing.T, dir string) ethdb.AncientStore{
+	"local": openLocalFreezer,
+	"ipc":   openIPCFreezer,
+	"http":  openHTTPFreezer,
+}
+
+// openLocalFreezer opens the chain freezer in the given directory.
+func openLocalFreezer(t *testing.T, dir string) ethdb.AncientStore {
+	f, err := newFreezer(dir, "")
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	return f
+}
+
+// testRemoteFreezer is a remote freezer client which also shuts its server down
+// when closed.
+type testRemoteFreezer struct {
+	*remoteFreezer
+	server *FreezerServer
+	stop   func()
+}
+
+func (f *testRemoteFreezer) Close() error {
+	f.remoteFreezer.Close()
+	f.stop()
+	return f.server.Close()
+}
+
+// openIPCFreezer serves the chain freezer in the given directory over IPC and
+// connects to it.
+func openIPCFreezer(t *testing.T, dir string) ethdb.AncientStore {
+	server, err := NewFreezerServer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer server: %v", err)
+	}
+	endpoint := filepath.Join(dir, "freezer.ipc")
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", endpoint, err)
+	}
+	go http.Serve(listener, server)
+
+	client, err := newRemoteFreezer("ipc://" + endpoint)
+	if err != nil {
+		t.Fatalf("failed to connect to freezer server: %v", err)
+	}
+	return &testRemoteFreezer{remoteFreezer: client, server: server, stop: func() { listener.Close() }}
+}
+
+// openHTTPFreezer serves the chain freezer in the given directory over HTTP and
+// connects to it.
+func openHTTPFreezer(t *testing.T, dir string) ethdb.AncientStore {
+	server, err := NewFreezerServer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer server: %v", err)
+	}
+	httpsrv := httptest.NewServer(server)
+
+	client, err := newRemoteFreezer(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to freezer server: %v", err)
+	}
+	return &testRemoteFreezer{remoteFreezer: client, server: server, stop: httpsrv.Close}
+}
+
+// Tests that the blobs appended to the freezer can be retrieved and that out of
+// order appends are rejected.
+func TestFreezerAppendRetrieve(t *testing.T) {
+	for name, open := range testAncientStores {
+		t.Run(name, func(t *testing.T) { testFreezerAppendRetrieve(t, open) })
+	}
+}
+
+func testFreezerAppendRetrieve(t *testing.T, open func(*testing.T, string) ethdb.AncientStore) {
+	dir := newTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	f := open(t, dir)
+	defer f.Close()
+
+	if frozen, err := f.Ancients(); err != nil || frozen != 10 {
+		t.Fatalf("frozen items mismatch: have %d, %v, want 10", frozen, err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		for _, kind := range []string{freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable} {
+			if blob, err := f.Ancient(kind, i); err != nil || !bytes.Equal(blob, []byte{byte(i)}) {
+				t.Fatalf("%s #%d mismatch: have %x, %v, want %x", kind, i, blob, err, []byte{byte(i)})
+			}
+		}
+		if has, err := f.HasAncient(freezerHeaderTable, i); err != nil || !has {
+			t.Fatalf("header #%d reported missing: %v", i, err)
+		}
+	}
+	if _, err := f.Ancient(freezerHeaderTable, 10); err != errOutOfBounds {
+		t.Fatalf("out of bounds error mismatch: have %v, want %v", err, errOutOfBounds)
+	}
+	if has, _ := f.HasAncient(freezerHeaderTable, 10); has {
+		t.Fatalf("missing item reported present")
+	}
+	if _, err := f.Ancient("unknown", 0); err != errUnknownTable {
+		t.Fatalf("unknown table error mismatch: have %v, want %v", err, errUnknownTable)
+	}
+	if size, err := f.AncientSize(freezerHeaderTable); err != nil || size == 0 {
+		t.Fatalf("table size mismatch: have %d, %v", size, err)
+	}
+	blob := []byte{0xff}
+	if err := f.AppendAncient(5, blob, blob, blob, blob, blob); err != errOutOrderInsertion {
+		t.Fatalf("out of order append error mismatch: have %v, want %v", err, errOutOrderInsertion)
+	}
+	if err := f.AppendAncient(10, blob, blob, blob, blob, blob); err != nil {
+		t.Fatalf("failed to append item: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("failed to sync freezer: %v", err)
+	}
+	if got, err := f.Ancient(freezerBodiesTable, 10); err != nil || !bytes.Equal(got, blob) {
+		t.Fatalf("appended item mismatch: have %x, %v, want %x", got, err, blob)
+	}
+}
+
+// Tests that truncating the freezer discards the items above the limit and that
+// new items can be appended afterwards.
+func TestFreezerTruncateAncients(t *testing.T) {
+	for name, open := range testAncientStores {
+		t.Run(name, func(t *testing.T) { testFreezerTruncateAncients(t, open) })
+	}
+}
+
+func testFreezerTruncateAncients(t *testing.T, open func(*testing.T, string) ethdb.AncientStore) {
+	dir := newTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	f := open(t, dir)
+	defer f.Close()
+
+	if err := f.TruncateAncients(20); err != nil {
+		t.Fatalf("failed to noop truncate freezer: %v", err)
+	}
+	if err := f.TruncateAncients(5); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	if frozen, _ := f.Ancients(); frozen != 5 {
+		t.Fatalf("frozen items mismatch: have %d, want 5", frozen)
+	}
+	if _, err := f.Ancient(freezerBodiesTable, 5); err != errOutOfBounds {
+		t.Fatalf("truncated item error mismatch: have %v, want %v", err, errOutOfBounds)
+	}
+	blob := []byte{0xff}
+	if err := f.AppendAncient(5, blob, blob, blob, blob, blob); err != nil {
+		t.Fatalf("failed to append item: %v", err)
+	}
+	if got, err := f.Ancient(freezerBodiesTable, 5); err != nil || !bytes.Equal(got, blob) {
+		t.Fatalf("appended item mismatch: have %x, %v, want %x", got, err, blob)
+	}
+}
+
+// Tests that pruning the freezer history hides the bodies and receipts below the
+// tail, retains everything else and persists across restarts.
+func TestFreezerPruneAncients(t *testing.T) {
+	for name, open := range testAncientStores {
+		t.Run(name, func(t *testing.T) { testFreezerPruneAncients(t, open) })
+	}
+}
+
+func testFreezerPruneAncients(t *testing.T, open func(*testing.T, string) ethdb.AncientStore) {
+	dir := newTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	f := open(t, dir)
+	if err := f.PruneAncients(11); err == nil {
+		t.Fatalf("pruned above the frozen items")
+	}
+	if err := f.PruneAncients(4); err != nil {
+		t.Fatalf("failed to prune freezer: %v", err)
+	}
+	f.Close()
+
+	f = open(t, dir)
+	defer f.Close()
+
+	if tail, _ := f.AncientTail(); tail != 4 {
+		t.Fatalf("tail mismatch: have %d, want 4", tail)
+	}
+	for _, kind := range []string{freezerBodiesTable, freezerReceiptTable} {
+		if _, err := f.Ancient(kind, 3); err != ErrAncientPruned {
+			t.Errorf("%s: pruned item error mismatch: have %v, want %v", kind, err, ErrAncientPruned)
+		}
+		if has, _ := f.HasAncient(kind, 3); has {
+			t.Errorf("%s: pruned item reported present", kind)
+		}
+		if blob, err := f.Ancient(kind, 4); err != nil || len(blob) != 1 || blob[0] != 4 {
+			t.Errorf("%s: retained item mismatch: have %x, %v", kind, blob, err)
+		}
+	}
+	for _, kind := range []string{freezerHashTable, freezerHeaderTable, freezerDifficultyTable} {
+		if _, err := f.Ancient(kind, 0); err != nil {
+			t.Errorf("%s: retained item missing: %v", kind, err)
+		}
+	}
+	if err := f.TruncateAncients(3); err != errTruncateBelowTail {
+		t.Fatalf("truncation error mismatch: have %v, want %v", err, errTruncateBelowTail)
+	}
+	if err := f.TruncateAncients(6); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+}
+
+// Tests that the state diff table of a freezer predating it starts at the frozen
+// items instead of truncating the chain, and that it can be truncated below that.
+func TestFreezerStateDiffs(t *testing.T) {
+	dir := newTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	// Drop the state diff table to simulate a freezer created before it existed
+	files, _ := filepath.Glob(filepath.Join(dir, freezerStateDiffTable+".*"))
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			t.Fatalf("failed to remove %s: %v", file, err)
+		}
+	}
+	f, err := newFreezer(dir, "")
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	if frozen, _ := f.Ancients(); frozen != 10 {
+		t.Fatalf("frozen items mismatch: have %d, want 10", frozen)
+	}
+	if has, _ := f.HasAncient(freezerStateDiffTable, 9); has {
+		t.Fatalf("state diff reported present before the table existed")
+	}
+	f.Close()
+
+	// Reopen the freezer with the empty state diff table and extend it
+	if f, err = newFreezer(dir, ""); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	if frozen, _ := f.Ancients(); frozen != 10 {
+		t.Fatalf("frozen items mismatch after reopen: have %d, want 10", frozen)
+	}
+	blob := []byte{0xff}
+	if err := f.appendAncient(10, blob, blob, blob, blob, blob, []byte("diff")); err != nil {
+		t.Fatalf("failed to append item: %v", err)
+	}
+	f.Close()
+
+	// Reopen the freezer and ensure the state diff table persisted its start
+	if f, err = newFreezer(dir, ""); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+
+	if frozen, _ := f.Ancients(); frozen != 11 {
+		t.Fatalf("frozen items mismatch: have %d, want 11", frozen)
+	}
+	if diff, err := f.Ancient(freezerStateDiffTable, 10); err != nil || string(diff) != "diff" {
+		t.Fatalf("state diff mismatch: have %q, %v, want %q", diff, err, "diff")
+	}
+	if _, err := f.Ancient(freezerStateDiffTable, 9); err != errOutOfBounds {
+		t.Fatalf("missing state diff error mismatch: have %v, want %v", err, errOutOfBounds)
+	}
+	// Truncate below the start of the state diff table and append anew
+	if err := f.TruncateAncients(5); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	if err := f.appendAncient(5, blob, blob, blob, blob, blob, []byte("rediff")); err != nil {
+		t.Fatalf("failed to append item: %v", err)
+	}
+	if diff, err := f.Ancient(freezerStateDiffTable, 5); err != nil || string(diff) != "rediff" {
+		t.Fatalf("state diff mismatch: have %q, %v, want %q", diff, err, "rediff")
+	}
+	if has, _ := f.HasAncient(freezerStateDiffTable, 4); has {
+		t.Fatalf("state diff reported present below the table start")
+	}
+}
+
+// Tests that a read-only freezer server rejects modifications but serves reads.
+func TestRemoteFreezerReadonly(t *testing.T) {
+	dir := newTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	server, err := NewFreezerServer(dir, "", true)
+	if err != nil {
+		t.Fatalf("failed to create freezer server: %v", err)
+	}
+	defer server.Close()
+
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	if !IsRemoteFreezer(httpsrv.URL) {
+		t.Fatalf("server URL %s not recognised as remote", httpsrv.URL)
+	}
+	f, err := newRemoteFreezer(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to freezer server: %v", err)
+	}
+	defer f.Close()
+
+	if blob, err := f.Ancient(freezerBodiesTable, 9); err != nil || !bytes.Equal(blob, []byte{9}) {
+		t.Fatalf("item mismatch: have %x, %v, want 09", blob, err)
+	}
+	blob := []byte{0xff}
+	if err := f.AppendAncient(10, blob, blob, blob, blob, blob); err != errReadonlyFreezer {
+		t.Fatalf("append error mismatch: have %v, want %v", err, errReadonlyFreezer)
+	}
+	if err := f.TruncateAncients(5); err != errReadonlyFreezer {
+		t.Fatalf("truncation error mismatch: have %v, want %v", err, errReadonlyFreezer)
+	}
+	if err := f.PruneAncients(5); err != errReadonlyFreezer {
+		t.Fatalf("prune error mismatch: have %v, want %v", err, errReadonlyFreezer)
+	}
+	if frozen, _ := f.Ancients(); frozen != 10 {
+		t.Fatalf("frozen items mismatch: have %d, want 10", frozen)
+	}
+}
+
+// Tests that ancient blobs are served as raw bytes instead of through the RPC API,
+// and that failed retrievals are mapped back to the freezer errors.
+func TestRemoteFreezerRawAncient(t *testing.T) {
+	dir := newTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	server, err := NewFreezerServer(dir, "", true)
+	if err != nil {
+		t.Fatalf("failed to create freezer server: %v", err)
+	}
+	defer server.Close()
+
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	res, err := http.Get(httpsrv.URL + freezerAncientPath + freezerBodiesTable + "/9")
+	if err != nil {
+		t.Fatalf("failed to retrieve raw item: %v", err)
+	}
+	blob, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !bytes.Equal(blob, []byte{9}) {
+		t.Fatalf("raw item mismatch: have %s %x, want 200 09", res.Status, blob)
+	}
+	if ctype := res.Header.Get("Content-Type"); ctype != "application/octet-stream" {
+		t.Fatalf("content type mismatch: have %s, want application/octet-stream", ctype)
+	}
+	f, err := newRemoteFreezer(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to freezer server: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.call(nil, "ancient", freezerBodiesTable, 9); err == nil {
+		t.Fatalf("ancient blob served through the RPC API")
+	}
+	if _, err := f.Ancient(freezerBodiesTable, 10); err != errOutOfBounds {
+		t.Fatalf("out of bounds error mismatch: have %v, want %v", err, errOutOfBounds)
+	}
+	if _, err := f.Ancient("unknown", 0); err != errUnknownTable {
+		t.Fatalf("unknown table error mismatch: have %v, want %v", err, errUnknownTable)
+	}
+}
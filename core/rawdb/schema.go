@@ -30,6 +30,9 @@ var (
 	// databaseVerisionKey tracks the current database version.
 	databaseVerisionKey = []byte("DatabaseVersion")
 
+	// databaseEngineKey tracks the key-value engine the database was created with.
+	databaseEngineKey = []byte("DatabaseEngine")
+
 	// headHeaderKey tracks the latest known header's hash.
 	headHeaderKey = []byte("LastHeader")
 
@@ -57,12 +60,18 @@ var (
 	// snapshotRecoveryKey tracks the snapshot recovery marker across restarts.
 	snapshotRecoveryKey = []byte("SnapshotRecovery")
 
+	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
+	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	// stateHistoryTailKey tracks the oldest block whose state can be rolled back to.
+	stateHistoryTailKey = []byte("StateHistoryTail")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -71,6 +80,9 @@ var (
 
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
+	stateDiffPrefix     = []byte("d") // stateDiffPrefix + num (uint64 big endian) + hash -> reverse state diff
+	accountChangePrefix = []byte("x") // accountChangePrefix + account hash + num (uint64 big endian) -> nil
+	storageChangePrefix = []byte("X") // storageChangePrefix + account hash + storage hash + num (uint64 big endian) -> nil
 
 	txLookupPrefix        = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix       = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
@@ -103,6 +115,10 @@ const (
 
 	// freezerDifficultyTable indicates the name of the freezer total difficulty table.
 	freezerDifficultyTable = "diffs"
+
+	// freezerStateDiffTable indicates the name of the freezer reverse state diff
+	// table. Contrary to the others, it only holds data since it was introduced.
+	freezerStateDiffTable = "statediffs"
 )
 
 // freezerNoSnappy configures whether compression is disabled for the ancient-tables.
@@ -113,6 +129,14 @@ var freezerNoSnappy = map[string]bool{
 	freezerBodiesTable:     false,
 	freezerReceiptTable:    false,
 	freezerDifficultyTable: true,
+	freezerStateDiffTable:  false,
+}
+
+// freezerPrunable configures which ancient-tables may be discarded below the
+// history tail. Headers, hashes and difficulties are always retained.
+var freezerPrunable = map[string]bool{
+	freezerBodiesTable:  true,
+	freezerReceiptTable: true,
 }
 
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
@@ -165,6 +189,21 @@ func blockReceiptsKey(number uint64, hash common.Hash) []byte {
 	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// stateDiffKey = stateDiffPrefix + num (uint64 big endian) + hash
+func stateDiffKey(number uint64, hash common.Hash) []byte {
+	return append(append(stateDiffPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// accountChangeKey = accountChangePrefix + account hash + num (uint64 big endian)
+func accountChangeKey(account common.Hash, number uint64) []byte {
+	return append(append(accountChangePrefix, account.Bytes()...), encodeBlockNumber(number)...)
+}
+
+// storageChangeKey = storageChangePrefix + account hash + storage hash + num (uint64 big endian)
+func storageChangeKey(account common.Hash, slot common.Hash, number uint64) []byte {
+	return append(append(append(storageChangePrefix, account.Bytes()...), slot.Bytes()...), encodeBlockNumber(number)...)
+}
+
 // txLookupKey = txLookupPrefix + hash
 func txLookupKey(hash common.Hash) []byte {
 	return append(txLookupPrefix, hash.Bytes()...)
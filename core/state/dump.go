@@ -17,11 +17,13 @@
 package state
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
@@ -111,10 +113,25 @@ func (d iterativeDump) OnRoot(root common.Hash) {
 	}{root})
 }
 
+// DumpToCollector iterates the accounts of the state starting at the given
+// (hashed) key, feeding them into the collector. If the state snapshot is
+// available, the accounts are read straight from it instead of the trie.
 func (s *StateDB) DumpToCollector(c DumpCollector, excludeCode, excludeStorage, excludeMissingPreimages bool, start []byte, maxResults int) (nextKey []byte) {
-	missingPreimages := 0
 	c.OnRoot(s.trie.Hash())
 
+	if s.snap != nil {
+		var seek common.Hash
+		copy(seek[:], start)
+
+		it, err := s.snaps.AccountIterator(s.snap.Root(), seek)
+		if err == nil {
+			defer it.Release()
+			return s.dumpSnapshot(c, it, excludeCode, excludeStorage, excludeMissingPreimages, maxResults)
+		}
+		log.Debug("State snapshot unavailable for dumping, iterating the trie", "err", err)
+	}
+	missingPreimages := 0
+
 	var count int
 	it := trie.NewIterator(s.trie.NodeIterator(start))
 	for it.Next() {
@@ -170,6 +187,76 @@ func (s *StateDB) DumpToCollector(c DumpCollector, excludeCode, excludeStorage,
 	return nextKey
 }
 
+// dumpSnapshot is the counterpart of the trie iteration of DumpToCollector,
+// reading the accounts and their storage slots straight from the snapshot.
+func (s *StateDB) dumpSnapshot(c DumpCollector, it snapshot.AccountIterator, excludeCode, excludeStorage, excludeMissingPreimages bool, maxResults int) (nextKey []byte) {
+	var (
+		missingPreimages int
+		count            int
+	)
+	for it.Next() {
+		data, err := snapshot.FullAccount(it.Account())
+		if err != nil {
+			panic(err)
+		}
+		account := DumpAccount{
+			Balance:  data.Balance.String(),
+			Nonce:    data.Nonce,
+			Root:     common.Bytes2Hex(data.Root),
+			CodeHash: common.Bytes2Hex(data.CodeHash),
+		}
+		hash := it.Hash()
+		addrBytes := s.trie.GetKey(hash[:])
+		if addrBytes == nil {
+			// Preimage missing
+			missingPreimages++
+			if excludeMissingPreimages {
+				continue
+			}
+			account.SecureKey = common.CopyBytes(hash[:])
+		}
+		if !excludeCode && !bytes.Equal(data.CodeHash, emptyCodeHash) {
+			code, err := s.db.ContractCode(hash, common.BytesToHash(data.CodeHash))
+			if err != nil {
+				log.Error("Failed to retrieve contract code", "hash", common.BytesToHash(data.CodeHash), "error", err)
+			}
+			account.Code = common.Bytes2Hex(code)
+		}
+		if !excludeStorage {
+			account.Storage = make(map[common.Hash]string)
+			storageIt, err := s.snaps.StorageIterator(s.snap.Root(), hash, common.Hash{})
+			if err != nil {
+				log.Error("Failed to iterate storage snapshot", "account", hash, "error", err)
+			} else {
+				for storageIt.Next() {
+					_, content, _, err := rlp.Split(storageIt.Slot())
+					if err != nil {
+						log.Error("Failed to decode the value returned by iterator", "error", err)
+						continue
+					}
+					account.Storage[common.BytesToHash(s.trie.GetKey(storageIt.Hash().Bytes()))] = common.Bytes2Hex(content)
+				}
+				storageIt.Release()
+			}
+		}
+		c.OnAccount(common.BytesToAddress(addrBytes), account)
+		count++
+		if maxResults > 0 && count >= maxResults {
+			if it.Next() {
+				nextKey = common.CopyBytes(it.Hash().Bytes())
+			}
+			break
+		}
+	}
+	if err := it.Error(); err != nil {
+		log.Error("Failed to iterate account snapshot", "error", err)
+	}
+	if missingPreimages > 0 {
+		log.Warn("Dump incomplete due to missing preimages", "missing", missingPreimages)
+	}
+	return nextKey
+}
+
 // RawDump returns the entire state an a single large object
 func (s *StateDB) RawDump(excludeCode, excludeStorage, excludeMissingPreimages bool) Dump {
 	dump := &Dump{
@@ -0,0 +1,470 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// stateDiffCacheSize is the number of decoded reverse state diffs to keep in
+// memory for serving historical state.
+const stateDiffCacheSize = 1024
+
+var (
+	// ErrStateHistoryUnavailable is returned if historical state is requested
+	// across a block whose reverse state diff was not recorded.
+	ErrStateHistoryUnavailable = errors.New("state history unavailable")
+
+	// errHistoryUnsupported is returned if a historical state view is attempted to
+	// be committed, iterated or proven, as it has no trie nodes.
+	errHistoryUnsupported = errors.New("not supported on historical state")
+)
+
+// StateDiff is the reverse diff of the state changes made by a block, holding the
+// values all the modified accounts and storage slots had before the block. The
+// entries are sorted by hash to allow binary searching them.
+type StateDiff struct {
+	Accounts []DiffAccount
+	Storage  []DiffStorage
+}
+
+// DiffAccount is the original value of an account modified by a block in the slim
+// snapshot format, empty if the account didn't exist.
+type DiffAccount struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// DiffStorage is the original values of the storage slots of an account modified
+// by a block, with a value being empty if the slot didn't exist.
+type DiffStorage struct {
+	Account common.Hash
+	Hashes  []common.Hash
+	Values  [][]byte
+}
+
+// account retrieves the original value of an account, if modified by the block.
+func (d *StateDiff) account(hash common.Hash) ([]byte, bool) {
+	i := sort.Search(len(d.Accounts), func(i int) bool {
+		return bytes.Compare(d.Accounts[i].Hash[:], hash[:]) >= 0
+	})
+	if i < len(d.Accounts) && d.Accounts[i].Hash == hash {
+		return d.Accounts[i].Blob, true
+	}
+	return nil, false
+}
+
+// storage retrieves the original value of a storage slot, if modified by the block.
+func (d *StateDiff) storage(account common.Hash, slot common.Hash) ([]byte, bool) {
+	i := sort.Search(len(d.Storage), func(i int) bool {
+		return bytes.Compare(d.Storage[i].Account[:], account[:]) >= 0
+	})
+	if i == len(d.Storage) || d.Storage[i].Account != account {
+		return nil, false
+	}
+	hashes := d.Storage[i].Hashes
+	j := sort.Search(len(hashes), func(j int) bool {
+		return bytes.Compare(hashes[j][:], slot[:]) >= 0
+	})
+	if j < len(hashes) && hashes[j] == slot {
+		return d.Storage[i].Values[j], true
+	}
+	return nil, false
+}
+
+// RecordReverseDiff instructs the next Commit to collect the original values of
+// all the accounts and storage slots it modifies, retrievable afterwards through
+// ReverseDiff. Recording requires the snapshot of the state being modified.
+func (s *StateDB) RecordReverseDiff() {
+	s.recordDiff = true
+}
+
+// ReverseDiff returns the reverse state diff collected by the last Commit, or nil
+// if none was recorded.
+func (s *StateDB) ReverseDiff() *StateDiff {
+	return s.diff
+}
+
+// reverseDiff collects the original values of all the modified accounts and
+// storage slots from the snapshot of the state. It needs to be called before the
+// changes are pushed into the snapshot tree.
+func (s *StateDB) reverseDiff() (*StateDiff, error) {
+	var (
+		diff     = new(StateDiff)
+		accounts = make(map[common.Hash]struct{})
+		storage  = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	for hash := range s.snapDestructs {
+		accounts[hash] = struct{}{}
+	}
+	for hash := range s.snapAccounts {
+		accounts[hash] = struct{}{}
+	}
+	for hash := range accounts {
+		blob, err := s.snap.AccountRLP(hash)
+		if err != nil {
+			return nil, err
+		}
+		diff.Accounts = append(diff.Accounts, DiffAccount{Hash: hash, Blob: blob})
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Hash[:], diff.Accounts[j].Hash[:]) < 0
+	})
+	// Destructed accounts lose all their storage, so every slot is recorded
+	for hash := range s.snapDestructs {
+		it, err := s.snaps.StorageIterator(s.snap.Root(), hash, common.Hash{})
+		if err != nil {
+			return nil, err
+		}
+		slots := make(map[common.Hash][]byte)
+		for it.Next() {
+			slots[it.Hash()] = common.CopyBytes(it.Slot())
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return nil, err
+		}
+		storage[hash] = slots
+	}
+	for hash, changes := range s.snapStorage {
+		slots := storage[hash]
+		if slots == nil {
+			slots = make(map[common.Hash][]byte)
+			storage[hash] = slots
+		}
+		for slot := range changes {
+			if _, ok := slots[slot]; ok {
+				continue
+			}
+			blob, err := s.snap.Storage(hash, slot)
+			if err != nil {
+				return nil, err
+			}
+			slots[slot] = blob
+		}
+	}
+	for hash, slots := range storage {
+		if len(slots) == 0 {
+			continue
+		}
+		entry := DiffStorage{Account: hash}
+		for slot := range slots {
+			entry.Hashes = append(entry.Hashes, slot)
+		}
+		sort.Slice(entry.Hashes, func(i, j int) bool {
+			return bytes.Compare(entry.Hashes[i][:], entry.Hashes[j][:]) < 0
+		})
+		for _, slot := range entry.Hashes {
+			entry.Values = append(entry.Values, slots[slot])
+		}
+		diff.Storage = append(diff.Storage, entry)
+	}
+	sort.Slice(diff.Storage, func(i, j int) bool {
+		return bytes.Compare(diff.Storage[i].Account[:], diff.Storage[j].Account[:]) < 0
+	})
+	return diff, nil
+}
+
+// History serves historical state without keeping the historical tries around,
+// by rolling the state of the chain head back through the reverse state diffs of
+// the canonical blocks above the requested one.
+//
+// Every account and storage slot is indexed with the blocks whose diffs hold its
+// original value, so a lookup only decodes the diff of the first block modifying
+// it after the requested one, instead of every diff up to the head.
+type History struct {
+	db    ethdb.Database
+	snaps *snapshot.Tree
+	diffs *lru.Cache // Decoded reverse state diffs, keyed by block hash
+}
+
+// NewHistory creates a historical state server on top of the given database and
+// snapshot tree.
+func NewHistory(db ethdb.Database, snaps *snapshot.Tree) *History {
+	diffs, _ := lru.New(stateDiffCacheSize)
+	return &History{
+		db:    db,
+		snaps: snaps,
+		diffs: diffs,
+	}
+}
+
+// StateAt returns a view of the state after the canonical block header, derived
+// from the state after the chain head. The view is read-only, any modification
+// is retained in memory but can't be committed.
+func (h *History) StateAt(db Database, header *types.Header, head *types.Header) (*StateDB, error) {
+	number := header.Number.Uint64()
+	if number > head.Number.Uint64() {
+		return nil, fmt.Errorf("block #%d above chain head #%d", number, head.Number)
+	}
+	if rawdb.ReadCanonicalHash(h.db, number) != header.Hash() {
+		return nil, fmt.Errorf("block #%d [%x…] not canonical", number, header.Hash().Bytes()[:4])
+	}
+	if tail := rawdb.ReadStateHistoryTail(h.db); number < tail {
+		return nil, fmt.Errorf("%w: block #%d below history tail #%d", ErrStateHistoryUnavailable, number, tail)
+	}
+	snap := h.snaps.Snapshot(head.Root)
+	if snap == nil {
+		return nil, fmt.Errorf("head state snapshot [%x…] unavailable", head.Root.Bytes()[:4])
+	}
+	hdb := &historyDatabase{
+		Database: db,
+		history:  h,
+		head:     snap,
+		number:   number,
+		last:     head.Number.Uint64(),
+	}
+	return New(header.Root, hdb, nil)
+}
+
+// WriteDiff stores the reverse state diff of a block, indexing all the accounts
+// and storage slots it holds the original values of.
+func (h *History) WriteDiff(hash common.Hash, number uint64, diff *StateDiff) error {
+	blob, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return err
+	}
+	batch := h.db.NewBatch()
+	rawdb.WriteStateDiffRLP(batch, hash, number, blob)
+	for _, account := range diff.Accounts {
+		rawdb.WriteAccountChange(batch, account.Hash, number)
+	}
+	for _, storage := range diff.Storage {
+		for _, slot := range storage.Hashes {
+			rawdb.WriteStorageChange(batch, storage.Account, slot, number)
+		}
+	}
+	return batch.Write()
+}
+
+// MarkMissing records that the reverse state diff of a block is missing, so the
+// states before it can't be rolled back to anymore. Without this, the change
+// index would silently skip the block and serve wrong values.
+func (h *History) MarkMissing(number uint64) {
+	if number > rawdb.ReadStateHistoryTail(h.db) {
+		rawdb.WriteStateHistoryTail(h.db, number)
+	}
+}
+
+// HasDiff reports whether the reverse state diff of a block was recorded.
+func (h *History) HasDiff(hash common.Hash, number uint64) bool {
+	return len(rawdb.ReadStateDiffRLP(h.db, hash, number)) > 0
+}
+
+// diff retrieves the decoded reverse state diff of a canonical block.
+func (h *History) diff(number uint64) (*StateDiff, error) {
+	hash := rawdb.ReadCanonicalHash(h.db, number)
+	if cached, ok := h.diffs.Get(hash); ok {
+		return cached.(*StateDiff), nil
+	}
+	blob := rawdb.ReadStateDiffRLP(h.db, hash, number)
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("%w: no state diff for block #%d", ErrStateHistoryUnavailable, number)
+	}
+	diff := new(StateDiff)
+	if err := rlp.DecodeBytes(blob, diff); err != nil {
+		return nil, fmt.Errorf("invalid state diff for block #%d: %v", number, err)
+	}
+	h.diffs.Add(hash, diff)
+	return diff, nil
+}
+
+// historyDatabase is a state database answering trie reads with the state after
+// a historical block, rolled back from the head snapshot. Contract code is read
+// from the wrapped database, as it's never deleted.
+type historyDatabase struct {
+	Database
+	history *History
+	head    snapshot.Snapshot // Snapshot of the head state to roll back from
+	number  uint64            // Block whose post-state is served
+	last    uint64            // Head block the snapshot belongs to
+}
+
+// OpenTrie opens the historical account trie.
+func (db *historyDatabase) OpenTrie(root common.Hash) (Trie, error) {
+	return &historyTrie{db: db, root: root}, nil
+}
+
+// OpenStorageTrie opens the historical storage trie of an account.
+func (db *historyDatabase) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	return &historyTrie{db: db, root: root, owner: addrHash, storage: true}, nil
+}
+
+// CopyTrie returns an independent copy of the given trie.
+func (db *historyDatabase) CopyTrie(t Trie) Trie {
+	switch t := t.(type) {
+	case *historyTrie:
+		return t.copy()
+	default:
+		panic(fmt.Errorf("unknown trie type %T", t))
+	}
+}
+
+// account retrieves the historical value of an account in the slim snapshot
+// format: its original value in the first block after the requested one which
+// modified it, or the head value if none did.
+//
+// The change index may also list blocks which were reorged out, whose canonical
+// replacements don't necessarily modify the account, so those are skipped.
+func (db *historyDatabase) account(hash common.Hash) ([]byte, error) {
+	for from := db.number + 1; ; {
+		number, ok := rawdb.ReadAccountChange(db.history.db, hash, from)
+		if !ok || number > db.last {
+			break
+		}
+		diff, err := db.history.diff(number)
+		if err != nil {
+			return nil, err
+		}
+		if blob, ok := diff.account(hash); ok {
+			return blob, nil
+		}
+		from = number + 1
+	}
+	return db.head.AccountRLP(hash)
+}
+
+// storage retrieves the historical value of a storage slot, see account.
+func (db *historyDatabase) storage(account common.Hash, slot common.Hash) ([]byte, error) {
+	for from := db.number + 1; ; {
+		number, ok := rawdb.ReadStorageChange(db.history.db, account, slot, from)
+		if !ok || number > db.last {
+			break
+		}
+		diff, err := db.history.diff(number)
+		if err != nil {
+			return nil, err
+		}
+		if blob, ok := diff.storage(account, slot); ok {
+			return blob, nil
+		}
+		from = number + 1
+	}
+	return db.head.Storage(account, slot)
+}
+
+// historyTrie is a read-only trie view of historical state. Updates are tracked
+// in memory, but the trie hash doesn't reflect them.
+type historyTrie struct {
+	db      *historyDatabase
+	root    common.Hash
+	owner   common.Hash       // Account hash of a storage trie
+	storage bool              // Whether the trie is a storage trie
+	dirty   map[string][]byte // Local modifications, nil for deletions
+}
+
+// GetKey returns nil, preimages are not tracked for historical state.
+func (t *historyTrie) GetKey([]byte) []byte {
+	return nil
+}
+
+// TryGet returns the historical value of key, in the same encoding as the trie
+// would have stored it.
+func (t *historyTrie) TryGet(key []byte) ([]byte, error) {
+	if value, ok := t.dirty[string(key)]; ok {
+		return value, nil
+	}
+	hash := crypto.Keccak256Hash(key)
+	if t.storage {
+		return t.db.storage(t.owner, hash)
+	}
+	blob, err := t.db.account(hash)
+	if err != nil || len(blob) == 0 {
+		return nil, err
+	}
+	return snapshot.FullAccountRLP(blob)
+}
+
+// TryUpdate tracks a modification of the historical state in memory.
+func (t *historyTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return t.TryDelete(key)
+	}
+	if t.dirty == nil {
+		t.dirty = make(map[string][]byte)
+	}
+	t.dirty[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+// TryDelete tracks a deletion from the historical state in memory.
+func (t *historyTrie) TryDelete(key []byte) error {
+	if t.dirty == nil {
+		t.dirty = make(map[string][]byte)
+	}
+	t.dirty[string(key)] = nil
+	return nil
+}
+
+// Hash returns the root hash of the historical trie, disregarding any updates.
+func (t *historyTrie) Hash() common.Hash {
+	return t.root
+}
+
+// Commit is not supported on historical state.
+func (t *historyTrie) Commit(onleaf trie.LeafCallback) (common.Hash, error) {
+	return common.Hash{}, errHistoryUnsupported
+}
+
+// NodeIterator is not supported on historical state, the returned iterator is
+// exhausted and reports an error.
+func (t *historyTrie) NodeIterator(startKey []byte) trie.NodeIterator {
+	return historyIterator{}
+}
+
+// Prove is not supported on historical state, as there are no trie nodes.
+func (t *historyTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return errHistoryUnsupported
+}
+
+// copy returns an independent copy of the trie.
+func (t *historyTrie) copy() *historyTrie {
+	cpy := *t
+	if t.dirty != nil {
+		cpy.dirty = make(map[string][]byte, len(t.dirty))
+		for key, value := range t.dirty {
+			cpy.dirty[key] = value
+		}
+	}
+	return &cpy
+}
+
+// historyIterator is a node iterator over historical state, which has no nodes.
+type historyIterator struct{}
+
+func (historyIterator) Next(bool) bool      { return false }
+func (historyIterator) Error() error        { return errHistoryUnsupported }
+func (historyIterator) Hash() common.Hash   { return common.Hash{} }
+func (historyIterator) Parent() common.Hash { return common.Hash{} }
+func (historyIterator) Path() []byte        { return nil }
+func (historyIterator) Leaf() bool          { return false }
+func (historyIterator) LeafKey() []byte     { return nil }
+func (historyIterator) LeafBlob() []byte    { return nil }
+func (historyIterator) LeafProof() [][]byte { return nil }
@@ -0,0 +1,443 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements offline pruning of the stale state data, using the
+// state snapshot as the source of truth for the state to retain.
+package pruner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// stateBloomFilePrefix is the filename prefix of the state bloom filter.
+	stateBloomFilePrefix = "statebloom"
+
+	// stateBloomFileSuffix is the filename suffix of the state bloom filter.
+	stateBloomFileSuffix = "bf.gz"
+
+	// stateBloomFileTempSuffix is the filename suffix of the state bloom filter
+	// while it is being written out, to detect aborted writes.
+	stateBloomFileTempSuffix = ".tmp"
+
+	// rangeCompactionThreshold is the minimal number of deleted entries for
+	// triggering a range compaction. It's a quite arbitrary number, just to
+	// avoid compacting the database after a small deletion.
+	rangeCompactionThreshold = 100000
+
+	// targetDepth is the number of layers below the head at which the default
+	// pruning target resides. It's the bottom-most diff layer of the snapshot.
+	targetDepth = 128
+)
+
+// Pruner is an offline tool to prune the stale state with the help of the
+// snapshot. The workflow of the pruner is very simple:
+//
+//   - iterate the snapshot, reconstruct the relevant state
+//   - iterate the database, delete all other state entries which
+//     don't belong to the target state and the genesis state
+//
+// It can take several hours (around 2 hours for mainnet) to finish the whole
+// pruning work. It's recommended to run this offline tool periodically in
+// order to release the disk usage and improve the disk read performance.
+type Pruner struct {
+	db            ethdb.Database
+	stateBloom    *stateBloom
+	datadir       string
+	trieCachePath string
+	headBlock     *types.Block
+	snaptree      *snapshot.Tree
+}
+
+// NewPruner creates a pruner instance for the state of the given database. The
+// bloom size is the number of megabytes to allocate for the bloom filter of the
+// retained state.
+func NewPruner(db ethdb.Database, datadir, trieCachePath string, bloomSize uint64) (*Pruner, error) {
+	headBlock := rawdb.ReadHeadBlock(db)
+	if headBlock == nil {
+		return nil, errors.New("failed to load head block")
+	}
+	if rawdb.ReadSnapshotRoot(db) == (common.Hash{}) {
+		return nil, errors.New("state snapshot not available")
+	}
+	snaptree := snapshot.New(db, trie.NewDatabase(db), 256, headBlock.Root(), false, false)
+	if snaptree.Snapshot(headBlock.Root()) == nil {
+		return nil, fmt.Errorf("state snapshot of head %x not available", headBlock.Root())
+	}
+	stateBloom, err := newStateBloomWithSize(bloomSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Pruner{
+		db:            db,
+		stateBloom:    stateBloom,
+		datadir:       datadir,
+		trieCachePath: trieCachePath,
+		headBlock:     headBlock,
+		snaptree:      snaptree,
+	}, nil
+}
+
+// Prune deletes all the historical state nodes except the nodes belonging to
+// the specified state version. If the user doesn't specify the state version,
+// the bottom-most snapshot diff layer (HEAD-127) is used as the target.
+func (p *Pruner) Prune(root common.Hash) error {
+	// If a state bloom filter was already committed previously, a part of the
+	// state may already be deleted. Resume that pruning instead of starting a
+	// new one.
+	bloomPath, bloomRoot, err := findBloomFilter(p.datadir)
+	if err != nil {
+		return err
+	}
+	if bloomPath != "" {
+		if root != (common.Hash{}) && root != bloomRoot {
+			return fmt.Errorf("interrupted pruning of state %x pending", bloomRoot)
+		}
+		log.Info("Resuming interrupted state pruning", "root", bloomRoot)
+		return RecoverPruning(p.datadir, p.db, p.trieCachePath)
+	}
+	// If the target state root is not specified, use the HEAD-127 as the target,
+	// since its state is available and the probability of it being reorged is
+	// very low.
+	layers := p.snaptree.Snapshots(p.headBlock.Root(), targetDepth, true)
+	if root == (common.Hash{}) {
+		if len(layers) != targetDepth {
+			return fmt.Errorf("snapshot not old enough yet: need %d more blocks", targetDepth-len(layers))
+		}
+		root = layers[len(layers)-1].Root()
+		log.Info("Selecting bottom-most difflayer as the pruning target", "root", root, "height", p.headBlock.NumberU64()-targetDepth+1)
+	} else {
+		log.Info("Selecting user-specified state as the pruning target", "root", root)
+	}
+	// Ensure the root is really present. The weak assumption is that the
+	// presence of the root indicates the presence of the entire trie.
+	if blob := rawdb.ReadTrieNode(p.db, root); len(blob) == 0 {
+		return fmt.Errorf("associated state %x is not present", root)
+	}
+	// Delete the clean trie cache first, otherwise the next start could pick
+	// up deleted trie nodes from it.
+	deleteCleanTrieCache(p.trieCachePath)
+
+	// The roots of the layers above the target are deleted forcibly, otherwise
+	// they might be left dangling due to a bloom false positive.
+	middleRoots := make(map[common.Hash]struct{})
+	for _, layer := range layers {
+		if layer.Root() == root {
+			break
+		}
+		middleRoots[layer.Root()] = struct{}{}
+	}
+	// Regenerate the target state from the snapshot, recording all its trie
+	// nodes and codes in the bloom filter. Do the same with the genesis state.
+	start := time.Now()
+	if err := snapshot.GenerateTrie(p.snaptree, root, p.db, p.stateBloom); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, p.stateBloom); err != nil {
+		return err
+	}
+	bloomPath = bloomFilterName(p.datadir, root)
+
+	log.Info("Writing state bloom to disk", "name", bloomPath)
+	if err := p.stateBloom.Commit(bloomPath, bloomPath+stateBloomFileTempSuffix); err != nil {
+		return err
+	}
+	log.Info("State bloom filter committed", "name", bloomPath)
+
+	return prune(p.snaptree, root, p.db, p.stateBloom, bloomPath, middleRoots, start)
+}
+
+// RecoverPruning resumes a pruning procedure that was interrupted after the
+// state bloom filter was committed, since some of the retained state might
+// already be missing. It's a no-op if no pruning is pending, and should be
+// invoked before the database is used by anything else.
+func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) error {
+	bloomPath, bloomRoot, err := findBloomFilter(datadir)
+	if err != nil {
+		return err
+	}
+	if bloomPath == "" {
+		return nil // nothing to recover
+	}
+	headBlock := rawdb.ReadHeadBlock(db)
+	if headBlock == nil {
+		return errors.New("failed to load head block")
+	}
+	// Load the snapshot tree in recovery mode, since the head state might have
+	// been rewound by a previous interrupted run.
+	snaptree := snapshot.New(db, trie.NewDatabase(db), 256, headBlock.Root(), false, true)
+
+	stateBloom, err := newStateBloomFromDisk(bloomPath)
+	if err != nil {
+		return err
+	}
+	log.Info("Loaded state bloom filter", "path", bloomPath)
+
+	deleteCleanTrieCache(trieCachePath)
+
+	// Collect the roots of the layers above the target to forcibly delete them
+	var (
+		found       bool
+		middleRoots = make(map[common.Hash]struct{})
+	)
+	for _, layer := range snaptree.Snapshots(headBlock.Root(), targetDepth+1, false) {
+		if layer.Root() == bloomRoot {
+			found = true
+			break
+		}
+		middleRoots[layer.Root()] = struct{}{}
+	}
+	if !found {
+		return fmt.Errorf("pruning target state %x not found in snapshot", bloomRoot)
+	}
+	return prune(snaptree, bloomRoot, db, stateBloom, bloomPath, middleRoots, time.Now())
+}
+
+// prune deletes all the trie nodes and contract codes not recorded in the state
+// bloom, then flattens the snapshot onto the retained state.
+func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, stateBloom *stateBloom, bloomPath string, middleRoots map[common.Hash]struct{}, start time.Time) error {
+	// Delete all stale trie nodes and codes on disk. The entries of the retained
+	// state are filtered out with the help of the bloom, along with a tiny part
+	// of the stale ones due to false positives.
+	var (
+		count  int
+		size   common.StorageSize
+		pstart = time.Now()
+		logged = time.Now()
+		batch  = maindb.NewBatch()
+		iter   = maindb.NewIterator(nil, nil)
+	)
+	for iter.Next() {
+		key := iter.Key()
+
+		// Only trie nodes, legacy codes (both keyed by hash) and prefixed codes
+		// are considered for deletion
+		isCode, codeKey := rawdb.IsCodeKey(key)
+		if len(key) != common.HashLength && !isCode {
+			continue
+		}
+		checkKey := key
+		if isCode {
+			checkKey = codeKey
+		}
+		if _, middle := middleRoots[common.BytesToHash(checkKey)]; middle {
+			log.Debug("Forcibly deleting middle state root", "hash", common.BytesToHash(checkKey))
+		} else if stateBloom.Contain(checkKey) {
+			continue
+		}
+		count++
+		size += common.StorageSize(len(key) + len(iter.Value()))
+		batch.Delete(key)
+
+		if time.Since(logged) > 8*time.Second {
+			var eta time.Duration
+			if done := binary.BigEndian.Uint64(checkKey[:8]); done > 0 {
+				var (
+					left  = math.MaxUint64 - done
+					speed = done/uint64(time.Since(pstart)/time.Millisecond+1) + 1 // +1 to avoid division by zero
+				)
+				eta = time.Duration(left/speed) * time.Millisecond
+			}
+			log.Info("Pruning state data", "nodes", count, "size", size,
+				"elapsed", common.PrettyDuration(time.Since(pstart)), "eta", common.PrettyDuration(eta))
+			logged = time.Now()
+		}
+		// Recreate the iterator after every batch commit in order to allow
+		// the underlying compactor to delete the entries
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				iter.Release()
+				return err
+			}
+			batch.Reset()
+
+			iter.Release()
+			iter = maindb.NewIterator(nil, key)
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if batch.ValueSize() > 0 {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	log.Info("Pruned state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(pstart)))
+
+	// Pruning is done, now drop the useless layers from the snapshot. Flatten
+	// the target layer (and all the ones below) into the disk layer, then
+	// journal the tree, which silently drops all the layers above it.
+	if snaptree.DiskRoot() != root {
+		if err := snaptree.Cap(root, 0); err != nil {
+			return err
+		}
+	}
+	if _, err := snaptree.Journal(root); err != nil {
+		return err
+	}
+	// Delete the state bloom, which marks the entire pruning as finished. If
+	// anything interrupts the process before this, RecoverPruning redoes the
+	// deletion on the next start.
+	os.RemoveAll(bloomPath)
+
+	// Compact the database to release the deleted data from the disk. Small
+	// prunings skip the compaction.
+	if count >= rangeCompactionThreshold {
+		cstart := time.Now()
+		for b := 0x00; b <= 0xf0; b += 0x10 {
+			var (
+				start = []byte{byte(b)}
+				end   = []byte{byte(b + 0x10)}
+			)
+			if b == 0xf0 {
+				end = nil
+			}
+			log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
+			if err := maindb.Compact(start, end); err != nil {
+				log.Error("Database compaction failed", "error", err)
+				return err
+			}
+		}
+		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	}
+	log.Info("State pruning successful", "pruned", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// extractGenesis records all the trie nodes and contract codes of the genesis
+// state in the state bloom, so that the genesis state is retained too.
+func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	if genesisHash == (common.Hash{}) {
+		return errors.New("missing genesis hash")
+	}
+	genesis := rawdb.ReadBlock(db, genesisHash, 0)
+	if genesis == nil {
+		return errors.New("missing genesis block")
+	}
+	t, err := trie.NewSecure(genesis.Root(), trie.NewDatabase(db))
+	if err != nil {
+		return err
+	}
+	accIter := t.NodeIterator(nil)
+	for accIter.Next(true) {
+		// Embedded nodes don't have a hash
+		if hash := accIter.Hash(); hash != (common.Hash{}) {
+			stateBloom.Put(hash.Bytes(), nil)
+		}
+		// If it's a leaf node, dig into the storage trie of the account
+		if !accIter.Leaf() {
+			continue
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
+			return err
+		}
+		if acc.Root != types.EmptyRootHash {
+			storageTrie, err := trie.NewSecure(acc.Root, trie.NewDatabase(db))
+			if err != nil {
+				return err
+			}
+			storageIter := storageTrie.NodeIterator(nil)
+			for storageIter.Next(true) {
+				if hash := storageIter.Hash(); hash != (common.Hash{}) {
+					stateBloom.Put(hash.Bytes(), nil)
+				}
+			}
+			if storageIter.Error() != nil {
+				return storageIter.Error()
+			}
+		}
+		if !bytes.Equal(acc.CodeHash, types.EmptyCodeHash.Bytes()) {
+			stateBloom.Put(acc.CodeHash, nil)
+		}
+	}
+	return accIter.Error()
+}
+
+// bloomFilterName returns the path of the state bloom filter of the given root.
+func bloomFilterName(datadir string, hash common.Hash) string {
+	return filepath.Join(datadir, fmt.Sprintf("%s.%s.%s", stateBloomFilePrefix, hash.Hex(), stateBloomFileSuffix))
+}
+
+// isBloomFilter checks whether the given file is a committed state bloom filter
+// and returns the state root it belongs to.
+func isBloomFilter(filename string) (bool, common.Hash) {
+	filename = filepath.Base(filename)
+	if strings.HasPrefix(filename, stateBloomFilePrefix+".") && strings.HasSuffix(filename, "."+stateBloomFileSuffix) {
+		return true, common.HexToHash(filename[len(stateBloomFilePrefix)+1 : len(filename)-len(stateBloomFileSuffix)-1])
+	}
+	return false, common.Hash{}
+}
+
+// findBloomFilter looks for a committed state bloom filter in the data directory,
+// returning its path and state root if found.
+func findBloomFilter(datadir string) (string, common.Hash, error) {
+	if datadir == "" {
+		return "", common.Hash{}, nil // ephemeral node, nothing persisted
+	}
+	files, err := ioutil.ReadDir(datadir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", common.Hash{}, nil
+		}
+		return "", common.Hash{}, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if ok, root := isBloomFilter(file.Name()); ok {
+			return filepath.Join(datadir, file.Name()), root, nil
+		}
+	}
+	return "", common.Hash{}, nil
+}
+
+// deleteCleanTrieCache deletes the journal of the clean trie cache, which might
+// reference trie nodes deleted by the pruning.
+func deleteCleanTrieCache(path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return
+	}
+	os.RemoveAll(path)
+	log.Info("Deleted trie clean cache", "path", path)
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// commitState applies the given modifications on top of the parent state and
+// persists the result, both into the trie database and the snapshot tree.
+func commitState(t *testing.T, db state.Database, snaps *snapshot.Tree, parent common.Hash, seed byte) common.Hash {
+	statedb, err := state.New(parent, db, snaps)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", parent, err)
+	}
+	for i := byte(0); i < 16; i++ {
+		addr := common.Address{seed, i}
+		statedb.AddBalance(addr, big.NewInt(int64(seed)+1), tracing.BalanceChangeUnspecified)
+		statedb.SetState(addr, common.Hash{i}, common.Hash{seed, i})
+		statedb.SetCode(addr, []byte{seed, i})
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	return root
+}
+
+// checkState ensures that the entire state of the given root is present.
+func checkState(t *testing.T, diskdb ethdb.Database, root common.Hash) {
+	t.Helper()
+
+	statedb, err := state.New(root, state.NewDatabase(diskdb), nil)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x incomplete: %v", root, it.Error)
+	}
+}
+
+// Tests that pruning retains the target and the genesis states, and deletes the
+// states of the layers above the target.
+func TestPrune(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		gspec  = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{common.Address{0xff}: {Balance: big.NewInt(1), Code: []byte{0xff}, Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}}},
+		}
+		genesis = gspec.MustCommit(diskdb)
+		db      = state.NewDatabase(diskdb)
+		snaps   = snapshot.New(diskdb, db.TrieDB(), 16, genesis.Root(), false, false)
+	)
+	target := commitState(t, db, snaps, genesis.Root(), 1)
+	middle := commitState(t, db, snaps, target, 2)
+
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	// Record the retained state into the bloom and prune everything else
+	bloom, err := newStateBloomWithSize(1)
+	if err != nil {
+		t.Fatalf("failed to create state bloom: %v", err)
+	}
+	if err := snapshot.GenerateTrie(snaps, target, diskdb, bloom); err != nil {
+		t.Fatalf("failed to regenerate target state: %v", err)
+	}
+	if err := extractGenesis(diskdb, bloom); err != nil {
+		t.Fatalf("failed to extract genesis state: %v", err)
+	}
+	bloomPath := bloomFilterName(datadir, target)
+	if err := bloom.Commit(bloomPath, bloomPath+stateBloomFileTempSuffix); err != nil {
+		t.Fatalf("failed to commit state bloom: %v", err)
+	}
+	if path, root, err := findBloomFilter(datadir); err != nil || path != bloomPath || root != target {
+		t.Fatalf("committed bloom not found: path %q, root %x, err %v", path, root, err)
+	}
+	if err := prune(snaps, target, diskdb, bloom, bloomPath, map[common.Hash]struct{}{middle: {}}, time.Now()); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	// Ensure the retained states are complete and the pruned one is gone
+	checkState(t, diskdb, target)
+	checkState(t, diskdb, genesis.Root())
+
+	if blob := rawdb.ReadTrieNode(diskdb, middle); len(blob) != 0 {
+		t.Errorf("middle state root not pruned")
+	}
+	for i := byte(0); i < 16; i++ {
+		if code := rawdb.ReadCode(diskdb, crypto.Keccak256Hash([]byte{2, i})); len(code) != 0 {
+			t.Errorf("code %d of the middle state not pruned", i)
+		}
+	}
+	// Ensure the pruning was marked finished and the snapshot flattened
+	if path, _, _ := findBloomFilter(datadir); path != "" {
+		t.Errorf("state bloom not deleted after pruning: %s", path)
+	}
+	if root := snaps.DiskRoot(); root != target {
+		t.Errorf("snapshot disk root mismatch: have %x, want %x", root, target)
+	}
+}
@@ -17,6 +17,7 @@
 package snapshot
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -25,7 +26,10 @@ import (
 	"github.com/VictoriaMetrics/fastcache"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // randomHash generates a random blob of data and returns it as a hash.
@@ -369,3 +373,50 @@ func TestPostCapBasicDataAccess(t *testing.T) {
 		t.Error("expected error capping the disk layer, got none")
 	}
 }
+
+// Tests that Load only accepts a complete snapshot matching the requested head
+// and never touches the database otherwise.
+func TestLoadReadOnly(t *testing.T) {
+	var (
+		diskdb = memorydb.New()
+		triedb = trie.NewDatabase(diskdb)
+	)
+	tr, _ := trie.NewSecure(common.Hash{}, triedb)
+	for i := byte(1); i <= 3; i++ {
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()}
+		val, _ := rlp.EncodeToBytes(acc)
+		tr.Update([]byte{i}, val)
+	}
+	root, _ := tr.Commit(nil)
+	triedb.Commit(root, false, nil)
+
+	snaps := New(diskdb, triedb, 16, root, false, false)
+	if _, err := snaps.Journal(root); err != nil {
+		t.Fatalf("failed to journal snapshot: %v", err)
+	}
+	// A complete snapshot matching the head should load
+	loaded, err := Load(diskdb, triedb, 16, root)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if acc, err := loaded.Snapshot(root).Account(crypto.Keccak256Hash([]byte{2})); err != nil || acc == nil || acc.Balance.Uint64() != 2 {
+		t.Fatalf("account mismatch: have %v, %v", acc, err)
+	}
+	// A snapshot not matching the head must not be loaded, nor regenerated
+	if _, err := Load(diskdb, triedb, 16, common.HexToHash("0x01")); err == nil {
+		t.Fatalf("loaded snapshot with mismatching head")
+	}
+	if have := rawdb.ReadSnapshotRoot(diskdb); have != root {
+		t.Fatalf("snapshot root changed: have %x, want %x", have, root)
+	}
+	// A snapshot still being generated must not be loaded, nor resumed
+	journalProgress(diskdb, crypto.Keccak256([]byte{1}), nil)
+	generator := rawdb.ReadSnapshotGenerator(diskdb)
+
+	if _, err := Load(diskdb, triedb, 16, root); err == nil {
+		t.Fatalf("loaded partially generated snapshot")
+	}
+	if have := rawdb.ReadSnapshotGenerator(diskdb); !bytes.Equal(have, generator) {
+		t.Fatalf("generator progress changed: have %x, want %x", have, generator)
+	}
+}
@@ -19,10 +19,13 @@ package state
 import (
 	"bytes"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
@@ -89,6 +92,48 @@ func TestDump(t *testing.T) {
 	}
 }
 
+// Tests that dumping the state from the snapshot yields the same result as
+// dumping it from the trie, including the paginated dumps.
+func TestDumpSnapshot(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	sdb := NewDatabase(db)
+	state, _ := New(common.Hash{}, sdb, nil)
+
+	for i := byte(0); i < 8; i++ {
+		addr := toAddr([]byte{0x01, i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1), tracing.BalanceChangeUnspecified)
+		state.SetNonce(addr, uint64(i))
+		if i%2 == 0 {
+			state.SetCode(addr, []byte{i, i, i})
+			state.SetState(addr, common.Hash{i}, common.Hash{0xff, i})
+		}
+	}
+	root, _ := state.Commit(false)
+	sdb.TrieDB().Commit(root, false, nil)
+
+	snaps := snapshot.New(db, sdb.TrieDB(), 16, root, false, false)
+	trieState, _ := New(root, sdb, nil)
+	snapState, _ := New(root, sdb, snaps)
+	if snapState.snap == nil {
+		t.Fatalf("snapshot not available")
+	}
+	if have, want := string(snapState.Dump(false, false, true)), string(trieState.Dump(false, false, true)); have != want {
+		t.Errorf("dump mismatch:\nhave: %s\nwant: %s", have, want)
+	}
+	var (
+		haveNext, wantNext []byte
+		first              = true
+	)
+	for first || wantNext != nil {
+		have := snapState.IteratorDump(false, false, true, haveNext, 3)
+		want := trieState.IteratorDump(false, false, true, wantNext, 3)
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("iterator dump mismatch:\nhave: %v\nwant: %v", have, want)
+		}
+		haveNext, wantNext, first = have.Next, want.Next, false
+	}
+}
+
 func TestNull(t *testing.T) {
 	s := newStateTest()
 	address := common.HexToAddress("0x823140710bf13990e4500136726d8b55")
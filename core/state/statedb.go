@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
@@ -71,6 +72,9 @@ type StateDB struct {
 	snapAccounts  map[common.Hash][]byte
 	snapStorage   map[common.Hash]map[common.Hash][]byte
 
+	recordDiff bool       // Whether to collect the reverse state diff on commit
+	diff       *StateDiff // Reverse state diff collected by the last commit
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects        map[common.Address]*stateObject
 	stateObjectsPending map[common.Address]struct{} // State objects finalized but not yet written to the trie
@@ -102,6 +106,9 @@ type StateDB struct {
 	validRevisions []revision
 	nextRevisionId int
 
+	// Logger notified about the state modifications, set during live tracing
+	logger tracing.StateLogger
+
 	// Measurements gathered during execution for debugging purposes
 	AccountReads         time.Duration
 	AccountHashes        time.Duration
@@ -371,46 +378,89 @@ func (s *StateDB) HasSuicided(addr common.Address) bool {
  */
 
 // AddBalance adds amount to the account associated with addr.
-func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
+func (s *StateDB) AddBalance(addr common.Address, amount *big.Int, reason tracing.BalanceChangeReason) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
+		prev := stateObject.Balance()
 		stateObject.AddBalance(amount)
+		s.logBalanceChange(addr, prev, stateObject.Balance(), reason)
 	}
 }
 
 // SubBalance subtracts amount from the account associated with addr.
-func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
+func (s *StateDB) SubBalance(addr common.Address, amount *big.Int, reason tracing.BalanceChangeReason) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
+		prev := stateObject.Balance()
 		stateObject.SubBalance(amount)
+		s.logBalanceChange(addr, prev, stateObject.Balance(), reason)
 	}
 }
 
-func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
+func (s *StateDB) SetBalance(addr common.Address, amount *big.Int, reason tracing.BalanceChangeReason) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
+		prev := stateObject.Balance()
 		stateObject.SetBalance(amount)
+		s.logBalanceChange(addr, prev, stateObject.Balance(), reason)
 	}
 }
 
 func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
+		prev := stateObject.Nonce()
 		stateObject.SetNonce(nonce)
+		if s.logger != nil && prev != nonce {
+			s.logger.OnNonceChange(addr, prev, nonce)
+		}
 	}
 }
 
 func (s *StateDB) SetCode(addr common.Address, code []byte) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
-		stateObject.SetCode(crypto.Keccak256Hash(code), code)
+		var (
+			prevHash common.Hash
+			prevCode []byte
+		)
+		if s.logger != nil {
+			prevHash, prevCode = common.BytesToHash(stateObject.CodeHash()), stateObject.Code(s.db)
+		}
+		hash := crypto.Keccak256Hash(code)
+		stateObject.SetCode(hash, code)
+		if s.logger != nil && prevHash != hash {
+			s.logger.OnCodeChange(addr, prevHash, prevCode, hash, code)
+		}
 	}
 }
 
 func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
+		var prev common.Hash
+		if s.logger != nil {
+			prev = stateObject.GetState(s.db, key)
+		}
 		stateObject.SetState(s.db, key, value)
+		if s.logger != nil && prev != value {
+			s.logger.OnStorageChange(addr, key, prev, value)
+		}
+	}
+}
+
+// SetLogger sets the logger to notify about all the subsequent modifications of
+// the state, including the ones undone by reverts. Copies of the state do not
+// inherit the logger.
+func (s *StateDB) SetLogger(logger tracing.StateLogger) {
+	s.logger = logger
+}
+
+// logBalanceChange notifies the logger, if any, about the balance of an account
+// changing.
+func (s *StateDB) logBalanceChange(addr common.Address, prev, post *big.Int, reason tracing.BalanceChangeReason) {
+	if s.logger != nil && prev.Cmp(post) != 0 {
+		s.logger.OnBalanceChange(addr, new(big.Int).Set(prev), new(big.Int).Set(post), reason)
 	}
 }
 
@@ -439,6 +489,7 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 		prevbalance: new(big.Int).Set(stateObject.Balance()),
 	})
 	stateObject.markSuicided()
+	s.logBalanceChange(addr, stateObject.Balance(), new(big.Int), tracing.BalanceDecreaseSelfdestruct)
 	stateObject.data.Balance = new(big.Int)
 
 	return true
@@ -756,6 +807,12 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 			continue
 		}
 		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
+			// Report the removal, burning any ether a self destructed contract
+			// received after its destruct
+			if s.logger != nil && !obj.deleted {
+				s.logBalanceChange(addr, obj.Balance(), common.Big0, tracing.BalanceDecreaseSelfdestructBurn)
+				s.logger.OnAccountDeleted(addr)
+			}
 			obj.deleted = true
 
 			// If state snapshotting is active, also mark the destruction there.
@@ -876,6 +933,15 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.SnapshotCommits += time.Since(start) }(time.Now())
 		}
+		// Collect the original values of the modified state if requested, before
+		// the snapshot tree is updated
+		if s.recordDiff {
+			diff, err := s.reverseDiff()
+			if err != nil {
+				log.Warn("Failed to collect reverse state diff", "root", root, "err", err)
+			}
+			s.diff = diff
+		}
 		// Only update if there's a state transition (skip empty Clique blocks)
 		if parent := s.snap.Root(); parent != root {
 			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
@@ -894,6 +960,32 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	return root, err
 }
 
+// PrepareAccessList handles the preparatory steps for executing a state transition with
+// regards to both EIP-2929 and EIP-2930:
+//
+// - Add sender to access list (2929)
+// - Add destination to access list (2929)
+// - Add precompiles to access list (2929)
+// - Add the contents of the optional tx access list (2930)
+//
+// This method should only be called if Yolov2/Berlin/2929+2930 is applicable at the current number.
+func (s *StateDB) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	s.AddAddressToAccessList(sender)
+	if dst != nil {
+		s.AddAddressToAccessList(*dst)
+		// If it's a create-tx, the destination will be added inside evm.create
+	}
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+	for _, el := range list {
+		s.AddAddressToAccessList(el.Address)
+		for _, key := range el.StorageKeys {
+			s.AddSlotToAccessList(el.Address, key)
+		}
+	}
+}
+
 // AddAddressToAccessList adds the given address to the access list
 func (s *StateDB) AddAddressToAccessList(addr common.Address) {
 	if s.accessList.AddAddress(addr) {
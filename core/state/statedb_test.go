@@ -31,7 +31,9 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
+	"sort"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -44,7 +46,7 @@ func TestUpdateLeaks(t *testing.T) {
 	// Update it with some accounts
 	for i := byte(0); i < 255; i++ {
 		addr := common.BytesToAddress([]byte{i})
-		state.AddBalance(addr, big.NewInt(int64(11*i)))
+		state.AddBalance(addr, big.NewInt(int64(11*i)), tracing.BalanceChangeUnspecified)
 		state.SetNonce(addr, uint64(42*i))
 		if i%2 == 0 {
 			state.SetState(addr, common.BytesToHash([]byte{i, i, i}), common.BytesToHash([]byte{i, i, i, i}))
@@ -77,7 +79,7 @@ func TestIntermediateLeaks(t *testing.T) {
 	finalState, _ := New(common.Hash{}, NewDatabase(finalDb), nil)
 
 	modify := func(state *StateDB, addr common.Address, i, tweak byte) {
-		state.SetBalance(addr, big.NewInt(int64(11*i)+int64(tweak)))
+		state.SetBalance(addr, big.NewInt(int64(11*i)+int64(tweak)), tracing.BalanceChangeUnspecified)
 		state.SetNonce(addr, uint64(42*i+tweak))
 		if i%2 == 0 {
 			state.SetState(addr, common.Hash{i, i, i, 0}, common.Hash{})
@@ -252,14 +254,14 @@ func newTestAction(addr common.Address, r *rand.Rand) testAction {
 		{
 			name: "SetBalance",
 			fn: func(a testAction, s *StateDB) {
-				s.SetBalance(addr, big.NewInt(a.args[0]))
+				s.SetBalance(addr, big.NewInt(a.args[0]), tracing.BalanceChangeUnspecified)
 			},
 			args: make([]int64, 1),
 		},
 		{
 			name: "AddBalance",
 			fn: func(a testAction, s *StateDB) {
-				s.AddBalance(addr, big.NewInt(a.args[0]))
+				s.AddBalance(addr, big.NewInt(a.args[0]), tracing.BalanceChangeUnspecified)
 			},
 			args: make([]int64, 1),
 		},
@@ -477,7 +479,7 @@ func TestTouchDelete(t *testing.T) {
 	s.state.Reset(root)
 
 	snapshot := s.state.Snapshot()
-	s.state.AddBalance(common.Address{}, new(big.Int))
+	s.state.AddBalance(common.Address{}, new(big.Int), tracing.BalanceChangeUnspecified)
 
 	if len(s.state.journal.dirties) != 1 {
 		t.Fatal("expected one dirty state object")
@@ -493,7 +495,7 @@ func TestTouchDelete(t *testing.T) {
 func TestCopyOfCopy(t *testing.T) {
 	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 	addr := common.HexToAddress("aaaa")
-	state.SetBalance(addr, big.NewInt(42))
+	state.SetBalance(addr, big.NewInt(42), tracing.BalanceChangeUnspecified)
 
 	if got := state.Copy().GetBalance(addr).Uint64(); got != 42 {
 		t.Fatalf("1st copy fail, expected 42, got %v", got)
@@ -515,9 +517,9 @@ func TestCopyCommitCopy(t *testing.T) {
 	skey := common.HexToHash("aaa")
 	sval := common.HexToHash("bbb")
 
-	state.SetBalance(addr, big.NewInt(42)) // Change the account trie
-	state.SetCode(addr, []byte("hello"))   // Change an external metadata
-	state.SetState(addr, skey, sval)       // Change the storage trie
+	state.SetBalance(addr, big.NewInt(42), tracing.BalanceChangeUnspecified) // Change the account trie
+	state.SetCode(addr, []byte("hello"))                                     // Change an external metadata
+	state.SetState(addr, skey, sval)                                         // Change the storage trie
 
 	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(42)) != 0 {
 		t.Fatalf("initial balance mismatch: have %v, want %v", balance, 42)
@@ -587,9 +589,9 @@ func TestCopyCopyCommitCopy(t *testing.T) {
 	skey := common.HexToHash("aaa")
 	sval := common.HexToHash("bbb")
 
-	state.SetBalance(addr, big.NewInt(42)) // Change the account trie
-	state.SetCode(addr, []byte("hello"))   // Change an external metadata
-	state.SetState(addr, skey, sval)       // Change the storage trie
+	state.SetBalance(addr, big.NewInt(42), tracing.BalanceChangeUnspecified) // Change the account trie
+	state.SetCode(addr, []byte("hello"))                                     // Change an external metadata
+	state.SetState(addr, skey, sval)                                         // Change the storage trie
 
 	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(42)) != 0 {
 		t.Fatalf("initial balance mismatch: have %v, want %v", balance, 42)
@@ -673,7 +675,7 @@ func TestDeleteCreateRevert(t *testing.T) {
 	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 
 	addr := toAddr([]byte("so"))
-	state.SetBalance(addr, big.NewInt(1))
+	state.SetBalance(addr, big.NewInt(1), tracing.BalanceChangeUnspecified)
 
 	root, _ := state.Commit(false)
 	state.Reset(root)
@@ -683,7 +685,7 @@ func TestDeleteCreateRevert(t *testing.T) {
 	state.Finalise(true)
 
 	id := state.Snapshot()
-	state.SetBalance(addr, big.NewInt(2))
+	state.SetBalance(addr, big.NewInt(2), tracing.BalanceChangeUnspecified)
 	state.RevertToSnapshot(id)
 
 	// Commit the entire state and make sure we don't crash and have the correct state
@@ -707,10 +709,10 @@ func TestMissingTrieNodes(t *testing.T) {
 	state, _ := New(common.Hash{}, db, nil)
 	addr := toAddr([]byte("so"))
 	{
-		state.SetBalance(addr, big.NewInt(1))
+		state.SetBalance(addr, big.NewInt(1), tracing.BalanceChangeUnspecified)
 		state.SetCode(addr, []byte{1, 2, 3})
 		a2 := toAddr([]byte("another"))
-		state.SetBalance(a2, big.NewInt(100))
+		state.SetBalance(a2, big.NewInt(100), tracing.BalanceChangeUnspecified)
 		state.SetCode(a2, []byte{1, 2, 4})
 		root, _ = state.Commit(false)
 		t.Logf("root: %x", root)
@@ -735,7 +737,7 @@ func TestMissingTrieNodes(t *testing.T) {
 		t.Errorf("expected %d, got %d", exp, got)
 	}
 	// Modify the state
-	state.SetBalance(addr, big.NewInt(2))
+	state.SetBalance(addr, big.NewInt(2), tracing.BalanceChangeUnspecified)
 	root, err := state.Commit(false)
 	if err == nil {
 		t.Fatalf("expected error, got root :%x", root)
@@ -915,3 +917,114 @@ func TestStateDBAccessList(t *testing.T) {
 		t.Fatalf("expected empty, got %d", got)
 	}
 }
+
+// stateLogRecorder is a tracing.StateLogger recording all the notifications in
+// a textual form.
+type stateLogRecorder struct {
+	logs []string
+}
+
+func (r *stateLogRecorder) OnBalanceChange(addr common.Address, prev, new *big.Int, reason tracing.BalanceChangeReason) {
+	r.logs = append(r.logs, fmt.Sprintf("balance %x: %v -> %v (%v)", addr[:1], prev, new, reason))
+}
+
+func (r *stateLogRecorder) OnNonceChange(addr common.Address, prev, new uint64) {
+	r.logs = append(r.logs, fmt.Sprintf("nonce %x: %d -> %d", addr[:1], prev, new))
+}
+
+func (r *stateLogRecorder) OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+	r.logs = append(r.logs, fmt.Sprintf("code %x: %x -> %x", addr[:1], prevCode, code))
+}
+
+func (r *stateLogRecorder) OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+	r.logs = append(r.logs, fmt.Sprintf("storage %x[%x]: %x -> %x", addr[:1], slot[:1], prev[:1], new[:1]))
+}
+
+func (r *stateLogRecorder) OnAccountDeleted(addr common.Address) {
+	r.logs = append(r.logs, fmt.Sprintf("deleted %x", addr[:1]))
+}
+
+// Tests that the state logger is notified about all modifications of the state,
+// and that reverted modifications are reported again in reverse order.
+func TestStateLogger(t *testing.T) {
+	var (
+		state, _ = New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		recorder = new(stateLogRecorder)
+		addr     = common.Address{0x01}
+	)
+	state.SetLogger(recorder)
+
+	state.AddBalance(addr, big.NewInt(100), tracing.BalanceIncreaseGenesisBalance)
+	state.AddBalance(addr, new(big.Int), tracing.BalanceChangeTouchAccount) // no-op, not reported
+	state.SetNonce(addr, 1)
+
+	snapshot := state.Snapshot()
+	state.SubBalance(addr, big.NewInt(40), tracing.BalanceChangeTransfer)
+	state.SetNonce(addr, 2)
+	state.SetCode(addr, []byte{0xfe})
+	state.SetState(addr, common.Hash{0x02}, common.Hash{0x03})
+	state.RevertToSnapshot(snapshot)
+
+	want := []string{
+		"balance 01: 0 -> 100 (genesis-balance)",
+		"nonce 01: 0 -> 1",
+		"balance 01: 100 -> 60 (transfer)",
+		"nonce 01: 1 -> 2",
+		"code 01:  -> fe",
+		"storage 01[02]: 00 -> 03",
+		"storage 01[02]: 03 -> 00",
+		"code 01: fe -> ",
+		"nonce 01: 2 -> 1",
+		"balance 01: 60 -> 100 (revert)",
+	}
+	if !reflect.DeepEqual(recorder.logs, want) {
+		t.Fatalf("notification mismatch:\nhave %q\nwant %q", recorder.logs, want)
+	}
+	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("balance mismatch after revert: have %v, want 100", balance)
+	}
+}
+
+// Tests that the state logger is notified about the accounts removed when the
+// state is finalised, along with the ether burnt by self destructed contracts.
+func TestStateLoggerDeletions(t *testing.T) {
+	var (
+		state, _ = New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		recorder = new(stateLogRecorder)
+		suicided = common.Address{0x01}
+		empty    = common.Address{0x02}
+		kept     = common.Address{0x03}
+	)
+	state.AddBalance(suicided, big.NewInt(100), tracing.BalanceIncreaseGenesisBalance)
+	state.SetCode(suicided, []byte{0xff})
+	state.AddBalance(kept, big.NewInt(100), tracing.BalanceIncreaseGenesisBalance)
+	state.Finalise(true)
+
+	state.SetLogger(recorder)
+
+	// Self destruct a contract and send it some more ether afterwards, as well
+	// as touching an empty and a non empty account
+	state.Suicide(suicided)
+	state.AddBalance(suicided, big.NewInt(5), tracing.BalanceChangeTransfer)
+	state.AddBalance(empty, new(big.Int), tracing.BalanceChangeTouchAccount)
+	state.AddBalance(kept, new(big.Int), tracing.BalanceChangeTouchAccount)
+	state.Finalise(true)
+
+	// Finalising again must not report the removals twice
+	state.Finalise(true)
+
+	sort.Strings(recorder.logs[2:]) // deletion order follows map iteration
+	want := []string{
+		"balance 01: 100 -> 0 (selfdestruct)",
+		"balance 01: 0 -> 5 (transfer)",
+		"balance 01: 5 -> 0 (selfdestruct-burn)",
+		"deleted 01",
+		"deleted 02",
+	}
+	if !reflect.DeepEqual(recorder.logs, want) {
+		t.Fatalf("notification mismatch:\nhave %q\nwant %q", recorder.logs, want)
+	}
+	if state.Exist(suicided) || state.Exist(empty) || !state.Exist(kept) {
+		t.Fatalf("existence mismatch: suicided %v, empty %v, kept %v", state.Exist(suicided), state.Exist(empty), state.Exist(kept))
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tracing defines the hooks through which a live tracer is notified
+// about the blocks and transactions imported into the chain, along with every
+// modification they make to the state.
+package tracing
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BalanceChangeReason is the cause of a change in the balance of an account.
+type BalanceChangeReason byte
+
+const (
+	BalanceChangeUnspecified BalanceChangeReason = iota
+
+	// Issuance of new ether.
+	BalanceIncreaseRewardMineBlock // Block reward of the miner
+	BalanceIncreaseRewardMineUncle // Block reward of an uncle miner
+	BalanceIncreaseGenesisBalance  // Ether allocated in the genesis block
+
+	// Transaction fees.
+	BalanceDecreaseGasBuy               // Sender buying the gas allowance of a transaction
+	BalanceIncreaseGasReturn            // Sender refunded for the gas left over
+	BalanceIncreaseRewardTransactionFee // Coinbase receiving the transaction fee
+
+	// Transfers during execution.
+	BalanceChangeTransfer           // Value transferred by a call or contract creation
+	BalanceChangeTouchAccount       // Zero value transfer touching an account
+	BalanceIncreaseSelfdestruct     // Beneficiary of a self destruct
+	BalanceDecreaseSelfdestruct     // Self destructed contract losing its balance
+	BalanceDecreaseSelfdestructBurn // Ether sent to a self destructed contract, burnt on its removal
+
+	// Irregular state transitions.
+	BalanceIncreaseDaoContract // DAO refund contract receiving the drained ether
+	BalanceDecreaseDaoAccount  // DAO account being drained
+
+	// BalanceChangeRevert is reported when a balance change is undone because
+	// the call frame or transaction that made it was reverted.
+	BalanceChangeRevert
+)
+
+// String implements the fmt.Stringer interface.
+func (r BalanceChangeReason) String() string {
+	switch r {
+	case BalanceChangeUnspecified:
+		return "unspecified"
+	case BalanceIncreaseRewardMineBlock:
+		return "reward-mine-block"
+	case BalanceIncreaseRewardMineUncle:
+		return "reward-mine-uncle"
+	case BalanceIncreaseGenesisBalance:
+		return "genesis-balance"
+	case BalanceDecreaseGasBuy:
+		return "gas-buy"
+	case BalanceIncreaseGasReturn:
+		return "gas-return"
+	case BalanceIncreaseRewardTransactionFee:
+		return "reward-transaction-fee"
+	case BalanceChangeTransfer:
+		return "transfer"
+	case BalanceChangeTouchAccount:
+		return "touch-account"
+	case BalanceIncreaseSelfdestruct:
+		return "selfdestruct-beneficiary"
+	case BalanceDecreaseSelfdestruct:
+		return "selfdestruct"
+	case BalanceDecreaseSelfdestructBurn:
+		return "selfdestruct-burn"
+	case BalanceIncreaseDaoContract:
+		return "dao-contract"
+	case BalanceDecreaseDaoAccount:
+		return "dao-account"
+	case BalanceChangeRevert:
+		return "revert"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(r))
+	}
+}
+
+// StateLogger is notified about every modification made to the accounts in the
+// state database. Changes undone by a revert are reported again in reverse, so
+// the sum of all the notifications always matches the final state.
+type StateLogger interface {
+	// OnBalanceChange is called when the balance of an account changes.
+	OnBalanceChange(addr common.Address, prev, new *big.Int, reason BalanceChangeReason)
+
+	// OnNonceChange is called when the nonce of an account changes.
+	OnNonceChange(addr common.Address, prev, new uint64)
+
+	// OnCodeChange is called when the code of an account changes.
+	OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte)
+
+	// OnStorageChange is called when a storage slot of an account changes.
+	OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash)
+
+	// OnAccountDeleted is called when an account is removed from the state at
+	// the end of a transaction, either because it self destructed or because it
+	// was touched while empty (EIP-158). Its nonce, code and storage are dropped
+	// along with it without separate notifications.
+	OnAccountDeleted(addr common.Address)
+}
+
+// LiveTracer is notified about the blocks and transactions processed during
+// the chain import, as well as all the state changes they make. Opcode level
+// tracing is still done through the vm.Tracer interface.
+//
+// Note, the notifications are delivered synchronously from the import, so any
+// slow processing directly stalls the chain.
+type LiveTracer interface {
+	StateLogger
+
+	// OnBlockStart is called before the transactions of a block are processed.
+	OnBlockStart(block *types.Block)
+
+	// OnBlockEnd is called after the block was processed and written into the
+	// chain, or with the reason why it was rejected.
+	OnBlockEnd(err error)
+
+	// OnTxStart is called before a transaction is applied.
+	OnTxStart(tx *types.Transaction, from common.Address)
+
+	// OnTxEnd is called after a transaction was applied, with its receipt or
+	// the error making it invalid.
+	OnTxEnd(receipt *types.Receipt, err error)
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxValidator is an admission policy of the transaction pool. Every transaction
+// entering the pool is checked against the built-in rules first and is then run
+// through the configured validators, being rejected on the first error returned.
+type TxValidator interface {
+	// ValidateTx checks whether a transaction may be accepted into the pool. The
+	// local flag reports whether the transaction was submitted via the local APIs,
+	// the environment can be used to check whether its sender is also local.
+	ValidateTx(env *TxValidationEnv, tx *types.Transaction, local bool) error
+}
+
+// TxValidationEnv is the pool state a validator may consult when deciding over
+// the admission of a transaction.
+//
+// Note, the environment is only valid for the duration of the validation call
+// and the state database must not be modified.
+type TxValidationEnv struct {
+	Signer   types.Signer   // Signer to derive transaction senders with
+	State    *state.StateDB // State of the current head block
+	GasPrice *big.Int       // Minimum gas price enforced for remote transactions
+	MaxGas   uint64         // Gas limit of the current head block
+
+	Istanbul bool // Fork indicator whether we are in the istanbul stage
+	EIP2718  bool // Fork indicator whether we are using EIP-2718 type transactions
+
+	locals *accountSet // Set of accounts considered local by the pool
+}
+
+// IsLocal reports whether the given account is treated as local by the pool.
+func (env *TxValidationEnv) IsLocal(addr common.Address) bool {
+	return env.locals.contains(addr)
+}
+
+// defaultTxValidator is the built-in admission policy of the transaction pool.
+// It checks transactions against the consensus rules and enforces some heuristic
+// limits of the local node (price and size).
+//
+// The built-in checks always run before any custom validators, which can only
+// restrict the admission further, since the pool relies on them to accept valid
+// transactions with a recoverable sender only.
+type defaultTxValidator struct{}
+
+// ValidateTx implements TxValidator, checking whether a transaction is valid
+// according to the consensus rules and the local node's limits.
+func (defaultTxValidator) ValidateTx(env *TxValidationEnv, tx *types.Transaction, local bool) error {
+	// Accept only legacy transactions until EIP-2718/2930 activates.
+	if !env.EIP2718 && tx.Type() != types.LegacyTxType {
+		return ErrTxTypeNotSupported
+	}
+	// Reject transactions over defined size to prevent DOS attacks
+	if uint64(tx.Size()) > txMaxSize {
+		return ErrOversizedData
+	}
+	// Transactions can't be negative. This may never happen using RLP decoded
+	// transactions but may occur if you create a transaction using the RPC.
+	if tx.Value().Sign() < 0 {
+		return ErrNegativeValue
+	}
+	// Ensure the transaction doesn't exceed the current block limit gas.
+	if env.MaxGas < tx.Gas() {
+		return ErrGasLimit
+	}
+	// Make sure the transaction is signed properly
+	from, err := types.Sender(env.Signer, tx)
+	if err != nil {
+		return ErrInvalidSender
+	}
+	// Drop non-local transactions under our own minimal accepted gas price
+	local = local || env.IsLocal(from) // account may be local even if the transaction arrived from the network
+	if !local && tx.GasPriceIntCmp(env.GasPrice) < 0 {
+		return ErrUnderpriced
+	}
+	// Ensure the transaction adheres to nonce ordering
+	if env.State.GetNonce(from) > tx.Nonce() {
+		return ErrNonceTooLow
+	}
+	// Transactor should have enough funds to cover the costs
+	// cost == V + GP * GL
+	if env.State.GetBalance(from).Cmp(tx.Cost()) < 0 {
+		return ErrInsufficientFunds
+	}
+	// Ensure the transaction has more gas than the basic tx fee.
+	intrGas, err := IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, true, env.Istanbul)
+	if err != nil {
+		return err
+	}
+	if tx.Gas() < intrGas {
+		return ErrIntrinsicGas
+	}
+	return nil
+}
+
+// TxIterator yields executable transactions in the order they should be
+// included into a block.
+type TxIterator interface {
+	// Peek returns the next transaction to include, nil if the set is exhausted.
+	Peek() *types.Transaction
+
+	// Shift replaces the current transaction with the next one from the same
+	// account.
+	Shift()
+
+	// Pop removes the current transaction without replacing it with the next
+	// one from the same account. This should be used when a transaction cannot
+	// be executed and hence all subsequent ones should be discarded too.
+	Pop()
+}
+
+// TxOrdering is a strategy to arrange the pending transactions of the pool for
+// block inclusion.
+type TxOrdering interface {
+	// Order creates an iterator over the given executable transactions, grouped
+	// by sender and sorted by nonce. Implementations may interleave accounts in
+	// any order, but must honour the nonce order within a single account.
+	//
+	// Note, the input map is reowned so the caller should not interact any more
+	// with it after providing it to the ordering.
+	Order(signer types.Signer, txs map[common.Address]types.Transactions) TxIterator
+}
+
+// PriceAndNonceOrdering is the built-in ordering strategy of the transaction
+// pool, returning transactions in a profit-maximizing, nonce-honouring order.
+type PriceAndNonceOrdering struct{}
+
+// Order implements TxOrdering, sorting transactions by gas price and nonce.
+func (PriceAndNonceOrdering) Order(signer types.Signer, txs map[common.Address]types.Transactions) TxIterator {
+	return types.NewTransactionsByPriceAndNonce(signer, txs)
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var errNotWhitelisted = errors.New("sender not whitelisted")
+
+// whitelistValidator is an admission policy only accepting transactions from a
+// fixed set of senders.
+type whitelistValidator map[common.Address]bool
+
+func (w whitelistValidator) ValidateTx(env *TxValidationEnv, tx *types.Transaction, local bool) error {
+	from, err := types.Sender(env.Signer, tx)
+	if err != nil {
+		return ErrInvalidSender
+	}
+	if !w[from] {
+		return errNotWhitelisted
+	}
+	return nil
+}
+
+// permissiveValidator is an admission policy accepting every transaction.
+type permissiveValidator struct{}
+
+func (permissiveValidator) ValidateTx(env *TxValidationEnv, tx *types.Transaction, local bool) error {
+	return nil
+}
+
+// Tests that custom admission policies are consulted by the pool on top of the
+// built-in checks, which they cannot disable.
+func TestTransactionCustomValidator(t *testing.T) {
+	t.Parallel()
+
+	allowKey, _ := crypto.GenerateKey()
+	denyKey, _ := crypto.GenerateKey()
+
+	allowed := crypto.PubkeyToAddress(allowKey.PublicKey)
+	denied := crypto.PubkeyToAddress(denyKey.PublicKey)
+
+	config := testTxPoolConfig
+	config.Validators = []TxValidator{whitelistValidator{allowed: true}}
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// Unfunded whitelisted senders are still rejected by the built-in checks
+	if err := pool.AddRemote(transaction(0, 100000, allowKey)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("unfunded whitelisted sender: have %v, want %v", err, ErrInsufficientFunds)
+	}
+	pool.currentState.AddBalance(allowed, big.NewInt(1000000000), tracing.BalanceChangeUnspecified)
+	pool.currentState.AddBalance(denied, big.NewInt(1000000000), tracing.BalanceChangeUnspecified)
+
+	// Funded senders are accepted only if whitelisted
+	if err := pool.AddRemote(transaction(0, 100000, allowKey)); err != nil {
+		t.Errorf("whitelisted sender rejected: %v", err)
+	}
+	if err := pool.AddRemote(transaction(0, 100000, denyKey)); !errors.Is(err, errNotWhitelisted) {
+		t.Errorf("non-whitelisted sender: have %v, want %v", err, errNotWhitelisted)
+	}
+	if err := pool.AddLocal(transaction(0, 100000, denyKey)); !errors.Is(err, errNotWhitelisted) {
+		t.Errorf("non-whitelisted local sender: have %v, want %v", err, errNotWhitelisted)
+	}
+	if pending, queued := pool.Stats(); pending != 1 || queued != 0 {
+		t.Errorf("pool stats mismatch: have %d/%d, want %d/%d", pending, queued, 1, 0)
+	}
+	// Transactions violating the consensus rules are rejected before reaching the
+	// custom policies, even if those would accept anything
+	config.Validators = []TxValidator{permissiveValidator{}}
+	lax := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer lax.Stop()
+
+	if err := lax.AddRemote(transaction(1, 100, allowKey)); !errors.Is(err, ErrIntrinsicGas) {
+		t.Errorf("underpaying transaction: have %v, want %v", err, ErrIntrinsicGas)
+	}
+	unsigned := types.NewTransaction(0, common.Address{}, big.NewInt(100), 100000, big.NewInt(1), nil)
+	if err := lax.AddRemote(unsigned); !errors.Is(err, ErrInvalidSender) {
+		t.Errorf("unsigned transaction: have %v, want %v", err, ErrInvalidSender)
+	}
+}
+
+// senderOrdering is a pending ordering strategy that includes the transactions
+// of accounts in a fixed priority order, irrelevant of their gas prices.
+type senderOrdering []common.Address
+
+func (o senderOrdering) Order(signer types.Signer, txs map[common.Address]types.Transactions) TxIterator {
+	it := new(senderIterator)
+	for _, addr := range o {
+		if len(txs[addr]) > 0 {
+			it.txs = append(it.txs, txs[addr])
+		}
+	}
+	return it
+}
+
+// senderIterator iterates over a list of nonce sorted transaction batches.
+type senderIterator struct {
+	txs []types.Transactions
+}
+
+func (it *senderIterator) Peek() *types.Transaction {
+	if len(it.txs) == 0 {
+		return nil
+	}
+	return it.txs[0][0]
+}
+
+func (it *senderIterator) Shift() {
+	if it.txs[0] = it.txs[0][1:]; len(it.txs[0]) == 0 {
+		it.txs = it.txs[1:]
+	}
+}
+
+func (it *senderIterator) Pop() {
+	it.txs = it.txs[1:]
+}
+
+// Tests that the pool defaults to ordering pending transactions by price and
+// nonce, and that a custom ordering strategy can be configured instead.
+func TestTransactionCustomOrdering(t *testing.T) {
+	t.Parallel()
+
+	cheapKey, _ := crypto.GenerateKey()
+	priceyKey, _ := crypto.GenerateKey()
+
+	cheap := crypto.PubkeyToAddress(cheapKey.PublicKey)
+	pricey := crypto.PubkeyToAddress(priceyKey.PublicKey)
+
+	pending := func() map[common.Address]types.Transactions {
+		return map[common.Address]types.Transactions{
+			cheap: {
+				pricedTransaction(0, 100000, big.NewInt(1), cheapKey),
+				pricedTransaction(1, 100000, big.NewInt(1), cheapKey),
+			},
+			pricey: {
+				pricedTransaction(0, 100000, big.NewInt(10), priceyKey),
+			},
+		}
+	}
+	order := func(it TxIterator) (senders []common.Address) {
+		for tx := it.Peek(); tx != nil; tx = it.Peek() {
+			from, _ := deriveSender(tx)
+			senders = append(senders, from)
+			it.Shift()
+		}
+		return senders
+	}
+	// The default pool should order by price
+	pool, _ := setupTxPool()
+	defer pool.Stop()
+
+	if _, ok := pool.Ordering().(PriceAndNonceOrdering); !ok {
+		t.Fatalf("default ordering mismatch: have %T, want %T", pool.Ordering(), PriceAndNonceOrdering{})
+	}
+	have := order(pool.Ordering().Order(pool.signer, pending()))
+	if want := []common.Address{pricey, cheap, cheap}; !reflect.DeepEqual(have, want) {
+		t.Errorf("default ordering mismatch: have %x, want %x", have, want)
+	}
+	// A custom ordering should override the prices
+	config := testTxPoolConfig
+	config.Ordering = senderOrdering{cheap, pricey}
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	custom := NewTxPool(config, params.TestChainConfig, &testBlockChain{statedb, 1000000, new(event.Feed)})
+	defer custom.Stop()
+
+	have = order(custom.Ordering().Order(custom.signer, pending()))
+	if want := []common.Address{cheap, cheap, pricey}; !reflect.DeepEqual(have, want) {
+		t.Errorf("custom ordering mismatch: have %x, want %x", have, want)
+	}
+}
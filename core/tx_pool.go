@@ -148,6 +148,12 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	PrivateLifetime uint64 // Number of blocks private transactions are withheld from the network
+	PrivateDrop     bool   // Whether expired private transactions are dropped instead of broadcast
+
+	Validators []TxValidator `toml:"-"` // Extra admission policies to vet transactions with after the built-in checks
+	Ordering   TxOrdering    `toml:"-"` // Strategy to order executable transactions for inclusion (nil = PriceAndNonceOrdering)
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -165,6 +171,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	PrivateLifetime: 25,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -203,6 +211,13 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.PrivateLifetime < 1 {
+		log.Warn("Sanitizing invalid txpool private lifetime", "provided", conf.PrivateLifetime, "updated", DefaultTxPoolConfig.PrivateLifetime)
+		conf.PrivateLifetime = DefaultTxPoolConfig.PrivateLifetime
+	}
+	if conf.Ordering == nil {
+		conf.Ordering = PriceAndNonceOrdering{}
+	}
 	return conf
 }
 
@@ -219,15 +234,18 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	releaseFeed event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
 
 	istanbul bool // Fork indicator whether we are in the istanbul stage.
+	eip2718  bool // Fork indicator whether we are using EIP-2718 type transactions.
 
 	currentState  *state.StateDB // Current state in the blockchain head
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
 	currentMaxGas uint64         // Current gas limit for transaction caps
+	currentNumber uint64         // Current block number the pool is synced to
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
@@ -237,6 +255,7 @@ type TxPool struct {
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	private map[common.Hash]uint64       // Transactions withheld from the network, mapped to their expiry block
 
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
@@ -263,11 +282,12 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		config:          config,
 		chainconfig:     chainconfig,
 		chain:           chain,
-		signer:          types.NewEIP155Signer(chainconfig.ChainID),
+		signer:          types.LatestSigner(chainconfig),
 		pending:         make(map[common.Address]*txList),
 		queue:           make(map[common.Address]*txList),
 		beats:           make(map[common.Address]time.Time),
 		all:             newTxLookup(),
+		private:         make(map[common.Hash]uint64),
 		chainHeadCh:     make(chan ChainHeadEvent, chainHeadChanSize),
 		reqResetCh:      make(chan *txpoolResetRequest),
 		reqPromoteCh:    make(chan *accountSet),
@@ -406,6 +426,12 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeReleasedTxsEvent registers a subscription of ReleasedTxsEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeReleasedTxsEvent(ch chan<- ReleasedTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.releaseFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -476,6 +502,23 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// ContentFrom retrieves the data content of the transaction pool, returning the
+// pending as well as queued transactions of this address, sorted by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var pending types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	var queued types.Transactions
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
 // Pending retrieves all currently processable transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -490,6 +533,12 @@ func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 	return pending, nil
 }
 
+// Ordering returns the strategy to arrange pending transactions for block
+// inclusion with.
+func (pool *TxPool) Ordering() TxOrdering {
+	return pool.config.Ordering
+}
+
 // Locals retrieves the accounts currently considered local by the pool.
 func (pool *TxPool) Locals() []common.Address {
 	pool.mu.Lock()
@@ -505,57 +554,34 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
 		if pending := pool.pending[addr]; pending != nil {
-			txs[addr] = append(txs[addr], pending.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(pending.Flatten())...)
 		}
 		if queued := pool.queue[addr]; queued != nil {
-			txs[addr] = append(txs[addr], queued.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(queued.Flatten())...)
 		}
 	}
 	return txs
 }
 
-// validateTx checks whether a transaction is valid according to the consensus
-// rules and adheres to some heuristic limits of the local node (price and size).
+// validateTx checks whether a transaction passes the built-in consensus checks
+// and all the extra admission policies configured for the pool.
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
-	// Reject transactions over defined size to prevent DOS attacks
-	if uint64(tx.Size()) > txMaxSize {
-		return ErrOversizedData
-	}
-	// Transactions can't be negative. This may never happen using RLP decoded
-	// transactions but may occur if you create a transaction using the RPC.
-	if tx.Value().Sign() < 0 {
-		return ErrNegativeValue
-	}
-	// Ensure the transaction doesn't exceed the current block limit gas.
-	if pool.currentMaxGas < tx.Gas() {
-		return ErrGasLimit
-	}
-	// Make sure the transaction is signed properly
-	from, err := types.Sender(pool.signer, tx)
-	if err != nil {
-		return ErrInvalidSender
-	}
-	// Drop non-local transactions under our own minimal accepted gas price
-	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !local && tx.GasPriceIntCmp(pool.gasPrice) < 0 {
-		return ErrUnderpriced
-	}
-	// Ensure the transaction adheres to nonce ordering
-	if pool.currentState.GetNonce(from) > tx.Nonce() {
-		return ErrNonceTooLow
-	}
-	// Transactor should have enough funds to cover the costs
-	// cost == V + GP * GL
-	if pool.currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
-		return ErrInsufficientFunds
-	}
-	// Ensure the transaction has more gas than the basic tx fee.
-	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, true, pool.istanbul)
-	if err != nil {
+	env := &TxValidationEnv{
+		Signer:   pool.signer,
+		State:    pool.currentState,
+		GasPrice: pool.gasPrice,
+		MaxGas:   pool.currentMaxGas,
+		Istanbul: pool.istanbul,
+		EIP2718:  pool.eip2718,
+		locals:   pool.locals,
+	}
+	if err := (defaultTxValidator{}).ValidateTx(env, tx, local); err != nil {
 		return err
 	}
-	if tx.Gas() < intrGas {
-		return ErrIntrinsicGas
+	for _, validator := range pool.config.Validators {
+		if err := validator.ValidateTx(env, tx, local); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -685,6 +711,10 @@ func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
 	if pool.journal == nil || !pool.locals.contains(from) {
 		return
 	}
+	// Private transactions must not leak out, not even after a restart
+	if _, ok := pool.private[tx.Hash()]; ok {
+		return
+	}
 	if err := pool.journal.insert(tx); err != nil {
 		log.Warn("Failed to journal local transaction", "err", err)
 	}
@@ -747,6 +777,87 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// AddPrivate enqueues a single local transaction into the pool if it is valid,
+// marking it private. Private transactions are not announced to the network
+// but are kept for inclusion by the local miner only, until they expire after
+// the configured number of blocks. Expired transactions are either dropped or
+// released for regular broadcast.
+//
+// Transactions already known to the pool cannot be made private anymore.
+func (pool *TxPool) AddPrivate(tx *types.Transaction) error {
+	hash := tx.Hash()
+
+	pool.mu.Lock()
+	if pool.all.Get(hash) != nil {
+		pool.mu.Unlock()
+		return ErrAlreadyKnown
+	}
+	pool.private[hash] = pool.currentNumber + pool.config.PrivateLifetime
+	pool.mu.Unlock()
+
+	if err := pool.addTxs([]*types.Transaction{tx}, !pool.config.NoLocals, true)[0]; err != nil {
+		pool.mu.Lock()
+		delete(pool.private, hash)
+		pool.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// IsPrivate reports whether the transaction with the given hash is withheld
+// from the network.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	_, ok := pool.private[hash]
+	return ok
+}
+
+// public filters out all the private transactions from the given list.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) public(txs types.Transactions) types.Transactions {
+	if len(pool.private) == 0 {
+		return txs
+	}
+	public := make(types.Transactions, 0, len(txs))
+	for _, tx := range txs {
+		if _, ok := pool.private[tx.Hash()]; !ok {
+			public = append(public, tx)
+		}
+	}
+	return public
+}
+
+// expirePrivate lifts the privacy of all transactions that were withheld from
+// the network for long enough, dropping them from the pool or returning them
+// for broadcast as configured.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) expirePrivate() types.Transactions {
+	var released types.Transactions
+	for hash, expiry := range pool.private {
+		if expiry > pool.currentNumber {
+			continue
+		}
+		delete(pool.private, hash)
+
+		tx := pool.all.Get(hash)
+		if tx == nil {
+			continue // Included or replaced meanwhile
+		}
+		if pool.config.PrivateDrop {
+			log.Trace("Dropping expired private transaction", "hash", hash)
+			pool.removeTx(hash, true)
+			continue
+		}
+		log.Trace("Releasing expired private transaction", "hash", hash)
+		released = append(released, tx)
+	}
+	return released
+}
+
 // AddRemotes enqueues a batch of transactions into the pool if they are valid. If the
 // senders are not among the locally tracked ones, full pricing constraints will apply.
 //
@@ -796,6 +907,10 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 		_, err := types.Sender(pool.signer, tx)
 		if err != nil {
 			errs[i] = ErrInvalidSender
+			if err == types.ErrTxTypeNotSupported {
+				// The signer doesn't know about the transaction type yet
+				errs[i] = ErrTxTypeNotSupported
+			}
 			invalidTxMeter.Mark(1)
 			continue
 		}
@@ -889,6 +1004,7 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 
 	// Remove it from the list of known transactions
 	pool.all.Remove(hash)
+	delete(pool.private, hash)
 	if outofbound {
 		pool.priced.Removed(1)
 	}
@@ -1032,7 +1148,10 @@ func (pool *TxPool) scheduleReorgLoop() {
 func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirtyAccounts *accountSet, events map[common.Address]*txSortedMap) {
 	defer close(done)
 
-	var promoteAddrs []common.Address
+	var (
+		promoteAddrs []common.Address
+		released     types.Transactions
+	)
 	if dirtyAccounts != nil && reset == nil {
 		// Only dirty accounts need to be promoted, unless we're resetting.
 		// For resets, all addresses in the tx queue will be promoted and
@@ -1044,6 +1163,9 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		// Reset from the old head to the new, rescheduling any reorged transactions
 		pool.reset(reset.oldHead, reset.newHead)
 
+		// Private transactions may have expired with the new head, release them
+		released = pool.expirePrivate()
+
 		// Nonces were reset, discard any events that became stale
 		for addr := range events {
 			events[addr].Forward(pool.pendingNonces.get(addr))
@@ -1092,6 +1214,9 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		}
 		pool.txFeed.Send(NewTxsEvent{txs})
 	}
+	if len(released) > 0 {
+		pool.releaseFeed.Send(ReleasedTxsEvent{released})
+	}
 }
 
 // reset retrieves the current state of the blockchain and ensures the content
@@ -1171,6 +1296,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.currentState = statedb
 	pool.pendingNonces = newTxNoncer(statedb)
 	pool.currentMaxGas = newHead.GasLimit
+	pool.currentNumber = newHead.Number.Uint64()
 
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
@@ -1180,6 +1306,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Update all fork indicator by next pending block number.
 	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
 	pool.istanbul = pool.chainconfig.IsIstanbul(next)
+	pool.eip2718 = pool.chainconfig.IsYoloV2(next)
 }
 
 // promoteExecutables moves transactions that have become processable from the
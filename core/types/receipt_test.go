@@ -154,9 +154,17 @@ func encodeAsV3StoredReceiptRLP(want *Receipt) ([]byte, error) {
 // Tests that receipt data can be correctly derived from the contextual infos
 func TestDeriveFields(t *testing.T) {
 	// Create a few transactions to have receipts for
+	to3 := common.HexToAddress("0x3")
 	txs := Transactions{
 		NewContractCreation(1, big.NewInt(1), 1, big.NewInt(1), nil),
 		NewTransaction(2, common.HexToAddress("0x2"), big.NewInt(2), 2, big.NewInt(2), nil),
+		NewTx(&AccessListTx{
+			Nonce:    3,
+			To:       &to3,
+			Value:    big.NewInt(3),
+			Gas:      3,
+			GasPrice: big.NewInt(3),
+		}),
 	}
 	// Create the corresponding receipts
 	receipts := Receipts{
@@ -182,6 +190,18 @@ func TestDeriveFields(t *testing.T) {
 			ContractAddress: common.BytesToAddress([]byte{0x02, 0x22, 0x22}),
 			GasUsed:         2,
 		},
+		&Receipt{
+			Type:              AccessListTxType,
+			PostState:         common.Hash{3}.Bytes(),
+			CumulativeGasUsed: 6,
+			Logs: []*Log{
+				{Address: common.BytesToAddress([]byte{0x33})},
+				{Address: common.BytesToAddress([]byte{0x03, 0x33})},
+			},
+			TxHash:          txs[2].Hash(),
+			ContractAddress: common.BytesToAddress([]byte{0x03, 0x33, 0x33}),
+			GasUsed:         3,
+		},
 	}
 	// Clear all the computed fields and re-derive them
 	number := big.NewInt(1)
@@ -196,6 +216,9 @@ func TestDeriveFields(t *testing.T) {
 
 	logIndex := uint(0)
 	for i := range receipts {
+		if receipts[i].Type != txs[i].Type() {
+			t.Errorf("receipts[%d].Type = %d, want %d", i, receipts[i].Type, txs[i].Type())
+		}
 		if receipts[i].TxHash != txs[i].Hash() {
 			t.Errorf("receipts[%d].TxHash = %s, want %s", i, receipts[i].TxHash.String(), txs[i].Hash().String())
 		}
@@ -243,6 +266,53 @@ func TestDeriveFields(t *testing.T) {
 	}
 }
 
+// Tests that typed receipts survive a round trip through both their RLP and
+// their binary encodings, and that legacy receipts keep their original format.
+func TestTypedReceiptEncodeDecode(t *testing.T) {
+	for _, typ := range []uint8{LegacyTxType, AccessListTxType} {
+		receipt := &Receipt{
+			Type:              typ,
+			Status:            ReceiptStatusSuccessful,
+			CumulativeGasUsed: 1,
+			Logs: []*Log{
+				{Address: common.BytesToAddress([]byte{0x11}), Topics: []common.Hash{{1}}, Data: []byte{0x01}},
+			},
+		}
+		receipt.Bloom = CreateBloom(Receipts{receipt})
+
+		// Round trip through the RLP encoding used in network messages
+		enc, err := rlp.EncodeToBytes(receipt)
+		if err != nil {
+			t.Fatalf("type %d: rlp encoding failed: %v", typ, err)
+		}
+		var dec Receipt
+		if err := rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatalf("type %d: rlp decoding failed: %v", typ, err)
+		}
+		if dec.Type != typ || dec.Status != receipt.Status || dec.Bloom != receipt.Bloom || len(dec.Logs) != 1 {
+			t.Fatalf("type %d: rlp round trip mismatch: have %+v, want %+v", typ, dec, receipt)
+		}
+		// Round trip through the binary encoding used for the receipt trie
+		bin, err := receipt.MarshalBinary()
+		if err != nil {
+			t.Fatalf("type %d: binary encoding failed: %v", typ, err)
+		}
+		if typ == LegacyTxType && !bytes.Equal(bin, enc) {
+			t.Fatalf("legacy binary encoding mismatch: have %x, want %x", bin, enc)
+		}
+		if typ != LegacyTxType && bin[0] != typ {
+			t.Fatalf("type %d: binary encoding prefix mismatch: have %d", typ, bin[0])
+		}
+		dec = Receipt{}
+		if err := dec.UnmarshalBinary(bin); err != nil {
+			t.Fatalf("type %d: binary decoding failed: %v", typ, err)
+		}
+		if dec.Type != typ || dec.CumulativeGasUsed != receipt.CumulativeGasUsed {
+			t.Fatalf("type %d: binary round trip mismatch: have %+v, want %+v", typ, dec, receipt)
+		}
+	}
+}
+
 func clearComputedFieldsOnReceipts(t *testing.T, receipts Receipts) {
 	t.Helper()
 
@@ -254,6 +324,7 @@ func clearComputedFieldsOnReceipts(t *testing.T, receipts Receipts) {
 func clearComputedFieldsOnReceipt(t *testing.T, receipt *Receipt) {
 	t.Helper()
 
+	receipt.Type = 0x71
 	receipt.TxHash = common.Hash{}
 	receipt.BlockHash = common.Hash{}
 	receipt.BlockNumber = big.NewInt(math.MaxUint32)
@@ -0,0 +1,70 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+func TestAccessListTracer(t *testing.T) {
+	var (
+		env      = NewEVM(BlockContext{}, TxContext{}, &dummyStatedb{}, params.TestChainConfig, Config{})
+		from     = common.HexToAddress("0x01")
+		to       = common.HexToAddress("0x02")
+		other    = common.HexToAddress("0x03")
+		precomp  = common.BytesToAddress([]byte{1})
+		mem      = NewMemory()
+		rstack   = newReturnStack()
+		contract = NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 0)
+	)
+	tracer := NewAccessListTracer(nil, from, to, []common.Address{precomp})
+
+	// Storage accesses are recorded against the executing contract
+	stack := newstack()
+	stack.push(uint256.NewInt().SetUint64(7))
+	tracer.CaptureState(env, 0, SLOAD, 0, 0, mem, stack, rstack, nil, contract, 0, nil)
+
+	// Account accesses are recorded unless the account is implicitly warm
+	for _, addr := range []common.Address{from, to, other} {
+		stack := newstack()
+		stack.push(new(uint256.Int).SetBytes(addr.Bytes()))
+		tracer.CaptureState(env, 0, BALANCE, 0, 0, mem, stack, rstack, nil, contract, 0, nil)
+	}
+	stack = newstack()
+	for i := 0; i < 5; i++ {
+		stack.push(uint256.NewInt())
+	}
+	stack.data[len(stack.data)-2].SetBytes(precomp.Bytes())
+	tracer.CaptureState(env, 0, STATICCALL, 0, 0, mem, stack, rstack, nil, contract, 0, nil)
+
+	want := NewAccessListTracer(types.AccessList{
+		{Address: contract.Address(), StorageKeys: []common.Hash{common.BigToHash(big.NewInt(7))}},
+		{Address: other, StorageKeys: []common.Hash{}},
+	}, from, to, []common.Address{precomp})
+	if !tracer.Equal(want) {
+		t.Fatalf("access list mismatch: have %v, want %v", tracer.AccessList(), want.AccessList())
+	}
+	if have := tracer.AccessList().StorageKeys(); have != 1 {
+		t.Fatalf("storage key count mismatch: have %d, want 1", have)
+	}
+}
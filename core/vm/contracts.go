@@ -123,6 +123,21 @@ func init() {
 	}
 }
 
+// ActivePrecompiles returns the addresses of the precompiles enabled with the
+// given chain rules.
+func ActivePrecompiles(rules params.Rules) []common.Address {
+	switch {
+	case rules.IsYoloV2:
+		return PrecompiledAddressesYoloV2
+	case rules.IsIstanbul:
+		return PrecompiledAddressesIstanbul
+	case rules.IsByzantium:
+		return PrecompiledAddressesByzantium
+	default:
+		return PrecompiledAddressesHomestead
+	}
+}
+
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
 // It returns
 // - the returned bytes,
@@ -22,6 +22,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -38,6 +39,8 @@ type Config struct {
 	EVMInterpreter   string // External EVM interpreter options
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	LiveTracer tracing.LiveTracer // Block, transaction and state change hooks invoked during chain import
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
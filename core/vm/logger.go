@@ -52,6 +52,7 @@ type LogConfig struct {
 	DisableStack      bool // disable stack capture
 	DisableStorage    bool // disable storage capture
 	DisableReturnData bool // disable return data capture
+	Compact           bool // capture only the memory, stack and storage changes of each step
 	Debug             bool // print output during capture end
 	Limit             int  // maximum length of output, but zero means unlimited
 	// Chain overrides, can be used to execute a trace using future fork rules
@@ -120,6 +121,10 @@ type Tracer interface {
 // StructLogger can capture state based on the given Log configuration and also keeps
 // a track record of modified storage which is used in reporting snapshots of the
 // contract their storage.
+//
+// If the Compact option is set, the logger does not take snapshots at all but
+// only records what changed since the previous step of the same call frame. The
+// results are available through StructLogDeltas instead of StructLogs.
 type StructLogger struct {
 	cfg LogConfig
 
@@ -127,6 +132,9 @@ type StructLogger struct {
 	logs    []StructLog
 	output  []byte
 	err     error
+
+	frames []*deltaFrame    // Call frames currently executing, used in compact mode
+	deltas []StructLogDelta // Captured log entries in compact mode
 }
 
 // NewStructLogger returns a new logger
@@ -150,9 +158,13 @@ func (l *StructLogger) CaptureStart(from common.Address, to common.Address, crea
 // CaptureState also tracks SLOAD/SSTORE ops to track storage change.
 func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, rStack *ReturnStack, rData []byte, contract *Contract, depth int, err error) error {
 	// check if already accumulated the specified number of logs
-	if l.cfg.Limit != 0 && l.cfg.Limit <= len(l.logs) {
+	if l.cfg.Limit != 0 && l.cfg.Limit <= len(l.logs)+len(l.deltas) {
 		return errTraceLimitReached
 	}
+	if l.cfg.Compact {
+		l.captureDelta(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+		return nil
+	}
 	// Copy a snapshot of the current memory state to a new buffer
 	var mem []byte
 	if !l.cfg.DisableMemory {
@@ -231,6 +243,9 @@ func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration
 // StructLogs returns the captured log entries.
 func (l *StructLogger) StructLogs() []StructLog { return l.logs }
 
+// StructLogDeltas returns the captured log entries in compact mode.
+func (l *StructLogger) StructLogDeltas() []StructLogDelta { return l.deltas }
+
 // Error returns the VM error captured by the trace.
 func (l *StructLogger) Error() error { return l.err }
 
@@ -0,0 +1,199 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/holiman/uint256"
+)
+
+// MemoryWrite is a contiguous region of the EVM memory modified by an instruction.
+type MemoryWrite struct {
+	Offset uint64        `json:"offset"`
+	Data   hexutil.Bytes `json:"data"`
+}
+
+//go:generate gencodec -type StructLogDelta -field-override structLogDeltaMarshaling -out gen_structlogdelta.go
+
+// StructLogDelta is the compact counterpart of StructLog. Instead of a snapshot
+// of the memory, stack and storage, it only contains the changes since the
+// previous step executed within the same call frame. Replaying the deltas in
+// order reproduces the snapshots of the full struct logs.
+//
+// Note, the return stack and the return data are not captured in compact mode.
+type StructLogDelta struct {
+	Pc            uint64                      `json:"pc"`
+	Op            OpCode                      `json:"op"`
+	Gas           uint64                      `json:"gas"`
+	GasCost       uint64                      `json:"gasCost"`
+	Depth         int                         `json:"depth"`
+	RefundCounter uint64                      `json:"refund"`
+	Err           error                       `json:"-"`
+	Address       *common.Address             `json:"address,omitempty"` // Executing contract, only set on the first step of a call frame
+	MemorySize    int                         `json:"memSize"`
+	MemoryWrites  []MemoryWrite               `json:"memory,omitempty"`      // Memory regions written by the previous step
+	StackPops     int                         `json:"stackPops,omitempty"`   // Number of items removed from the top of the stack
+	StackPushes   []*big.Int                  `json:"stackPushes,omitempty"` // Items pushed after the removal, bottom first
+	Storage       map[common.Hash]common.Hash `json:"storage,omitempty"`     // Storage slots read or written by this step
+}
+
+// overrides for gencodec
+type structLogDeltaMarshaling struct {
+	Gas         math.HexOrDecimal64
+	GasCost     math.HexOrDecimal64
+	StackPushes []*math.HexOrDecimal256
+	OpName      string `json:"opName"`          // adds call to OpName() in MarshalJSON
+	ErrorString string `json:"error,omitempty"` // adds call to ErrorString() in MarshalJSON
+}
+
+// OpName formats the operand name in a human-readable format.
+func (s *StructLogDelta) OpName() string {
+	return s.Op.String()
+}
+
+// ErrorString formats the log's error as a string.
+func (s *StructLogDelta) ErrorString() string {
+	if s.Err != nil {
+		return s.Err.Error()
+	}
+	return ""
+}
+
+// deltaFrame is the last state observed in a call frame, used by the compact
+// struct logger to compute the changes between two consecutive steps.
+type deltaFrame struct {
+	stack []uint256.Int // Stack contents as of the previous step
+
+	writeOffset uint64 // Offset of the memory region written by the previous step
+	writeSize   uint64 // Size of the memory region written by the previous step
+}
+
+// captureDelta records the changes the previous step of the current call frame
+// made to the memory and the stack, along with the storage accessed by the
+// current step.
+func (l *StructLogger) captureDelta(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) {
+	log := StructLogDelta{
+		Pc:            pc,
+		Op:            op,
+		Gas:           gas,
+		GasCost:       cost,
+		Depth:         depth,
+		RefundCounter: env.StateDB.GetRefund(),
+		Err:           err,
+		MemorySize:    memory.Len(),
+	}
+	// Drop the frames of the calls returned since the last step and start a new
+	// one if a call was entered
+	if len(l.frames) > depth {
+		l.frames = l.frames[:depth]
+	}
+	if len(l.frames) < depth {
+		for len(l.frames) < depth {
+			l.frames = append(l.frames, new(deltaFrame))
+		}
+		address := contract.Address()
+		log.Address = &address
+	}
+	frame := l.frames[depth-1]
+
+	if !l.cfg.DisableMemory {
+		// The region written by the previous step is only known now, after its
+		// execution. Clip it to the memory in case the write failed.
+		if frame.writeSize > 0 && frame.writeOffset < uint64(memory.Len()) {
+			size := frame.writeSize
+			if size > uint64(memory.Len())-frame.writeOffset {
+				size = uint64(memory.Len()) - frame.writeOffset
+			}
+			log.MemoryWrites = []MemoryWrite{{
+				Offset: frame.writeOffset,
+				Data:   memory.GetCopy(int64(frame.writeOffset), int64(size)),
+			}}
+		}
+		frame.writeOffset, frame.writeSize = memoryWriteRegion(op, stack)
+	}
+	if !l.cfg.DisableStack {
+		data := stack.Data()
+
+		shared := 0
+		for shared < len(frame.stack) && shared < len(data) && frame.stack[shared].Eq(&data[shared]) {
+			shared++
+		}
+		log.StackPops = len(frame.stack) - shared
+		for _, item := range data[shared:] {
+			log.StackPushes = append(log.StackPushes, item.ToBig())
+		}
+		frame.stack = append(frame.stack[:0], data...)
+	}
+	if !l.cfg.DisableStorage {
+		if op == SLOAD && stack.len() >= 1 {
+			address := common.Hash(stack.data[stack.len()-1].Bytes32())
+			log.Storage = map[common.Hash]common.Hash{
+				address: env.StateDB.GetState(contract.Address(), address),
+			}
+		}
+		if op == SSTORE && stack.len() >= 2 {
+			var (
+				value   = common.Hash(stack.data[stack.len()-2].Bytes32())
+				address = common.Hash(stack.data[stack.len()-1].Bytes32())
+			)
+			log.Storage = map[common.Hash]common.Hash{address: value}
+		}
+	}
+	l.deltas = append(l.deltas, log)
+}
+
+// memoryWriteRegion returns the memory region the given operation is going to
+// write to, based on its stack arguments. For calls, this is the region the
+// return data is copied into.
+func memoryWriteRegion(op OpCode, stack *Stack) (uint64, uint64) {
+	var offset, size *uint256.Int
+
+	switch op {
+	case MSTORE:
+		if stack.len() >= 1 {
+			offset, size = stack.Back(0), uint256.NewInt().SetUint64(32)
+		}
+	case MSTORE8:
+		if stack.len() >= 1 {
+			offset, size = stack.Back(0), uint256.NewInt().SetUint64(1)
+		}
+	case CALLDATACOPY, CODECOPY, RETURNDATACOPY:
+		if stack.len() >= 3 {
+			offset, size = stack.Back(0), stack.Back(2)
+		}
+	case EXTCODECOPY:
+		if stack.len() >= 4 {
+			offset, size = stack.Back(1), stack.Back(3)
+		}
+	case CALL, CALLCODE:
+		if stack.len() >= 7 {
+			offset, size = stack.Back(5), stack.Back(6)
+		}
+	case DELEGATECALL, STATICCALL:
+		if stack.len() >= 6 {
+			offset, size = stack.Back(4), stack.Back(5)
+		}
+	}
+	if offset == nil || !offset.IsUint64() || !size.IsUint64() {
+		return 0, 0
+	}
+	return offset.Uint64(), size.Uint64()
+}
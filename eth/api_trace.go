@@ -0,0 +1,366 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// flatCallTracer is the name of the native tracer producing the flat call
+	// traces of the trace namespace.
+	flatCallTracer = "flatCallTracer"
+
+	// maxTraceFilterRange is the maximum number of blocks trace_filter is willing
+	// to reexecute in a single request.
+	maxTraceFilterRange = 1000
+)
+
+// PrivateTraceAPI is the collection of OpenEthereum (Parity) compatible tracing
+// APIs, reporting the calls made by transactions as flat call traces, followed
+// by the block and uncle rewards for ethash blocks.
+type PrivateTraceAPI struct {
+	debug *PrivateDebugAPI
+}
+
+// NewPrivateTraceAPI creates a new API definition for the OpenEthereum compatible
+// tracing methods of the Ethereum service.
+func NewPrivateTraceAPI(eth *Ethereum) *PrivateTraceAPI {
+	return &PrivateTraceAPI{debug: NewPrivateDebugAPI(eth)}
+}
+
+// TraceFilterArgs are the arguments of trace_filter, selecting the traces of
+// a block range by the addresses the calls were made from or to.
+type TraceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`   // First block of the range, latest if omitted
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`     // Last block of the range, latest if omitted
+	FromAddress []common.Address `json:"fromAddress"` // Senders to match, any if empty
+	ToAddress   []common.Address `json:"toAddress"`   // Recipients to match, any if empty
+	After       *uint64          `json:"after"`       // Number of matching traces to skip
+	Count       *uint64          `json:"count"`       // Maximum number of traces to return
+}
+
+// traceReplayResult is the result of trace_replayTransaction.
+type traceReplayResult struct {
+	Output    hexutil.Bytes            `json:"output"`
+	StateDiff interface{}              `json:"stateDiff"`
+	Trace     []*tracers.FlatCallTrace `json:"trace"`
+	VMTrace   interface{}              `json:"vmTrace"`
+}
+
+// traceConfig returns the tracing configuration producing flat call traces.
+func (api *PrivateTraceAPI) traceConfig() *TraceConfig {
+	tracer := flatCallTracer
+	return &TraceConfig{Tracer: &tracer}
+}
+
+// Block returns the flat call traces of all the transactions in the given block,
+// followed by the traces of the rewards credited by it.
+func (api *PrivateTraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*tracers.FlatCallTrace, error) {
+	block, err := api.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceBlock(ctx, block)
+}
+
+// Transaction returns the flat call traces of the given transaction.
+func (api *PrivateTraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*tracers.FlatCallTrace, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.debug.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	result, err := api.debug.TraceTransaction(ctx, hash, api.traceConfig())
+	if err != nil {
+		return nil, err
+	}
+	traces, err := decodeFlatTraces(result)
+	if err != nil {
+		return nil, err
+	}
+	annotateFlatTraces(traces, blockHash, blockNumber, hash, index)
+	return traces, nil
+}
+
+// ReplayTransaction replays the given transaction and returns the requested
+// kinds of traces. Only the "trace" kind is supported at the moment.
+func (api *PrivateTraceAPI) ReplayTransaction(ctx context.Context, hash common.Hash, traceTypes []string) (*traceReplayResult, error) {
+	var traced bool
+	for _, typ := range traceTypes {
+		switch typ {
+		case "trace":
+			traced = true
+		case "stateDiff", "vmTrace":
+			return nil, fmt.Errorf("trace type %q not supported", typ)
+		default:
+			return nil, fmt.Errorf("unknown trace type %q", typ)
+		}
+	}
+	result, err := api.debug.TraceTransaction(ctx, hash, api.traceConfig())
+	if err != nil {
+		return nil, err
+	}
+	traces, err := decodeFlatTraces(result)
+	if err != nil {
+		return nil, err
+	}
+	replay := &traceReplayResult{Output: hexutil.Bytes{}}
+	if len(traces) > 0 && traces[0].Result != nil {
+		if res := traces[0].Result; res.Output != nil {
+			replay.Output = *res.Output
+		} else if res.Code != nil {
+			replay.Output = *res.Code
+		}
+	}
+	if traced {
+		replay.Trace = traces
+	}
+	return replay, nil
+}
+
+// Filter returns the flat call traces of the requested block range, made from
+// any of the requested senders to any of the requested recipients. Reward traces
+// only have a recipient, so they never match a sender filter.
+//
+// Since the blocks of the range need to be reexecuted, at most maxTraceFilterRange
+// of them may be requested at once.
+func (api *PrivateTraceAPI) Filter(ctx context.Context, args TraceFilterArgs) ([]*tracers.FlatCallTrace, error) {
+	var (
+		head  = api.debug.eth.blockchain.CurrentBlock().NumberU64()
+		start = head
+		end   = head
+	)
+	if args.FromBlock != nil {
+		start = resolveBlockNumber(*args.FromBlock, head)
+	}
+	if args.ToBlock != nil {
+		end = resolveBlockNumber(*args.ToBlock, head)
+	}
+	if start > end {
+		return nil, fmt.Errorf("end block (#%d) needs to come after start block (#%d)", end, start)
+	}
+	if end > head {
+		return nil, fmt.Errorf("end block #%d not found", end)
+	}
+	if end-start >= maxTraceFilterRange {
+		return nil, fmt.Errorf("block range too large (%d blocks), maximum is %d", end-start+1, maxTraceFilterRange)
+	}
+	var (
+		from = make(map[common.Address]struct{})
+		to   = make(map[common.Address]struct{})
+	)
+	for _, addr := range args.FromAddress {
+		from[addr] = struct{}{}
+	}
+	for _, addr := range args.ToAddress {
+		to[addr] = struct{}{}
+	}
+	var (
+		skipped uint64
+		matches = []*tracers.FlatCallTrace{}
+	)
+	for number := start; number <= end; number++ {
+		// Abort if the request was cancelled, ranges may take a while to trace
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		block := api.debug.eth.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		traces, err := api.traceBlock(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range traces {
+			if !matchFlatTrace(trace, from, to) {
+				continue
+			}
+			if args.After != nil && skipped < *args.After {
+				skipped++
+				continue
+			}
+			matches = append(matches, trace)
+			if args.Count != nil && uint64(len(matches)) >= *args.Count {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// blockByNumber retrieves the block with the given number from the chain.
+func (api *PrivateTraceAPI) blockByNumber(number rpc.BlockNumber) (*types.Block, error) {
+	var block *types.Block
+
+	switch number {
+	case rpc.PendingBlockNumber:
+		block = api.debug.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		block = api.debug.eth.blockchain.CurrentBlock()
+	default:
+		block = api.debug.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, nil
+}
+
+// traceBlock traces all the transactions of the given block and returns their
+// flat call traces, annotated with their position in the chain, followed by the
+// traces of the block rewards.
+func (api *PrivateTraceAPI) traceBlock(ctx context.Context, block *types.Block) ([]*tracers.FlatCallTrace, error) {
+	// The genesis block has no transactions, nor a parent to trace them on
+	if block.NumberU64() == 0 {
+		return []*tracers.FlatCallTrace{}, nil
+	}
+	traces := []*tracers.FlatCallTrace{}
+	if len(block.Transactions()) == 0 {
+		return append(traces, api.rewardTraces(block)...), nil
+	}
+	results, err := api.debug.traceBlock(ctx, block, api.traceConfig())
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if result.Error != "" {
+			return nil, errors.New(result.Error)
+		}
+		txTraces, err := decodeFlatTraces(result.Result)
+		if err != nil {
+			return nil, err
+		}
+		annotateFlatTraces(txTraces, block.Hash(), block.NumberU64(), block.Transactions()[i].Hash(), uint64(i))
+		traces = append(traces, txTraces...)
+	}
+	return append(traces, api.rewardTraces(block)...), nil
+}
+
+// rewardTraces returns the traces of the block and uncle rewards credited by the
+// given block. Only ethash rewards miners, any other engine produces none.
+func (api *PrivateTraceAPI) rewardTraces(block *types.Block) []*tracers.FlatCallTrace {
+	if _, ok := api.debug.eth.engine.(*ethash.Ethash); !ok {
+		return nil
+	}
+	var (
+		hash   = block.Hash()
+		number = block.NumberU64()
+	)
+	reward := func(author common.Address, kind string, value *big.Int) *tracers.FlatCallTrace {
+		return &tracers.FlatCallTrace{
+			Action: tracers.FlatCallAction{
+				Author:     &author,
+				RewardType: kind,
+				Value:      (*hexutil.Big)(value),
+			},
+			BlockHash:    &hash,
+			BlockNumber:  &number,
+			TraceAddress: []int{},
+			Type:         "reward",
+		}
+	}
+	minerReward, uncleRewards := ethash.Rewards(api.debug.eth.blockchain.Config(), block.Header(), block.Uncles())
+
+	traces := []*tracers.FlatCallTrace{reward(block.Coinbase(), "block", minerReward)}
+	for i, uncle := range block.Uncles() {
+		traces = append(traces, reward(uncle.Coinbase, "uncle", uncleRewards[i]))
+	}
+	return traces
+}
+
+// decodeFlatTraces decodes the output of the flat call tracer.
+func decodeFlatTraces(result interface{}) ([]*tracers.FlatCallTrace, error) {
+	blob, ok := result.(json.RawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected trace result type %T", result)
+	}
+	var traces []*tracers.FlatCallTrace
+	if err := json.Unmarshal(blob, &traces); err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// annotateFlatTraces sets the position of the traced transaction in the chain
+// on all its flat call traces.
+func annotateFlatTraces(traces []*tracers.FlatCallTrace, blockHash common.Hash, blockNumber uint64, txHash common.Hash, txIndex uint64) {
+	for _, trace := range traces {
+		trace.BlockHash = &blockHash
+		trace.BlockNumber = &blockNumber
+		trace.TransactionHash = &txHash
+		trace.TransactionPosition = &txIndex
+	}
+}
+
+// matchFlatTrace checks whether the sender and recipient of the given trace are
+// within the requested sets. An empty set matches any address.
+func matchFlatTrace(trace *tracers.FlatCallTrace, from, to map[common.Address]struct{}) bool {
+	var sender, recipient *common.Address
+
+	switch trace.Type {
+	case "create":
+		sender = trace.Action.From
+		if trace.Result != nil {
+			recipient = trace.Result.Address
+		}
+	case "suicide":
+		sender, recipient = trace.Action.Address, trace.Action.RefundAddress
+	case "reward":
+		recipient = trace.Action.Author
+	default:
+		sender, recipient = trace.Action.From, trace.Action.To
+	}
+	return matchAddress(sender, from) && matchAddress(recipient, to)
+}
+
+// matchAddress checks whether the address is contained within the given set.
+// An empty set matches any address, even a missing one.
+func matchAddress(addr *common.Address, set map[common.Address]struct{}) bool {
+	if len(set) == 0 {
+		return true
+	}
+	if addr == nil {
+		return false
+	}
+	_, ok := set[*addr]
+	return ok
+}
+
+// resolveBlockNumber converts the given block number into an absolute one. The
+// pending block is not traceable, so it's resolved to the head too.
+func resolveBlockNumber(number rpc.BlockNumber, head uint64) uint64 {
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		return head
+	case rpc.EarliestBlockNumber:
+		return 0
+	}
+	return uint64(number)
+}
@@ -0,0 +1,492 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that trace_filter matches the senders and recipients of the various
+// trace types against the requested address sets.
+func TestMatchFlatTrace(t *testing.T) {
+	var (
+		a, b, c = common.HexToAddress("0xa"), common.HexToAddress("0xb"), common.HexToAddress("0xc")
+
+		call    = &tracers.FlatCallTrace{Type: "call", Action: tracers.FlatCallAction{From: &a, To: &b}}
+		create  = &tracers.FlatCallTrace{Type: "create", Action: tracers.FlatCallAction{From: &a}, Result: &tracers.FlatCallResult{Address: &c}}
+		failed  = &tracers.FlatCallTrace{Type: "create", Action: tracers.FlatCallAction{From: &a}, Error: "Out of gas"}
+		suicide = &tracers.FlatCallTrace{Type: "suicide", Action: tracers.FlatCallAction{Address: &c, RefundAddress: &b}}
+	)
+	set := func(addrs ...common.Address) map[common.Address]struct{} {
+		s := make(map[common.Address]struct{})
+		for _, addr := range addrs {
+			s[addr] = struct{}{}
+		}
+		return s
+	}
+	tests := []struct {
+		trace    *tracers.FlatCallTrace
+		from, to map[common.Address]struct{}
+		match    bool
+	}{
+		{call, set(), set(), true},
+		{call, set(a), set(), true},
+		{call, set(b), set(), false},
+		{call, set(a), set(b), true},
+		{call, set(a), set(c), false},
+		{create, set(), set(c), true},
+		{failed, set(a), set(), true},
+		{failed, set(), set(c), false},
+		{suicide, set(c), set(b), true},
+		{suicide, set(a, c), set(a), false},
+	}
+	for i, tt := range tests {
+		if match := matchFlatTrace(tt.trace, tt.from, tt.to); match != tt.match {
+			t.Errorf("test %d: match mismatch: have %v, want %v", i, match, tt.match)
+		}
+	}
+}
+
+// Tests that the block and uncle rewards of ethash blocks are reported as
+// reward traces.
+func TestRewardTraces(t *testing.T) {
+	api := NewPrivateTraceAPI(newTestTraceEthereum(t, 0, nil, nil))
+
+	var (
+		miner  = common.Address{0x01}
+		uncle1 = common.Address{0x02}
+		uncle2 = common.Address{0x03}
+	)
+	header := &types.Header{Number: big.NewInt(10), Coinbase: miner, Difficulty: big.NewInt(1)}
+	uncles := []*types.Header{
+		{Number: big.NewInt(9), Coinbase: uncle1, Difficulty: big.NewInt(1)},
+		{Number: big.NewInt(8), Coinbase: uncle2, Difficulty: big.NewInt(1)},
+	}
+	block := types.NewBlock(header, nil, uncles, nil, trie.NewStackTrie(nil))
+
+	// The test chain is Constantinople from genesis, rewarding 2 ether per block,
+	// 1/32 of it per uncle included and (uncle + 8 - number) / 8 of it per uncle
+	ether := func(num, denom int64) *big.Int {
+		return new(big.Int).Div(new(big.Int).Mul(big.NewInt(num), big.NewInt(params.Ether)), big.NewInt(denom))
+	}
+	want := []struct {
+		author common.Address
+		kind   string
+		value  *big.Int
+	}{
+		{miner, "block", ether(2*32+2*2, 32)},
+		{uncle1, "uncle", ether(2*7, 8)},
+		{uncle2, "uncle", ether(2*6, 8)},
+	}
+	traces := api.rewardTraces(block)
+	if len(traces) != len(want) {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), len(want))
+	}
+	for i, trace := range traces {
+		if trace.Type != "reward" || trace.Action.RewardType != want[i].kind {
+			t.Errorf("trace %d: type mismatch: have %s/%s, want reward/%s", i, trace.Type, trace.Action.RewardType, want[i].kind)
+		}
+		if *trace.Action.Author != want[i].author {
+			t.Errorf("trace %d: author mismatch: have %x, want %x", i, *trace.Action.Author, want[i].author)
+		}
+		if trace.Action.Value.ToInt().Cmp(want[i].value) != 0 {
+			t.Errorf("trace %d: value mismatch: have %v, want %v", i, trace.Action.Value.ToInt(), want[i].value)
+		}
+		if *trace.BlockHash != block.Hash() || *trace.BlockNumber != 10 {
+			t.Errorf("trace %d: position mismatch: have %x/%d", i, *trace.BlockHash, *trace.BlockNumber)
+		}
+	}
+}
+
+// Tests that trace_filter reports the rewards of empty blocks and rejects block
+// ranges exceeding the reexecution limit.
+func TestTraceFilter(t *testing.T) {
+	coinbase := common.Address{0xcb}
+	api := NewPrivateTraceAPI(newTestTraceEthereum(t, maxTraceFilterRange, nil, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(coinbase)
+	}))
+	number := func(n int64) *rpc.BlockNumber {
+		num := rpc.BlockNumber(n)
+		return &num
+	}
+	// Rewards are matched on their recipients only
+	traces, err := api.Filter(context.Background(), TraceFilterArgs{FromBlock: number(1), ToBlock: number(3), ToAddress: []common.Address{coinbase}})
+	if err != nil {
+		t.Fatalf("failed to filter traces: %v", err)
+	}
+	if len(traces) != 3 {
+		t.Fatalf("reward trace count mismatch: have %d, want 3", len(traces))
+	}
+	for i, trace := range traces {
+		if trace.Type != "reward" || *trace.BlockNumber != uint64(i+1) {
+			t.Errorf("trace %d: unexpected trace %s in block %d", i, trace.Type, *trace.BlockNumber)
+		}
+	}
+	traces, err = api.Filter(context.Background(), TraceFilterArgs{FromBlock: number(1), ToBlock: number(3), FromAddress: []common.Address{coinbase}})
+	if err != nil {
+		t.Fatalf("failed to filter traces: %v", err)
+	}
+	if len(traces) != 0 {
+		t.Fatalf("rewards matched by sender: %d traces", len(traces))
+	}
+	// The maximum range is accepted, anything beyond rejected
+	if _, err := api.Filter(context.Background(), TraceFilterArgs{FromBlock: number(1), ToBlock: number(maxTraceFilterRange)}); err != nil {
+		t.Errorf("maximum range rejected: %v", err)
+	}
+	if _, err := api.Filter(context.Background(), TraceFilterArgs{FromBlock: number(0), ToBlock: number(maxTraceFilterRange)}); err == nil {
+		t.Error("range exceeding the maximum accepted")
+	}
+}
+
+var (
+	// traceInitCode deploys a contract consisting of a single INVALID opcode
+	traceInitCode = common.FromHex("0x60fe60005360016000f3")
+
+	traceEntry    = common.BytesToAddress([]byte{0xa0}) // Contract running all the call types below
+	traceNested   = common.BytesToAddress([]byte{0xb0}) // Contract calling into traceReturner
+	traceReturner = common.BytesToAddress([]byte{0xc0}) // Contract returning the word 0x2a
+	traceReverter = common.BytesToAddress([]byte{0xd0}) // Contract reverting unconditionally
+	traceSuicider = common.BytesToAddress([]byte{0xe0}) // Contract self destructing to traceHeir
+	traceHeir     = common.BytesToAddress([]byte{0xbe}) // Beneficiary of the self destruct
+)
+
+// traceCallCode returns the code calling the given single byte address with all
+// the available gas, no value and no input, copying the first outLen bytes of
+// the return data to memory and discarding the result.
+func traceCallCode(addr common.Address, outLen byte) string {
+	return "60" + common.Bytes2Hex([]byte{outLen}) + "6000600060006000" + "60" + common.Bytes2Hex(addr[19:]) + "5af150"
+}
+
+// newTestTraceAPI creates a chain with a single block containing a transaction
+// into a contract that creates a contract, makes a nested call, a reverted call
+// and a call into a self destructing contract, followed by a transaction
+// deploying a contract.
+func newTestTraceAPI(t *testing.T) (*PrivateTraceAPI, *types.Block) {
+	signer := types.HomesteadSigner{}
+	eth := newTestTraceEthereum(t, 1, core.GenesisAlloc{
+		testBank: {Balance: big.NewInt(params.Ether)},
+		// Stores the init code in memory, creates a contract from it and calls
+		// the nested, reverting and self destructing contracts
+		traceEntry: {Balance: big.NewInt(0), Code: common.FromHex("0x69" + common.Bytes2Hex(traceInitCode) + "600052" + "600a60166000f050" +
+			traceCallCode(traceNested, 0) + traceCallCode(traceReverter, 0) + traceCallCode(traceSuicider, 0) + "00")},
+		traceNested:   {Balance: big.NewInt(0), Code: common.FromHex("0x" + traceCallCode(traceReturner, 0x20) + "00")},
+		traceReturner: {Balance: big.NewInt(0), Code: common.FromHex("0x602a60005260206000f3")},
+		traceReverter: {Balance: big.NewInt(0), Code: common.FromHex("0x60006000fd")},
+		traceSuicider: {Balance: big.NewInt(100), Code: common.FromHex("0x60beff")},
+	}, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(0, traceEntry, big.NewInt(0), 1000000, big.NewInt(1), nil), signer, testBankKey)
+		b.AddTx(tx)
+		tx, _ = types.SignTx(types.NewContractCreation(1, big.NewInt(0), 1000000, big.NewInt(1), traceInitCode), signer, testBankKey)
+		b.AddTx(tx)
+	})
+	return NewPrivateTraceAPI(eth), eth.blockchain.GetBlockByNumber(1)
+}
+
+// checkFlatTrace compares the type, position and action of a flat call trace to
+// the expected ones, along with its result or error.
+func checkFlatTrace(t *testing.T, index int, have, want *tracers.FlatCallTrace) {
+	t.Helper()
+
+	if have.Type != want.Type || have.Subtraces != want.Subtraces || !reflect.DeepEqual(have.TraceAddress, want.TraceAddress) {
+		t.Errorf("trace %d: position mismatch: have %s/%d/%v, want %s/%d/%v", index, have.Type, have.Subtraces, have.TraceAddress, want.Type, want.Subtraces, want.TraceAddress)
+	}
+	if have.Error != want.Error {
+		t.Errorf("trace %d: error mismatch: have %q, want %q", index, have.Error, want.Error)
+	}
+	haveAction, _ := json.Marshal(have.Action)
+	wantAction, _ := json.Marshal(want.Action)
+	if !bytes.Equal(haveAction, wantAction) {
+		t.Errorf("trace %d: action mismatch:\nhave %s\nwant %s", index, haveAction, wantAction)
+	}
+	haveResult, _ := json.Marshal(have.Result)
+	wantResult, _ := json.Marshal(want.Result)
+	if !bytes.Equal(haveResult, wantResult) {
+		t.Errorf("trace %d: result mismatch:\nhave %s\nwant %s", index, haveResult, wantResult)
+	}
+}
+
+// wantTxTraces returns the expected flat call traces of the transactions in the
+// block created by newTestTraceAPI. The gas fields of calls nested in the entry
+// contract are taken from the given traces of the first transaction, the top
+// level ones are derived from the receipts, excluding the intrinsic gas.
+func wantTxTraces(t *testing.T, api *PrivateTraceAPI, block *types.Block, call []*tracers.FlatCallTrace) ([]*tracers.FlatCallTrace, []*tracers.FlatCallTrace) {
+	t.Helper()
+
+	receipts := api.debug.eth.blockchain.GetReceiptsByHash(block.Hash())
+
+	var (
+		zero = (*hexutil.Big)(new(big.Int))
+		none = hexutil.Bytes{}
+		word = hexutil.Bytes(common.LeftPadBytes([]byte{0x2a}, 32))
+		init = hexutil.Bytes(traceInitCode)
+		code = hexutil.Bytes{0xfe}
+
+		sender  = testBank
+		entry   = traceEntry
+		nested  = traceNested
+		ret     = traceReturner
+		reverts = traceReverter
+		suicide = traceSuicider
+		heir    = traceHeir
+		inner   = crypto.CreateAddress(traceEntry, 0)
+		outer   = crypto.CreateAddress(testBank, 1)
+	)
+	uint64p := func(n uint64) *hexutil.Uint64 { return (*hexutil.Uint64)(&n) }
+
+	// The self destruct refunds 24000 gas, which is not part of the traced usage
+	callIntrinsic, _ := core.IntrinsicGas(nil, nil, false, true, true)
+	callUsed := receipts[0].GasUsed + params.SelfdestructRefundGas - callIntrinsic
+
+	createIntrinsic, _ := core.IntrinsicGas(traceInitCode, nil, true, true, true)
+	createUsed := receipts[1].GasUsed - createIntrinsic
+
+	if len(call) != 7 {
+		t.Fatalf("call trace count mismatch: have %d, want %d", len(call), 7)
+	}
+	gas := func(i int) (*hexutil.Uint64, *hexutil.Uint64) {
+		if call[i].Action.Gas == nil || call[i].Result == nil || call[i].Result.GasUsed == nil {
+			return call[i].Action.Gas, nil
+		}
+		if *call[i].Result.GasUsed > *call[i].Action.Gas {
+			t.Errorf("trace %d: gas used %d above allowance %d", i, *call[i].Result.GasUsed, *call[i].Action.Gas)
+		}
+		return call[i].Action.Gas, call[i].Result.GasUsed
+	}
+	createGas, createGasUsed := gas(1)
+	nestedGas, nestedGasUsed := gas(2)
+	retGas, retGasUsed := gas(3)
+	revertGas, _ := gas(4)
+	suicideGas, suicideGasUsed := gas(5)
+
+	calls := []*tracers.FlatCallTrace{
+		{
+			Type:         "call",
+			Action:       tracers.FlatCallAction{CallType: "call", From: &sender, To: &entry, Gas: uint64p(1000000 - callIntrinsic), Input: &none, Value: zero},
+			Result:       &tracers.FlatCallResult{GasUsed: uint64p(callUsed), Output: &none},
+			Subtraces:    4,
+			TraceAddress: []int{},
+		},
+		{
+			Type:         "create",
+			Action:       tracers.FlatCallAction{From: &entry, Gas: createGas, Init: &init, Value: zero},
+			Result:       &tracers.FlatCallResult{Address: &inner, Code: &code, GasUsed: createGasUsed},
+			TraceAddress: []int{0},
+		},
+		{
+			Type:         "call",
+			Action:       tracers.FlatCallAction{CallType: "call", From: &entry, To: &nested, Gas: nestedGas, Input: &none, Value: zero},
+			Result:       &tracers.FlatCallResult{GasUsed: nestedGasUsed, Output: &none},
+			Subtraces:    1,
+			TraceAddress: []int{1},
+		},
+		{
+			Type:         "call",
+			Action:       tracers.FlatCallAction{CallType: "call", From: &nested, To: &ret, Gas: retGas, Input: &none, Value: zero},
+			Result:       &tracers.FlatCallResult{GasUsed: retGasUsed, Output: &word},
+			TraceAddress: []int{1, 0},
+		},
+		{
+			Type:         "call",
+			Action:       tracers.FlatCallAction{CallType: "call", From: &entry, To: &reverts, Gas: revertGas, Input: &none, Value: zero},
+			Error:        "Reverted",
+			TraceAddress: []int{2},
+		},
+		{
+			Type:         "call",
+			Action:       tracers.FlatCallAction{CallType: "call", From: &entry, To: &suicide, Gas: suicideGas, Input: &none, Value: zero},
+			Result:       &tracers.FlatCallResult{GasUsed: suicideGasUsed, Output: &none},
+			Subtraces:    1,
+			TraceAddress: []int{3},
+		},
+		{
+			Type:         "suicide",
+			Action:       tracers.FlatCallAction{Address: &suicide, RefundAddress: &heir, Balance: (*hexutil.Big)(big.NewInt(100))},
+			TraceAddress: []int{3, 0},
+		},
+	}
+	creates := []*tracers.FlatCallTrace{
+		{
+			Type:         "create",
+			Action:       tracers.FlatCallAction{From: &sender, Gas: uint64p(1000000 - createIntrinsic), Init: &init, Value: zero},
+			Result:       &tracers.FlatCallResult{Address: &outer, Code: &code, GasUsed: uint64p(createUsed)},
+			TraceAddress: []int{},
+		},
+	}
+	return calls, creates
+}
+
+// Tests that trace_transaction reports every call type in the flat format, with
+// the top level gas and gas usage excluding the intrinsic gas.
+func TestTraceTransaction(t *testing.T) {
+	api, block := newTestTraceAPI(t)
+
+	traces := make([][]*tracers.FlatCallTrace, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		var err error
+		if traces[i], err = api.Transaction(context.Background(), tx.Hash()); err != nil {
+			t.Fatalf("tx %d: failed to trace transaction: %v", i, err)
+		}
+		for j, trace := range traces[i] {
+			if *trace.BlockHash != block.Hash() || *trace.BlockNumber != 1 || *trace.TransactionHash != tx.Hash() || *trace.TransactionPosition != uint64(i) {
+				t.Errorf("tx %d, trace %d: position mismatch: have %x/%d/%x/%d", i, j, *trace.BlockHash, *trace.BlockNumber, *trace.TransactionHash, *trace.TransactionPosition)
+			}
+		}
+	}
+	calls, creates := wantTxTraces(t, api, block, traces[0])
+	for i, want := range [][]*tracers.FlatCallTrace{calls, creates} {
+		if len(traces[i]) != len(want) {
+			t.Fatalf("tx %d: trace count mismatch: have %d, want %d", i, len(traces[i]), len(want))
+		}
+		for j := range want {
+			checkFlatTrace(t, j, traces[i][j], want[j])
+		}
+	}
+	if _, err := api.Transaction(context.Background(), common.Hash{0x01}); err == nil {
+		t.Error("unknown transaction traced")
+	}
+}
+
+// Tests that trace_replayTransaction returns the output of the transaction and,
+// if requested, its flat call traces.
+func TestTraceReplayTransaction(t *testing.T) {
+	api, block := newTestTraceAPI(t)
+
+	var (
+		call   = block.Transactions()[0].Hash()
+		create = block.Transactions()[1].Hash()
+	)
+	callTraces, err := api.Transaction(context.Background(), call)
+	if err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	wantCalls, wantCreates := wantTxTraces(t, api, block, callTraces)
+
+	tests := []struct {
+		hash   common.Hash
+		types  []string
+		output hexutil.Bytes
+		traces []*tracers.FlatCallTrace
+	}{
+		{call, []string{"trace"}, hexutil.Bytes{}, wantCalls},
+		{call, nil, hexutil.Bytes{}, nil},
+		{create, []string{"trace"}, hexutil.Bytes{0xfe}, wantCreates},
+	}
+	for i, tt := range tests {
+		result, err := api.ReplayTransaction(context.Background(), tt.hash, tt.types)
+		if err != nil {
+			t.Fatalf("test %d: failed to replay transaction: %v", i, err)
+		}
+		if !bytes.Equal(result.Output, tt.output) {
+			t.Errorf("test %d: output mismatch: have %x, want %x", i, result.Output, tt.output)
+		}
+		if result.StateDiff != nil || result.VMTrace != nil {
+			t.Errorf("test %d: unrequested traces returned", i)
+		}
+		if len(result.Trace) != len(tt.traces) {
+			t.Fatalf("test %d: trace count mismatch: have %d, want %d", i, len(result.Trace), len(tt.traces))
+		}
+		for j := range tt.traces {
+			checkFlatTrace(t, j, result.Trace[j], tt.traces[j])
+		}
+	}
+	for _, typ := range []string{"vmTrace", "stateDiff", "unknown"} {
+		if _, err := api.ReplayTransaction(context.Background(), call, []string{typ}); err == nil {
+			t.Errorf("unsupported trace type %q accepted", typ)
+		}
+	}
+}
+
+// Tests that trace_block reports the flat call traces of all the transactions in
+// order, followed by the block reward, in the OpenEthereum wire format.
+func TestTraceBlock(t *testing.T) {
+	api, block := newTestTraceAPI(t)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("trace", api); err != nil {
+		t.Fatalf("failed to register trace API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer server.Stop()
+	defer client.Close()
+
+	var raw []json.RawMessage
+	if err := client.Call(&raw, "trace_block", "0x1"); err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	traces := make([]*tracers.FlatCallTrace, len(raw))
+	for i, blob := range raw {
+		if err := json.Unmarshal(blob, &traces[i]); err != nil {
+			t.Fatalf("trace %d: failed to decode: %v", i, err)
+		}
+	}
+	if len(traces) != 9 {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), 9)
+	}
+	calls, creates := wantTxTraces(t, api, block, traces[:7])
+	for i, want := range append(calls, creates...) {
+		checkFlatTrace(t, i, traces[i], want)
+
+		position := uint64(0)
+		if i >= len(calls) {
+			position = 1
+		}
+		if *traces[i].TransactionHash != block.Transactions()[position].Hash() || *traces[i].TransactionPosition != position {
+			t.Errorf("trace %d: transaction mismatch: have %x/%d", i, *traces[i].TransactionHash, *traces[i].TransactionPosition)
+		}
+	}
+	if traces[8].Type != "reward" || *traces[8].Action.Author != block.Coinbase() {
+		t.Errorf("reward trace mismatch: have %s to %x", traces[8].Type, traces[8].Action.Author)
+	}
+	// Ensure the top level call and the reverted call are in the wire format of
+	// OpenEthereum, with the result omitted for failed calls
+	var (
+		intrinsic, _ = core.IntrinsicGas(nil, nil, false, true, true)
+		receipts     = api.debug.eth.blockchain.GetReceiptsByHash(block.Hash())
+		used         = receipts[0].GasUsed + params.SelfdestructRefundGas - intrinsic
+		tx           = block.Transactions()[0].Hash()
+	)
+	want := `{"action":{"callType":"call","from":"` + hexutil.Encode(testBank[:]) + `","to":"` + hexutil.Encode(traceEntry[:]) + `",` +
+		`"gas":"` + hexutil.EncodeUint64(1000000-intrinsic) + `","input":"0x","value":"0x0"},` +
+		`"blockHash":"` + block.Hash().Hex() + `","blockNumber":1,` +
+		`"result":{"gasUsed":"` + hexutil.EncodeUint64(used) + `","output":"0x"},` +
+		`"subtraces":4,"traceAddress":[],"transactionHash":"` + tx.Hex() + `","transactionPosition":0,"type":"call"}`
+	if string(raw[0]) != want {
+		t.Errorf("top level trace mismatch:\nhave %s\nwant %s", raw[0], want)
+	}
+	want = `{"action":{"callType":"call","from":"` + hexutil.Encode(traceEntry[:]) + `","to":"` + hexutil.Encode(traceReverter[:]) + `",` +
+		`"gas":"` + traces[4].Action.Gas.String() + `","input":"0x","value":"0x0"},` +
+		`"blockHash":"` + block.Hash().Hex() + `","blockNumber":1,"error":"Reverted",` +
+		`"subtraces":0,"traceAddress":[2],"transactionHash":"` + tx.Hex() + `","transactionPosition":0,"type":"call"}`
+	if string(raw[4]) != want {
+		t.Errorf("reverted trace mismatch:\nhave %s\nwant %s", raw[4], want)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -58,9 +59,18 @@ const (
 // TraceConfig holds extra parameters to trace functions.
 type TraceConfig struct {
 	*vm.LogConfig
-	Tracer  *string
-	Timeout *string
-	Reexec  *uint64
+	Tracer       *string
+	TracerConfig json.RawMessage // Tracer specific options, only used by native tracers
+	Timeout      *string
+	Reexec       *uint64
+}
+
+// TraceCallConfig is the config for traceCall API. It holds one more field to
+// override the state and block context for tracing.
+type TraceCallConfig struct {
+	TraceConfig
+	StateOverrides *ethapi.StateOverride
+	BlockOverrides *ethapi.BlockOverrides
 }
 
 // StdTraceConfig holds extra parameters to standard-json trace functions.
@@ -93,6 +103,23 @@ type blockTraceResult struct {
 	Traces []*txTraceResult `json:"traces"` // Trace results produced by the task
 }
 
+// txStreamTraceResult is the result of a single transaction trace, sent out as
+// a notification when a block is being traced over a subscription.
+type txStreamTraceResult struct {
+	TxIndex hexutil.Uint64 `json:"txIndex"`          // Position of the transaction in the block
+	TxHash  common.Hash    `json:"txHash"`           // Hash of the traced transaction
+	Result  interface{}    `json:"result,omitempty"` // Trace results produced by the tracer
+	Error   string         `json:"error,omitempty"`  // Trace failure produced by the tracer
+}
+
+// blockStreamTraceEnd is the last notification sent when a block is being traced
+// over a subscription, signalling that no more transaction results will follow.
+type blockStreamTraceEnd struct {
+	Done         bool           `json:"done"`            // Always true, marks the end of the stream
+	Transactions hexutil.Uint64 `json:"transactions"`    // Number of transaction results sent
+	Error        string         `json:"error,omitempty"` // Block execution failure aborting the trace
+}
+
 // txTraceTask represents a single transaction trace task when an entire block
 // is being traced.
 type txTraceTask struct {
@@ -517,6 +544,201 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 	return results, nil
 }
 
+// TraceBlockStream returns the structured logs created during the execution of
+// EVM for the given block, streaming the result of each transaction over the
+// subscription as soon as it's available instead of in a single response. Each
+// transaction of the block produces exactly one notification, sent in order.
+//
+// The stream is terminated by a final notification with the done flag set, which
+// also carries the error if the block couldn't be executed to its end.
+func (api *PrivateDebugAPI) TraceBlockStream(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, config *TraceConfig) (*rpc.Subscription, error) {
+	var block *types.Block
+
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		block = api.eth.blockchain.GetBlockByHash(hash)
+		if block == nil {
+			return nil, fmt.Errorf("block %#x not found", hash)
+		}
+	} else if number, ok := blockNrOrHash.Number(); ok {
+		switch number {
+		case rpc.PendingBlockNumber:
+			block = api.eth.miner.PendingBlock()
+		case rpc.LatestBlockNumber:
+			block = api.eth.blockchain.CurrentBlock()
+		default:
+			block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+	} else {
+		return nil, errors.New("invalid arguments; neither block nor hash specified")
+	}
+	return api.traceBlockStream(ctx, block, config)
+}
+
+// traceBlockStream configures a new tracer according to the provided configuration,
+// and executes all the transactions contained within, similarly to traceBlock. The
+// difference is that each transaction's trace is streamed to the user in order as
+// soon as it's done, with the tracing throttled by the rate of the notifications.
+func (api *PrivateDebugAPI) traceBlockStream(ctx context.Context, block *types.Block, config *TraceConfig) (*rpc.Subscription, error) {
+	// Tracing a block may produce huge results, only stream with subscriptions
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	// Create the parent state database
+	if err := api.eth.engine.VerifyHeader(api.eth.blockchain, block.Header(), true); err != nil {
+		return nil, err
+	}
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, err := api.computeStateDB(parent, reexec)
+	if err != nil {
+		return nil, err
+	}
+	sub := notifier.CreateSubscription()
+
+	// The call context is cancelled as soon as the subscription is returned, so
+	// run the traces on a detached one, torn down when the subscriber goes away
+	// or the stream is finished
+	traceCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-sub.Err():
+		case <-notifier.Closed():
+		case <-traceCtx.Done():
+		}
+		cancel()
+	}()
+	// Execute all the transaction contained within the block concurrently
+	var (
+		signer = types.MakeSigner(api.eth.blockchain.Config(), block.Number())
+		txs    = block.Transactions()
+	)
+	threads := runtime.NumCPU()
+	if threads > len(txs) {
+		threads = len(txs)
+	}
+	var (
+		pend    = new(sync.WaitGroup)
+		tasks   = make(chan *txTraceTask, threads)
+		results = make(chan *txStreamTraceResult, threads)
+	)
+	blockCtx := core.NewEVMBlockContext(block.Header(), api.eth.blockchain, nil)
+	for th := 0; th < threads; th++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+
+			// Fetch and execute the next transaction trace tasks
+			for task := range tasks {
+				tx := txs[task.index]
+				result := &txStreamTraceResult{TxIndex: hexutil.Uint64(task.index), TxHash: tx.Hash()}
+
+				msg, _ := tx.AsMessage(signer)
+				res, err := api.traceTx(traceCtx, msg, blockCtx, task.statedb, config)
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Result = res
+				}
+				// Stream the result back to the user or abort on teardown
+				select {
+				case results <- result:
+				case <-sub.Err():
+					return
+				case <-notifier.Closed():
+					return
+				}
+			}
+		}()
+	}
+	// Start a goroutine to feed all the transactions into the tracers
+	var (
+		begin  = time.Now()
+		index  int
+		failed error
+	)
+	go func() {
+		// Ensure everything is properly cleaned up on any exit path
+		defer func() {
+			close(tasks)
+			pend.Wait()
+
+			switch {
+			case failed != nil:
+				log.Warn("Block tracing failed", "number", block.NumberU64(), "hash", block.Hash(), "transactions", index, "elapsed", time.Since(begin), "err", failed)
+			case index < len(txs):
+				log.Warn("Block tracing aborted", "number", block.NumberU64(), "hash", block.Hash(), "transactions", index, "elapsed", time.Since(begin))
+			default:
+				log.Debug("Block tracing finished", "number", block.NumberU64(), "hash", block.Hash(), "transactions", index, "elapsed", time.Since(begin))
+			}
+			close(results)
+		}()
+		for index = 0; index < len(txs); index++ {
+			// Send the trace task over for execution, blocking if the tracers or
+			// the subscriber can't keep up
+			select {
+			case tasks <- &txTraceTask{statedb: statedb.Copy(), index: index}:
+			case <-sub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+			// Generate the next state snapshot fast without tracing
+			msg, _ := txs[index].AsMessage(signer)
+			txContext := core.NewEVMTxContext(msg)
+
+			vmenv := vm.NewEVM(blockCtx, txContext, statedb, api.eth.blockchain.Config(), vm.Config{})
+			if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+				failed = fmt.Errorf("transaction %d: %w", index, err)
+				index++ // The failing transaction is still traced
+				return
+			}
+			// Finalize the state so any modifications are written to the trie
+			// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
+			statedb.Finalise(vmenv.ChainConfig().IsEIP158(block.Number()))
+		}
+	}()
+
+	// Keep reading the trace results and stream them to the user in order
+	go func() {
+		defer cancel()
+
+		var (
+			done = make(map[uint64]*txStreamTraceResult)
+			next uint64
+		)
+		for res := range results {
+			done[uint64(res.TxIndex)] = res
+
+			for result, ok := done[next]; ok; result, ok = done[next] {
+				notifier.Notify(sub.ID, result)
+				delete(done, next)
+				next++
+			}
+		}
+		// All results are in, terminate the stream unless the user went away.
+		// The feeder is done with index and failed by the time results closes.
+		if failed == nil && index < len(txs) {
+			return
+		}
+		end := &blockStreamTraceEnd{Done: true, Transactions: hexutil.Uint64(next)}
+		if failed != nil {
+			end.Error = failed.Error()
+		}
+		notifier.Notify(sub.ID, end)
+	}()
+	return sub, nil
+}
+
 // standardTraceBlockToFile configures a new tracer which uses standard JSON output,
 // and traces either a full block or an individual transaction. The return value will
 // be one filename per transaction traced.
@@ -742,8 +964,9 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 
 // TraceCall lets you trace a given eth_call. It collects the structured logs created during the execution of EVM
 // if the given transaction was added on top of the provided block and returns them as a JSON object.
-// You can provide -2 as a block number to trace on top of the pending block.
-func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceConfig) (interface{}, error) {
+// You can provide -2 as a block number to trace on top of the pending block. Optionally, the state and
+// the block context to execute the call in can be overridden.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (interface{}, error) {
 	// First try to retrieve the state
 	statedb, header, err := api.eth.APIBackend.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if err != nil {
@@ -766,12 +989,21 @@ func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs,
 		if err != nil {
 			return nil, err
 		}
+		header = block.Header()
+	}
+	// Apply the customized state and block overrides if any
+	var traceConfig *TraceConfig
+	vmctx := core.NewEVMBlockContext(header, api.eth.blockchain, nil)
+	if config != nil {
+		if err := config.StateOverrides.Apply(statedb); err != nil {
+			return nil, err
+		}
+		config.BlockOverrides.Apply(&vmctx)
+		traceConfig = &config.TraceConfig
 	}
-
 	// Execute the trace
 	msg := args.ToMessage(api.eth.APIBackend.RPCGasCap())
-	vmctx := core.NewEVMBlockContext(header, api.eth.blockchain, nil)
-	return api.traceTx(ctx, msg, vmctx, statedb, config)
+	return api.traceTx(ctx, msg, vmctx, statedb, traceConfig)
 }
 
 // traceTx configures a new tracer according to the provided configuration, and
@@ -793,15 +1025,27 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 				return nil, err
 			}
 		}
-		// Constuct the JavaScript tracer to execute with
-		if tracer, err = tracers.New(*config.Tracer); err != nil {
+		// Construct the native tracer if one is registered by the requested name,
+		// otherwise fall back to constructing the JavaScript tracer to execute with
+		var stop func(error)
+		native, ok, err := tracers.NewNative(*config.Tracer, config.TracerConfig)
+		if err != nil {
 			return nil, err
 		}
+		if ok {
+			tracer, stop = native, native.Stop
+		} else {
+			js, err := tracers.New(*config.Tracer)
+			if err != nil {
+				return nil, err
+			}
+			tracer, stop = js, js.Stop
+		}
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*tracers.Tracer).Stop(errors.New("execution timeout"))
+			stop(errors.New("execution timeout"))
 		}()
 		defer cancel()
 
@@ -814,10 +1058,17 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 	// Run the transaction with tracing enabled.
 	vmenv := vm.NewEVM(vmctx, txContext, statedb, api.eth.blockchain.Config(), vm.Config{Debug: true, Tracer: tracer})
 
+	stateTracer, ok := tracer.(tracers.StateTracer)
+	if ok {
+		stateTracer.CapturePreState(statedb, message.From(), message.To(), vmctx.Coinbase)
+	}
 	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
 	if err != nil {
 		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
+	if ok {
+		stateTracer.CapturePostState(statedb)
+	}
 	// Depending on the tracer type, format and return the output
 	switch tracer := tracer.(type) {
 	case *vm.StructLogger:
@@ -826,6 +1077,14 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 		if len(result.Revert()) > 0 {
 			returnVal = fmt.Sprintf("%x", result.Revert())
 		}
+		if config != nil && config.LogConfig != nil && config.Compact {
+			return &ethapi.CompactExecutionResult{
+				Gas:         result.UsedGas,
+				Failed:      result.Failed(),
+				ReturnValue: returnVal,
+				StructLogs:  tracer.StructLogDeltas(),
+			}, nil
+		}
 		return &ethapi.ExecutionResult{
 			Gas:         result.UsedGas,
 			Failed:      result.Failed(),
@@ -836,6 +1095,9 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 	case *tracers.Tracer:
 		return tracer.GetResult()
 
+	case tracers.NativeTracer:
+		return tracer.GetResult()
+
 	default:
 		panic(fmt.Sprintf("bad tracer type %T", tracer))
 	}
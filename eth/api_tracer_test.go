@@ -0,0 +1,389 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newTestTraceEthereum creates a bare Ethereum service around a chain with the
+// given genesis allocation and n generated blocks, with just enough wiring for
+// the tracing APIs to operate on.
+func newTestTraceEthereum(t *testing.T, n int, alloc core.GenesisAlloc, generator func(i int, b *core.BlockGen)) *Ethereum {
+	var (
+		engine = ethash.NewFaker()
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc}
+	)
+	genesis := gspec.MustCommit(db)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, n, generator)
+
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieDirtyDisabled: true}, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	eth := &Ethereum{
+		config:     &Config{RPCGasCap: 25000000},
+		blockchain: chain,
+		chainDb:    db,
+		engine:     engine,
+	}
+	eth.APIBackend = &EthAPIBackend{eth: eth}
+	return eth
+}
+
+func TestTraceCallOverrides(t *testing.T) {
+	var (
+		contract = common.Address{0xc0}
+		slot0    = common.HexToHash("0x00")
+		slot1    = common.HexToHash("0x01")
+
+		// Returns storage slots 0 and 1 of the contract
+		storageCode = common.FromHex("0x60005460005260015460205260406000f3")
+		// Returns the block number and coinbase
+		blockCode = common.FromHex("0x436000524160205260406000f3")
+	)
+	eth := newTestTraceEthereum(t, 1, core.GenesisAlloc{
+		contract: {
+			Balance: big.NewInt(0),
+			Code:    storageCode,
+			Storage: map[common.Hash]common.Hash{slot0: {0x01}, slot1: {0x02}},
+		},
+	}, nil)
+	api := NewPrivateDebugAPI(eth)
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+
+	code := hexutil.Bytes(blockCode)
+	number := big.NewInt(1000)
+	coinbase := common.Address{0xcb}
+
+	tests := []struct {
+		config *TraceCallConfig
+		want   []byte
+		fail   bool
+	}{
+		// No override, the genesis storage is returned
+		{
+			config: nil,
+			want:   append(common.Hash{0x01}.Bytes(), common.Hash{0x02}.Bytes()...),
+		},
+		// State diff overrides a single slot and retains the rest
+		{
+			config: &TraceCallConfig{StateOverrides: &ethapi.StateOverride{contract: ethapi.OverrideAccount{
+				StateDiff: &map[common.Hash]common.Hash{slot0: {0x05}},
+			}}},
+			want: append(common.Hash{0x05}.Bytes(), common.Hash{0x02}.Bytes()...),
+		},
+		// Full state override drops every slot not specified
+		{
+			config: &TraceCallConfig{StateOverrides: &ethapi.StateOverride{contract: ethapi.OverrideAccount{
+				State: &map[common.Hash]common.Hash{slot0: {0x05}},
+			}}},
+			want: append(common.Hash{0x05}.Bytes(), common.Hash{}.Bytes()...),
+		},
+		// Code and block overrides together
+		{
+			config: &TraceCallConfig{
+				StateOverrides: &ethapi.StateOverride{contract: ethapi.OverrideAccount{Code: &code}},
+				BlockOverrides: &ethapi.BlockOverrides{Number: (*hexutil.Big)(number), Coinbase: &coinbase},
+			},
+			want: append(common.BigToHash(number).Bytes(), common.BytesToHash(coinbase.Bytes()).Bytes()...),
+		},
+		// State and state diff can't be specified together
+		{
+			config: &TraceCallConfig{StateOverrides: &ethapi.StateOverride{contract: ethapi.OverrideAccount{
+				State:     &map[common.Hash]common.Hash{},
+				StateDiff: &map[common.Hash]common.Hash{},
+			}}},
+			fail: true,
+		},
+	}
+	for i, tt := range tests {
+		res, err := api.TraceCall(context.Background(), ethapi.CallArgs{To: &contract}, latest, tt.config)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: trace failed: %v", i, err)
+			continue
+		}
+		result, ok := res.(*ethapi.ExecutionResult)
+		if !ok {
+			t.Errorf("test %d: unexpected result type %T", i, res)
+			continue
+		}
+		if have := common.FromHex(result.ReturnValue); !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: result mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+// newTestTraceStreamChain creates a chain with a first block of three value
+// transfers and an empty second one, returning an RPC client to trace it over.
+func newTestTraceStreamChain(t *testing.T) (*Ethereum, *rpc.Client) {
+	var (
+		signer = types.HomesteadSigner{}
+		to     = common.Address{0xaa}
+	)
+	eth := newTestTraceEthereum(t, 2, core.GenesisAlloc{
+		testBank: {Balance: big.NewInt(params.Ether)},
+	}, func(i int, b *core.BlockGen) {
+		if i != 0 {
+			return
+		}
+		for nonce := uint64(0); nonce < 3; nonce++ {
+			tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testBankKey)
+			b.AddTx(tx)
+		}
+	})
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(eth)); err != nil {
+		t.Fatalf("failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	t.Cleanup(func() {
+		client.Close()
+		server.Stop()
+	})
+	return eth, client
+}
+
+// collectTraceStream subscribes to the trace stream of the given block and
+// gathers all the notifications until the end of the stream.
+func collectTraceStream(t *testing.T, client *rpc.Client, block interface{}, config ...*TraceConfig) ([]*txStreamTraceResult, *blockStreamTraceEnd) {
+	args := []interface{}{"traceBlockStream", block}
+	for _, c := range config {
+		args = append(args, c)
+	}
+	ch := make(chan json.RawMessage)
+	sub, err := client.Subscribe(context.Background(), "debug", ch, args...)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	var results []*txStreamTraceResult
+	for {
+		select {
+		case msg := <-ch:
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(msg, &fields); err != nil {
+				t.Fatalf("failed to decode notification: %v", err)
+			}
+			if _, ok := fields["done"]; ok {
+				end := new(blockStreamTraceEnd)
+				if err := json.Unmarshal(msg, end); err != nil {
+					t.Fatalf("failed to decode stream end: %v", err)
+				}
+				return results, end
+			}
+			result := new(txStreamTraceResult)
+			if err := json.Unmarshal(msg, result); err != nil {
+				t.Fatalf("failed to decode trace result: %v", err)
+			}
+			results = append(results, result)
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stream not terminated, %d results received", len(results))
+		}
+	}
+}
+
+func TestTraceBlockStream(t *testing.T) {
+	eth, client := newTestTraceStreamChain(t)
+	block := eth.blockchain.GetBlockByNumber(1)
+
+	results, end := collectTraceStream(t, client, "0x1")
+	if len(results) != block.Transactions().Len() {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), block.Transactions().Len())
+	}
+	for i, result := range results {
+		if uint64(result.TxIndex) != uint64(i) || result.TxHash != block.Transactions()[i].Hash() {
+			t.Errorf("result %d: out of order: index %d, hash %x", i, result.TxIndex, result.TxHash)
+		}
+		if result.Error != "" || result.Result == nil {
+			t.Errorf("result %d: trace failed: %v", i, result.Error)
+		}
+	}
+	if !end.Done || end.Error != "" || int(end.Transactions) != len(results) {
+		t.Errorf("stream end mismatch: have %+v", end)
+	}
+}
+
+// Tests that named tracers can be streamed, running on transactions executing
+// nested contract calls.
+func TestTraceBlockStreamTracer(t *testing.T) {
+	var (
+		signer = types.HomesteadSigner{}
+		caller = common.Address{0xc1}
+		callee = common.BytesToAddress([]byte{0xc2})
+	)
+	eth := newTestTraceEthereum(t, 1, core.GenesisAlloc{
+		testBank: {Balance: big.NewInt(params.Ether)},
+		// Calls into the callee with all the gas and no input
+		caller: {Balance: big.NewInt(0), Code: common.FromHex("0x60006000600060006000" + "60c2" + "5af100")},
+		// Spins in a loop for a while, long enough to observe interruptions, and
+		// sets storage slot 0 to 1
+		callee: {Balance: big.NewInt(0), Code: common.FromHex("0x610800" + "5b600190038060035750" + "600160005500")},
+	}, func(i int, b *core.BlockGen) {
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			tx, _ := types.SignTx(types.NewTransaction(nonce, caller, big.NewInt(0), 500000, big.NewInt(1), nil), signer, testBankKey)
+			b.AddTx(tx)
+		}
+	})
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(eth)); err != nil {
+		t.Fatalf("failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer server.Stop()
+	defer client.Close()
+
+	tracer := "callTracer"
+	results, end := collectTraceStream(t, client, "0x1", &TraceConfig{Tracer: &tracer})
+	if len(results) != 2 {
+		t.Fatalf("%s: result count mismatch: have %d, want 2", tracer, len(results))
+	}
+	for i, result := range results {
+		if result.Error != "" {
+			t.Errorf("%s, result %d: trace failed: %v", tracer, i, result.Error)
+			continue
+		}
+		blob, _ := json.Marshal(result.Result)
+
+		var frame struct {
+			To    common.Address `json:"to"`
+			Calls []struct {
+				To common.Address `json:"to"`
+			} `json:"calls"`
+		}
+		if err := json.Unmarshal(blob, &frame); err != nil {
+			t.Fatalf("%s, result %d: failed to decode call frame: %v", tracer, i, err)
+		}
+		if frame.To != caller || len(frame.Calls) != 1 || frame.Calls[0].To != callee {
+			t.Errorf("%s, result %d: call frame mismatch: %s", tracer, i, blob)
+		}
+	}
+	if !end.Done || end.Error != "" || end.Transactions != 2 {
+		t.Errorf("%s: stream end mismatch: have %+v", tracer, end)
+	}
+}
+
+func TestTraceBlockStreamEmpty(t *testing.T) {
+	_, client := newTestTraceStreamChain(t)
+
+	results, end := collectTraceStream(t, client, "0x2")
+	if len(results) != 0 {
+		t.Fatalf("results of empty block: %d", len(results))
+	}
+	if !end.Done || end.Error != "" || end.Transactions != 0 {
+		t.Errorf("stream end mismatch: have %+v", end)
+	}
+}
+
+func TestTraceBlockStreamFailure(t *testing.T) {
+	eth, client := newTestTraceStreamChain(t)
+
+	// Assemble a block on top of the chain whose second transaction can't be
+	// executed due to a nonce gap, and make it available by hash
+	var (
+		signer = types.HomesteadSigner{}
+		to     = common.Address{0xaa}
+		head   = eth.blockchain.CurrentBlock()
+	)
+	blocks, _ := core.GenerateChain(eth.blockchain.Config(), head, eth.engine, eth.chainDb, 1, nil)
+
+	var txs []*types.Transaction
+	for _, nonce := range []uint64{3, 10, 4} {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testBankKey)
+		txs = append(txs, tx)
+	}
+	bad := blocks[0].WithBody(txs, nil)
+	rawdb.WriteBlock(eth.chainDb, bad)
+
+	results, end := collectTraceStream(t, client, bad.Hash())
+	if len(results) != 2 {
+		t.Fatalf("result count mismatch: have %d, want 2", len(results))
+	}
+	if results[0].Error != "" {
+		t.Errorf("valid transaction trace failed: %v", results[0].Error)
+	}
+	if results[1].Error == "" {
+		t.Errorf("invalid transaction trace succeeded")
+	}
+	if !end.Done || end.Error == "" || end.Transactions != 2 {
+		t.Errorf("stream end mismatch: have %+v", end)
+	}
+}
+
+func TestTraceBlockStreamUnsubscribe(t *testing.T) {
+	_, client := newTestTraceStreamChain(t)
+
+	// Trace the block fully once, so the lazily established connection doesn't
+	// count towards the goroutines of the tracer
+	if results, end := collectTraceStream(t, client, "0x1"); len(results) != 3 || !end.Done {
+		t.Fatalf("trace failed: %d results, end %+v", len(results), end)
+	}
+	before := runtime.NumGoroutine()
+
+	// Subscribe and drop the subscription as soon as the first result arrives
+	ch := make(chan json.RawMessage)
+	sub, err := client.Subscribe(context.Background(), "debug", ch, "traceBlockStream", "0x1")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no trace result received")
+	}
+	sub.Unsubscribe()
+
+	// All the tracing goroutines should terminate
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("tracing goroutines leaked: have %d, want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
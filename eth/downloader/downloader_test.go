@@ -17,6 +17,7 @@
 package downloader
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -29,9 +30,13 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -477,6 +482,104 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 	return nil
 }
 
+// downloadTesterSnapPeer is a `snap` peer serving the state from the database of
+// the download tester's peers.
+type downloadTesterSnapPeer struct {
+	dl       *downloadTester
+	id       string
+	accounts uint32 // Number of account range requests served
+}
+
+// newSnapPeer registers a new `snap` state serving peer into the tester's
+// snapshot syncer.
+func (dl *downloadTester) newSnapPeer(id string) *downloadTesterSnapPeer {
+	peer := &downloadTesterSnapPeer{dl: dl, id: id}
+	if err := dl.downloader.SnapSyncer.Register(peer); err != nil {
+		panic(err)
+	}
+	return peer
+}
+
+// ID retrieves the peer's unique identifier.
+func (dlp *downloadTesterSnapPeer) ID() string { return dlp.id }
+
+// Log retrieves the peer's own contextual logger.
+func (dlp *downloadTesterSnapPeer) Log() log.Logger { return log.New("peer", dlp.id) }
+
+// RequestAccountRange serves a range of accounts iterated directly from the
+// peer database's account trie, along with the edge proofs.
+func (dlp *downloadTesterSnapPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, size uint64) error {
+	atomic.AddUint32(&dlp.accounts, 1)
+
+	tr, err := trie.New(root, trie.NewDatabase(dlp.dl.peerDb))
+	if err != nil {
+		return dlp.dl.downloader.SnapSyncer.OnAccounts(dlp, id, nil, nil, nil)
+	}
+	var (
+		hashes   []common.Hash
+		accounts [][]byte
+		served   uint64
+	)
+	it := trie.NewIterator(tr.NodeIterator(origin[:]))
+	for it.Next() && served < size {
+		hash := common.BytesToHash(it.Key)
+		hashes = append(hashes, hash)
+		accounts = append(accounts, common.CopyBytes(it.Value))
+		served += uint64(common.HashLength + len(it.Value))
+
+		if bytes.Compare(hash[:], limit[:]) >= 0 {
+			break
+		}
+	}
+	proof := light.NewNodeSet()
+	if err := tr.Prove(origin[:], 0, proof); err != nil {
+		return err
+	}
+	if len(hashes) > 0 {
+		if err := tr.Prove(hashes[len(hashes)-1][:], 0, proof); err != nil {
+			return err
+		}
+	}
+	var proofs [][]byte
+	for _, blob := range proof.NodeList() {
+		proofs = append(proofs, blob)
+	}
+	return dlp.dl.downloader.SnapSyncer.OnAccounts(dlp, id, hashes, accounts, proofs)
+}
+
+// RequestStorageRanges rejects all storage requests, the test chain does not
+// contain any contracts.
+func (dlp *downloadTesterSnapPeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, size uint64) error {
+	return dlp.dl.downloader.SnapSyncer.OnStorage(dlp, id, nil, nil, nil)
+}
+
+// RequestByteCodes rejects all bytecode requests, the test chain does not
+// contain any contracts.
+func (dlp *downloadTesterSnapPeer) RequestByteCodes(id uint64, hashes []common.Hash, size uint64) error {
+	return dlp.dl.downloader.SnapSyncer.OnByteCodes(dlp, id, nil)
+}
+
+// RequestTrieNodes serves the account trie nodes at the requested paths to heal
+// the state after the account ranges are retrieved.
+func (dlp *downloadTesterSnapPeer) RequestTrieNodes(id uint64, root common.Hash, paths []snap.TrieNodePathSet, size uint64) error {
+	tr, err := trie.New(root, trie.NewDatabase(dlp.dl.peerDb))
+	if err != nil {
+		return dlp.dl.downloader.SnapSyncer.OnTrieNodes(dlp, id, nil)
+	}
+	var nodes [][]byte
+	for _, pathset := range paths {
+		if len(pathset) != 1 {
+			break
+		}
+		blob, _, err := tr.TryGetNode(pathset[0])
+		if err != nil {
+			break
+		}
+		nodes = append(nodes, blob)
+	}
+	return dlp.dl.downloader.SnapSyncer.OnTrieNodes(dlp, id, nodes)
+}
+
 // assertOwnChain checks if the local chain contains the correct number of items
 // of the various chain components.
 func assertOwnChain(t *testing.T, tester *downloadTester, length int) {
@@ -545,6 +648,42 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, chain.len())
 }
 
+// Tests that synchronising in snap mode retrieves the chain like fast sync does,
+// but downloads the pivot state over the snap protocol.
+func TestSnapSynchronisation(t *testing.T) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a small enough block chain to download, served over both protocols
+	chain := testChainBase.shorten(blockCacheMaxItems - 15)
+	tester.newPeer("peer", 65, chain)
+	peer := tester.newSnapPeer("peer")
+
+	// Synchronise with the peer and make sure all relevant data was retrieved
+	if err := tester.sync("peer", nil, SnapSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, chain.len())
+
+	if atomic.LoadUint32(&peer.accounts) == 0 {
+		t.Fatalf("state not retrieved over the snap protocol")
+	}
+	// Ensure the state of the pivot block is fully available
+	pivot := chain.blockm[chain.chain[chain.len()-1-fsMinFullBlocks]]
+	statedb, err := state.New(pivot.Root(), state.NewDatabase(tester.stateDb), nil)
+	if err != nil {
+		t.Fatalf("failed to open synchronised state: %v", err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("synchronised state incomplete: %v", it.Error)
+	}
+}
+
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
 func TestThrottling63Full(t *testing.T) { testThrottling(t, 63, FullSync) }
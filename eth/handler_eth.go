@@ -0,0 +1,321 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tags of the local components issuing data retrievals, used to route eth/66
+// responses back to the exact requester.
+const (
+	tagDownloader   eth.RequestTag = iota // Chain and state synchronisation
+	tagBlockFetcher                       // Retrieval of announced blocks
+	tagTxFetcher                          // Retrieval of announced transactions
+	tagCheckpoint                         // Checkpoint challenge of a new peer
+	tagWhitelist                          // Verification of whitelisted blocks
+)
+
+// ethHandler implements the eth.Backend interface to handle the various network
+// packets that are sent as replies or broadcasts.
+type ethHandler ProtocolManager
+
+// Chain retrieves the blockchain object to serve data.
+func (h *ethHandler) Chain() *core.BlockChain { return h.blockchain }
+
+// StateBloom retrieves the bloom filter - if any - for state trie nodes.
+func (h *ethHandler) StateBloom() *trie.SyncBloom { return h.stateBloom }
+
+// TxPool retrieves the transaction pool object to serve data, hiding private
+// transactions from remote peers.
+func (h *ethHandler) TxPool() eth.TxPool { return publicTxPool{h.txpool} }
+
+// AcceptTxs retrieves whether transaction processing is enabled on the node
+// or if inbound transactions should simply be dropped.
+func (h *ethHandler) AcceptTxs() bool {
+	return atomic.LoadUint32(&h.acceptTxs) == 1
+}
+
+// RunPeer is invoked when a peer joins on the `eth` protocol.
+func (h *ethHandler) RunPeer(peer *eth.Peer, hand eth.Handler) error {
+	return (*ProtocolManager)(h).runEthPeer(peer, hand)
+}
+
+// PeerInfo retrieves all known `eth` information about a peer.
+func (h *ethHandler) PeerInfo(id enode.ID) interface{} {
+	if p := h.peers.Peer(id.String()); p != nil {
+		return p.Info()
+	}
+	return nil
+}
+
+// Handle is invoked from a peer's message handler when it receives a new remote
+// message that the handler couldn't consume and serve itself.
+func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
+	// Consume any broadcasts and announces, forwarding the rest to the downloader
+	switch packet := packet.(type) {
+	case *eth.Response:
+		switch res := packet.Packet.(type) {
+		case *eth.BlockHeadersPacket:
+			return h.handleHeadersResponse(peer, packet.Tag, *res)
+
+		case *eth.BlockBodiesPacket:
+			txset, uncleset := res.Unpack()
+			return h.handleBodiesResponse(peer, packet.Tag, txset, uncleset)
+
+		default:
+			// Delivery doesn't depend on the component that issued the request
+			return h.Handle(peer, packet.Packet)
+		}
+
+	case *eth.BlockHeadersPacket:
+		return h.handleHeaders(peer, *packet)
+
+	case *eth.BlockBodiesPacket:
+		txset, uncleset := packet.Unpack()
+		return h.handleBodies(peer, txset, uncleset)
+
+	case *eth.NodeDataPacket:
+		if err := h.downloader.DeliverNodeData(peer.ID(), *packet); err != nil {
+			log.Debug("Failed to deliver node state data", "err", err)
+		}
+		return nil
+
+	case *eth.ReceiptsPacket:
+		if err := h.downloader.DeliverReceipts(peer.ID(), *packet); err != nil {
+			log.Debug("Failed to deliver receipts", "err", err)
+		}
+		return nil
+
+	case *eth.NewBlockHashesPacket:
+		hashes, numbers := packet.Unpack()
+		return h.handleBlockAnnounces(peer, hashes, numbers)
+
+	case *eth.NewBlockPacket:
+		return h.handleBlockBroadcast(peer, packet.Block, packet.TD)
+
+	case *eth.NewPooledTransactionHashesPacket:
+		return h.txFetcher.Notify(peer.ID(), *packet)
+
+	case *eth.TransactionsPacket:
+		return h.txFetcher.Enqueue(peer.ID(), *packet, false)
+
+	case *eth.PooledTransactionsPacket:
+		return h.txFetcher.Enqueue(peer.ID(), *packet, true)
+
+	default:
+		return fmt.Errorf("unexpected eth packet type: %T", packet)
+	}
+}
+
+// handleHeaders is invoked from a peer's message handler when it transmits a batch
+// of headers on a protocol version without request IDs, in which case the fetcher,
+// the downloader and the challenge replies need to be told apart heuristically.
+func (h *ethHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) error {
+	p := h.peers.Peer(peer.ID())
+	if p == nil {
+		return errors.New("unregistered during callback")
+	}
+	// If no headers were received, but we're expencting a checkpoint header, consider it that
+	if len(headers) == 0 && p.syncDrop != nil {
+		// Stop the timer either way, decide later to drop or not
+		p.syncDrop.Stop()
+		p.syncDrop = nil
+
+		// If we're doing a fast sync, we must enforce the checkpoint block to avoid
+		// eclipse attacks. Unsynced nodes are welcome to connect after we're done
+		// joining the network
+		if atomic.LoadUint32(&h.fastSync) == 1 {
+			peer.Log().Warn("Dropping unsynced node during fast sync", "addr", peer.RemoteAddr(), "type", peer.Name())
+			return errors.New("unsynced node cannot serve fast sync")
+		}
+	}
+	// Filter out any explicitly requested headers, deliver the rest to the downloader
+	filter := len(headers) == 1
+	if filter {
+		// If it's a potential sync progress check, validate the content and advertised chain weight
+		if p.syncDrop != nil && headers[0].Number.Uint64() == h.checkpointNumber {
+			// Disable the sync drop timer
+			p.syncDrop.Stop()
+			p.syncDrop = nil
+
+			// Validate the header and either drop the peer or continue
+			if headers[0].Hash() != h.checkpointHash {
+				return errors.New("checkpoint hash mismatch")
+			}
+			return nil
+		}
+		// Otherwise if it's a whitelisted block, validate against the set
+		if want, ok := h.whitelist[headers[0].Number.Uint64()]; ok {
+			if hash := headers[0].Hash(); want != hash {
+				peer.Log().Info("Whitelist mismatch, dropping peer", "number", headers[0].Number.Uint64(), "hash", hash, "want", want)
+				return errors.New("whitelist block mismatch")
+			}
+			peer.Log().Debug("Whitelist block verified", "number", headers[0].Number.Uint64(), "hash", want)
+		}
+		// Irrelevant of the fork checks, send the header to the fetcher just in case
+		headers = h.blockFetcher.FilterHeaders(peer.ID(), headers, time.Now())
+	}
+	if len(headers) > 0 || !filter {
+		err := h.downloader.DeliverHeaders(peer.ID(), headers)
+		if err != nil {
+			log.Debug("Failed to deliver headers", "err", err)
+		}
+	}
+	return nil
+}
+
+// handleHeadersResponse delivers a batch of headers received on eth/66 or later
+// to the exact component that requested them. Contrary to older protocol versions,
+// no heuristics are needed to tell fetcher, downloader and challenge replies apart.
+func (h *ethHandler) handleHeadersResponse(peer *eth.Peer, tag eth.RequestTag, headers []*types.Header) error {
+	switch tag {
+	case tagCheckpoint:
+		p := h.peers.Peer(peer.ID())
+		if p == nil {
+			return errors.New("unregistered during callback")
+		}
+		// Disable the sync drop timer, decide below to drop or not
+		if p.syncDrop != nil {
+			p.syncDrop.Stop()
+			p.syncDrop = nil
+		}
+		// If the peer doesn't have the checkpoint yet, only accept it if we're
+		// not doing a fast sync, where it must be enforced against eclipse attacks
+		if len(headers) == 0 {
+			if atomic.LoadUint32(&h.fastSync) == 1 {
+				peer.Log().Warn("Dropping unsynced node during fast sync", "addr", peer.RemoteAddr(), "type", peer.Name())
+				return errors.New("unsynced node cannot serve fast sync")
+			}
+			return nil
+		}
+		if headers[0].Number.Uint64() != h.checkpointNumber || headers[0].Hash() != h.checkpointHash {
+			return errors.New("checkpoint hash mismatch")
+		}
+
+	case tagWhitelist:
+		// Validate the block against the whitelisted set if the peer has it
+		if len(headers) == 0 {
+			return nil
+		}
+		number := headers[0].Number.Uint64()
+		if want, ok := h.whitelist[number]; ok {
+			if hash := headers[0].Hash(); want != hash {
+				peer.Log().Info("Whitelist mismatch, dropping peer", "number", number, "hash", hash, "want", want)
+				return errors.New("whitelist block mismatch")
+			}
+			peer.Log().Debug("Whitelist block verified", "number", number, "hash", want)
+		}
+
+	case tagBlockFetcher:
+		h.blockFetcher.FilterHeaders(peer.ID(), headers, time.Now())
+
+	default:
+		if err := h.downloader.DeliverHeaders(peer.ID(), headers); err != nil {
+			log.Debug("Failed to deliver headers", "err", err)
+		}
+	}
+	return nil
+}
+
+// handleBodies is invoked from a peer's message handler when it transmits a batch
+// of block bodies on a protocol version without request IDs.
+func (h *ethHandler) handleBodies(peer *eth.Peer, txs [][]*types.Transaction, uncles [][]*types.Header) error {
+	// Filter out any explicitly requested bodies, deliver the rest to the downloader
+	filter := len(txs) > 0 || len(uncles) > 0
+	if filter {
+		txs, uncles = h.blockFetcher.FilterBodies(peer.ID(), txs, uncles, time.Now())
+	}
+	if len(txs) > 0 || len(uncles) > 0 || !filter {
+		err := h.downloader.DeliverBodies(peer.ID(), txs, uncles)
+		if err != nil {
+			log.Debug("Failed to deliver bodies", "err", err)
+		}
+	}
+	return nil
+}
+
+// handleBodiesResponse delivers a batch of block bodies received on eth/66 or
+// later to whoever requested them, no filtering needed.
+func (h *ethHandler) handleBodiesResponse(peer *eth.Peer, tag eth.RequestTag, txs [][]*types.Transaction, uncles [][]*types.Header) error {
+	if tag == tagBlockFetcher {
+		h.blockFetcher.FilterBodies(peer.ID(), txs, uncles, time.Now())
+		return nil
+	}
+	if err := h.downloader.DeliverBodies(peer.ID(), txs, uncles); err != nil {
+		log.Debug("Failed to deliver bodies", "err", err)
+	}
+	return nil
+}
+
+// handleBlockAnnounces is invoked from a peer's message handler when it transmits a
+// batch of block announcements for the local node to process.
+func (h *ethHandler) handleBlockAnnounces(peer *eth.Peer, hashes []common.Hash, numbers []uint64) error {
+	// Schedule all the unknown hashes for retrieval
+	var (
+		unknownHashes  = make([]common.Hash, 0, len(hashes))
+		unknownNumbers = make([]uint64, 0, len(numbers))
+	)
+	for i := 0; i < len(hashes); i++ {
+		if !h.blockchain.HasBlock(hashes[i], numbers[i]) {
+			unknownHashes = append(unknownHashes, hashes[i])
+			unknownNumbers = append(unknownNumbers, numbers[i])
+		}
+	}
+	headerFetcher := func(hash common.Hash) error {
+		return peer.RequestOneHeader(tagBlockFetcher, hash)
+	}
+	bodyFetcher := func(hashes []common.Hash) error {
+		return peer.RequestBodies(tagBlockFetcher, hashes)
+	}
+	for i := 0; i < len(unknownHashes); i++ {
+		h.blockFetcher.Notify(peer.ID(), unknownHashes[i], unknownNumbers[i], time.Now(), headerFetcher, bodyFetcher)
+	}
+	return nil
+}
+
+// handleBlockBroadcast is invoked from a peer's message handler when it transmits a
+// block broadcast for the local node to process.
+func (h *ethHandler) handleBlockBroadcast(peer *eth.Peer, block *types.Block, td *big.Int) error {
+	// Schedule the block for import
+	h.blockFetcher.Enqueue(peer.ID(), block)
+
+	// Assuming the block is importable by the peer, but possibly not yet done so,
+	// calculate the head hash and TD that the peer truly must have.
+	var (
+		trueHead = block.ParentHash()
+		trueTD   = new(big.Int).Sub(td, block.Difficulty())
+	)
+	// Update the peer's total difficulty if better than the previous
+	if _, td := peer.Head(); trueTD.Cmp(td) > 0 {
+		peer.SetHead(trueHead, trueTD)
+		h.chainSync.handlePeerEvent(peer)
+	}
+	return nil
+}
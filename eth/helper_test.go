@@ -37,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -90,9 +91,11 @@ func newTestProtocolManagerMust(t *testing.T, mode downloader.SyncMode, blocks i
 
 // testTxPool is a fake, helper transaction pool for testing purposes
 type testTxPool struct {
-	txFeed event.Feed
-	pool   map[common.Hash]*types.Transaction // Hash map of collected transactions
-	added  chan<- []*types.Transaction        // Notification channel for new transactions
+	txFeed      event.Feed
+	releaseFeed event.Feed
+	pool        map[common.Hash]*types.Transaction // Hash map of collected transactions
+	private     map[common.Hash]bool               // Hash set of transactions withheld from the network
+	added       chan<- []*types.Transaction        // Notification channel for new transactions
 
 	lock sync.RWMutex // Protects the transaction pool
 }
@@ -147,10 +150,50 @@ func (p *testTxPool) Pending() (map[common.Address]types.Transactions, error) {
 	return batches, nil
 }
 
+// IsPrivate returns whether the transaction with the given hash is withheld
+// from the network.
+func (p *testTxPool) IsPrivate(hash common.Hash) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.private[hash]
+}
+
+// addPrivate inserts a batch of transactions into the pool, withholding them
+// from the network until released.
+func (p *testTxPool) addPrivate(txs []*types.Transaction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.private == nil {
+		p.private = make(map[common.Hash]bool)
+	}
+	for _, tx := range txs {
+		p.pool[tx.Hash()] = tx
+		p.private[tx.Hash()] = true
+	}
+	p.txFeed.Send(core.NewTxsEvent{Txs: txs})
+}
+
+// release lifts the privacy of a batch of transactions, notifying any listeners.
+func (p *testTxPool) release(txs []*types.Transaction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, tx := range txs {
+		delete(p.private, tx.Hash())
+	}
+	p.releaseFeed.Send(core.ReleasedTxsEvent{Txs: txs})
+}
+
 func (p *testTxPool) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return p.txFeed.Subscribe(ch)
 }
 
+func (p *testTxPool) SubscribeReleasedTxsEvent(ch chan<- core.ReleasedTxsEvent) event.Subscription {
+	return p.releaseFeed.Subscribe(ch)
+}
+
 // newTestTransaction create a new dummy transaction.
 func newTestTransaction(from *ecdsa.PrivateKey, nonce uint64, datasize int) *types.Transaction {
 	tx := types.NewTransaction(nonce, common.Address{}, big.NewInt(0), 100000, big.NewInt(0), make([]byte, datasize))
@@ -162,21 +205,21 @@ func newTestTransaction(from *ecdsa.PrivateKey, nonce uint64, datasize int) *typ
 type testPeer struct {
 	net p2p.MsgReadWriter // Network layer reader/writer to simulate remote messaging
 	app *p2p.MsgPipeRW    // Application layer reader/writer to simulate the local side
-	*peer
+	*eth.Peer
 }
 
 // newTestPeer creates a new peer registered at the given protocol manager.
-func newTestPeer(name string, version int, pm *ProtocolManager, shake bool) (*testPeer, <-chan error) {
+func newTestPeer(name string, version uint, pm *ProtocolManager, shake bool) (*testPeer, <-chan error) {
 	// Create a message pipe to communicate through
 	app, net := p2p.MsgPipe()
 
 	// Start the peer on a new thread
 	var id enode.ID
 	rand.Read(id[:])
-	peer := pm.newPeer(version, p2p.NewPeer(id, name, nil), net, pm.txpool.Get)
+	peer := eth.NewPeer(version, p2p.NewPeer(id, name, nil), net, pm.txpool)
 	errc := make(chan error, 1)
-	go func() { errc <- pm.runPeer(peer) }()
-	tp := &testPeer{app: app, net: net, peer: peer}
+	go func() { errc <- runTestPeer(pm, peer) }()
+	tp := &testPeer{app: app, net: net, Peer: peer}
 
 	// Execute any implicitly requested handshakes and return
 	if shake {
@@ -191,22 +234,31 @@ func newTestPeer(name string, version int, pm *ProtocolManager, shake bool) (*te
 	return tp, errc
 }
 
+// runTestPeer runs the eth protocol on the given peer against the protocol
+// manager, mimicking how the p2p server would drive a live connection.
+func runTestPeer(pm *ProtocolManager, peer *eth.Peer) error {
+	handler := (*ethHandler)(pm)
+	return handler.RunPeer(peer, func(peer *eth.Peer) error {
+		return eth.Handle(handler, peer)
+	})
+}
+
 // handshake simulates a trivial handshake that expects the same state from the
 // remote side as we are simulating locally.
 func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter) {
 	var msg interface{}
 	switch {
-	case p.version == eth63:
-		msg = &statusData63{
-			ProtocolVersion: uint32(p.version),
+	case p.Version() == eth.ETH63:
+		msg = &eth.StatusPacket63{
+			ProtocolVersion: uint32(p.Version()),
 			NetworkId:       DefaultConfig.NetworkId,
 			TD:              td,
 			CurrentBlock:    head,
 			GenesisBlock:    genesis,
 		}
-	case p.version >= eth64:
-		msg = &statusData{
-			ProtocolVersion: uint32(p.version),
+	case p.Version() >= eth.ETH64:
+		msg = &eth.StatusPacket{
+			ProtocolVersion: uint32(p.Version()),
 			NetworkID:       DefaultConfig.NetworkId,
 			TD:              td,
 			Head:            head,
@@ -214,18 +266,28 @@ func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesi
 			ForkID:          forkID,
 		}
 	default:
-		panic(fmt.Sprintf("unsupported eth protocol version: %d", p.version))
+		panic(fmt.Sprintf("unsupported eth protocol version: %d", p.Version()))
 	}
-	if err := p2p.ExpectMsg(p.app, StatusMsg, msg); err != nil {
+	if err := p2p.ExpectMsg(p.app, eth.StatusMsg, msg); err != nil {
 		t.Fatalf("status recv: %v", err)
 	}
-	if err := p2p.Send(p.app, StatusMsg, msg); err != nil {
+	if err := p2p.Send(p.app, eth.StatusMsg, msg); err != nil {
 		t.Fatalf("status send: %v", err)
 	}
 }
 
+// wrapRequest wraps a request or response payload together with the given request
+// ID if the protocol version carries one (eth/66 and later).
+func wrapRequest(version uint, id uint64, data interface{}) interface{} {
+	if version >= eth.ETH66 {
+		return []interface{}{id, data}
+	}
+	return data
+}
+
 // close terminates the local side of the peer, notifying the remote protocol
 // manager of termination.
 func (p *testPeer) close() {
+	p.Peer.Close()
 	p.app.Close()
 }
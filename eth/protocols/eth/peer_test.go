@@ -0,0 +1,112 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// This file contains some shares testing functionality, common to  multiple
+// different files and modules being tested.
+
+package eth
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// testPeer is a simulated peer to allow testing direct network calls.
+type testPeer struct {
+	*Peer
+
+	net p2p.MsgReadWriter // Network layer reader/writer to simulate remote messaging
+	app *p2p.MsgPipeRW    // Application layer reader/writer to simulate the local side
+}
+
+// newTestPeer creates a new peer registered at the given data backend.
+func newTestPeer(name string, version uint, backend Backend) (*testPeer, <-chan error) {
+	// Create a message pipe to communicate through
+	app, net := p2p.MsgPipe()
+
+	// Start the peer on a new thread
+	var id enode.ID
+	rand.Read(id[:])
+
+	peer := NewPeer(version, p2p.NewPeer(id, name, nil), net, backend.TxPool())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- backend.RunPeer(peer, func(peer *Peer) error {
+			return Handle(backend, peer)
+		})
+	}()
+	return &testPeer{app: app, net: net, Peer: peer}, errc
+}
+
+// close terminates the local side of the peer, notifying the remote protocol
+// manager of termination.
+func (p *testPeer) close() {
+	p.Peer.Close()
+	p.app.Close()
+}
+
+// wrapRequest wraps a request or response payload together with the given request
+// ID if the protocol version carries one (eth/66 and later).
+func wrapRequest(version uint, id uint64, data interface{}) interface{} {
+	if version >= ETH66 {
+		return []interface{}{id, data}
+	}
+	return data
+}
+
+// Tests that eth/66 responses are matched against the pending requests of the
+// peer: replies to unknown requests are discarded, but answering a request with
+// the wrong message type drops the peer.
+func TestResponseDispatch66(t *testing.T) {
+	backend := newTestBackend(0)
+	defer backend.close()
+
+	peer, errc := newTestPeer("peer", ETH66, backend)
+	defer peer.close()
+
+	// Send a response nobody asked for, it should be ignored
+	if err := p2p.Send(peer.app, BlockHeadersMsg, wrapRequest(ETH66, 1, []*types.Header{})); err != nil {
+		t.Fatalf("failed to send unrequested response: %v", err)
+	}
+	// Issue a header request and answer it with block bodies instead
+	go peer.RequestOneHeader(0, backend.chain.Genesis().Hash())
+
+	msg, err := peer.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read request: %v", err)
+	}
+	var packet GetBlockHeadersPacket66
+	if err := msg.Decode(&packet); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if err := p2p.Send(peer.app, BlockBodiesMsg, wrapRequest(ETH66, packet.RequestId, []*BlockBody{})); err != nil {
+		t.Fatalf("failed to send mismatched response: %v", err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errInvalidMsgCode) {
+			t.Fatalf("peer drop reason mismatch: have %v, want %v", err, errInvalidMsgCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("peer not dropped on mismatched response")
+	}
+}
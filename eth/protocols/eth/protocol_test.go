@@ -0,0 +1,163 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that the custom union field encoder and decoder works correctly.
+func TestGetBlockHeadersDataEncodeDecode(t *testing.T) {
+	// Create a "random" hash for testing
+	var hash common.Hash
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+	// Assemble some table driven tests
+	tests := []struct {
+		packet *GetBlockHeadersPacket
+		fail   bool
+	}{
+		// Providing the origin as either a hash or a number should both work
+		{fail: false, packet: &GetBlockHeadersPacket{Origin: HashOrNumber{Number: 314}}},
+		{fail: false, packet: &GetBlockHeadersPacket{Origin: HashOrNumber{Hash: hash}}},
+
+		// Providing arbitrary query field should also work
+		{fail: false, packet: &GetBlockHeadersPacket{Origin: HashOrNumber{Number: 314}, Amount: 314, Skip: 1, Reverse: true}},
+		{fail: false, packet: &GetBlockHeadersPacket{Origin: HashOrNumber{Hash: hash}, Amount: 314, Skip: 1, Reverse: true}},
+
+		// Providing both the origin hash and origin number must fail
+		{fail: true, packet: &GetBlockHeadersPacket{Origin: HashOrNumber{Hash: hash, Number: 314}}},
+	}
+	// Iterate over each of the tests and try to encode and then decode
+	for i, tt := range tests {
+		bytes, err := rlp.EncodeToBytes(tt.packet)
+		if err != nil && !tt.fail {
+			t.Fatalf("test %d: failed to encode packet: %v", i, err)
+		} else if err == nil && tt.fail {
+			t.Fatalf("test %d: encode should have failed", i)
+		}
+		if !tt.fail {
+			packet := new(GetBlockHeadersPacket)
+			if err := rlp.DecodeBytes(bytes, packet); err != nil {
+				t.Fatalf("test %d: failed to decode packet: %v", i, err)
+			}
+			if packet.Origin.Hash != tt.packet.Origin.Hash || packet.Origin.Number != tt.packet.Origin.Number || packet.Amount != tt.packet.Amount ||
+				packet.Skip != tt.packet.Skip || packet.Reverse != tt.packet.Reverse {
+				t.Fatalf("test %d: encode decode mismatch: have %+v, want %+v", i, packet, tt.packet)
+			}
+		}
+	}
+}
+
+// Tests that the eth/66 request and response packets are encoded as a list of
+// the request ID followed by the eth/65 payload, and that the pre-encoded RLP
+// variants are identical on the wire to their decoded counterparts.
+func TestEth66Messages(t *testing.T) {
+	// Assemble some data to fill the packets with
+	var (
+		hashes     = []common.Hash{common.HexToHash("deadc0de"), common.HexToHash("feedbeef")}
+		header     = &types.Header{Difficulty: big.NewInt(2222), Number: big.NewInt(3333), GasLimit: 4444, GasUsed: 5555, Time: 6666, Extra: []byte{0x77, 0x88}}
+		tx         = types.NewTransaction(1, common.HexToAddress("0x01"), big.NewInt(2), 3, big.NewInt(4), []byte{0x05})
+		receipt    = &types.Receipt{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 1, Logs: []*types.Log{}}
+		body       = &BlockBody{Transactions: []*types.Transaction{tx}, Uncles: []*types.Header{header}}
+		query      = &GetBlockHeadersPacket{Origin: HashOrNumber{Number: 9999}, Amount: 5, Skip: 5, Reverse: false}
+		bodyRLP    rlp.RawValue
+		txRLP      rlp.RawValue
+		receiptRLP rlp.RawValue
+	)
+	bodyRLP, _ = rlp.EncodeToBytes(body)
+	txRLP, _ = rlp.EncodeToBytes(tx)
+	receiptRLP, _ = rlp.EncodeToBytes([]*types.Receipt{receipt})
+
+	for i, tt := range []struct {
+		message interface{} // eth/66 packet to encode
+		payload interface{} // eth/65 payload that should be wrapped
+		same    interface{} // optional alternate packet with identical encoding
+	}{
+		{
+			message: GetBlockHeadersPacket66{1111, query},
+			payload: query,
+		},
+		{
+			message: BlockHeadersPacket66{1111, BlockHeadersPacket{header}},
+			payload: BlockHeadersPacket{header},
+		},
+		{
+			message: GetBlockBodiesPacket66{1111, GetBlockBodiesPacket(hashes)},
+			payload: GetBlockBodiesPacket(hashes),
+		},
+		{
+			message: BlockBodiesPacket66{1111, BlockBodiesPacket{body}},
+			payload: BlockBodiesPacket{body},
+			same:    BlockBodiesRLPPacket66{1111, BlockBodiesRLPPacket{bodyRLP}},
+		},
+		{
+			message: GetNodeDataPacket66{1111, GetNodeDataPacket(hashes)},
+			payload: GetNodeDataPacket(hashes),
+		},
+		{
+			message: NodeDataPacket66{1111, NodeDataPacket{[]byte{0xde, 0xad}, []byte{0xc0, 0xde}}},
+			payload: NodeDataPacket{[]byte{0xde, 0xad}, []byte{0xc0, 0xde}},
+		},
+		{
+			message: GetReceiptsPacket66{1111, GetReceiptsPacket(hashes)},
+			payload: GetReceiptsPacket(hashes),
+		},
+		{
+			message: ReceiptsPacket66{1111, ReceiptsPacket{[]*types.Receipt{receipt}}},
+			payload: ReceiptsPacket{[]*types.Receipt{receipt}},
+			same:    ReceiptsRLPPacket66{1111, ReceiptsRLPPacket{receiptRLP}},
+		},
+		{
+			message: GetPooledTransactionsPacket66{1111, GetPooledTransactionsPacket(hashes)},
+			payload: GetPooledTransactionsPacket(hashes),
+		},
+		{
+			message: PooledTransactionsPacket66{1111, PooledTransactionsPacket{tx}},
+			payload: PooledTransactionsPacket{tx},
+			same:    PooledTransactionsRLPPacket66{1111, PooledTransactionsRLPPacket{txRLP}},
+		},
+	} {
+		have, err := rlp.EncodeToBytes(tt.message)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode packet: %v", i, err)
+		}
+		want, err := rlp.EncodeToBytes([]interface{}{uint64(1111), tt.payload})
+		if err != nil {
+			t.Fatalf("test %d: failed to encode payload: %v", i, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("test %d: encoding mismatch: have %x, want %x", i, have, want)
+		}
+		if tt.same != nil {
+			same, err := rlp.EncodeToBytes(tt.same)
+			if err != nil {
+				t.Fatalf("test %d: failed to encode rlp packet: %v", i, err)
+			}
+			if !bytes.Equal(same, want) {
+				t.Errorf("test %d: rlp encoding mismatch: have %x, want %x", i, same, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// maxHash is the largest possible hash, the end of the hash space.
+var maxHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+// serve feeds a single request into the `snap` message handler of the given
+// backend and decodes the reply into res. If res is nil, no reply is expected
+// and the handler's error is returned instead.
+func serve(t *testing.T, backend Backend, req Packet, res Packet) error {
+	t.Helper()
+
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	defer remote.Close()
+
+	peer := newPeer(snap1, p2p.NewPeer(enode.ID{1}, "client", nil), local)
+
+	errc := make(chan error, 1)
+	go func() { errc <- handleMessage(backend, peer) }()
+	go p2p.Send(remote, uint64(req.Kind()), req)
+
+	if res == nil {
+		return <-errc
+	}
+	msg, err := remote.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if msg.Code != uint64(res.Kind()) {
+		t.Fatalf("reply code mismatch: have %d, want %d", msg.Code, res.Kind())
+	}
+	if err := msg.Decode(res); err != nil {
+		t.Fatalf("failed to decode reply: %v", err)
+	}
+	return <-errc
+}
+
+// Tests that account range requests are served with the correct edge proofs,
+// are capped by the requested byte limit and are empty for unknown states.
+func TestGetAccountRange(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		backend = &testBackend{chain: chain}
+		root    = chain.CurrentBlock().Root()
+		limit   = common.HexToHash("0x8000000000000000000000000000000000000000000000000000000000000000")
+	)
+	tests := []struct {
+		origin common.Hash
+		limit  common.Hash
+		bytes  uint64
+		count  int  // Number of accounts expected, -1 if only the range is checked
+		cont   bool // Whether the proof should signal more accounts on the right
+	}{
+		// A range request without any limits should stop at the first account
+		// past the requested limit hash
+		{common.Hash{}, limit, softResponseLimit, -1, true},
+		// A range request hitting the byte limit should be cut short
+		{common.Hash{}, limit, 1, 1, true},
+		// A range request from a non-zero origin needs a proof for it
+		{limit, maxHash, 1, 1, true},
+		// A range past the last account should be empty, but proven so
+		{maxHash, maxHash, softResponseLimit, 0, false},
+	}
+	for i, tt := range tests {
+		res := new(AccountRangePacket)
+		req := &GetAccountRangePacket{ID: uint64(i), Root: root, Origin: tt.origin, Limit: tt.limit, Bytes: tt.bytes}
+		if err := serve(t, backend, req, res); err != nil {
+			t.Fatalf("test %d: failed to serve request: %v", i, err)
+		}
+		if res.ID != uint64(i) {
+			t.Errorf("test %d: request id mismatch: have %d, want %d", i, res.ID, i)
+		}
+		if tt.count >= 0 && len(res.Accounts) != tt.count {
+			t.Errorf("test %d: account count mismatch: have %d, want %d", i, len(res.Accounts), tt.count)
+		}
+		if tt.count < 0 {
+			if len(res.Accounts) < 2 {
+				t.Fatalf("test %d: too few accounts returned: %d", i, len(res.Accounts))
+			}
+			last := res.Accounts[len(res.Accounts)-1].Hash
+			prev := res.Accounts[len(res.Accounts)-2].Hash
+			if bytes.Compare(last[:], tt.limit[:]) < 0 || bytes.Compare(prev[:], tt.limit[:]) >= 0 {
+				t.Errorf("test %d: range not terminated at limit: last %x, prev %x", i, last, prev)
+			}
+		}
+		if len(res.Proof) == 0 {
+			t.Fatalf("test %d: missing edge proofs", i)
+		}
+		hashes, accounts, err := res.Unpack()
+		if err != nil {
+			t.Fatalf("test %d: failed to unpack accounts: %v", i, err)
+		}
+		keys := make([][]byte, len(hashes))
+		for j, hash := range hashes {
+			keys[j] = common.CopyBytes(hash[:])
+		}
+		lastKey := tt.origin[:]
+		if len(keys) > 0 {
+			lastKey = keys[len(keys)-1]
+		}
+		err, cont := trie.VerifyRangeProof(root, tt.origin[:], lastKey, keys, accounts, proofDatabase(res.Proof))
+		if err != nil {
+			t.Fatalf("test %d: failed to verify range proof: %v", i, err)
+		}
+		if cont != tt.cont {
+			t.Errorf("test %d: continuation flag mismatch: have %v, want %v", i, cont, tt.cont)
+		}
+	}
+	// Requests for unknown states should be answered with an empty response
+	res := new(AccountRangePacket)
+	if err := serve(t, backend, &GetAccountRangePacket{ID: 1, Root: common.Hash{0x01}, Limit: maxHash, Bytes: softResponseLimit}, res); err != nil {
+		t.Fatalf("failed to serve unknown state: %v", err)
+	}
+	if len(res.Accounts) != 0 || len(res.Proof) != 0 {
+		t.Errorf("unknown state served: %d accounts, %d proofs", len(res.Accounts), len(res.Proof))
+	}
+}
+
+// Tests that storage range requests deliver complete small storage tries
+// without proofs and cut large ones short at the requested byte limit, proving
+// the delivered part.
+func TestGetStorageRanges(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		backend = &testBackend{chain: chain}
+		root    = chain.CurrentBlock().Root()
+		small   = common.BigToAddress(big.NewInt(11))
+		large   = common.Address{0xff}
+	)
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to retrieve state: %v", err)
+	}
+	// Small storage tries should be delivered in full, without proofs
+	res := new(StorageRangesPacket)
+	req := &GetStorageRangesPacket{
+		ID:       1,
+		Root:     root,
+		Accounts: []common.Hash{crypto.Keccak256Hash(small[:]), crypto.Keccak256Hash(common.BigToAddress(big.NewInt(21)).Bytes())},
+		Bytes:    softResponseLimit,
+	}
+	if err := serve(t, backend, req, res); err != nil {
+		t.Fatalf("failed to serve small storage: %v", err)
+	}
+	if len(res.Slots) != 2 || len(res.Slots[0]) != 10 || len(res.Slots[1]) != 10 {
+		t.Fatalf("small storage ranges mismatch: %d tries", len(res.Slots))
+	}
+	if len(res.Proof) != 0 {
+		t.Errorf("complete storage tries proven: %d nodes", len(res.Proof))
+	}
+	hashset, slotset := res.Unpack()
+	hasher := trie.NewStackTrie(nil)
+	for i, hash := range hashset[0] {
+		hasher.Update(hash[:], slotset[0][i])
+	}
+	if have, want := hasher.Hash(), statedb.StorageTrie(small).Hash(); have != want {
+		t.Errorf("small storage root mismatch: have %x, want %x", have, want)
+	}
+	// Large storage tries should be cut at the byte limit (plus some slack) and
+	// the delivered range proven, even if more accounts were requested
+	res = new(StorageRangesPacket)
+	req = &GetStorageRangesPacket{
+		ID:       2,
+		Root:     root,
+		Accounts: []common.Hash{crypto.Keccak256Hash(large[:]), crypto.Keccak256Hash(small[:])},
+		Bytes:    1024,
+	}
+	if err := serve(t, backend, req, res); err != nil {
+		t.Fatalf("failed to serve large storage: %v", err)
+	}
+	if len(res.Slots) != 1 {
+		t.Fatalf("capped storage response continued with further accounts: %d tries", len(res.Slots))
+	}
+	var size uint64
+	for _, slot := range res.Slots[0] {
+		size += uint64(common.HashLength + len(slot.Body))
+	}
+	if hardLimit := uint64(float64(req.Bytes) * (1 + stateLookupSlack)); size < req.Bytes || size > hardLimit+uint64(common.HashLength+len(res.Slots[0][0].Body)) {
+		t.Errorf("capped storage size mismatch: have %d, want %d-%d", size, req.Bytes, hardLimit)
+	}
+	if len(res.Proof) == 0 {
+		t.Fatalf("capped storage range not proven")
+	}
+	hashset, slotset = res.Unpack()
+	keys := make([][]byte, len(hashset[0]))
+	for i, hash := range hashset[0] {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	err, cont := trie.VerifyRangeProof(statedb.StorageTrie(large).Hash(), common.Hash{}.Bytes(), keys[len(keys)-1], keys, slotset[0], proofDatabase(res.Proof))
+	if err != nil {
+		t.Fatalf("failed to verify storage range proof: %v", err)
+	}
+	if !cont {
+		t.Errorf("capped storage range reported as complete")
+	}
+	// Requests for unknown states should be answered with an empty response
+	res = new(StorageRangesPacket)
+	req = &GetStorageRangesPacket{ID: 3, Root: common.Hash{0x01}, Accounts: []common.Hash{crypto.Keccak256Hash(small[:])}, Bytes: softResponseLimit}
+	if err := serve(t, backend, req, res); err != nil {
+		t.Fatalf("failed to serve unknown state: %v", err)
+	}
+	if len(res.Slots) != 0 || len(res.Proof) != 0 {
+		t.Errorf("unknown state served: %d tries, %d proofs", len(res.Slots), len(res.Proof))
+	}
+}
+
+// Tests that bytecode requests skip unknown codes and stop at the byte limit.
+func TestGetByteCodes(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		backend = &testBackend{chain: chain}
+		first   = crypto.Keccak256Hash([]byte{10, 0})
+		second  = crypto.Keccak256Hash([]byte{20, 0})
+		unknown = common.Hash{0x01}
+	)
+	tests := []struct {
+		hashes []common.Hash
+		bytes  uint64
+		codes  [][]byte
+	}{
+		{[]common.Hash{first, unknown, second}, softResponseLimit, [][]byte{{10, 0}, {20, 0}}},
+		{[]common.Hash{emptyCode, first}, softResponseLimit, [][]byte{{}, {10, 0}}},
+		{[]common.Hash{first, second}, 1, [][]byte{{10, 0}}},
+		{[]common.Hash{unknown}, softResponseLimit, nil},
+	}
+	for i, tt := range tests {
+		res := new(ByteCodesPacket)
+		if err := serve(t, backend, &GetByteCodesPacket{ID: uint64(i), Hashes: tt.hashes, Bytes: tt.bytes}, res); err != nil {
+			t.Fatalf("test %d: failed to serve request: %v", i, err)
+		}
+		if len(res.Codes) != len(tt.codes) {
+			t.Fatalf("test %d: code count mismatch: have %d, want %d", i, len(res.Codes), len(tt.codes))
+		}
+		for j, code := range res.Codes {
+			if !bytes.Equal(code, tt.codes[j]) {
+				t.Errorf("test %d, code %d: content mismatch: have %x, want %x", i, j, code, tt.codes[j])
+			}
+		}
+	}
+}
+
+// Tests that trie node requests are served by path, stop at the byte limit,
+// are empty for unknown states and are rejected if malformed.
+func TestGetTrieNodes(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		backend = &testBackend{chain: chain}
+		root    = chain.CurrentBlock().Root()
+		account = crypto.Keccak256(common.Address{0xff}.Bytes())
+	)
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to retrieve state: %v", err)
+	}
+	storageRoot := statedb.StorageTrie(common.Address{0xff}).Hash()
+
+	// Root nodes of both the account and a storage trie should be retrievable
+	res := new(TrieNodesPacket)
+	req := &GetTrieNodesPacket{
+		ID:    1,
+		Root:  root,
+		Paths: []TrieNodePathSet{{[]byte{}}, {account, []byte{}}},
+		Bytes: softResponseLimit,
+	}
+	if err := serve(t, backend, req, res); err != nil {
+		t.Fatalf("failed to serve trie nodes: %v", err)
+	}
+	if len(res.Nodes) != 2 {
+		t.Fatalf("trie node count mismatch: have %d, want %d", len(res.Nodes), 2)
+	}
+	if hash := crypto.Keccak256Hash(res.Nodes[0]); hash != root {
+		t.Errorf("account root node mismatch: have %x, want %x", hash, root)
+	}
+	if hash := crypto.Keccak256Hash(res.Nodes[1]); hash != storageRoot {
+		t.Errorf("storage root node mismatch: have %x, want %x", hash, storageRoot)
+	}
+	// Requests exceeding the byte limit should be cut short
+	res = new(TrieNodesPacket)
+	req = &GetTrieNodesPacket{ID: 2, Root: root, Paths: []TrieNodePathSet{{[]byte{}}, {account, []byte{}}}, Bytes: 1}
+	if err := serve(t, backend, req, res); err != nil {
+		t.Fatalf("failed to serve capped trie nodes: %v", err)
+	}
+	if len(res.Nodes) != 1 {
+		t.Errorf("capped trie node count mismatch: have %d, want %d", len(res.Nodes), 1)
+	}
+	// Requests for unknown states should be answered with an empty response
+	res = new(TrieNodesPacket)
+	req = &GetTrieNodesPacket{ID: 3, Root: common.Hash{0x01}, Paths: []TrieNodePathSet{{[]byte{}}}, Bytes: softResponseLimit}
+	if err := serve(t, backend, req, res); err != nil {
+		t.Fatalf("failed to serve unknown state: %v", err)
+	}
+	if len(res.Nodes) != 0 {
+		t.Errorf("unknown state served: %d nodes", len(res.Nodes))
+	}
+	// Empty path sets are invalid and should drop the peer
+	req = &GetTrieNodesPacket{ID: 4, Root: root, Paths: []TrieNodePathSet{{}}, Bytes: softResponseLimit}
+	if err := serve(t, backend, req, nil); !errors.Is(err, errBadRequest) {
+		t.Errorf("empty path set error mismatch: have %v, want %v", err, errBadRequest)
+	}
+}
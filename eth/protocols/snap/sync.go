@@ -0,0 +1,1525 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+const (
+	// maxRequestSize is the maximum number of bytes to request from a remote peer.
+	maxRequestSize = 512 * 1024
+
+	// maxStorageSetFetch is the maximum number of contracts to request the
+	// storage of in a single query. If this number is too low, we're not
+	// filling responses fully and waste round trip times. If it's too high,
+	// we're capping responses and waste bandwidth.
+	maxStorageSetFetch = maxRequestSize / 1024 // Approximate 1KB storage per contract
+
+	// maxCodeRequestCount is the maximum number of bytecode blobs to request in a
+	// single query. If this number is too low, we're not filling responses fully
+	// and waste round trip times. If it's too high, we're capping responses and
+	// waste bandwidth.
+	maxCodeRequestCount = maxRequestSize / (24 * 1024) * 4 // ~4x the maximum contract size
+
+	// maxTrieRequestCount is the maximum number of trie node blobs to request in
+	// a single query. If this number is too low, we're not filling responses fully
+	// and waste round trip times. If it's too high, we're capping responses and
+	// waste bandwidth.
+	maxTrieRequestCount = 512
+
+	// requestTimeout is the maximum time a peer is allowed to spend on serving
+	// a single network request.
+	requestTimeout = 10 * time.Second
+
+	// accountConcurrency is the number of chunks to split the account trie into
+	// to allow concurrent retrievals.
+	accountConcurrency = 16
+)
+
+// ErrCancelled is returned from snap syncing if the operation was prematurely
+// terminated.
+var ErrCancelled = errors.New("sync cancelled")
+
+// SyncPeer abstracts out the methods required for a peer to be synced against
+// with the goal of allowing the construction of mock peers without the full
+// blown networking.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a batch of accounts rooted in a specific account
+	// trie, starting with the origin.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRanges fetches a batch of storage slots belonging to one or
+	// more accounts. If slots from only one account is requested, an origin marker
+	// may also be used to retrieve from there.
+	RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of bytecodes by hash.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+
+	// RequestTrieNodes fetches a batch of account or storage trie nodes rooted in
+	// a specific state trie.
+	RequestTrieNodes(id uint64, root common.Hash, paths []TrieNodePathSet, bytes uint64) error
+
+	// Log retrieves the peer's own contextual logger.
+	Log() log.Logger
+}
+
+// accountRequest tracks a pending account range request to ensure responses are
+// to actual requests and to validate any security constraints.
+type accountRequest struct {
+	peer    string      // Peer to which this request is assigned
+	id      uint64      // Request ID of this request
+	timeout *time.Timer // Timer to track delivery timeout
+
+	root   common.Hash  // State root the account range was requested against
+	origin common.Hash  // First account requested to allow continuation checks
+	limit  common.Hash  // Last account requested to allow non-overlapping chunking
+	task   *accountTask // Task which this request is filling
+}
+
+// accountResponse is an already Merkle-verified remote response to an account
+// range request. It contains the subtrie for the requested account range and
+// the database that's going to be filled with the internal nodes on commit.
+type accountResponse struct {
+	task *accountTask // Task which this request is filling
+
+	hashes   []common.Hash    // Account hashes in the returned range
+	accounts []*state.Account // Expanded accounts in the returned range
+	blobs    [][]byte         // Consensus encoded accounts to feed into the stack trie
+
+	cont bool // Whether the account range has a continuation
+}
+
+// storageRequest tracks a pending storage ranges request to ensure responses are
+// to actual requests and to validate any security constraints.
+type storageRequest struct {
+	peer    string      // Peer to which this request is assigned
+	id      uint64      // Request ID of this request
+	timeout *time.Timer // Timer to track delivery timeout
+
+	root  common.Hash    // State root the storage ranges were requested against
+	tasks []*storageTask // Tasks which this request is filling, in account order
+}
+
+// storageResponse is an already Merkle-verified remote response to a storage
+// range request. It contains the slots of the answered contracts, any contracts
+// the remote peer did not get around to serving are released back as pending.
+type storageResponse struct {
+	req *storageRequest // Request this response is delivered for
+
+	hashes  [][]common.Hash // Storage slot hashes in the returned ranges
+	slots   [][][]byte      // Storage slot values in the returned ranges
+	invalid []bool          // Whether the returned range failed verification
+
+	cont bool // Whether the last storage range has a continuation
+}
+
+// bytecodeRequest tracks a pending bytecode request to ensure responses are to
+// actual requests and to validate any security constraints.
+type bytecodeRequest struct {
+	peer    string      // Peer to which this request is assigned
+	id      uint64      // Request ID of this request
+	timeout *time.Timer // Timer to track delivery timeout
+
+	hashes []common.Hash // Bytecode hashes to validate responses
+	heal   bool          // Whether the codes were requested by the state healer
+}
+
+// bytecodeResponse is an already verified remote response to a bytecode request.
+type bytecodeResponse struct {
+	req *bytecodeRequest // Request this response is delivered for
+
+	codes map[common.Hash][]byte // Delivered bytecodes, keyed by their hash
+}
+
+// trienodeHealRequest tracks a pending state trie request to ensure responses
+// are to actual requests and to validate any security constraints.
+type trienodeHealRequest struct {
+	peer    string      // Peer to which this request is assigned
+	id      uint64      // Request ID of this request
+	timeout *time.Timer // Timer to track delivery timeout
+
+	root   common.Hash                   // State root the trie nodes were requested against
+	hashes []common.Hash                 // Trie node hashes to validate responses
+	paths  map[common.Hash]trie.SyncPath // Trie node paths for requeueing undelivered nodes
+}
+
+// trienodeHealResponse is an already verified remote response to a trie node
+// request.
+type trienodeHealResponse struct {
+	req *trienodeHealRequest // Request this response is delivered for
+
+	nodes map[common.Hash][]byte // Delivered trie nodes, keyed by their hash
+}
+
+// accountTask represents the sync task for a chunk of the account snapshot.
+type accountTask struct {
+	Next common.Hash // Next account to sync in this interval
+	Last common.Hash // Last account to sync in this interval
+
+	req     *accountRequest // Pending request to fill this task
+	genTrie *trie.StackTrie // Stack trie regenerating the interval's trie nodes
+	done    bool            // Flag whether the task can be removed
+}
+
+// storageTask represents the sync task for the storage trie of a contract.
+type storageTask struct {
+	Account common.Hash // Account hash of one of the contracts owning the storage
+	Root    common.Hash // Storage root hash of the contract to verify against
+	Next    common.Hash // Next slot to sync in the storage trie (zero if not started)
+
+	req     *storageRequest // Pending request to fill this task
+	genTrie *trie.StackTrie // Stack trie regenerating a storage trie delivered in chunks
+}
+
+// syncProgress is a database entry to allow suspending and resuming a snapshot
+// state sync. Opposed to full and fast sync, there is no way to restart a
+// suspended snap sync without prior knowledge of the suspension point.
+type syncProgress struct {
+	Tasks        []*accountTask // The account range tasks not yet completed
+	StorageTasks []*storageTask // The storage tries queued up for retrieval
+	CodeTasks    []common.Hash  // The bytecodes queued up for retrieval
+
+	// Status report during syncing phase
+	AccountSynced  uint64             // Number of accounts downloaded
+	AccountBytes   common.StorageSize // Number of account trie bytes persisted to disk
+	BytecodeSynced uint64             // Number of bytecodes downloaded
+	BytecodeBytes  common.StorageSize // Number of bytecode bytes downloaded
+	StorageSynced  uint64             // Number of storage slots downloaded
+	StorageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
+}
+
+// healTask represents the sync task for healing the snap-synced chunk boundaries
+// and any state changed since the range retrievals were started.
+type healTask struct {
+	scheduler *trie.Sync                    // State trie sync scheduler defining the tasks
+	trieTasks map[common.Hash]trie.SyncPath // Set of trie node tasks currently queued for retrieval
+	codeTasks map[common.Hash]struct{}      // Set of byte code tasks currently queued for retrieval
+}
+
+// trieWriter is an ethdb.KeyValueWriter collecting the trie nodes regenerated
+// by the stack tries into a database batch, marking them in the sync bloom too.
+type trieWriter struct {
+	batch ethdb.Batch
+	bloom *trie.SyncBloom
+}
+
+// Put implements ethdb.KeyValueWriter, writing a trie node into the batch.
+func (w *trieWriter) Put(key []byte, value []byte) error {
+	if w.bloom != nil {
+		w.bloom.Add(key)
+	}
+	return w.batch.Put(key, value)
+}
+
+// Delete implements ethdb.KeyValueWriter, but it's not supported.
+func (w *trieWriter) Delete(key []byte) error { panic("not supported") }
+
+// Syncer is an Ethereum account and storage trie syncer based on snapshots and
+// the snap protocol. Its purpose is to download all the accounts and storage
+// slots from remote peers and reassemble chunks of the state trie, on top of
+// which a state sync can be run to fix any gaps / overlaps.
+//
+// Every network request has a variety of failure events:
+//   - The peer disconnects after task assignment, failing to send the request
+//   - The peer disconnects after sending the request, before delivering on it
+//   - The peer remains connected, but does not deliver a response in time
+//   - The peer delivers a stale response after a previous timeout
+//   - The peer delivers a refusal to serve the requested state
+type Syncer struct {
+	db    ethdb.KeyValueStore // Database to store the trie nodes into (and dedup)
+	bloom *trie.SyncBloom     // Bloom filter to deduplicate nodes for state fixup
+
+	writer *trieWriter // Batch writer of the regenerated trie nodes and codes
+
+	root   common.Hash    // Current state trie root being synced
+	tasks  []*accountTask // Current account task set being synced
+	healer *healTask      // Current state healing task being executed
+
+	storageTasks []*storageTask           // Storage tries queued up for retrieval
+	storageRoots map[common.Hash]struct{} // Storage roots already queued up, to deduplicate contracts
+	codeTasks    map[common.Hash]struct{} // Bytecodes queued up for retrieval
+
+	update chan struct{} // Notification channel for possible sync progression
+
+	peers   map[string]SyncPeer // Currently active peers to download from
+	idlers  map[string]struct{} // Peers that aren't serving requests
+	refused map[string]struct{} // Peers that refused to serve the current root
+
+	nextID       uint64                          // Request ID to assign to the next request
+	accountReqs  map[uint64]*accountRequest      // Account requests currently running
+	storageReqs  map[uint64]*storageRequest      // Storage requests currently running
+	bytecodeReqs map[uint64]*bytecodeRequest     // Bytecode requests currently running
+	trienodeReqs map[uint64]*trienodeHealRequest // Trie node requests currently running
+
+	pend []interface{} // Delivered responses and failed requests awaiting processing
+
+	accountSynced  uint64             // Number of accounts downloaded
+	accountBytes   common.StorageSize // Number of account trie bytes persisted to disk
+	bytecodeSynced uint64             // Number of bytecodes downloaded
+	bytecodeBytes  common.StorageSize // Number of bytecode bytes downloaded
+	storageSynced  uint64             // Number of storage slots downloaded
+	storageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
+	healSynced     uint64             // Number of state trie nodes and codes healed
+	healBytes      common.StorageSize // Number of state trie bytes healed
+
+	startTime time.Time // Time instance when snapshot sync started
+	logTime   time.Time // Time instance when status was last reported
+
+	lock sync.RWMutex // Protects fields that can change outside of sync (peers, reqs, root)
+}
+
+// NewSyncer creates a new snapshot syncer to download the Ethereum state over the
+// snap protocol, resuming the progress of any previously suspended sync.
+func NewSyncer(db ethdb.KeyValueStore, bloom *trie.SyncBloom) *Syncer {
+	s := &Syncer{
+		db:           db,
+		bloom:        bloom,
+		writer:       &trieWriter{batch: db.NewBatch(), bloom: bloom},
+		storageRoots: make(map[common.Hash]struct{}),
+		codeTasks:    make(map[common.Hash]struct{}),
+		update:       make(chan struct{}, 1),
+		peers:        make(map[string]SyncPeer),
+		idlers:       make(map[string]struct{}),
+		refused:      make(map[string]struct{}),
+		accountReqs:  make(map[uint64]*accountRequest),
+		storageReqs:  make(map[uint64]*storageRequest),
+		bytecodeReqs: make(map[uint64]*bytecodeRequest),
+		trienodeReqs: make(map[uint64]*trienodeHealRequest),
+	}
+	s.loadSyncStatus()
+	return s
+}
+
+// loadSyncStatus retrieves a previously aborted sync status from the database,
+// or generates a fresh one if none is available.
+func (s *Syncer) loadSyncStatus() {
+	if status := rawdb.ReadSnapshotSyncStatus(s.db); status != nil {
+		var progress syncProgress
+		if err := json.Unmarshal(status, &progress); err != nil {
+			log.Error("Failed to decode snap sync status", "err", err)
+		} else {
+			s.tasks = progress.Tasks
+			s.storageTasks = progress.StorageTasks
+			for _, task := range s.storageTasks {
+				s.storageRoots[task.Root] = struct{}{}
+			}
+			for _, hash := range progress.CodeTasks {
+				s.codeTasks[hash] = struct{}{}
+			}
+			s.accountSynced, s.accountBytes = progress.AccountSynced, progress.AccountBytes
+			s.bytecodeSynced, s.bytecodeBytes = progress.BytecodeSynced, progress.BytecodeBytes
+			s.storageSynced, s.storageBytes = progress.StorageSynced, progress.StorageBytes
+
+			log.Debug("Resuming snapshot sync", "accounttasks", len(s.tasks), "storagetasks", len(s.storageTasks), "codetasks", len(s.codeTasks))
+			return
+		}
+	}
+	// Either we've failed to decode the previous state, or there was none, start
+	// a fresh sync by chunking up the account range
+	s.tasks = newAccountTasks()
+}
+
+// saveSyncStatus marshals the remaining sync tasks into the given database
+// writer, to be persisted atomically with the data they account for.
+func (s *Syncer) saveSyncStatus(db ethdb.KeyValueWriter) {
+	progress := &syncProgress{
+		StorageTasks:   s.storageTasks,
+		AccountSynced:  s.accountSynced,
+		AccountBytes:   s.accountBytes,
+		BytecodeSynced: s.bytecodeSynced,
+		BytecodeBytes:  s.bytecodeBytes,
+		StorageSynced:  s.storageSynced,
+		StorageBytes:   s.storageBytes,
+	}
+	for _, task := range s.tasks {
+		if !task.done {
+			progress.Tasks = append(progress.Tasks, task)
+		}
+	}
+	for hash := range s.codeTasks {
+		progress.CodeTasks = append(progress.CodeTasks, hash)
+	}
+	// Bytecodes are removed from the queue while being retrieved, so include all
+	// the ones not yet written to disk
+	s.lock.RLock()
+	for _, req := range s.bytecodeReqs {
+		if !req.heal {
+			progress.CodeTasks = append(progress.CodeTasks, req.hashes...)
+		}
+	}
+	for _, item := range s.pend {
+		switch item := item.(type) {
+		case *bytecodeRequest:
+			if !item.heal {
+				progress.CodeTasks = append(progress.CodeTasks, item.hashes...)
+			}
+		case *bytecodeResponse:
+			if !item.req.heal {
+				progress.CodeTasks = append(progress.CodeTasks, item.req.hashes...)
+			}
+		}
+	}
+	s.lock.RUnlock()
+
+	status, err := json.Marshal(progress)
+	if err != nil {
+		panic(err) // This can only fail during implementation
+	}
+	rawdb.WriteSnapshotSyncStatus(db, status)
+}
+
+// newAccountTasks splits the account hash space into a number of equal chunks
+// to allow concurrent retrievals.
+func newAccountTasks() []*accountTask {
+	var (
+		tasks []*accountTask
+		next  = new(big.Int)
+		step  = new(big.Int).Exp(common.Big2, common.Big256, nil)
+	)
+	step.Div(step, big.NewInt(accountConcurrency))
+	for i := 0; i < accountConcurrency; i++ {
+		last := new(big.Int).Add(next, step)
+		last.Sub(last, common.Big1)
+		if i == accountConcurrency-1 {
+			// Make sure we don't overflow if the step is not a proper divisor
+			last = math.MaxBig256
+		}
+		tasks = append(tasks, &accountTask{
+			Next: common.BigToHash(next),
+			Last: common.BigToHash(last),
+		})
+		next = new(big.Int).Add(last, common.Big1)
+	}
+	return tasks
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer SyncPeer) error {
+	// Make sure the peer is not registered yet
+	id := peer.ID()
+
+	s.lock.Lock()
+	if _, ok := s.peers[id]; ok {
+		log.Error("Snap peer already registered", "id", id)
+
+		s.lock.Unlock()
+		return errors.New("already registered")
+	}
+	s.peers[id] = peer
+	s.idlers[id] = struct{}{}
+	s.lock.Unlock()
+
+	// Notify any active syncs that a new peer can be assigned data
+	s.notify()
+	return nil
+}
+
+// Unregister removes a data source from the syncer's peerset, failing any of
+// its pending requests.
+func (s *Syncer) Unregister(id string) error {
+	// Remove all traces of the peer from the registry
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; !ok {
+		log.Error("Snap peer not registered", "id", id)
+		return errors.New("not registered")
+	}
+	delete(s.peers, id)
+	delete(s.idlers, id)
+	delete(s.refused, id)
+
+	// Fail all the requests assigned to the peer
+	for reqid, req := range s.accountReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.accountReqs, reqid)
+			s.pend = append(s.pend, req)
+		}
+	}
+	for reqid, req := range s.storageReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.storageReqs, reqid)
+			s.pend = append(s.pend, req)
+		}
+	}
+	for reqid, req := range s.bytecodeReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.bytecodeReqs, reqid)
+			s.pend = append(s.pend, req)
+		}
+	}
+	for reqid, req := range s.trienodeReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.trienodeReqs, reqid)
+			s.pend = append(s.pend, req)
+		}
+	}
+	s.notify()
+	return nil
+}
+
+// notify pings the sync loop that there might be something to do.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// Sync starts (or resumes a previous) sync cycle to iterate over an state trie
+// with the given root and reconstruct the nodes based on the snapshot leaves.
+// Previously downloaded segments will not be redownloaded or fixed, rather any
+// errors will be healed after the leaves are fully accumulated.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	// Move the trie root from any previous value, revert stateless markers for
+	// any peers and initialize the syncer if it was not yet run
+	s.lock.Lock()
+	if s.root != root {
+		s.root = root
+		s.healer = nil
+		s.refused = make(map[string]struct{})
+	}
+	if s.startTime == (time.Time{}) {
+		s.startTime = time.Now()
+	}
+	s.lock.Unlock()
+
+	log.Debug("Starting snapshot sync cycle", "root", root)
+	defer s.revert()
+
+	for {
+		// Process all the deliveries and failures accumulated since the last
+		// run, and check whether the sync cycle is finished
+		s.process()
+
+		if s.healer == nil && s.ranged() {
+			// All the contiguous ranges were retrieved, switch over to healing
+			// the gaps between the chunks and any changes to the pivot state
+			if err := s.flush(); err != nil {
+				return err
+			}
+			s.healer = &healTask{
+				scheduler: state.NewStateSync(root, s.db, s.bloom),
+				trieTasks: make(map[common.Hash]trie.SyncPath),
+				codeTasks: make(map[common.Hash]struct{}),
+			}
+			log.Debug("Snapshot ranges retrieved, healing state", "root", root)
+		}
+		if s.healer != nil && s.healer.scheduler.Pending() == 0 {
+			if err := s.flush(); err != nil {
+				return err
+			}
+			s.report(true)
+			return nil
+		}
+		// Assign all the data retrieval tasks to any free peers
+		s.assignAccountTasks()
+		s.assignStorageTasks()
+		s.assignBytecodeTasks()
+		s.assignTrienodeHealTasks()
+		s.assignBytecodeHealTasks()
+
+		s.report(false)
+
+		// Wait for something to happen
+		select {
+		case <-s.update:
+		case <-cancel:
+			return ErrCancelled
+		}
+	}
+}
+
+// ranged reports whether all the account ranges, storage tries and bytecodes
+// have been retrieved.
+func (s *Syncer) ranged() bool {
+	for _, task := range s.tasks {
+		if !task.done {
+			return false
+		}
+	}
+	if len(s.storageTasks) > 0 || len(s.codeTasks) > 0 {
+		return false
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.pend) == 0 && len(s.accountReqs) == 0 && len(s.storageReqs) == 0 && len(s.bytecodeReqs) == 0
+}
+
+// flush writes all the accumulated trie nodes and codes into the database,
+// together with the sync status to resume from if the sync is interrupted.
+// Once the state is complete, the status is dropped so a subsequent sync
+// starts afresh.
+func (s *Syncer) flush() error {
+	if s.healer != nil && s.healer.scheduler.Pending() == 0 {
+		rawdb.DeleteSnapshotSyncStatus(s.writer.batch)
+	} else {
+		s.saveSyncStatus(s.writer.batch)
+	}
+	if err := s.writer.batch.Write(); err != nil {
+		return err
+	}
+	s.writer.batch.Reset()
+	return nil
+}
+
+// process runs all the accumulated deliveries and failed requests through the
+// task scheduler.
+func (s *Syncer) process() {
+	s.lock.Lock()
+	pend := s.pend
+	s.pend = nil
+	s.lock.Unlock()
+
+	for _, item := range pend {
+		switch item := item.(type) {
+		case *accountRequest:
+			s.revertAccountRequest(item)
+		case *storageRequest:
+			s.revertStorageRequest(item)
+		case *bytecodeRequest:
+			s.revertBytecodeRequest(item)
+		case *trienodeHealRequest:
+			s.revertTrienodeHealRequest(item)
+
+		case *accountResponse:
+			s.processAccountResponse(item)
+		case *storageResponse:
+			s.processStorageResponse(item)
+		case *bytecodeResponse:
+			s.processBytecodeResponse(item)
+		case *trienodeHealResponse:
+			s.processTrienodeHealResponse(item)
+		}
+	}
+	if s.writer.batch.ValueSize() > ethdb.IdealBatchSize {
+		if err := s.flush(); err != nil {
+			log.Crit("Failed to persist synced state", "err", err)
+		}
+	}
+}
+
+// revert fails all the requests still in flight when a sync cycle terminates,
+// so that their tasks are rescheduled on the next cycle.
+func (s *Syncer) revert() {
+	s.lock.Lock()
+	for id, req := range s.accountReqs {
+		req.timeout.Stop()
+		delete(s.accountReqs, id)
+		s.pend = append(s.pend, req)
+		s.markIdle(req.peer)
+	}
+	for id, req := range s.storageReqs {
+		req.timeout.Stop()
+		delete(s.storageReqs, id)
+		s.pend = append(s.pend, req)
+		s.markIdle(req.peer)
+	}
+	for id, req := range s.bytecodeReqs {
+		req.timeout.Stop()
+		delete(s.bytecodeReqs, id)
+		s.pend = append(s.pend, req)
+		s.markIdle(req.peer)
+	}
+	for id, req := range s.trienodeReqs {
+		req.timeout.Stop()
+		delete(s.trienodeReqs, id)
+		s.pend = append(s.pend, req)
+		s.markIdle(req.peer)
+	}
+	s.lock.Unlock()
+
+	// Process any already delivered data too, it was verified against the old
+	// root, so any stale bits will be healed by the next cycle
+	s.process()
+	if err := s.flush(); err != nil {
+		log.Error("Failed to persist synced state", "err", err)
+	}
+}
+
+// markIdle returns a peer into the idle pool if it's still connected. The
+// caller must hold the lock.
+func (s *Syncer) markIdle(id string) {
+	if _, ok := s.peers[id]; ok {
+		s.idlers[id] = struct{}{}
+	}
+}
+
+// idlePeer retrieves a peer without any requests in flight that has not yet
+// refused to serve the current root, removing it from the idle pool. The
+// caller must hold the lock.
+func (s *Syncer) idlePeer() SyncPeer {
+	for id := range s.idlers {
+		if _, ok := s.refused[id]; ok {
+			continue
+		}
+		delete(s.idlers, id)
+		return s.peers[id]
+	}
+	return nil
+}
+
+// scheduleTimeout starts a timer failing the given request if the remote peer
+// does not deliver it in time. The caller must hold the lock.
+func (s *Syncer) scheduleTimeout(peer SyncPeer, fail func() bool) *time.Timer {
+	return time.AfterFunc(requestTimeout, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if fail() {
+			peer.Log().Debug("Snap request timed out")
+			s.markIdle(peer.ID())
+			s.notify()
+		}
+	})
+}
+
+// assignAccountTasks attempts to match idle peers to pending account range
+// retrievals.
+func (s *Syncer) assignAccountTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, task := range s.tasks {
+		// Skip any tasks already filling or completed
+		if task.done || task.req != nil {
+			continue
+		}
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		s.nextID++
+		req := &accountRequest{
+			peer:   peer.ID(),
+			id:     s.nextID,
+			root:   s.root,
+			origin: task.Next,
+			limit:  task.Last,
+			task:   task,
+		}
+		req.timeout = s.scheduleTimeout(peer, func() bool {
+			if s.accountReqs[req.id] != req {
+				return false
+			}
+			delete(s.accountReqs, req.id)
+			s.pend = append(s.pend, req)
+			return true
+		})
+		s.accountReqs[req.id] = req
+		task.req = req
+
+		go func(peer SyncPeer, root common.Hash) {
+			if err := peer.RequestAccountRange(req.id, root, req.origin, req.limit, maxRequestSize); err != nil {
+				peer.Log().Debug("Failed to request account range", "err", err)
+			}
+		}(peer, s.root)
+	}
+}
+
+// assignStorageTasks attempts to match idle peers to pending storage range
+// retrievals.
+func (s *Syncer) assignStorageTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		// Gather a batch of contracts to retrieve the storage of. Contracts
+		// already partially retrieved are requested alone, continuing from
+		// the last delivered slot.
+		var tasks []*storageTask
+		for _, task := range s.storageTasks {
+			if task.req != nil {
+				continue
+			}
+			if task.Next != (common.Hash{}) {
+				if len(tasks) == 0 {
+					tasks = append(tasks, task)
+					break
+				}
+				continue
+			}
+			tasks = append(tasks, task)
+			if len(tasks) >= maxStorageSetFetch {
+				break
+			}
+		}
+		if len(tasks) == 0 {
+			return
+		}
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		s.nextID++
+		req := &storageRequest{
+			peer:  peer.ID(),
+			id:    s.nextID,
+			root:  s.root,
+			tasks: tasks,
+		}
+		req.timeout = s.scheduleTimeout(peer, func() bool {
+			if s.storageReqs[req.id] != req {
+				return false
+			}
+			delete(s.storageReqs, req.id)
+			s.pend = append(s.pend, req)
+			return true
+		})
+		s.storageReqs[req.id] = req
+
+		var (
+			accounts = make([]common.Hash, len(tasks))
+			origin   []byte
+		)
+		for i, task := range tasks {
+			task.req = req
+			accounts[i] = task.Account
+		}
+		if tasks[0].Next != (common.Hash{}) {
+			origin = tasks[0].Next[:]
+		}
+		go func(peer SyncPeer, root common.Hash) {
+			if err := peer.RequestStorageRanges(req.id, root, accounts, origin, nil, maxRequestSize); err != nil {
+				peer.Log().Debug("Failed to request storage ranges", "err", err)
+			}
+		}(peer, s.root)
+	}
+}
+
+// assignBytecodeTasks attempts to match idle peers to pending code retrievals.
+func (s *Syncer) assignBytecodeTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for len(s.codeTasks) > 0 {
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		hashes := make([]common.Hash, 0, maxCodeRequestCount)
+		for hash := range s.codeTasks {
+			delete(s.codeTasks, hash)
+
+			hashes = append(hashes, hash)
+			if len(hashes) >= maxCodeRequestCount {
+				break
+			}
+		}
+		s.requestBytecodes(peer, hashes, false)
+	}
+}
+
+// assignBytecodeHealTasks attempts to match idle peers to bytecode requests to
+// heal any missing codes encountered while healing the state trie.
+func (s *Syncer) assignBytecodeHealTasks() {
+	if s.healer == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for len(s.healer.codeTasks) > 0 {
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		hashes := make([]common.Hash, 0, maxCodeRequestCount)
+		for hash := range s.healer.codeTasks {
+			delete(s.healer.codeTasks, hash)
+
+			hashes = append(hashes, hash)
+			if len(hashes) >= maxCodeRequestCount {
+				break
+			}
+		}
+		s.requestBytecodes(peer, hashes, true)
+	}
+}
+
+// requestBytecodes assigns a bytecode retrieval to the given peer. The caller
+// must hold the lock.
+func (s *Syncer) requestBytecodes(peer SyncPeer, hashes []common.Hash, heal bool) {
+	s.nextID++
+	req := &bytecodeRequest{
+		peer:   peer.ID(),
+		id:     s.nextID,
+		hashes: hashes,
+		heal:   heal,
+	}
+	req.timeout = s.scheduleTimeout(peer, func() bool {
+		if s.bytecodeReqs[req.id] != req {
+			return false
+		}
+		delete(s.bytecodeReqs, req.id)
+		s.pend = append(s.pend, req)
+		return true
+	})
+	s.bytecodeReqs[req.id] = req
+
+	go func() {
+		if err := peer.RequestByteCodes(req.id, hashes, maxRequestSize); err != nil {
+			peer.Log().Debug("Failed to request bytecodes", "err", err)
+		}
+	}()
+}
+
+// assignTrienodeHealTasks attempts to match idle peers to trie node requests to
+// heal any trie errors caused by the snap sync's chunked retrieval model.
+func (s *Syncer) assignTrienodeHealTasks() {
+	if s.healer == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		// Top up the pending tasks from the scheduler if they ran dry
+		if len(s.healer.trieTasks) == 0 && len(s.healer.codeTasks) == 0 {
+			nodes, paths, codes := s.healer.scheduler.Missing(maxTrieRequestCount)
+			for i, hash := range nodes {
+				s.healer.trieTasks[hash] = paths[i]
+			}
+			for _, hash := range codes {
+				s.healer.codeTasks[hash] = struct{}{}
+			}
+		}
+		if len(s.healer.trieTasks) == 0 {
+			return
+		}
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		var (
+			hashes   = make([]common.Hash, 0, maxTrieRequestCount)
+			paths    = make(map[common.Hash]trie.SyncPath)
+			pathsets = make([]TrieNodePathSet, 0, maxTrieRequestCount)
+		)
+		for hash, path := range s.healer.trieTasks {
+			delete(s.healer.trieTasks, hash)
+
+			hashes = append(hashes, hash)
+			paths[hash] = path
+			pathsets = append(pathsets, TrieNodePathSet(path))
+			if len(hashes) >= maxTrieRequestCount {
+				break
+			}
+		}
+		s.nextID++
+		req := &trienodeHealRequest{
+			peer:   peer.ID(),
+			id:     s.nextID,
+			root:   s.root,
+			hashes: hashes,
+			paths:  paths,
+		}
+		req.timeout = s.scheduleTimeout(peer, func() bool {
+			if s.trienodeReqs[req.id] != req {
+				return false
+			}
+			delete(s.trienodeReqs, req.id)
+			s.pend = append(s.pend, req)
+			return true
+		})
+		s.trienodeReqs[req.id] = req
+
+		go func(peer SyncPeer, root common.Hash) {
+			if err := peer.RequestTrieNodes(req.id, root, pathsets, maxRequestSize); err != nil {
+				peer.Log().Debug("Failed to request trie nodes", "err", err)
+			}
+		}(peer, s.root)
+	}
+}
+
+// revertAccountRequest cleans up an account range request and returns all
+// failed retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) revertAccountRequest(req *accountRequest) {
+	if req.task.req == req {
+		req.task.req = nil
+	}
+}
+
+// revertStorageRequest cleans up a storage range request and returns all
+// failed retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) revertStorageRequest(req *storageRequest) {
+	for _, task := range req.tasks {
+		if task.req == req {
+			task.req = nil
+		}
+	}
+}
+
+// revertBytecodeRequest cleans up a bytecode request and returns all failed
+// retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) revertBytecodeRequest(req *bytecodeRequest) {
+	if req.heal {
+		// Drop the codes if the healer was replaced in the mean time, the new
+		// one will schedule them afresh
+		if s.healer == nil {
+			return
+		}
+		for _, hash := range req.hashes {
+			s.healer.codeTasks[hash] = struct{}{}
+		}
+		return
+	}
+	for _, hash := range req.hashes {
+		s.codeTasks[hash] = struct{}{}
+	}
+}
+
+// revertTrienodeHealRequest cleans up a trie node request and returns all
+// failed retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) revertTrienodeHealRequest(req *trienodeHealRequest) {
+	if s.healer == nil || req.root != s.root {
+		return
+	}
+	for hash, path := range req.paths {
+		s.healer.trieTasks[hash] = path
+	}
+}
+
+// processAccountResponse integrates an already validated account range response
+// into the account tasks, regenerating the trie nodes of the interval and
+// scheduling the retrieval of any storage tries and bytecodes referenced.
+func (s *Syncer) processAccountResponse(res *accountResponse) {
+	task := res.task
+	task.req = nil
+
+	if task.genTrie == nil {
+		task.genTrie = trie.NewStackTrie(s.writer)
+	}
+	for i, hash := range res.hashes {
+		// Accounts past the end of the interval are filled by the next task
+		if bytes.Compare(hash[:], task.Last[:]) > 0 {
+			res.cont = false
+			break
+		}
+		account := res.accounts[i]
+		if account.CodeHash != nil && !bytes.Equal(account.CodeHash, emptyCode[:]) {
+			if code := common.BytesToHash(account.CodeHash); !s.hasCode(code) {
+				s.codeTasks[code] = struct{}{}
+			}
+		}
+		if account.Root != emptyRoot && !s.hasTrieNode(account.Root) {
+			if _, ok := s.storageRoots[account.Root]; !ok {
+				s.storageRoots[account.Root] = struct{}{}
+				s.storageTasks = append(s.storageTasks, &storageTask{
+					Account: hash,
+					Root:    account.Root,
+				})
+			}
+		}
+		task.genTrie.Update(hash[:], res.blobs[i])
+
+		s.accountSynced++
+		s.accountBytes += common.StorageSize(common.HashLength + len(res.blobs[i]))
+		task.Next = incHash(hash)
+	}
+	// If the interval was fully retrieved, flush the nodes of the regenerated
+	// trie chunk. Any nodes crossing the interval boundaries will be fixed up
+	// by the healing phase.
+	if !res.cont || task.Next == (common.Hash{}) {
+		if _, err := task.genTrie.Commit(); err != nil {
+			log.Error("Failed to commit account trie chunk", "err", err)
+		}
+		task.genTrie = nil
+		task.done = true
+	}
+}
+
+// processStorageResponse integrates an already validated storage range response
+// into the storage tasks, regenerating the storage tries delivered.
+func (s *Syncer) processStorageResponse(res *storageResponse) {
+	// Release all the tasks, the ones not delivered are requeued implicitly
+	s.revertStorageRequest(res.req)
+
+	completed := make(map[*storageTask]struct{})
+	for i, hashes := range res.hashes {
+		task := res.req.tasks[i]
+		if res.invalid[i] {
+			// The storage trie could not be verified, most probably because it
+			// changed since the account was retrieved. Leave it to the healer.
+			log.Debug("Dropping unverifiable storage range", "account", task.Account, "root", task.Root)
+			completed[task] = struct{}{}
+			continue
+		}
+		if task.genTrie == nil {
+			task.genTrie = trie.NewStackTrie(s.writer)
+		}
+		for j, hash := range hashes {
+			task.genTrie.Update(hash[:], res.slots[i][j])
+
+			s.storageSynced++
+			s.storageBytes += common.StorageSize(common.HashLength + len(res.slots[i][j]))
+		}
+		// If the storage trie is incomplete, continue from the last slot
+		if i == len(res.hashes)-1 && res.cont {
+			task.Next = incHash(hashes[len(hashes)-1])
+			continue
+		}
+		// Storage trie complete, persist it and ensure it matches the account
+		if root, err := task.genTrie.Commit(); err != nil {
+			log.Error("Failed to commit storage trie", "err", err)
+		} else if root != task.Root {
+			log.Debug("Regenerated storage trie mismatch", "account", task.Account, "have", root, "want", task.Root)
+		}
+		task.genTrie = nil
+		completed[task] = struct{}{}
+	}
+	// Drop all the completed storage tasks from the queue
+	if len(completed) > 0 {
+		tasks := s.storageTasks[:0]
+		for _, task := range s.storageTasks {
+			if _, ok := completed[task]; ok {
+				delete(s.storageRoots, task.Root)
+				continue
+			}
+			tasks = append(tasks, task)
+		}
+		s.storageTasks = tasks
+	}
+}
+
+// processBytecodeResponse integrates an already validated bytecode response
+// into the database, requeueing any codes not delivered.
+func (s *Syncer) processBytecodeResponse(res *bytecodeResponse) {
+	for _, hash := range res.req.hashes {
+		code, ok := res.codes[hash]
+		if !ok {
+			// Requeue anything the remote peer did not deliver
+			if !res.req.heal {
+				s.codeTasks[hash] = struct{}{}
+			} else if s.healer != nil {
+				s.healer.codeTasks[hash] = struct{}{}
+			}
+			continue
+		}
+		if res.req.heal {
+			if s.healer == nil {
+				continue
+			}
+			if err := s.healer.scheduler.Process(trie.SyncResult{Hash: hash, Data: code}); err != nil {
+				log.Debug("Failed to process healed bytecode", "hash", hash, "err", err)
+			}
+			s.healSynced++
+			s.healBytes += common.StorageSize(len(code))
+			continue
+		}
+		rawdb.WriteCode(s.writer.batch, hash, code)
+		if s.bloom != nil {
+			s.bloom.Add(hash[:])
+		}
+		s.bytecodeSynced++
+		s.bytecodeBytes += common.StorageSize(len(code))
+	}
+	if res.req.heal && s.healer != nil {
+		s.healer.scheduler.Commit(s.writer.batch)
+	}
+}
+
+// processTrienodeHealResponse integrates an already validated trie node response
+// into the healer tasks, requeueing any nodes not delivered.
+func (s *Syncer) processTrienodeHealResponse(res *trienodeHealResponse) {
+	if s.healer == nil || res.req.root != s.root {
+		return
+	}
+	for hash, path := range res.req.paths {
+		node, ok := res.nodes[hash]
+		if !ok {
+			s.healer.trieTasks[hash] = path
+			continue
+		}
+		if err := s.healer.scheduler.Process(trie.SyncResult{Hash: hash, Data: node}); err != nil {
+			log.Debug("Failed to process healed trie node", "hash", hash, "err", err)
+		}
+		s.healSynced++
+		s.healBytes += common.StorageSize(len(node))
+	}
+	s.healer.scheduler.Commit(s.writer.batch)
+}
+
+// hasCode checks whether a contract code is already present locally.
+func (s *Syncer) hasCode(hash common.Hash) bool {
+	if s.bloom != nil && !s.bloom.Contains(hash[:]) {
+		return false
+	}
+	return rawdb.HasCode(s.db, hash)
+}
+
+// hasTrieNode checks whether a trie node is already present locally.
+func (s *Syncer) hasTrieNode(hash common.Hash) bool {
+	if s.bloom != nil && !s.bloom.Contains(hash[:]) {
+		return false
+	}
+	return rawdb.HasTrieNode(s.db, hash)
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes []common.Hash, accounts [][]byte, proof [][]byte) error {
+	// Whether or not the response is valid, we can mark the peer as idle and
+	// notify the scheduler to assign a new task. If the response is invalid,
+	// we'll drop the peer in a bit.
+	s.lock.Lock()
+	req, ok := s.accountReqs[id]
+	if !ok || req.peer != peer.ID() {
+		// Request stale, perhaps the peer timed out but came through in the end
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected account range packet", "reqid", id)
+		return nil
+	}
+	delete(s.accountReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data. For account range queries that means the state being
+	// retrieved was either already pruned remotely, or the peer is not yet
+	// synced to our head.
+	if len(hashes) == 0 && len(accounts) == 0 && len(proof) == 0 {
+		peer.Log().Debug("Peer rejected account range request", "root", req.root)
+		s.refused[req.peer] = struct{}{}
+		s.pend = append(s.pend, req)
+		s.lock.Unlock()
+		s.notify()
+		return nil
+	}
+	s.lock.Unlock()
+
+	// Reconstruct a partial trie from the response and verify it
+	keys := make([][]byte, len(hashes))
+	for i, key := range hashes {
+		keys[i] = common.CopyBytes(key[:])
+	}
+	var (
+		proofdb = proofDatabase(proof)
+		lastKey = req.origin[:]
+	)
+	if len(keys) > 0 {
+		lastKey = keys[len(keys)-1]
+	}
+	err, cont := trie.VerifyRangeProof(req.root, req.origin[:], lastKey, keys, accounts, proofdb)
+	if err != nil {
+		peer.Log().Warn("Account range failed proof", "err", err)
+		s.fail(req)
+		return err
+	}
+	// Partial trie reconstructed, decode the accounts for the scheduler
+	accs := make([]*state.Account, len(accounts))
+	for i, account := range accounts {
+		acc := new(state.Account)
+		if err := rlp.DecodeBytes(account, acc); err != nil {
+			s.fail(req)
+			return fmt.Errorf("invalid account %x: %v", account, err)
+		}
+		accs[i] = acc
+	}
+	s.deliver(&accountResponse{
+		task:     req.task,
+		hashes:   hashes,
+		accounts: accs,
+		blobs:    accounts,
+		cont:     cont,
+	})
+	return nil
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots
+// are received from a remote peer.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.storageReqs[id]
+	if !ok || req.peer != peer.ID() {
+		// Request stale, perhaps the peer timed out but came through in the end
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected storage ranges packet", "reqid", id)
+		return nil
+	}
+	delete(s.storageReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+
+	// Reject the response if the hash sets and slot sets don't match, or if the
+	// peer sent more data than requested.
+	if len(hashes) != len(slots) || len(hashes) > len(req.tasks) {
+		s.pend = append(s.pend, req)
+		s.lock.Unlock()
+		s.notify()
+		return fmt.Errorf("invalid storage ranges: hashsets %d, slotsets %d, requested %d", len(hashes), len(slots), len(req.tasks))
+	}
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data.
+	if len(hashes) == 0 {
+		peer.Log().Debug("Peer rejected storage request", "root", req.root)
+		s.refused[req.peer] = struct{}{}
+		s.pend = append(s.pend, req)
+		s.lock.Unlock()
+		s.notify()
+		return nil
+	}
+	s.lock.Unlock()
+
+	// Verify each of the storage ranges. All but the last must be complete
+	// tries, which are checked against the stack-trie regenerated roots. The
+	// last one may be a chunk of a larger trie, proven by the edge proofs.
+	var (
+		invalid = make([]bool, len(hashes))
+		cont    bool
+	)
+	for i := 0; i < len(hashes); i++ {
+		if len(hashes[i]) != len(slots[i]) {
+			s.fail(req)
+			return fmt.Errorf("invalid storage range %d: hashes %d, slots %d", i, len(hashes[i]), len(slots[i]))
+		}
+		task := req.tasks[i]
+		if i < len(hashes)-1 || len(proof) == 0 {
+			hasher := trie.NewStackTrie(nil)
+			for j, hash := range hashes[i] {
+				hasher.Update(hash[:], slots[i][j])
+			}
+			invalid[i] = task.Next != (common.Hash{}) || hasher.Hash() != task.Root
+			continue
+		}
+		keys := make([][]byte, len(hashes[i]))
+		for j, key := range hashes[i] {
+			keys[j] = common.CopyBytes(key[:])
+		}
+		lastKey := task.Next[:]
+		if len(keys) > 0 {
+			lastKey = keys[len(keys)-1]
+		}
+		var err error
+		if err, cont = trie.VerifyRangeProof(task.Root, task.Next[:], lastKey, keys, slots[i], proofDatabase(proof)); err != nil {
+			invalid[i], cont = true, false
+		}
+	}
+	s.deliver(&storageResponse{
+		req:     req,
+		hashes:  hashes,
+		slots:   slots,
+		invalid: invalid,
+		cont:    cont,
+	})
+	return nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract
+// bytes codes are received from a remote peer.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, bytecodes [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.bytecodeReqs[id]
+	if !ok || req.peer != peer.ID() {
+		// Request stale, perhaps the peer timed out but came through in the end
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected bytecode packet", "reqid", id)
+		return nil
+	}
+	delete(s.bytecodeReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data. For bytecode range queries that means the peer is not
+	// yet synced.
+	if len(bytecodes) == 0 {
+		peer.Log().Debug("Peer rejected bytecode request")
+		s.refused[req.peer] = struct{}{}
+		s.pend = append(s.pend, req)
+		s.lock.Unlock()
+		s.notify()
+		return nil
+	}
+	s.lock.Unlock()
+
+	// Cross reference the requested bytecodes with the response to find gaps
+	// that the serving node is missing
+	requested := make(map[common.Hash]struct{}, len(req.hashes))
+	for _, hash := range req.hashes {
+		requested[hash] = struct{}{}
+	}
+	var (
+		hasher = sha3.NewLegacyKeccak256()
+		hash   = make([]byte, 32)
+		codes  = make(map[common.Hash][]byte, len(bytecodes))
+	)
+	for _, code := range bytecodes {
+		hasher.Reset()
+		hasher.Write(code)
+		hasher.Sum(hash[:0])
+
+		key := common.BytesToHash(hash)
+		if _, ok := requested[key]; !ok {
+			// We've either ran out of hashes, or got unrequested data
+			peer.Log().Warn("Unexpected bytecodes", "count", len(bytecodes))
+			s.fail(req)
+			return errors.New("unexpected bytecode")
+		}
+		codes[key] = code
+	}
+	s.deliver(&bytecodeResponse{
+		req:   req,
+		codes: codes,
+	})
+	return nil
+}
+
+// OnTrieNodes is a callback method to invoke when a batch of trie nodes
+// are received from a remote peer.
+func (s *Syncer) OnTrieNodes(peer SyncPeer, id uint64, trienodes [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.trienodeReqs[id]
+	if !ok || req.peer != peer.ID() {
+		// Request stale, perhaps the peer timed out but came through in the end
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected trienode heal packet", "reqid", id)
+		return nil
+	}
+	delete(s.trienodeReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data. For trie node queries that means the state being
+	// healed was either already pruned remotely, or the peer is not yet synced.
+	if len(trienodes) == 0 {
+		peer.Log().Debug("Peer rejected trienode heal request", "root", req.root)
+		s.refused[req.peer] = struct{}{}
+		s.pend = append(s.pend, req)
+		s.lock.Unlock()
+		s.notify()
+		return nil
+	}
+	s.lock.Unlock()
+
+	// Cross reference the requested trienodes with the response to find gaps
+	// that the serving node is missing
+	var (
+		hasher = sha3.NewLegacyKeccak256()
+		hash   = make([]byte, 32)
+		nodes  = make(map[common.Hash][]byte, len(trienodes))
+	)
+	for _, node := range trienodes {
+		hasher.Reset()
+		hasher.Write(node)
+		hasher.Sum(hash[:0])
+
+		key := common.BytesToHash(hash)
+		if _, ok := req.paths[key]; !ok {
+			// We've either ran out of hashes, or got unrequested data
+			peer.Log().Warn("Unexpected healing trienodes", "count", len(trienodes))
+			s.fail(req)
+			return errors.New("unexpected healing trienode")
+		}
+		nodes[key] = node
+	}
+	s.deliver(&trienodeHealResponse{
+		req:   req,
+		nodes: nodes,
+	})
+	return nil
+}
+
+// deliver queues up a verified response for the sync loop to process.
+func (s *Syncer) deliver(res interface{}) {
+	s.lock.Lock()
+	s.pend = append(s.pend, res)
+	s.lock.Unlock()
+
+	s.notify()
+}
+
+// fail queues up a request whose response was rejected for the sync loop to
+// reschedule.
+func (s *Syncer) fail(req interface{}) {
+	s.deliver(req)
+}
+
+// report calculates various status reports and provides it to the user.
+func (s *Syncer) report(force bool) {
+	// Don't report all the events, just occasionally
+	if !force && time.Since(s.logTime) < 8*time.Second {
+		return
+	}
+	s.logTime = time.Now()
+
+	log.Info("State sync in progress", "accounts", s.accountSynced, "accountbytes", s.accountBytes,
+		"slots", s.storageSynced, "storagebytes", s.storageBytes, "codes", s.bytecodeSynced, "codebytes", s.bytecodeBytes,
+		"healed", s.healSynced, "healbytes", s.healBytes, "elapsed", common.PrettyDuration(time.Since(s.startTime)))
+}
+
+// proofDatabase assembles the Merkle proof nodes of a range response into a
+// database, returning nil if no proof was provided at all.
+func proofDatabase(proof [][]byte) ethdb.KeyValueReader {
+	if len(proof) == 0 {
+		return nil
+	}
+	nodes := make(light.NodeList, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes.NodeSet()
+}
+
+// incHash returns the next hash, in lexicographical order (a.k.a plus one).
+// Note, it wraps around to zero on overflow.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,331 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testBackend is a `snap` backend serving the state of a local chain and
+// feeding any remote responses into a syncer.
+type testBackend struct {
+	chain  *core.BlockChain
+	syncer *Syncer
+
+	filter func(packet Packet) Packet // Optional hook to tamper with deliveries
+}
+
+func (b *testBackend) Chain() *core.BlockChain { return b.chain }
+
+func (b *testBackend) RunPeer(peer *Peer, handler Handler) error {
+	if b.syncer != nil {
+		if err := b.syncer.Register(peer); err != nil {
+			return err
+		}
+		defer b.syncer.Unregister(peer.ID())
+	}
+	return handler(peer)
+}
+
+func (b *testBackend) PeerInfo(id enode.ID) interface{} { return nil }
+
+func (b *testBackend) Handle(peer *Peer, packet Packet) error {
+	if b.filter != nil {
+		packet = b.filter(packet)
+	}
+	switch packet := packet.(type) {
+	case *AccountRangePacket:
+		hashes, accounts, err := packet.Unpack()
+		if err != nil {
+			return err
+		}
+		return b.syncer.OnAccounts(peer, packet.ID, hashes, accounts, packet.Proof)
+
+	case *StorageRangesPacket:
+		hashset, slotset := packet.Unpack()
+		return b.syncer.OnStorage(peer, packet.ID, hashset, slotset, packet.Proof)
+
+	case *ByteCodesPacket:
+		return b.syncer.OnByteCodes(peer, packet.ID, packet.Codes)
+
+	case *TrieNodesPacket:
+		return b.syncer.OnTrieNodes(peer, packet.ID, packet.Nodes)
+
+	default:
+		return fmt.Errorf("unexpected snap packet type: %T", packet)
+	}
+}
+
+// newTestChain creates a blockchain with a snapshot-backed genesis state of many
+// accounts, some contracts with small storage tries and a single contract with
+// a storage trie too large to be served in a single response.
+func newTestChain(t *testing.T) *core.BlockChain {
+	alloc := make(core.GenesisAlloc)
+	for i := 0; i < 1000; i++ {
+		account := core.GenesisAccount{Balance: big.NewInt(int64(i + 1))}
+		if i%10 == 0 {
+			account.Code = []byte{byte(i), byte(i >> 8)}
+			account.Storage = make(map[common.Hash]common.Hash)
+			for j := 0; j < 10; j++ {
+				account.Storage[common.BigToHash(big.NewInt(int64(j+1)))] = common.BigToHash(big.NewInt(int64(i + j + 1)))
+			}
+		}
+		alloc[common.BigToAddress(big.NewInt(int64(i+1)))] = account
+	}
+	large := core.GenesisAccount{
+		Balance: big.NewInt(1),
+		Code:    []byte{0xff},
+		Storage: make(map[common.Hash]common.Hash),
+	}
+	for i := 0; i < 20000; i++ {
+		large.Storage[common.BigToHash(big.NewInt(int64(i+1)))] = common.BigToHash(big.NewInt(int64(i + 1)))
+	}
+	alloc[common.Address{0xff}] = large
+
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc}
+	)
+	gspec.MustCommit(db)
+
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit: 16,
+		TrieDirtyLimit: 16,
+		TrieTimeLimit:  5 * time.Minute,
+		SnapshotLimit:  16,
+		SnapshotWait:   true,
+	}
+	chain, err := core.NewBlockChain(db, cacheConfig, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test chain: %v", err)
+	}
+	return chain
+}
+
+// connect links a serving and a syncing backend together through an in-memory
+// pipe, returning a function to tear the connection down.
+func connect(server, client *testBackend) func() {
+	srw, crw := p2p.MsgPipe()
+
+	go server.RunPeer(newPeer(snap1, p2p.NewPeer(enode.ID{1}, "client", nil), srw), func(peer *Peer) error {
+		return handle(server, peer)
+	})
+	go client.RunPeer(newPeer(snap1, p2p.NewPeer(enode.ID{2}, "server", nil), crw), func(peer *Peer) error {
+		return handle(client, peer)
+	})
+	return func() {
+		srw.Close()
+		crw.Close()
+	}
+}
+
+// checkState ensures that the entire state of the given root is present.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash) {
+	t.Helper()
+
+	statedb, err := state.New(root, state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open synced state %x: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("synced state %x incomplete: %v", root, it.Error)
+	}
+}
+
+// Tests that the complete state can be synced from a remote peer, including a
+// storage trie retrieved in multiple chunks and the healing of the gaps left
+// between the concurrently retrieved account ranges.
+func TestSync(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		syncer = NewSyncer(db, nil)
+		server = &testBackend{chain: chain}
+		client = &testBackend{syncer: syncer}
+		root   = chain.CurrentBlock().Root()
+	)
+	defer connect(server, client)()
+
+	done := make(chan error, 1)
+	cancel := make(chan struct{})
+	go func() { done <- syncer.Sync(root, cancel) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		close(cancel)
+		t.Fatalf("sync timed out")
+	}
+	checkState(t, db, root)
+
+	// Spot check some of the synced state content
+	statedb, _ := state.New(root, state.NewDatabase(db), nil)
+	if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(500))); balance.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", balance, 500)
+	}
+	if slot := statedb.GetState(common.Address{0xff}, common.BigToHash(big.NewInt(20000))); slot != common.BigToHash(big.NewInt(20000)) {
+		t.Errorf("large storage slot mismatch: have %x, want %x", slot, common.BigToHash(big.NewInt(20000)))
+	}
+}
+
+// Tests that syncing a state the remote peer refuses to serve does not finish
+// and can be cancelled.
+func TestSyncRefused(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		syncer = NewSyncer(rawdb.NewMemoryDatabase(), nil)
+		server = &testBackend{chain: chain}
+		client = &testBackend{syncer: syncer}
+	)
+	defer connect(server, client)()
+
+	done := make(chan error, 1)
+	cancel := make(chan struct{})
+	go func() { done <- syncer.Sync(common.Hash{0x01}, cancel) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("sync of unavailable state finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(cancel)
+	if err := <-done; err != ErrCancelled {
+		t.Fatalf("cancelled sync error mismatch: have %v, want %v", err, ErrCancelled)
+	}
+}
+
+// Tests that an interrupted sync persists its progress and that a new syncer on
+// the same database resumes from it instead of restarting from scratch.
+func TestSyncResume(t *testing.T) {
+	chain := newTestChain(t)
+	defer chain.Stop()
+
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		server = &testBackend{chain: chain}
+		root   = chain.CurrentBlock().Root()
+	)
+	// Sync a few account ranges, after which the client pretends the server
+	// refuses to serve the state any more, stalling the sync
+	var (
+		syncer  = NewSyncer(db, nil)
+		client  = &testBackend{syncer: syncer}
+		served  int
+		stalled = make(chan struct{})
+	)
+	client.filter = func(packet Packet) Packet {
+		if res, ok := packet.(*AccountRangePacket); ok {
+			if served++; served > 4 {
+				if served == 5 {
+					close(stalled)
+				}
+				return &AccountRangePacket{ID: res.ID}
+			}
+		}
+		return packet
+	}
+	disconnect := connect(server, client)
+
+	done := make(chan error, 1)
+	cancel := make(chan struct{})
+	go func() { done <- syncer.Sync(root, cancel) }()
+
+	select {
+	case <-stalled:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("sync did not progress")
+	}
+	close(cancel)
+	if err := <-done; err != ErrCancelled {
+		t.Fatalf("interrupted sync error mismatch: have %v, want %v", err, ErrCancelled)
+	}
+	disconnect()
+
+	if rawdb.ReadSnapshotSyncStatus(db) == nil {
+		t.Fatalf("interrupted sync did not persist its progress")
+	}
+	// Create a new syncer on the same database and ensure it picks up the
+	// progress of the previous one
+	resumed := NewSyncer(db, nil)
+	if resumed.accountSynced != syncer.accountSynced || resumed.accountSynced == 0 {
+		t.Errorf("resumed account count mismatch: have %d, want %d", resumed.accountSynced, syncer.accountSynced)
+	}
+	var pending int
+	for _, task := range syncer.tasks {
+		if !task.done {
+			pending++
+		}
+	}
+	if len(resumed.tasks) != pending || pending == len(newAccountTasks()) {
+		t.Fatalf("resumed account task count mismatch: have %d, want %d", len(resumed.tasks), pending)
+	}
+	// Finish the sync with the resumed syncer, counting the re-downloaded accounts
+	var fetched int
+	client = &testBackend{syncer: resumed, filter: func(packet Packet) Packet {
+		if res, ok := packet.(*AccountRangePacket); ok {
+			fetched += len(res.Accounts)
+		}
+		return packet
+	}}
+	defer connect(server, client)()
+
+	done = make(chan error, 1)
+	cancel = make(chan struct{})
+	go func() { done <- resumed.Sync(root, cancel) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("resumed sync failed: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		close(cancel)
+		t.Fatalf("resumed sync timed out")
+	}
+	checkState(t, db, root)
+
+	if uint64(fetched) >= resumed.accountSynced {
+		t.Errorf("resumed sync refetched all accounts: fetched %d, synced %d", fetched, resumed.accountSynced)
+	}
+	if rawdb.ReadSnapshotSyncStatus(db) != nil {
+		t.Errorf("completed sync left its progress in the database")
+	}
+}
@@ -22,17 +22,19 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 )
 
-func TestFastSyncDisabling63(t *testing.T) { testFastSyncDisabling(t, 63) }
-func TestFastSyncDisabling64(t *testing.T) { testFastSyncDisabling(t, 64) }
-func TestFastSyncDisabling65(t *testing.T) { testFastSyncDisabling(t, 65) }
+func TestFastSyncDisabling63(t *testing.T) { testFastSyncDisabling(t, eth.ETH63) }
+func TestFastSyncDisabling64(t *testing.T) { testFastSyncDisabling(t, eth.ETH64) }
+func TestFastSyncDisabling65(t *testing.T) { testFastSyncDisabling(t, eth.ETH65) }
+func TestFastSyncDisabling66(t *testing.T) { testFastSyncDisabling(t, eth.ETH66) }
 
 // Tests that fast sync gets disabled as soon as a real block is successfully
 // imported into the blockchain.
-func testFastSyncDisabling(t *testing.T, protocol int) {
+func testFastSyncDisabling(t *testing.T, protocol uint) {
 	t.Parallel()
 
 	// Create a pristine protocol manager, check that fast sync is left enabled
@@ -48,8 +50,8 @@ func testFastSyncDisabling(t *testing.T, protocol int) {
 
 	// Sync up the two peers
 	io1, io2 := p2p.MsgPipe()
-	go pmFull.handle(pmFull.newPeer(protocol, p2p.NewPeer(enode.ID{}, "empty", nil), io2, pmFull.txpool.Get))
-	go pmEmpty.handle(pmEmpty.newPeer(protocol, p2p.NewPeer(enode.ID{}, "full", nil), io1, pmEmpty.txpool.Get))
+	go runTestPeer(pmFull, eth.NewPeer(protocol, p2p.NewPeer(enode.ID{}, "empty", nil), io2, pmFull.txpool))
+	go runTestPeer(pmEmpty, eth.NewPeer(protocol, p2p.NewPeer(enode.ID{}, "full", nil), io1, pmEmpty.txpool))
 
 	time.Sleep(250 * time.Millisecond)
 	op := peerToSyncOp(downloader.FastSync, pmEmpty.peers.BestPeer())
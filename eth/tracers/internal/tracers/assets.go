@@ -6,7 +6,7 @@
 // evmdis_tracer.js (4.195kB)
 // noop_tracer.js (1.271kB)
 // opcount_tracer.js (1.372kB)
-// prestate_tracer.js (4.234kB)
+// prestate_tracer.js (4.606kB)
 // trigram_tracer.js (1.788kB)
 // unigram_tracer.js (1.51kB)
 
@@ -197,7 +197,7 @@ func opcount_tracerJs() (*asset, error) {
 	return a, nil
 }
 
-var _prestate_tracerJs = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x57\xdd\x6f\xdb\x38\x12\x7f\x96\xfe\x8a\x41\x5f\x6c\xa3\xae\xdc\x64\x81\x3d\xc0\xb9\x1c\xa0\xba\x6e\x1b\x20\x9b\x04\xb6\x7b\xb9\xdc\x62\x1f\x28\x72\x24\x73\x4d\x93\x02\x49\xd9\xf1\x15\xf9\xdf\x0f\x43\x7d\xf8\xa3\x49\xd3\xdd\x37\x9b\x1c\xfe\xe6\xfb\x37\xa3\xd1\x08\x26\xa6\xdc\x59\x59\x2c\x3d\x9c\xbf\x3f\xfb\x07\x2c\x96\x08\x85\x79\x87\x7e\x89\x16\xab\x35\xa4\x95\x5f\x1a\xeb\xe2\xd1\x08\x16\x4b\xe9\x20\x97\x0a\x41\x3a\x28\x99\xf5\x60\x72\xf0\x27\xf2\x4a\x66\x96\xd9\x5d\x12\x8f\x46\xf5\x9b\x67\xaf\x09\x21\xb7\x88\xe0\x4c\xee\xb7\xcc\xe2\x18\x76\xa6\x02\xce\x34\x58\x14\xd2\x79\x2b\xb3\xca\x23\x48\x0f\x4c\x8b\x91\xb1\xb0\x36\x42\xe6\x3b\x82\x94\x1e\x2a\x2d\xd0\x06\xd5\x1e\xed\xda\xb5\x76\x7c\xbe\xf9\x0a\xd7\xe8\x1c\x5a\xf8\x8c\x1a\x2d\x53\x70\x57\x65\x4a\x72\xb8\x96\x1c\xb5\x43\x60\x0e\x4a\x3a\x71\x4b\x14\x90\x05\x38\x7a\xf8\x89\x4c\x99\x37\xa6\xc0\x27\x53\x69\xc1\xbc\x34\x7a\x08\x28\xc9\x72\xd8\xa0\x75\xd2\x68\xf8\xa5\x55\xd5\x00\x0e\xc1\x58\x02\xe9\x33\x4f\x0e\x58\x30\x25\xbd\x1b\x00\xd3\x3b\x50\xcc\xef\x9f\xfe\x44\x40\xf6\x7e\x0b\x90\x3a\xa8\x59\x9a\x12\xc1\x2f\x99\x27\xaf\xb7\x52\x29\xc8\x10\x2a\x87\x79\xa5\x86\x84\x96\x55\x1e\xee\xaf\x16\x5f\x6e\xbf\x2e\x20\xbd\x79\x80\xfb\x74\x36\x4b\x6f\x16\x0f\x17\xb0\x95\x7e\x69\x2a\x0f\xb8\xc1\x1a\x4a\xae\x4b\x25\x51\xc0\x96\x59\xcb\xb4\xdf\x81\xc9\x09\xe1\xb7\xe9\x6c\xf2\x25\xbd\x59\xa4\x1f\xae\xae\xaf\x16\x0f\x60\x2c\x7c\xba\x5a\xdc\x4c\xe7\x73\xf8\x74\x3b\x83\x14\xee\xd2\xd9\xe2\x6a\xf2\xf5\x3a\x9d\xc1\xdd\xd7\xd9\xdd\xed\x7c\x9a\xc0\x1c\xc9\x2a\xa4\xf7\xaf\xc7\x3c\x0f\xd9\xb3\x08\x02\x3d\x93\xca\xb5\x91\x78\x30\x15\xb8\xa5\xa9\x94\x80\x25\xdb\x20\x58\xe4\x28\x37\x28\x80\x01\x37\xe5\xee\xa7\x93\x4a\x58\x4c\x19\x5d\x04\x9f\x5f\x2c\x48\xb8\xca\x41\x1b\x3f\x04\x87\x08\xff\x5c\x7a\x5f\x8e\x47\xa3\xed\x76\x9b\x14\xba\x4a\x8c\x2d\x46\xaa\x86\x73\xa3\x7f\x25\x31\x61\x96\x16\x9d\x67\x1e\x17\x96\x71\xb4\x60\x2a\x5f\x56\xde\x81\xab\xf2\x5c\x72\x89\xda\x83\xd4\xb9\xb1\xeb\x50\x29\xe0\x0d\x70\x8b\xcc\x23\x30\x50\x86\x33\x05\xf8\x88\xbc\x0a\x77\x75\xa4\x43\xb9\x5a\xa6\x1d\xe3\xe1\x34\xb7\x66\x4d\xbe\x56\xce\xd3\x0f\xe7\x70\x9d\x29\x14\x50\xa0\x46\x27\x1d\x64\xca\xf0\x55\x12\x7f\x8b\xa3\x03\x63\xa8\x4e\x82\x87\x8d\x50\xa8\x8d\x2d\xf6\x2c\x42\x56\x49\x25\xa4\x2e\x92\x38\x6a\xa5\xc7\xa0\x2b\xa5\x86\x71\x80\x50\xc6\xac\xaa\x32\xe5\xdc\x54\xc1\xf6\x3f\x91\xfb\x1a\xcc\x95\xc8\x65\x4e\xc5\xc1\xba\x5b\x6f\xc2\x55\xa7\xd7\x64\x24\x9f\xc4\xd1\x11\xcc\x18\xf2\x4a\x07\x77\xfa\x4c\x08\x3b\x04\x91\x0d\xbe\xc5\x51\xb4\x61\x96\xb0\xe0\x12\xbc\xf9\x82\x8f\xe1\x72\x70\x11\x47\x91\xcc\xa1\xef\x97\xd2\x25\x2d\xf0\xef\x8c\xf3\x3f\xe0\xf2\xf2\x32\x34\x75\x2e\x35\x8a\x01\x10\x44\xf4\x9c\x58\x7d\x13\x65\x4c\x31\xcd\x71\x0c\xbd\xf7\x8f\x3d\x78\x0b\x22\x4b\x0a\xf4\x1f\xea\xd3\x5a\x59\xe2\xcd\xdc\x5b\xa9\x8b\xfe\xd9\xaf\x83\x61\x78\xa5\x4d\x78\x03\x8d\xf8\x8d\xe9\x84\xeb\x7b\x6e\x44\xb8\x6e\x6c\xae\xa5\x26\x46\x34\x42\x8d\x94\xf3\xc6\xb2\x02\xc7\xf0\xed\x89\xfe\x3f\x91\x57\x4f\x71\xf4\x74\x14\xe5\x79\x2d\xf4\x42\x94\x1b\x08\x40\xed\x6d\x57\xe7\x85\xa4\x4e\x3d\x4c\x40\xc0\xfb\x51\x12\xe6\xad\x29\x27\x49\x58\xe1\xee\xf5\x4c\xd0\x85\x14\x8f\xdd\xc5\x0a\x77\x83\x8b\xf8\xc5\x14\x25\x8d\xd1\xbf\x4b\xf1\xf8\xb3\xf9\x3a\x79\x73\x14\xd7\x39\x49\xed\xed\x1d\x0c\x4e\xe2\x68\xd1\x55\xca\x53\xb9\x4b\xbd\x31\x2b\x22\xae\x25\xc5\x47\xa9\x10\x12\x53\x52\xb6\x5c\xcd\x1c\x19\xa2\x06\xe9\xd1\x32\xa2\x4e\xb3\x41\x4b\x53\x03\x2c\xfa\xca\x6a\xd7\x85\x31\x97\x9a\xa9\x16\xb8\x89\xba\xb7\x8c\xd7\x3d\x53\x9f\x1f\xc4\x92\xfb\xc7\x10\xc5\xe0\xdd\x68\x04\xa9\x07\x72\x11\x4a\x23\xb5\x1f\xc2\x16\x41\x23\x0a\x6a\x7c\x81\xa2\xe2\x3e\xe0\xf5\x36\x4c\x55\xd8\xab\x9b\x9b\x28\x32\x3c\x35\x15\x4d\x82\x83\xe6\x1f\x06\x03\xd7\x66\x13\x46\x5c\xc6\xf8\x0a\x9a\x86\x33\x56\x16\x52\xc7\x4d\x38\x8f\x9a\x8d\x2c\x4a\x08\x38\x98\x15\x72\x45\x49\xa4\x93\x0f\x4c\xc1\x25\x64\xb2\xb8\xd2\xfe\x24\x79\x75\xd0\xdb\xa7\x83\x3f\x92\xa6\x79\x12\x47\x84\xd7\x3f\x1f\x0c\xe1\xec\xd7\xae\x22\xbc\x21\x28\x78\x1d\xcc\x9b\x97\xa1\xe2\xd3\x62\x78\xfe\x59\x50\x43\x1d\xfc\x36\x68\x4d\x5c\x95\x51\x3a\x6a\x3f\x43\x1c\x8f\xbb\xf8\xe2\x07\xb8\xc7\xbe\xb5\xb8\x4d\x68\x12\x26\xc4\xcb\xa0\x75\x8a\x3e\x22\xb7\xb8\x26\x56\xa7\x2c\x70\xa6\x14\xda\x9e\x83\xc0\x19\xc3\xa6\x9c\x42\xbe\x70\x5d\xfa\x5d\xcb\xf5\x9e\xd9\x02\xbd\x7b\xdd\xb0\x80\xf3\xee\x5d\x4b\x81\x21\x14\xbb\x12\xe1\xf2\x12\x7a\x93\xd9\x34\x5d\x4c\x7b\x4d\x1b\x8d\x46\x70\x8f\x61\x13\xca\x94\xcc\x84\xda\x81\x40\x85\x1e\x6b\xbb\x8c\x0e\x21\xea\x28\x61\x48\x2b\x0d\x2d\x1b\xf8\x28\x9d\x97\xba\x80\x9a\x29\xb6\x34\x57\x1b\xb8\xd0\x23\x9c\x55\x8e\xaa\xf5\x64\x08\x79\x43\x1b\x85\x45\xe2\x15\xe2\xff\xd0\x6e\x4c\xc9\x6e\x03\xc9\xa5\x75\x1e\x4a\xc5\x38\x26\x84\xd7\x19\xf3\x72\x7e\x9b\x4e\x26\xd5\xb3\xd0\x82\x01\x68\x3f\xe0\x98\xa2\x01\x49\xea\x1d\xf4\x5b\x8c\x41\x1c\x45\xb6\x95\x3e\xc0\xbe\xd8\x53\x82\xf3\x58\x1e\x12\x02\x2d\x16\xb8\x41\xa2\xd0\xc0\x06\xf5\x30\x24\x5d\xff\xfe\xad\x99\xbe\xe8\x92\x38\xa2\x77\x07\x7d\xad\x4c\x71\xdc\xd7\xa2\x0e\x0b\xaf\xac\xa5\xfc\x77\x14\x9c\x53\x8f\xff\x59\x39\x4f\x31\xb5\x14\x9e\x86\x2d\x9e\x23\xc9\x40\x89\x34\x6d\x07\xdf\x93\x21\xcd\xad\x30\x27\x48\x5d\x33\xa5\xea\x6d\xae\x34\x1e\xb5\x97\x4c\xa9\x1d\xe5\x61\x6b\x69\x8d\xa1\xc5\x65\x08\x4e\x92\x54\x60\x9c\x20\x2a\x35\x57\x95\xa8\xcb\x20\xd4\x71\x83\xe7\x82\xcd\xc7\xfb\xcf\x1a\x9d\x63\x05\x26\x54\x49\xb9\x7c\x6c\x36\x48\x0d\xbd\x9a\xe4\xfa\x83\x5e\xd2\x19\x79\x4c\x31\xca\x14\x49\x5b\x64\x44\xd3\xa9\x10\x16\x9d\xeb\x0f\x1a\xce\xe9\x32\x7b\xbf\x44\x4d\xc1\x07\x8d\x5b\xe8\x56\x13\xc6\x39\xad\x6a\x62\x08\x4c\x08\xa2\xb6\x93\x35\x22\x8e\x22\xb7\x95\x9e\x2f\x21\x68\x32\xe5\xbe\x17\x07\x4d\xfd\x73\xe6\x10\xde\x4c\xff\xb3\x98\xdc\x7e\x9c\x4e\x6e\xef\x1e\xde\x8c\xe1\xe8\x6c\x7e\xf5\xdf\x69\x77\xf6\x21\xbd\x4e\x6f\x26\xd3\x37\xe3\x30\x9b\x9f\x71\xc8\x9b\xd6\x05\x52\xe8\x3c\xe3\xab\xa4\x44\x5c\xf5\xdf\x1f\xf3\xc0\xde\xc1\x28\xca\x2c\xb2\xd5\xc5\xde\x98\xba\x41\x1b\x1d\x2d\xe5\xc2\x25\xbc\x18\xac\x8b\x97\xad\x99\x34\xf2\xfd\x96\xc8\xf7\xab\x48\xa0\x8a\xd7\xed\x38\xff\xcb\x86\x84\xde\x61\x7c\x35\x06\xc7\x14\x6d\xc0\xf2\x7f\xf4\xe5\x92\xe7\x0e\xfd\x10\x50\x0b\xb3\x25\xe6\xeb\x50\xeb\x9b\x06\xf7\x20\x64\x67\x83\x9a\x41\x6f\xf3\xfe\xa0\x13\x26\xb0\xef\x45\xcf\x9f\x13\x45\x2d\xe0\xb2\x45\x7f\x1b\x5e\xbe\x1e\xa8\xf3\x26\x52\x27\x0a\x7e\x39\xd9\xf0\xc2\xfd\x1a\xd7\xc6\xee\x9a\x71\x74\xe0\xdf\x8f\xa3\x9a\x5e\x5f\x77\xf5\x44\x7f\xa8\xc8\xba\x83\x8f\xd3\xeb\xe9\xe7\x74\x31\x3d\x92\x9a\x2f\xd2\xc5\xd5\xa4\x3e\xfa\xcb\x85\x77\xf6\xd3\x85\xd7\x9b\xcf\x17\xb7\xb3\x69\x6f\xdc\xfc\xbb\xbe\x4d\x3f\xf6\xbe\x53\xd8\x6c\x81\x3f\x6a\x5d\x6f\xee\x8d\x15\x7f\xa7\x03\x0e\x36\xb2\x9c\x3d\xb7\x90\x05\x6a\xe7\xbe\x3a\xf9\xe0\x01\xa6\x5b\x56\xce\xeb\x8f\xbe\x28\xbc\x7f\x96\x87\x9f\xe2\xa7\xf8\xff\x01\x00\x00\xff\xff\xb1\x28\x85\x2a\x8a\x10\x00\x00")
+var _prestate_tracerJs = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x57\x5f\x6f\xdb\x38\x12\x7f\x96\x3e\xc5\x5c\x5f\x6c\xa3\xae\xdc\x76\x81\x3d\xc0\xb9\x1c\xa0\xba\x6e\x1b\xc0\x9b\x04\xb6\x7b\xb9\xdc\x62\x1f\x28\x72\x64\x73\x43\x93\x02\x49\xd9\xf1\x16\xf9\xee\x87\xa1\x28\xff\x49\xe3\x24\x77\x6f\x36\x39\xfc\xcd\xff\xdf\x8c\x06\x03\x18\x99\x6a\x6b\xe5\x62\xe9\xe1\xe3\xfb\x0f\x7f\x87\xf9\x12\x61\x61\xde\xa1\x5f\xa2\xc5\x7a\x05\x79\xed\x97\xc6\xba\x74\x30\x80\xf9\x52\x3a\x28\xa5\x42\x90\x0e\x2a\x66\x3d\x98\x12\xfc\x23\x79\x25\x0b\xcb\xec\x36\x4b\x07\x83\xe6\xcd\x93\xd7\x84\x50\x5a\x44\x70\xa6\xf4\x1b\x66\x71\x08\x5b\x53\x03\x67\x1a\x2c\x0a\xe9\xbc\x95\x45\xed\x11\xa4\x07\xa6\xc5\xc0\x58\x58\x19\x21\xcb\x2d\x41\x4a\x0f\xb5\x16\x68\x83\x6a\x8f\x76\xe5\x5a\x3b\xbe\x5e\x7e\x87\x09\x3a\x87\x16\xbe\xa2\x46\xcb\x14\x5c\xd7\x85\x92\x1c\x26\x92\xa3\x76\x08\xcc\x41\x45\x27\x6e\x89\x02\x8a\x00\x47\x0f\xbf\x90\x29\xb3\x68\x0a\x7c\x31\xb5\x16\xcc\x4b\xa3\xfb\x80\x92\x2c\x87\x35\x5a\x27\x8d\x86\x5f\x5a\x55\x11\xb0\x0f\xc6\x12\x48\x97\x79\x72\xc0\x82\xa9\xe8\x5d\x0f\x98\xde\x82\x62\x7e\xff\xf4\x15\x01\xd9\xfb\x2d\x40\xea\xe0\xde\xd2\x54\x08\x7e\xc9\x3c\x45\x62\x23\x95\x82\x02\xa1\x76\x58\xd6\xaa\x4f\x68\x45\xed\xe1\xe6\x62\xfe\xed\xea\xfb\x1c\xf2\xcb\x5b\xb8\xc9\xa7\xd3\xfc\x72\x7e\x7b\x06\x1b\xe9\x97\xa6\xf6\x80\x6b\x6c\xa0\xe4\xaa\x52\x12\x05\x6c\x98\xb5\x4c\xfb\x2d\x98\x92\x10\x7e\x1b\x4f\x47\xdf\xf2\xcb\x79\xfe\xe9\x62\x72\x31\xbf\x05\x63\xe1\xcb\xc5\xfc\x72\x3c\x9b\xc1\x97\xab\x29\xe4\x70\x9d\x4f\xe7\x17\xa3\xef\x93\x7c\x0a\xd7\xdf\xa7\xd7\x57\xb3\x71\x06\x33\x24\xab\x90\xde\xbf\x1c\xf3\x32\x64\xcf\x22\x08\xf4\x4c\x2a\xd7\x46\xe2\xd6\xd4\xe0\x96\xa6\x56\x02\x96\x6c\x8d\x60\x91\xa3\x5c\xa3\x00\x06\xdc\x54\xdb\x57\x27\x95\xb0\x98\x32\x7a\x11\x7c\x3e\x59\x90\x70\x51\x82\x36\xbe\x0f\x0e\x11\xfe\xb1\xf4\xbe\x1a\x0e\x06\x9b\xcd\x26\x5b\xe8\x3a\x33\x76\x31\x50\x0d\x9c\x1b\xfc\x33\x4b\x09\xb3\xb2\xe8\x3c\xf3\x38\xb7\x8c\xa3\x05\x53\xfb\xaa\xf6\x0e\x5c\x5d\x96\x92\x4b\xd4\x1e\xa4\x2e\x8d\x5d\x85\x4a\x01\x6f\x80\x5b\x64\x1e\x81\x81\x32\x9c\x29\xc0\x7b\xe4\x75\xb8\x6b\x22\x4d\x86\x79\xcb\xb4\x63\x3c\x9c\x96\xd6\xac\xc8\xd7\xda\x79\xfa\xe1\x1c\xae\x0a\x85\x02\x16\xa8\xd1\x49\x07\x85\x32\xfc\x2e\x4b\x7f\xa4\xc9\x81\x31\xd4\x38\x04\xd4\x0a\x85\xda\xd8\x60\xc7\x22\x14\xb5\x54\x42\xea\x45\x96\x26\xad\xf4\x10\x74\xad\x54\x3f\x0d\x10\xca\x98\xbb\xba\xca\x39\x37\x75\xb0\xfd\x4f\xe4\x9e\x00\x10\x5c\x85\x5c\x96\x54\x1c\x6c\x77\xeb\x4d\xb8\xda\xe9\x35\x05\xc9\x67\x69\x72\x04\x33\x84\xb2\xd6\xc1\x9d\x2e\x13\xc2\xf6\x41\x14\xbd\x1f\x69\x92\xac\x99\x05\xc6\x39\x9c\x83\x37\xdf\xf0\x3e\x5c\xf6\xce\xd2\x24\x91\x25\x74\xfd\x52\xba\xac\x05\xfe\x9d\x71\xfe\x07\x9c\x9f\x9f\x87\xa6\x2e\xa5\x46\xd1\x03\x82\x48\x9e\x12\x6b\x6e\x92\x82\x29\xa6\x39\x0e\xa1\xf3\xfe\xbe\x03\x6f\x41\x14\xd9\x02\xfd\xa7\xe6\xb4\x51\x96\x79\x33\xf3\x56\xea\x45\xf7\xc3\xaf\xbd\x7e\x78\xa5\x4d\x78\x03\x51\xfc\xd2\xec\x84\x9b\x7b\x6e\x44\xb8\x8e\x36\x37\x52\x23\x23\xa2\x50\x94\x72\xde\x58\xb6\xc0\x21\xfc\x78\xa0\xff\x0f\xe4\xd5\x43\x9a\x3c\x1c\x45\x79\xd6\x08\x9d\x88\x72\x84\x00\xd4\xde\xee\xea\x7c\x21\xa9\x53\x0f\x13\x10\xf0\x9e\x4b\x42\xd4\xf2\x53\x12\xee\x70\xfb\x72\x26\x28\x45\x52\xdc\xef\x2e\xee\x70\xdb\x3b\x4b\x4f\xa6\x28\x8b\x46\xff\x2e\xc5\xfd\x6b\xf3\xf5\xe8\x4d\x54\xd4\xc4\x75\x46\xc8\x7b\x7b\x7b\xbd\x47\x71\xb4\xe8\x6a\xe5\xa9\xdc\xa5\x5e\x9b\x3b\x22\xae\x25\xc5\x47\xa9\x10\x2d\x53\x51\xb6\x5c\xc3\x1c\x05\xa2\x06\xe9\xd1\x32\xa2\x4e\xb3\x46\x4b\x53\x03\x2c\xfa\xda\x6a\xb7\x0b\x63\x29\x35\x53\x2d\x70\x8c\xba\xb7\x8c\x37\x3d\xd3\x9c\x1f\xc4\x92\xfb\xfb\x10\xc5\xe0\xdd\x60\xd0\xf0\x07\x90\x5a\xd8\x30\x17\xdb\x1b\x05\x74\x31\x5b\x64\x50\x29\x26\x35\xac\x99\xaa\x63\x97\x97\x68\x7b\x7d\x62\x9c\xa5\x24\x6a\x62\xae\x41\xa1\xcc\xa1\x80\xba\x82\x2d\xfa\x7e\x20\x70\xf2\x87\xc6\xa9\xe4\xb2\x62\xda\xef\xc6\xd9\x21\x59\x38\x4f\xe4\xcf\x2c\x3e\x95\xa0\x90\x0e\xea\xf4\xa7\x32\x41\x4d\xd3\x16\x29\x19\x90\x93\x42\x1a\xe0\x46\x6a\xdf\x87\x0d\x82\x46\x14\xc4\x5f\x02\x45\xcd\xe9\x16\xa1\x13\x1c\xe9\x34\x1c\x45\x4c\x1f\x6c\x37\xb5\x47\x7b\x68\x56\x3f\xc4\x79\x65\xd6\x61\x52\x17\x8c\xdf\x41\xe4\x0d\x63\xe5\x42\xea\x34\xda\x72\xc4\x19\x5d\xee\xef\x33\x02\x0e\xd1\x3d\x3b\x2d\xe3\x4d\x94\x68\x0c\xa7\xc9\xb9\x92\x1a\x2d\x15\x05\xa7\x35\x81\xb2\x4d\xca\x4a\xc4\x10\x34\x5c\xa3\xdd\x1e\xda\x17\x83\x45\x0a\xb9\x91\xba\x60\x0e\xe1\x6f\xa7\x4a\xf7\x67\x03\xda\x37\x3b\x43\x1f\xd2\xd8\x38\x64\xfe\x27\xa6\xe0\x1c\x0a\xb9\xb8\xd0\xfe\x51\xc3\x34\x85\xde\xfa\xd9\xfb\x23\x8b\x84\x95\x39\x1a\x32\xdd\x8f\xbd\x3e\x7c\xf8\x75\xd7\x85\xde\x10\x14\xbc\x0c\xe6\xcd\x69\xa8\x36\x8c\x2f\x3c\x0b\x6a\x88\x35\xdf\x06\xad\x99\xab\x0b\x6a\x81\xc6\xdf\x90\xf4\x63\xe6\x3c\x7b\x06\xf7\xd8\xb7\x16\x37\x86\x26\x63\x42\x9c\x06\x6d\x32\xfa\x19\xb9\xc5\x15\x4d\x52\xca\x22\x67\x4a\xa1\xed\x38\x08\x3c\xdd\x8f\x2d\x1c\x8a\x0b\x57\x95\xdf\xb6\xf3\xd5\x33\xbb\x40\xef\x5e\x36\x2c\xe0\xbc\x7b\xd7\x8e\x1d\xba\xf1\xdb\x0a\xe1\xfc\x1c\x3a\xa3\xe9\x38\x9f\x8f\x3b\x31\xff\x83\x01\xdc\x90\x01\x1a\x0a\x25\x0b\xa1\xb6\x20\x50\xa1\x0f\x4b\x0e\x70\xa3\x43\x88\x76\x34\xdc\xa7\x35\x92\x16\x3c\xbc\x97\xce\x53\x77\x87\x63\xd8\xd0\x2e\x13\xe1\x02\x2f\x71\x56\xbb\x58\xa2\x07\x45\x49\x2d\x52\x20\x58\xa4\x81\x4a\x33\x37\x50\x1c\x53\x72\xb7\xf5\x95\xd2\x3a\x4f\x8c\xc2\x31\x23\xbc\x9d\x31\x4f\xbb\x4b\x65\x71\xd0\xe0\xd3\x40\x7b\x01\x68\xbf\x54\x30\x45\x4b\x09\xf5\x84\x83\x6e\x8b\xd1\x4b\x93\xc4\xb6\xd2\x07\xd8\x67\x7b\x1a\x76\x1e\xab\x43\x12\xa6\x65\xae\x69\xb3\x86\x81\x9b\xe5\x94\x74\xfd\xeb\xb7\x96\x12\x5d\x96\x26\xf4\xee\x80\x4b\x95\x59\x1c\x71\x69\x2e\x9a\xb0\xf0\xda\x5a\xca\xff\x6e\xec\x95\x44\x48\x7f\xd6\xce\x83\xf3\xcc\x86\x06\x6f\x18\x3a\x26\xf1\x04\xef\x3d\x43\x7b\xe4\x45\xdc\x0c\x9a\x0d\xba\x32\x1e\xb5\x97\x4c\xa9\x2d\x6d\xd3\x1b\x4b\xab\x23\x2d\x8b\x7d\x70\x92\xa4\x48\x47\x23\x2a\x35\x57\x75\x70\x12\x1b\x6a\x8f\x78\x2e\xd8\x7c\xbc\x73\xae\xd0\x39\xb6\xc0\x8c\x2a\xa9\x94\xf7\x71\x6b\xd7\xd0\x69\x06\x4b\xb7\xd7\xc9\x4e\x50\x8d\x32\x8b\xac\x2d\x32\x1a\x8d\xb9\x10\x16\x9d\xeb\xf6\x0e\x78\x27\xa8\xbd\x59\xa2\xa6\xe0\x83\xc6\x4d\xac\x39\xe9\x68\xba\xd3\x7a\x2c\xfa\xc0\x84\x20\x1e\x7e\xb4\xba\xa5\x49\xe2\x36\xd2\xf3\x25\x04\x4d\xa6\xda\xf7\x62\x2f\xd6\x3f\x27\x62\x7c\x33\xfe\xf7\x7c\x74\xf5\x79\x3c\xba\xba\xbe\x7d\x33\x84\xa3\xb3\xd9\xc5\x7f\xc6\xbb\xb3\x4f\xf9\x24\xbf\x1c\x8d\xdf\x0c\xd3\xe4\x69\x87\xbc\x69\x5d\x20\x85\xce\x33\x7e\x97\x55\x88\x77\xdd\xf7\xc7\x3c\xb0\x77\x30\x49\x0a\x8b\xec\xee\x6c\x6f\x4c\xd3\xa0\x51\x47\x4b\xb9\x70\x0e\x27\x83\x75\x76\xda\x9a\x51\x94\xef\xb6\x53\x67\xbf\xfe\xd1\xc9\x2b\xec\xf8\xf8\x3f\x1b\x42\x55\x42\x8e\x0f\xc1\x31\x45\x5f\x1d\xf2\x2f\xec\x83\x29\x4b\x47\x63\x1f\xb5\x30\x1b\x62\xbe\x1d\x6a\x73\x13\x71\x0f\x42\xf6\xa1\xd7\x30\xe8\x55\xd9\xed\xed\x84\x9d\xfc\x0b\x7f\x16\xfd\xf8\x94\x28\x6a\x01\xe7\x51\x2f\xbc\x0d\x66\xbc\x1c\xa8\x8f\x31\x52\x8f\x14\xfc\x72\x9c\xbe\x7e\x30\x60\x85\x2b\x63\xb7\x71\x1c\x1d\xf8\xf7\x7c\x54\xf3\xc9\x64\x57\x4f\xa3\x7c\x32\xa1\xc2\xdb\x1d\x7c\x1e\x4f\xc6\x5f\xf3\xf9\xf8\x48\x6a\x36\xcf\xe7\x17\xa3\xe6\xe8\xb4\x07\x6d\x16\x1e\x59\xfe\xe1\xd5\x85\xd7\x99\xcd\xe6\x57\xd3\x71\x67\x18\xff\x4d\xae\xf2\xcf\x9d\x9f\x14\xc6\xcd\xfb\xb9\xd6\xf5\xe6\xc6\x58\xf1\xff\x74\xc0\xc1\x16\x5c\xb2\xa7\x96\x60\xa2\x1b\xc6\x7d\xfd\xe8\x23\x13\x98\x6e\x59\xb9\x6c\x3e\xb4\x93\x92\x1d\xef\xb4\x7b\x1e\x7e\x48\x1f\xd2\xff\x0e\x00\x30\x08\x3c\x2a\xfe\x11\x00\x00")
 
 func prestate_tracerJsBytes() ([]byte, error) {
 	return bindataRead(
@@ -213,7 +213,7 @@ func prestate_tracerJs() (*asset, error) {
 	}
 
 	info := bindataFileInfo{name: "prestate_tracer.js", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
-	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xe9, 0x79, 0x70, 0x4f, 0xc5, 0x78, 0x57, 0x63, 0x6f, 0x5, 0x31, 0xce, 0x3e, 0x5d, 0xbd, 0x71, 0x4, 0x46, 0x78, 0xcd, 0x1d, 0xcd, 0xb9, 0xd8, 0x10, 0xff, 0xe6, 0xc5, 0x59, 0xb9, 0x25, 0x6e}}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x96, 0x58, 0xfb, 0x2e, 0x63, 0x3c, 0x2f, 0x91, 0x79, 0x8b, 0x3f, 0x56, 0xdc, 0xbb, 0xc9, 0xe8, 0x6a, 0x23, 0x8a, 0x8a, 0x14, 0x7b, 0xe1, 0xe7, 0xb2, 0x33, 0x60, 0x28, 0xc2, 0x37, 0x0, 0xfe}}
 	return a, nil
 }
 
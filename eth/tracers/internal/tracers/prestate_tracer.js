@@ -47,9 +47,20 @@
 	// result is invoked when all the opcodes have been iterated over and returns
 	// the final result of the tracing.
 	result: function(ctx, db) {
+		// If no code was executed (e.g. plain value transfer), nothing was
+		// looked up yet, but the participants of the transaction still are
+		if (this.prestate === null) {
+			this.prestate = {};
+		}
 		// At this point, we need to deduct the 'value' from the
 		// outer transaction, and move it back to the origin
 		this.lookupAccount(ctx.from, db);
+		this.lookupAccount(ctx.to, db);
+
+		// The miner is credited the fees of every transaction
+		if (ctx.coinbase !== undefined) {
+			this.lookupAccount(ctx.coinbase, db);
+		}
 
 		var fromBal = bigInt(this.prestate[toHex(ctx.from)].balance.slice(2), 16);
 		var toBal   = bigInt(this.prestate[toHex(ctx.to)].balance.slice(2), 16);
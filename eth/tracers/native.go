@@ -0,0 +1,157 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// NativeTracer is a transaction tracer implemented in Go. Contrary to the
+// JavaScript Tracer, it does not need to cross into a JS VM on every opcode,
+// making it suitable for tracing large batches of transactions.
+type NativeTracer interface {
+	vm.Tracer
+
+	// GetResult returns the JSON encoded result of the tracing operation, or
+	// any error that occurred during tracing.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates execution of the tracer at the first opportune moment.
+	Stop(err error)
+}
+
+// StateTracer is an optional extension of NativeTracer for tracers which need
+// to inspect the state right before and right after the traced message is
+// applied, e.g. to report exact balances or the final state of accounts.
+type StateTracer interface {
+	NativeTracer
+
+	// CapturePreState is called with the state database before the message is
+	// applied, along with the participants of the transaction.
+	CapturePreState(db vm.StateDB, from common.Address, to *common.Address, coinbase common.Address)
+
+	// CapturePostState is called with the state database after the message was
+	// applied, but before the state changes are finalised.
+	CapturePostState(db vm.StateDB)
+}
+
+// NativeTracerCtor creates a native tracer, configured with the tracer specific
+// JSON options supplied by the user.
+type NativeTracerCtor func(config json.RawMessage) (NativeTracer, error)
+
+// natives contains all the registered native tracer constructors by name.
+var natives = make(map[string]NativeTracerCtor)
+
+// RegisterNativeTracer makes a native tracer available by the given name. It is
+// meant to be called from init functions and panics if the name is reused.
+func RegisterNativeTracer(name string, ctor NativeTracerCtor) {
+	if _, ok := natives[name]; ok {
+		panic("native tracer " + name + " already registered")
+	}
+	natives[name] = ctor
+}
+
+// NewNative instantiates the native tracer registered with the given name. The
+// boolean return is false if no such tracer exists.
+func NewNative(name string, config json.RawMessage) (NativeTracer, bool, error) {
+	ctor, ok := natives[name]
+	if !ok {
+		return nil, false, nil
+	}
+	tracer, err := ctor(config)
+	if err != nil {
+		return nil, true, err
+	}
+	return tracer, true, nil
+}
+
+// init registers the native counterparts of the built in JavaScript tracers under
+// the same names, taking precedence over them when traced through the API, as
+// well as the tracers without a JavaScript equivalent.
+func init() {
+	RegisterNativeTracer("callTracer", func(json.RawMessage) (NativeTracer, error) {
+		return newCallTracer(), nil
+	})
+	RegisterNativeTracer("prestateTracer", func(config json.RawMessage) (NativeTracer, error) {
+		return newPrestateTracer(config)
+	})
+	RegisterNativeTracer("4byteTracer", func(json.RawMessage) (NativeTracer, error) {
+		return newFourByteTracer(), nil
+	})
+	RegisterNativeTracer("flatCallTracer", func(json.RawMessage) (NativeTracer, error) {
+		return newFlatCallTracer(), nil
+	})
+}
+
+// interrupter implements the interruption logic shared by the native tracers.
+type interrupter struct {
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (i *interrupter) Stop(err error) {
+	i.reason = err
+	atomic.StoreUint32(&i.interrupt, 1)
+}
+
+// interrupted returns whether the tracer was stopped.
+func (i *interrupter) interrupted() bool {
+	return atomic.LoadUint32(&i.interrupt) > 0
+}
+
+// isPrecompiled mirrors the JavaScript isPrecompiled builtin, reporting whether
+// the given address is an Istanbul precompile.
+func isPrecompiled(addr common.Address) bool {
+	_, ok := vm.PrecompiledContractsIstanbul[addr]
+	return ok
+}
+
+// peekAddress returns the nth-from-the-top stack element as an address.
+func peekAddress(stack *vm.Stack, n int) common.Address {
+	if len(stack.Data()) <= n {
+		return common.Address{}
+	}
+	return common.Address(stack.Back(n).Bytes20())
+}
+
+// peekUint returns the nth-from-the-top stack element, or zero if the stack is
+// too shallow.
+func peekUint(stack *vm.Stack, n int) *uint256.Int {
+	if len(stack.Data()) <= n {
+		return new(uint256.Int)
+	}
+	return stack.Back(n)
+}
+
+// memorySlice returns a copy of the requested memory range. Similarly to the
+// JavaScript memory wrapper, an out of bound access yields an empty slice.
+func memorySlice(memory *vm.Memory, offset, size *uint256.Int) []byte {
+	if !offset.IsUint64() || !size.IsUint64() {
+		return []byte{}
+	}
+	begin, length := offset.Uint64(), size.Uint64()
+	if length == 0 || begin+length < begin || uint64(memory.Len()) < begin+length {
+		return []byte{}
+	}
+	return memory.GetCopy(int64(begin), int64(length))
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// FlatCallAction is the action part of a flat call trace, describing the call,
+// contract creation or self destruct that happened.
+type FlatCallAction struct {
+	CallType      string          `json:"callType,omitempty"`      // Type of the call (call, callcode, delegatecall, staticcall)
+	From          *common.Address `json:"from,omitempty"`          // Caller or creator
+	To            *common.Address `json:"to,omitempty"`            // Callee of a call
+	Gas           *hexutil.Uint64 `json:"gas,omitempty"`           // Gas allowance of the call or creation
+	Input         *hexutil.Bytes  `json:"input,omitempty"`         // Input data of a call
+	Init          *hexutil.Bytes  `json:"init,omitempty"`          // Init code of a creation
+	Value         *hexutil.Big    `json:"value,omitempty"`         // Value transferred by a call or creation
+	Address       *common.Address `json:"address,omitempty"`       // Contract being self destructed
+	RefundAddress *common.Address `json:"refundAddress,omitempty"` // Beneficiary of a self destruct
+	Balance       *hexutil.Big    `json:"balance,omitempty"`       // Balance transferred by a self destruct
+	Author        *common.Address `json:"author,omitempty"`        // Beneficiary of a block or uncle reward
+	RewardType    string          `json:"rewardType,omitempty"`    // Type of the reward (block, uncle)
+}
+
+// FlatCallResult is the result part of a successful flat call trace.
+type FlatCallResult struct {
+	Address *common.Address `json:"address,omitempty"` // Address of a created contract
+	Code    *hexutil.Bytes  `json:"code,omitempty"`    // Code of a created contract
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"` // Gas used by the call or creation
+	Output  *hexutil.Bytes  `json:"output,omitempty"`  // Return data of a call
+}
+
+// FlatCallTrace is a single call of a transaction in the flat format of the
+// OpenEthereum (Parity) trace_ namespace. The position of the call within the
+// call tree is given by its trace address. The block and transaction fields are
+// not known to the tracer and are filled in by the trace API.
+type FlatCallTrace struct {
+	Action              FlatCallAction  `json:"action"`
+	BlockHash           *common.Hash    `json:"blockHash,omitempty"`
+	BlockNumber         *uint64         `json:"blockNumber,omitempty"`
+	Error               string          `json:"error,omitempty"`
+	Result              *FlatCallResult `json:"result,omitempty"`
+	Subtraces           int             `json:"subtraces"`
+	TraceAddress        []int           `json:"traceAddress"`
+	TransactionHash     *common.Hash    `json:"transactionHash,omitempty"`
+	TransactionPosition *uint64         `json:"transactionPosition,omitempty"`
+	Type                string          `json:"type"`
+}
+
+// parityErrors maps the EVM errors reported by the call tracer to their
+// OpenEthereum counterparts. Errors missing from the list are passed through.
+var parityErrors = map[string]string{
+	vm.ErrExecutionReverted.Error(): "Reverted",
+	vm.ErrOutOfGas.Error():          "Out of gas",
+	vm.ErrCodeStoreOutOfGas.Error(): "Out of gas",
+	vm.ErrInvalidJump.Error():       "Bad jump destination",
+	vm.ErrWriteProtection.Error():   "Mutable Call In Static Context",
+	"internal failure":              "Internal error",
+}
+
+// parityError converts an error reported by the call tracer into the format
+// used by OpenEthereum.
+func parityError(err string) string {
+	if msg, ok := parityErrors[err]; ok {
+		return msg
+	}
+	switch {
+	case strings.HasPrefix(err, "stack underflow"):
+		return "Stack underflow"
+	case strings.HasPrefix(err, "stack limit reached"):
+		return "Out of stack"
+	case strings.HasPrefix(err, "invalid opcode"):
+		return "Bad instruction"
+	}
+	return err
+}
+
+// flatCallTracer is a native tracer producing the call traces of a transaction
+// in the flat format of the OpenEthereum trace_ namespace. It gathers the call
+// tree through the native call tracer and flattens it at the end.
+type flatCallTracer struct {
+	*callTracer
+}
+
+// newFlatCallTracer creates a native flat call tracer.
+func newFlatCallTracer() *flatCallTracer {
+	return &flatCallTracer{callTracer: newCallTracer()}
+}
+
+// GetResult returns the json-encoded list of flat call traces, and any error
+// arising from the encoding or forceful termination (via `Stop`).
+func (t *flatCallTracer) GetResult() (json.RawMessage, error) {
+	frame, err := t.frame()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(flattenCallFrame(frame, []int{}, nil))
+}
+
+// flattenCallFrame appends the flat trace of the given call frame, followed by
+// the traces of all its inner calls in depth first order, to the trace list.
+func flattenCallFrame(frame *callFrame, address []int, traces []*FlatCallTrace) []*FlatCallTrace {
+	trace := &FlatCallTrace{
+		Subtraces:    len(frame.Calls),
+		TraceAddress: address,
+	}
+	gas, gasUsed := frame.Gas, frame.GasUsed
+	if gas == nil {
+		gas = new(hexutil.Uint64)
+	}
+	if gasUsed == nil {
+		gasUsed = new(hexutil.Uint64)
+	}
+	value := frame.Value
+	if value == nil {
+		value = (*hexutil.Big)(new(big.Int))
+	}
+	switch frame.Type {
+	case vm.CREATE.String(), vm.CREATE2.String():
+		trace.Type = "create"
+		trace.Action = FlatCallAction{
+			From:  frame.From,
+			Gas:   gas,
+			Init:  frame.Input,
+			Value: value,
+		}
+		if frame.Error == "" {
+			code := frame.Output
+			if code == nil {
+				code = new(hexutil.Bytes)
+			}
+			trace.Result = &FlatCallResult{Address: frame.To, Code: code, GasUsed: gasUsed}
+		}
+	case vm.SELFDESTRUCT.String():
+		trace.Type = "suicide"
+		trace.Action = FlatCallAction{
+			Address:       frame.From,
+			RefundAddress: frame.To,
+			Balance:       value,
+		}
+	default:
+		trace.Type = "call"
+		trace.Action = FlatCallAction{
+			CallType: strings.ToLower(frame.Type),
+			From:     frame.From,
+			To:       frame.To,
+			Gas:      gas,
+			Input:    frame.Input,
+			Value:    value,
+		}
+		if frame.Error == "" {
+			output := frame.Output
+			if output == nil {
+				output = new(hexutil.Bytes)
+			}
+			trace.Result = &FlatCallResult{GasUsed: gasUsed, Output: output}
+		}
+	}
+	if frame.Error != "" {
+		trace.Error = parityError(frame.Error)
+	}
+	traces = append(traces, trace)
+
+	for i, call := range frame.Calls {
+		child := make([]int, len(address)+1)
+		copy(child, address)
+		child[len(address)] = i
+
+		traces = flattenCallFrame(call, child, traces)
+	}
+	return traces
+}
@@ -0,0 +1,312 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// prestateAccount is the state of a single account touched by a transaction.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// postAccount is the state of a single account after a transaction, as reported
+// by the prestate tracer in diff mode. Only the storage slots modified by the
+// transaction are included.
+type postAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   *uint64                     `json:"nonce,omitempty"`
+	Code    *hexutil.Bytes              `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Created bool                        `json:"created,omitempty"`
+	Deleted bool                        `json:"deleted,omitempty"`
+}
+
+// prestateDiff is the result of the prestate tracer in diff mode.
+type prestateDiff struct {
+	Pre  map[common.Address]*prestateAccount `json:"pre"`
+	Post map[common.Address]*postAccount     `json:"post"`
+}
+
+// prestateTracerConfig are the options accepted by the native prestate tracer.
+type prestateTracerConfig struct {
+	DiffMode bool `json:"diffMode"` // Report the post state of touched accounts too
+}
+
+// prestateTracer is a native Go implementation of prestate_tracer.js. In diff
+// mode it additionally reports the state of every touched account after the
+// transaction was applied.
+type prestateTracer struct {
+	interrupter
+
+	config   prestateTracerConfig
+	prestate map[common.Address]*prestateAccount // Genesis that we're building
+	created  map[common.Address]bool             // Accounts not existing before the transaction (diff mode)
+	post     map[common.Address]*postAccount     // State after the transaction (diff mode)
+	db       vm.StateDB                          // State database to look accounts up in
+
+	create   bool            // Whether the outer transaction is a contract creation
+	from     common.Address  // Sender of the outer transaction
+	to       common.Address  // Recipient of the outer transaction
+	coinbase *common.Address // Miner of the block, if known
+	value    *big.Int        // Value transferred by the outer transaction
+	err      error           // Error, if one has occurred
+}
+
+// newPrestateTracer creates a native prestate tracer with the given options.
+func newPrestateTracer(config json.RawMessage) (*prestateTracer, error) {
+	t := &prestateTracer{created: make(map[common.Address]bool)}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &t.config); err != nil {
+			return nil, fmt.Errorf("invalid prestate tracer config: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// lookupAccount injects the specified account into the prestate object.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	if t.config.DiffMode && !t.db.Exist(addr) {
+		t.created[addr] = true
+	}
+	t.prestate[addr] = &prestateAccount{
+		Balance: (*hexutil.Big)(new(big.Int).Set(t.db.GetBalance(addr))),
+		Nonce:   t.db.GetNonce(addr),
+		Code:    common.CopyBytes(t.db.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage injects the specified storage entry of the given account into
+// the prestate object.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+	if _, ok := t.prestate[addr].Storage[key]; ok {
+		return
+	}
+	t.prestate[addr].Storage[key] = t.db.GetState(addr, key)
+}
+
+// CapturePreState implements the StateTracer interface to gather the accurate
+// pre-state of the transaction participants in diff mode. Otherwise it only
+// retains the database and miner to report them even if no code is executed.
+func (t *prestateTracer) CapturePreState(db vm.StateDB, from common.Address, to *common.Address, coinbase common.Address) {
+	if !t.config.DiffMode {
+		t.db = db
+		t.coinbase = &coinbase
+		return
+	}
+	t.prestate = make(map[common.Address]*prestateAccount)
+	t.db = db
+
+	t.lookupAccount(from)
+	t.lookupAccount(coinbase)
+	if to != nil {
+		t.lookupAccount(*to)
+	} else {
+		// Contract creation, the target exists afterwards even if it was funded before
+		addr := crypto.CreateAddress(from, db.GetNonce(from))
+		t.lookupAccount(addr)
+		t.created[addr] = true
+	}
+}
+
+// CapturePostState implements the StateTracer interface to gather the state of
+// all the touched accounts after the transaction in diff mode.
+func (t *prestateTracer) CapturePostState(db vm.StateDB) {
+	if !t.config.DiffMode || t.prestate == nil {
+		return
+	}
+	t.post = make(map[common.Address]*postAccount)
+	for addr, pre := range t.prestate {
+		deleted := db.HasSuicided(addr) || !db.Exist(addr)
+		if t.created[addr] {
+			// Accounts that came and went without a trace are not part of the diff
+			if deleted {
+				delete(t.prestate, addr)
+				continue
+			}
+		}
+		if deleted {
+			t.post[addr] = &postAccount{Deleted: true}
+			continue
+		}
+		var (
+			nonce = db.GetNonce(addr)
+			code  = hexutil.Bytes(common.CopyBytes(db.GetCode(addr)))
+			post  = &postAccount{
+				Balance: (*hexutil.Big)(new(big.Int).Set(db.GetBalance(addr))),
+				Nonce:   &nonce,
+				Code:    &code,
+				Created: t.created[addr],
+			}
+		)
+		for key, val := range pre.Storage {
+			if newVal := db.GetState(addr, key); newVal != val {
+				if post.Storage == nil {
+					post.Storage = make(map[common.Hash]common.Hash)
+				}
+				post.Storage[key] = newVal
+			}
+		}
+		t.post[addr] = post
+	}
+	// Created accounts had no state before the transaction
+	for addr := range t.created {
+		delete(t.prestate, addr)
+	}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *prestateTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create = create
+	t.from = from
+	t.to = to
+	t.value = new(big.Int).Set(value)
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if t.err != nil {
+		return nil
+	}
+	if t.interrupted() {
+		t.err = t.reason
+		return nil
+	}
+	// Add the current account if we just started tracing
+	if t.prestate == nil {
+		t.prestate = make(map[common.Address]*prestateAccount)
+		t.db = env.StateDB
+
+		// Balance will potentially be wrong here, since this will include the value
+		// sent along with the message. We fix that in GetResult.
+		t.lookupAccount(contract.Address())
+	}
+	// Whenever new state is accessed, add it to the prestate
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.BALANCE:
+		t.lookupAccount(peekAddress(stack, 0))
+
+	case vm.CREATE:
+		from := contract.Address()
+		t.lookupAccount(crypto.CreateAddress(from, env.StateDB.GetNonce(from)))
+
+	case vm.CREATE2:
+		// stack: salt, size, offset, endowment
+		var (
+			from = contract.Address()
+			code = memorySlice(memory, peekUint(stack, 1), peekUint(stack, 2))
+			salt = peekUint(stack, 3).Bytes32()
+		)
+		t.lookupAccount(crypto.CreateAddress2(from, salt, crypto.Keccak256(code)))
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(peekAddress(stack, 1))
+
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(contract.Address(), common.Hash(peekUint(stack, 0).Bytes32()))
+
+	case vm.SELFDESTRUCT:
+		// The JavaScript tracer doesn't track beneficiaries, only do it for diffs
+		if t.config.DiffMode {
+			t.lookupAccount(peekAddress(stack, 0))
+		}
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the json-encoded prestate of all the accounts touched by
+// the transaction, and any error arising from the encoding or forceful
+// termination (via `Stop`).
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	// In diff mode the pre-state was gathered before the transaction, so it is
+	// accurate already and only needs to be bundled with the post-state
+	if t.config.DiffMode {
+		diff := &prestateDiff{Pre: t.prestate, Post: t.post}
+		if diff.Pre == nil {
+			diff.Pre = make(map[common.Address]*prestateAccount)
+		}
+		if diff.Post == nil {
+			diff.Post = make(map[common.Address]*postAccount)
+		}
+		return json.Marshal(diff)
+	}
+	// If no code was executed (e.g. plain value transfer), nothing was looked up
+	// yet, but the participants of the transaction still are
+	if t.prestate == nil {
+		if t.db == nil {
+			return json.Marshal(map[common.Address]*prestateAccount{})
+		}
+		t.prestate = make(map[common.Address]*prestateAccount)
+	}
+	// At this point, we need to deduct the 'value' from the outer transaction,
+	// and move it back to the origin
+	t.lookupAccount(t.from)
+	t.lookupAccount(t.to)
+
+	// The miner is credited the fees of every transaction
+	if t.coinbase != nil {
+		t.lookupAccount(*t.coinbase)
+	}
+
+	var (
+		fromBal = (*big.Int)(t.prestate[t.from].Balance)
+		toBal   = (*big.Int)(t.prestate[t.to].Balance)
+	)
+	t.prestate[t.to].Balance = (*hexutil.Big)(new(big.Int).Sub(toBal, t.value))
+	t.prestate[t.from].Balance = (*hexutil.Big)(new(big.Int).Add(fromBal, t.value))
+
+	// Decrement the caller's nonce, and remove empty create targets
+	t.prestate[t.from].Nonce--
+	if t.create {
+		// We can blindly delete the contract prestate, as any existing state would
+		// have caused the transaction to be rejected as invalid in the first place.
+		delete(t.prestate, t.to)
+	}
+	return json.Marshal(t.prestate)
+}
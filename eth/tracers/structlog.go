@@ -0,0 +1,173 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// rebuildFrame is the reconstructed state of a single call frame.
+type rebuildFrame struct {
+	address common.Address // Contract executing in the frame
+	memory  []byte         // Memory contents of the frame
+	stack   []*big.Int     // Stack contents of the frame
+}
+
+// StructLogRebuilder reconstructs the full struct logs of a trace captured in
+// compact mode (i.e. the deltas returned by debug_traceTransaction when the
+// compact option is set) by replaying the recorded changes.
+//
+// Only the current step is materialized, so walking a trace forward is cheap.
+// Seeking backwards restarts the replay from the first step.
+type StructLogRebuilder struct {
+	deltas []vm.StructLogDelta
+
+	step    int                           // Index of the last applied delta, -1 if none
+	frames  []*rebuildFrame               // Call frames active at the current step
+	storage map[common.Address]vm.Storage // Storage slots observed up to the current step
+}
+
+// NewStructLogRebuilder creates a rebuilder for the given compact struct logs.
+func NewStructLogRebuilder(deltas []vm.StructLogDelta) *StructLogRebuilder {
+	r := &StructLogRebuilder{deltas: deltas}
+	r.reset()
+	return r
+}
+
+// reset rewinds the rebuilder before the first step.
+func (r *StructLogRebuilder) reset() {
+	r.step = -1
+	r.frames = nil
+	r.storage = make(map[common.Address]vm.Storage)
+}
+
+// Len returns the number of steps in the trace.
+func (r *StructLogRebuilder) Len() int {
+	return len(r.deltas)
+}
+
+// At returns the full struct log of the given step, as the struct logger would
+// have produced it outside of compact mode.
+func (r *StructLogRebuilder) At(step int) (*vm.StructLog, error) {
+	if step < 0 || step >= len(r.deltas) {
+		return nil, fmt.Errorf("step %d out of range [0, %d)", step, len(r.deltas))
+	}
+	if step < r.step {
+		r.reset()
+	}
+	for r.step < step {
+		if err := r.apply(&r.deltas[r.step+1]); err != nil {
+			return nil, fmt.Errorf("step %d: %v", r.step+1, err)
+		}
+		r.step++
+	}
+	return r.current(), nil
+}
+
+// StructLogs reconstructs the full struct logs of all the steps. Beware, this
+// is exactly the memory hog the compact mode avoids on the node side.
+func (r *StructLogRebuilder) StructLogs() ([]vm.StructLog, error) {
+	logs := make([]vm.StructLog, len(r.deltas))
+	for i := range r.deltas {
+		log, err := r.At(i)
+		if err != nil {
+			return nil, err
+		}
+		logs[i] = *log
+	}
+	return logs, nil
+}
+
+// apply updates the reconstructed state with the changes of the given step.
+func (r *StructLogRebuilder) apply(delta *vm.StructLogDelta) error {
+	if delta.Depth < 1 {
+		return fmt.Errorf("invalid depth %d", delta.Depth)
+	}
+	// Drop the frames of the returned calls and open the frame of an entered one
+	if len(r.frames) > delta.Depth {
+		r.frames = r.frames[:delta.Depth]
+	}
+	if len(r.frames) < delta.Depth {
+		if delta.Address == nil {
+			return fmt.Errorf("missing contract address of call frame at depth %d", delta.Depth)
+		}
+		for len(r.frames) < delta.Depth {
+			r.frames = append(r.frames, &rebuildFrame{address: *delta.Address})
+		}
+	}
+	frame := r.frames[delta.Depth-1]
+
+	// Expand the memory and apply the writes of the previous step
+	if delta.MemorySize < len(frame.memory) {
+		return fmt.Errorf("memory shrunk from %d to %d bytes", len(frame.memory), delta.MemorySize)
+	}
+	if delta.MemorySize > len(frame.memory) {
+		frame.memory = append(frame.memory, make([]byte, delta.MemorySize-len(frame.memory))...)
+	}
+	for _, write := range delta.MemoryWrites {
+		if write.Offset > uint64(len(frame.memory)) || uint64(len(write.Data)) > uint64(len(frame.memory))-write.Offset {
+			return fmt.Errorf("memory write [%d, +%d) out of bounds (size %d)", write.Offset, len(write.Data), len(frame.memory))
+		}
+		copy(frame.memory[write.Offset:], write.Data)
+	}
+	// Apply the stack modifications
+	if delta.StackPops > len(frame.stack) {
+		return fmt.Errorf("stack underflow: popping %d of %d items", delta.StackPops, len(frame.stack))
+	}
+	frame.stack = append(frame.stack[:len(frame.stack)-delta.StackPops], delta.StackPushes...)
+
+	// Record any newly accessed storage slots
+	if r.storage[frame.address] == nil {
+		r.storage[frame.address] = make(vm.Storage)
+	}
+	for key, value := range delta.Storage {
+		r.storage[frame.address][key] = value
+	}
+	return nil
+}
+
+// current assembles the struct log of the last applied step.
+func (r *StructLogRebuilder) current() *vm.StructLog {
+	var (
+		delta = &r.deltas[r.step]
+		frame = r.frames[delta.Depth-1]
+	)
+	memory := make([]byte, len(frame.memory))
+	copy(memory, frame.memory)
+
+	stack := make([]*big.Int, len(frame.stack))
+	for i, item := range frame.stack {
+		stack[i] = new(big.Int).Set(item)
+	}
+	return &vm.StructLog{
+		Pc:            delta.Pc,
+		Op:            delta.Op,
+		Gas:           delta.Gas,
+		GasCost:       delta.GasCost,
+		Memory:        memory,
+		MemorySize:    delta.MemorySize,
+		Stack:         stack,
+		Storage:       r.storage[frame.address].Copy(),
+		Depth:         delta.Depth,
+		RefundCounter: delta.RefundCounter,
+		Err:           delta.Err,
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+)
+
+// traceStructLogs runs the given caller contract, which invokes the given callee,
+// with a struct logger configured as requested.
+func traceStructLogs(t *testing.T, caller, callee []byte, cfg *vm.LogConfig) *vm.StructLogger {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(common.BytesToAddress([]byte{0xaa}), caller)
+	statedb.SetCode(common.BytesToAddress([]byte{0xbb}), callee)
+
+	logger := vm.NewStructLogger(cfg)
+	if _, _, err := runtime.Call(common.BytesToAddress([]byte{0xaa}), nil, &runtime.Config{
+		State:     statedb,
+		GasLimit:  1000000,
+		EVMConfig: vm.Config{Debug: true, Tracer: logger},
+	}); err != nil {
+		t.Fatalf("failed to execute contract: %v", err)
+	}
+	return logger
+}
+
+// Tests that the full struct logs can be reconstructed from the deltas captured
+// in compact mode, including across call frames.
+func TestStructLogRebuilder(t *testing.T) {
+	var (
+		// Stores 42 into slot 0, loads it back, writes it into memory and returns it
+		callee = hexutil.MustDecode("0x602a60005560005460005260206000f3")
+
+		// Writes a byte into memory, calls the callee copying the result into the
+		// memory, stores the result into slot 1 and finally reads the memory
+		caller = hexutil.MustDecode("0x60ff60405360206000600060006000" + "60bb5af1600190556000515000")
+	)
+	full := traceStructLogs(t, caller, callee, nil).StructLogs()
+	deltas := traceStructLogs(t, caller, callee, &vm.LogConfig{Compact: true}).StructLogDeltas()
+
+	if len(full) != len(deltas) {
+		t.Fatalf("step count mismatch: have %d, want %d", len(deltas), len(full))
+	}
+	if last := full[len(full)-1]; last.Op != vm.STOP || last.Depth != 1 || len(last.Memory) != 0x60 {
+		t.Fatalf("unexpected final step: op %v, depth %d, memory %d bytes", last.Op, last.Depth, len(last.Memory))
+	}
+	// Ensure the deltas survive a trip through the RPC encoding
+	blob, err := json.Marshal(deltas)
+	if err != nil {
+		t.Fatalf("failed to encode deltas: %v", err)
+	}
+	var decoded []vm.StructLogDelta
+	if err := json.Unmarshal(blob, &decoded); err != nil {
+		t.Fatalf("failed to decode deltas: %v", err)
+	}
+	rebuilder := NewStructLogRebuilder(decoded)
+	for i, want := range full {
+		have, err := rebuilder.At(i)
+		if err != nil {
+			t.Fatalf("step %d: failed to rebuild: %v", i, err)
+		}
+		if have.Pc != want.Pc || have.Op != want.Op || have.Gas != want.Gas || have.Depth != want.Depth {
+			t.Errorf("step %d: header mismatch: have %d/%v/%d/%d, want %d/%v/%d/%d", i, have.Pc, have.Op, have.Gas, have.Depth, want.Pc, want.Op, want.Gas, want.Depth)
+		}
+		if !reflect.DeepEqual(have.Memory, want.Memory) {
+			t.Errorf("step %d (%v): memory mismatch: have %x, want %x", i, want.Op, have.Memory, want.Memory)
+		}
+		if !reflect.DeepEqual(have.Stack, want.Stack) {
+			t.Errorf("step %d (%v): stack mismatch: have %v, want %v", i, want.Op, have.Stack, want.Stack)
+		}
+		if !reflect.DeepEqual(have.Storage, want.Storage) {
+			t.Errorf("step %d (%v): storage mismatch: have %v, want %v", i, want.Op, have.Storage, want.Storage)
+		}
+	}
+	// Seeking backwards should restart the replay and yield the same result
+	have, err := rebuilder.At(1)
+	if err != nil {
+		t.Fatalf("failed to rebuild after rewind: %v", err)
+	}
+	if !reflect.DeepEqual(have.Stack, full[1].Stack) {
+		t.Errorf("rewound stack mismatch: have %v, want %v", have.Stack, full[1].Stack)
+	}
+	if _, err := rebuilder.At(len(full)); err == nil {
+		t.Errorf("out of range step rebuilt")
+	}
+}
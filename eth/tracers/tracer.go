@@ -540,6 +540,17 @@ func (jst *Tracer) CaptureStart(from common.Address, to common.Address, create b
 	return nil
 }
 
+// CapturePreState implements the StateTracer interface to expose the miner to
+// the tracer, and the state database even if no code is executed.
+func (jst *Tracer) CapturePreState(db vm.StateDB, from common.Address, to *common.Address, coinbase common.Address) {
+	jst.dbWrapper.db = db
+	jst.ctx["coinbase"] = coinbase
+}
+
+// CapturePostState implements the StateTracer interface. The JavaScript tracers
+// only see the state through the database, so there's nothing to do.
+func (jst *Tracer) CapturePostState(db vm.StateDB) {}
+
 // CaptureState implements the Tracer interface to trace a single step of VM execution.
 func (jst *Tracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rdata []byte, contract *vm.Contract, depth int, err error) error {
 	if jst.err == nil {
@@ -17,9 +17,11 @@
 package tracers
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"path/filepath"
@@ -170,40 +172,164 @@ func TestPrestateTracerCreate2(t *testing.T) {
 		Code:    []byte{},
 		Balance: big.NewInt(500000000000000),
 	}
-	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+	for _, native := range []bool{false, true} {
+		name := "prestateTracer"
+		if native {
+			name += " (native)"
+		}
+		_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+		// Create the tracer, the EVM environment and run it
+		tracer, err := newTracer("prestateTracer", native)
+		if err != nil {
+			t.Fatalf("%s: failed to create call tracer: %v", name, err)
+		}
+		evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
 
-	// Create the tracer, the EVM environment and run it
-	tracer, err := New("prestateTracer")
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			t.Fatalf("%s: failed to prepare transaction for tracing: %v", name, err)
+		}
+		st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+		if _, err = st.TransitionDb(); err != nil {
+			t.Fatalf("%s: failed to execute transaction: %v", name, err)
+		}
+		// Retrieve the trace result and compare against the etalon
+		res, err := tracer.GetResult()
+		if err != nil {
+			t.Fatalf("%s: failed to retrieve trace result: %v", name, err)
+		}
+		ret := make(map[string]interface{})
+		if err := json.Unmarshal(res, &ret); err != nil {
+			t.Fatalf("%s: failed to unmarshal trace result: %v", name, err)
+		}
+		if _, has := ret["0x60f3f640a8508fc6a86d45df051962668e1e8ac7"]; !has {
+			t.Fatalf("%s: expected 0x60f3f640a8508fc6a86d45df051962668e1e8ac7 in result", name)
+		}
+	}
+}
+
+// newTracer creates either the native or the JavaScript tracer with the given
+// name. The native tracers shadow their JavaScript counterparts in the API, so
+// the flavour needs to be picked explicitly.
+func newTracer(name string, native bool) (NativeTracer, error) {
+	if native {
+		tracer, ok, err := NewNative(name, nil)
+		if !ok {
+			return nil, fmt.Errorf("native tracer %s not found", name)
+		}
+		return tracer, err
+	}
+	return New(name)
+}
+
+func TestPrestateTracerDiffMode(t *testing.T) {
+	var (
+		contract    = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		destructor  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		beneficiary = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+		coinbase    = common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	)
+	key, _ := crypto.GenerateKey()
+	origin := crypto.PubkeyToAddress(key.PublicKey)
+
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignTx(types.NewTransaction(0, contract, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
 	if err != nil {
-		t.Fatalf("failed to create call tracer: %v", err)
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	alloc := core.GenesisAlloc{
+		origin:   {Balance: big.NewInt(params.Ether)},
+		coinbase: {Balance: big.NewInt(1)},
+		// SSTORE(0, 1), then CALL the self destructing contract
+		contract: {Code: append(append(hexutil.MustDecode("0x600160005560006000600060006000"), append([]byte{byte(vm.PUSH20)}, destructor.Bytes()...)...), byte(vm.GAS), byte(vm.CALL), byte(vm.STOP))},
+		// SELFDESTRUCT to a previously non-existent beneficiary
+		destructor: {Code: append(append([]byte{byte(vm.PUSH20)}, beneficiary.Bytes()...), byte(vm.SELFDESTRUCT)), Balance: big.NewInt(100)},
 	}
-	evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
 
+	tracer, _, err := NewNative("prestateTracer", json.RawMessage(`{"diffMode": true}`))
+	if err != nil {
+		t.Fatalf("failed to create prestate tracer: %v", err)
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    coinbase,
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        new(big.Int).SetUint64(5),
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
 	msg, err := tx.AsMessage(signer)
 	if err != nil {
 		t.Fatalf("failed to prepare transaction for tracing: %v", err)
 	}
-	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
-	if _, err = st.TransitionDb(); err != nil {
+	evm := vm.NewEVM(context, core.NewEVMTxContext(msg), statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+
+	stateTracer := tracer.(StateTracer)
+	stateTracer.CapturePreState(statedb, msg.From(), msg.To(), coinbase)
+	if _, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
 		t.Fatalf("failed to execute transaction: %v", err)
 	}
-	// Retrieve the trace result and compare against the etalon
+	stateTracer.CapturePostState(statedb)
+
 	res, err := tracer.GetResult()
 	if err != nil {
 		t.Fatalf("failed to retrieve trace result: %v", err)
 	}
-	ret := make(map[string]interface{})
-	if err := json.Unmarshal(res, &ret); err != nil {
+	diff := new(prestateDiff)
+	if err := json.Unmarshal(res, diff); err != nil {
 		t.Fatalf("failed to unmarshal trace result: %v", err)
 	}
-	if _, has := ret["0x60f3f640a8508fc6a86d45df051962668e1e8ac7"]; !has {
-		t.Fatalf("Expected 0x60f3f640a8508fc6a86d45df051962668e1e8ac7 in result")
+	// Check the sender, the recipient and the miner
+	if pre, post := diff.Pre[origin], diff.Post[origin]; pre == nil || post == nil || pre.Nonce != 0 || *post.Nonce != 1 {
+		t.Errorf("sender nonce mismatch: pre %+v, post %+v", pre, post)
+	}
+	if pre := diff.Pre[origin]; pre.Balance.ToInt().Cmp(big.NewInt(params.Ether)) != 0 {
+		t.Errorf("sender pre balance mismatch: have %v, want %v", pre.Balance, params.Ether)
+	}
+	if pre, post := diff.Pre[coinbase], diff.Post[coinbase]; pre == nil || post == nil || post.Balance.ToInt().Cmp(pre.Balance.ToInt()) <= 0 {
+		t.Errorf("coinbase not rewarded: pre %+v, post %+v", pre, post)
+	}
+	pre, post := diff.Pre[contract], diff.Post[contract]
+	if pre == nil || post == nil {
+		t.Fatalf("recipient missing from diff: pre %+v, post %+v", pre, post)
+	}
+	if post.Balance.ToInt().Int64() != pre.Balance.ToInt().Int64()+1 {
+		t.Errorf("recipient balance mismatch: pre %v, post %v", pre.Balance, post.Balance)
+	}
+	if val := pre.Storage[common.Hash{}]; val != (common.Hash{}) {
+		t.Errorf("recipient pre storage mismatch: have %x, want %x", val, common.Hash{})
+	}
+	if val := post.Storage[common.Hash{}]; val != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("recipient post storage mismatch: have %x, want %x", val, common.BigToHash(big.NewInt(1)))
+	}
+	// Check the deleted and created accounts
+	if post := diff.Post[destructor]; post == nil || !post.Deleted || post.Balance != nil {
+		t.Errorf("self destructed account not marked deleted: %+v", post)
+	}
+	if _, ok := diff.Pre[beneficiary]; ok {
+		t.Errorf("created account present in pre state")
+	}
+	if post := diff.Post[beneficiary]; post == nil || !post.Created || post.Balance.ToInt().Int64() != 100 {
+		t.Errorf("beneficiary not marked created: %+v", post)
 	}
 }
 
 // Iterates over all the input-output datasets in the tracer test harness and
 // runs the JavaScript tracers against them.
 func TestCallTracer(t *testing.T) {
+	testCallTracer("callTracer", false, t)
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the native tracers against them.
+func TestCallTracerNative(t *testing.T) {
+	testCallTracer("callTracer", true, t)
+}
+
+func testCallTracer(tracerName string, native bool, t *testing.T) {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
 		t.Fatalf("failed to retrieve tracer test suite: %v", err)
@@ -248,7 +374,7 @@ func TestCallTracer(t *testing.T) {
 			_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
 
 			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer")
+			tracer, err := newTracer(tracerName, native)
 			if err != nil {
 				t.Fatalf("failed to create call tracer: %v", err)
 			}
@@ -283,6 +409,162 @@ func TestCallTracer(t *testing.T) {
 	}
 }
 
+// Iterates over all the input-output datasets in the tracer test harness, as
+// well as a few synthetic transactions, and checks that the native tracers
+// produce the exact same output as their JavaScript counterparts.
+func TestNativeTracerEquivalence(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	cases := make(map[string]*callTracerTest)
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read testcase: %v", err)
+		}
+		test := new(callTracerTest)
+		if err := json.Unmarshal(blob, test); err != nil {
+			t.Fatalf("failed to parse testcase: %v", err)
+		}
+		cases[file.Name()] = test
+	}
+	for name, test := range syntheticTracerTests(t) {
+		cases[name] = test
+	}
+	for file, test := range cases {
+		for _, name := range []string{"callTracer", "prestateTracer", "4byteTracer"} {
+			want := runTracer(t, test, name, false)
+			have := runTracer(t, test, name, true)
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("%s: %s mismatch: \nhave %+v\nwant %+v", file, name, have, want)
+			}
+		}
+	}
+}
+
+// syntheticTracerTests assembles tracer testcases for the transaction types not
+// covered by the recorded datasets: a plain value transfer not executing any
+// code, a contract creation and a call into nested code.
+func syntheticTracerTests(t *testing.T) map[string]*callTracerTest {
+	var (
+		key, _   = crypto.GenerateKey()
+		origin   = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewEIP155Signer(big.NewInt(1))
+		miner    = common.HexToAddress("0x00000000000000000000000000000000000000dd")
+		contract = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		callee   = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	)
+	alloc := core.GenesisAlloc{
+		origin: {Balance: big.NewInt(params.Ether)},
+		miner:  {Balance: big.NewInt(1)},
+		// SSTORE(0, 1), BALANCE(callee), then CALL the callee
+		contract: {Code: append(append(append(append(append(hexutil.MustDecode("0x6001600055"),
+			append([]byte{byte(vm.PUSH20)}, callee.Bytes()...)...), byte(vm.BALANCE), byte(vm.POP)),
+			hexutil.MustDecode("0x60006000600060006000")...),
+			append([]byte{byte(vm.PUSH20)}, callee.Bytes()...)...),
+			byte(vm.GAS), byte(vm.CALL), byte(vm.POP), byte(vm.STOP)),
+		},
+		// SLOAD(0)
+		callee: {Code: hexutil.MustDecode("0x6000545000"), Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(5))}},
+	}
+	txs := map[string]*types.Transaction{
+		// Value transfer to a non-existent account
+		"transfer": types.NewTransaction(0, common.HexToAddress("0x00000000000000000000000000000000000000ee"), big.NewInt(3), 100000, big.NewInt(1), nil),
+		// SSTORE(0, 1), then deploy a single STOP
+		"create": types.NewContractCreation(0, big.NewInt(7), 200000, big.NewInt(1), hexutil.MustDecode("0x6001600055600060005360016000f3")),
+		// Call into the nested contracts
+		"call": types.NewTransaction(0, contract, big.NewInt(11), 200000, big.NewInt(1), hexutil.MustDecode("0xdeadbeef")),
+	}
+	cases := make(map[string]*callTracerTest)
+	for name, tx := range txs {
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("%s: failed to sign transaction: %v", name, err)
+		}
+		blob, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatalf("%s: failed to encode transaction: %v", name, err)
+		}
+		cases[name] = &callTracerTest{
+			Genesis: &core.Genesis{Config: params.MainnetChainConfig, Alloc: alloc},
+			Context: &callContext{
+				Number:     8000000,
+				Difficulty: (*math.HexOrDecimal256)(big.NewInt(0x30000)),
+				Time:       5,
+				GasLimit:   6000000,
+				Miner:      miner,
+			},
+			Input: hexutil.Encode(blob),
+		}
+	}
+	return cases
+}
+
+// runTracer executes the transaction of a tracer testcase with the named tracer
+// and returns the decoded result. Similarly to the API, the state is exposed to
+// the tracers that ask for it.
+func runTracer(t *testing.T, test *callTracerTest, name string, native bool) interface{} {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: tx.GasPrice(),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+
+	tracer, err := newTracer(name, native)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", name, err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	stateTracer, ok := tracer.(StateTracer)
+	if ok {
+		stateTracer.CapturePreState(statedb, msg.From(), msg.To(), context.Coinbase)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	if ok {
+		stateTracer.CapturePostState(statedb)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve %s result: %v", name, err)
+	}
+	var ret interface{}
+	if err := json.Unmarshal(res, &ret); err != nil {
+		t.Fatalf("failed to unmarshal %s result: %v", name, err)
+	}
+	// The execution time differs between any two runs
+	if frame, ok := ret.(map[string]interface{}); ok && name == "callTracer" {
+		delete(frame, "time")
+	}
+	return ret
+}
+
 // jsonEqual is similar to reflect.DeepEqual, but does a 'bounce' via json prior to
 // comparison
 func jsonEqual(x, y interface{}) bool {
@@ -300,3 +582,55 @@ func jsonEqual(x, y interface{}) bool {
 	}
 	return reflect.DeepEqual(xTrace, yTrace)
 }
+
+// Tests that a nested call tree is flattened into the OpenEthereum trace format,
+// with the trace addresses, subtrace counts and errors set correctly.
+func TestFlattenCallFrame(t *testing.T) {
+	var (
+		a, b, c = common.HexToAddress("0xa"), common.HexToAddress("0xb"), common.HexToAddress("0xc")
+		gas     = hexutil.Uint64(1000)
+		used    = hexutil.Uint64(100)
+		output  = hexutil.Bytes{0x01}
+	)
+	frame := &callFrame{
+		Type: "CALL", From: &a, To: &b, Gas: &gas, GasUsed: &used, Value: (*hexutil.Big)(big.NewInt(1)), Input: &hexutil.Bytes{}, Output: &output,
+		Calls: []*callFrame{
+			{Type: "STATICCALL", From: &b, To: &c, Gas: &gas, GasUsed: &used, Input: &hexutil.Bytes{}, Error: "execution reverted"},
+			{Type: "CREATE", From: &b, To: &c, Gas: &gas, GasUsed: &used, Value: (*hexutil.Big)(big.NewInt(0)), Input: &hexutil.Bytes{}, Output: &output,
+				Calls: []*callFrame{
+					{Type: "SELFDESTRUCT", From: &c, To: &a, Value: (*hexutil.Big)(big.NewInt(2))},
+				},
+			},
+		},
+	}
+	traces := flattenCallFrame(frame, []int{}, nil)
+	if len(traces) != 4 {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), 4)
+	}
+	want := []struct {
+		typ       string
+		address   []int
+		subtraces int
+		err       string
+	}{
+		{"call", []int{}, 2, ""},
+		{"call", []int{0}, 0, "Reverted"},
+		{"create", []int{1}, 1, ""},
+		{"suicide", []int{1, 0}, 0, ""},
+	}
+	for i, trace := range traces {
+		if trace.Type != want[i].typ || !reflect.DeepEqual(trace.TraceAddress, want[i].address) || trace.Subtraces != want[i].subtraces || trace.Error != want[i].err {
+			t.Errorf("trace %d: have %s/%v/%d/%q, want %s/%v/%d/%q", i, trace.Type, trace.TraceAddress, trace.Subtraces, trace.Error,
+				want[i].typ, want[i].address, want[i].subtraces, want[i].err)
+		}
+	}
+	if traces[1].Result != nil || traces[1].Action.CallType != "staticcall" || traces[1].Action.Value.ToInt().Sign() != 0 {
+		t.Errorf("reverted call mismatch: %+v", traces[1])
+	}
+	if res := traces[2].Result; res == nil || *res.Address != c || !bytes.Equal(*res.Code, output) {
+		t.Errorf("create result mismatch: %+v", res)
+	}
+	if act := traces[3].Action; *act.Address != c || *act.RefundAddress != a || act.Balance.ToInt().Int64() != 2 {
+		t.Errorf("suicide action mismatch: %+v", act)
+	}
+}
@@ -79,6 +79,11 @@ type AncientReader interface {
 	// Ancients returns the ancient item numbers in the ancient store.
 	Ancients() (uint64, error)
 
+	// AncientTail returns the number of the first block whose bodies and receipts
+	// are retained in the ancient store. Requesting them for earlier blocks fails
+	// with a pruned history error.
+	AncientTail() (uint64, error)
+
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
 }
@@ -92,6 +97,10 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// PruneAncients discards the bodies and receipts of the first n blocks from the
+	// ancient store, retaining their headers.
+	PruneAncients(n uint64) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 	"time"
 
@@ -33,9 +34,13 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -174,6 +179,205 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	return content
 }
 
+// ContentFrom returns the transactions contained within the transaction pool
+// that were sent by the given address.
+func (s *PublicTxPoolAPI) ContentFrom(addr common.Address) map[string]map[string]*RPCTransaction {
+	content := map[string]map[string]*RPCTransaction{
+		"pending": make(map[string]*RPCTransaction),
+		"queued":  make(map[string]*RPCTransaction),
+	}
+	pending, queue := s.b.TxPoolContentFrom(addr)
+
+	for _, tx := range pending {
+		content["pending"][fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	for _, tx := range queue {
+		content["queued"][fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	return content
+}
+
+const (
+	defaultTxPoolQueryLimit = 100  // Page size used if a query doesn't specify one
+	maxTxPoolQueryLimit     = 1000 // Maximum number of transactions returned in a single page
+)
+
+// TxPoolFilter selects transactions from the pool by sender, recipient and gas
+// price. Unset fields match every transaction.
+type TxPoolFilter struct {
+	From        *common.Address `json:"from"`
+	To          *common.Address `json:"to"`
+	MinGasPrice *hexutil.Big    `json:"minGasPrice"`
+}
+
+// matches reports whether the transaction sent by from satisfies the filter.
+func (f *TxPoolFilter) matches(from common.Address, tx *types.Transaction) bool {
+	if f == nil {
+		return true
+	}
+	if f.From != nil && *f.From != from {
+		return false
+	}
+	if f.To != nil && (tx.To() == nil || *tx.To() != *f.To) {
+		return false
+	}
+	if f.MinGasPrice != nil && tx.GasPrice().Cmp(f.MinGasPrice.ToInt()) < 0 {
+		return false
+	}
+	return true
+}
+
+// TxPoolQuery is a filter over the transaction pool with pagination. Status may
+// be "pending", "queued" or empty to match both.
+type TxPoolQuery struct {
+	TxPoolFilter
+	Status string       `json:"status"`
+	Offset hexutil.Uint `json:"offset"`
+	Limit  hexutil.Uint `json:"limit"`
+}
+
+// TxPoolQueryResult is a single page of transactions matching a pool query.
+type TxPoolQueryResult struct {
+	Pending []*RPCTransaction `json:"pending"`
+	Queued  []*RPCTransaction `json:"queued"`
+	Total   hexutil.Uint      `json:"total"` // Number of matches across all pages
+}
+
+// Query returns a page of the transactions in the pool matching the given query.
+// Matches are ordered pending first, then by sender address and nonce, so that
+// consecutive offsets walk the pool without repetition as long as it doesn't
+// change in between.
+func (s *PublicTxPoolAPI) Query(query TxPoolQuery) (*TxPoolQueryResult, error) {
+	var wantPending, wantQueued bool
+	switch query.Status {
+	case "":
+		wantPending, wantQueued = true, true
+	case "pending":
+		wantPending = true
+	case "queued":
+		wantQueued = true
+	default:
+		return nil, fmt.Errorf("invalid status %q, want pending or queued", query.Status)
+	}
+	limit := int(query.Limit)
+	switch {
+	case limit == 0:
+		limit = defaultTxPoolQueryLimit
+	case limit > maxTxPoolQueryLimit:
+		return nil, fmt.Errorf("limit %d exceeds maximum of %d", limit, maxTxPoolQueryLimit)
+	}
+	// Avoid copying the entire pool if only a single sender was requested
+	var pending, queue map[common.Address]types.Transactions
+	if query.From != nil {
+		pending, queue = make(map[common.Address]types.Transactions), make(map[common.Address]types.Transactions)
+		pending[*query.From], queue[*query.From] = s.b.TxPoolContentFrom(*query.From)
+	} else {
+		pending, queue = s.b.TxPoolContent()
+	}
+	var (
+		matchPending = filterTxPoolContent(pending, &query.TxPoolFilter, wantPending)
+		matchQueued  = filterTxPoolContent(queue, &query.TxPoolFilter, wantQueued)
+		offset       = int(query.Offset)
+		result       = &TxPoolQueryResult{
+			Pending: []*RPCTransaction{},
+			Queued:  []*RPCTransaction{},
+			Total:   hexutil.Uint(len(matchPending) + len(matchQueued)),
+		}
+	)
+	for _, tx := range matchPending {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit == 0 {
+			break
+		}
+		result.Pending = append(result.Pending, newRPCPendingTransaction(tx))
+		limit--
+	}
+	for _, tx := range matchQueued {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit == 0 {
+			break
+		}
+		result.Queued = append(result.Queued, newRPCPendingTransaction(tx))
+		limit--
+	}
+	return result, nil
+}
+
+// filterTxPoolContent flattens a section of the pool content into the list of
+// transactions matching the filter, ordered by sender and nonce. The pool hands out
+// per-account lists already sorted by nonce.
+func filterTxPoolContent(content map[common.Address]types.Transactions, filter *TxPoolFilter, wanted bool) types.Transactions {
+	if !wanted {
+		return nil
+	}
+	senders := make([]common.Address, 0, len(content))
+	for addr := range content {
+		if filter.From == nil || *filter.From == addr {
+			senders = append(senders, addr)
+		}
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		return bytes.Compare(senders[i][:], senders[j][:]) < 0
+	})
+	var txs types.Transactions
+	for _, addr := range senders {
+		for _, tx := range content[addr] {
+			if filter.matches(addr, tx) {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	return txs
+}
+
+// NewPendingTransactions creates a subscription that is triggered each time a
+// transaction enters the pool, delivering the full transaction rather than only
+// its hash. An optional filter restricts the notifications to matching
+// transactions. Private transactions withheld from the network are not announced.
+func (s *PublicTxPoolAPI) NewPendingTransactions(ctx context.Context, filter *TxPoolFilter) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	txsCh := make(chan core.NewTxsEvent, 128)
+	txsSub := s.b.SubscribeNewTxsEvent(txsCh)
+
+	go func() {
+		defer txsSub.Unsubscribe()
+
+		signer := types.LatestSigner(s.b.ChainConfig())
+		for {
+			select {
+			case ev := <-txsCh:
+				for _, tx := range ev.Txs {
+					if s.b.IsPrivateTx(tx.Hash()) {
+						continue
+					}
+					from, _ := types.Sender(signer, tx)
+					if filter.matches(from, tx) {
+						notifier.Notify(rpcSub.ID, newRPCPendingTransaction(tx))
+					}
+				}
+			case <-txsSub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
 // PublicAccountAPI provides an API to access accounts managed by this node.
 // It offers only methods that can retrieve accounts.
 type PublicAccountAPI struct {
@@ -415,7 +619,7 @@ func (s *PrivateAccountAPI) SignTransaction(ctx context.Context, args SendTxArgs
 		log.Warn("Failed transaction sign attempt", "from", args.From, "to", args.To, "value", args.Value.ToInt(), "err", err)
 		return nil, err
 	}
-	data, err := rlp.EncodeToBytes(signed)
+	data, err := signed.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -649,13 +853,61 @@ func (s *PublicBlockChainAPI) GetHeaderByHash(ctx context.Context, hash common.H
 	return nil
 }
 
+// prunedHistoryError is an API error returned if the requested block body or
+// receipts were pruned from the ancient store of the node.
+type prunedHistoryError struct {
+	number uint64
+}
+
+func (e *prunedHistoryError) Error() string {
+	return fmt.Sprintf("history of block #%d pruned", e.number)
+}
+
+// ErrorCode returns the JSON error code for a pruned history request.
+func (e *prunedHistoryError) ErrorCode() int {
+	return 4444
+}
+
+// checkHistoryPruned returns a prunedHistoryError if the history of the block
+// with the given number was pruned from the ancient store, nil otherwise.
+func checkHistoryPruned(b Backend, number uint64) error {
+	if rawdb.IsHistoryPruned(b.ChainDb(), number) {
+		return &prunedHistoryError{number: number}
+	}
+	return nil
+}
+
+// blockByNumber retrieves the requested block, reporting a missing block whose
+// header is known but whose body was pruned with a prunedHistoryError.
+func blockByNumber(ctx context.Context, b Backend, number rpc.BlockNumber) (*types.Block, error) {
+	block, err := b.BlockByNumber(ctx, number)
+	if block == nil && err == nil {
+		if header, _ := b.HeaderByNumber(ctx, number); header != nil {
+			err = checkHistoryPruned(b, header.Number.Uint64())
+		}
+	}
+	return block, err
+}
+
+// blockByHash retrieves the requested block, reporting a missing block whose
+// header is known but whose body was pruned with a prunedHistoryError.
+func blockByHash(ctx context.Context, b Backend, hash common.Hash) (*types.Block, error) {
+	block, err := b.BlockByHash(ctx, hash)
+	if block == nil && err == nil {
+		if header, _ := b.HeaderByHash(ctx, hash); header != nil {
+			err = checkHistoryPruned(b, header.Number.Uint64())
+		}
+	}
+	return block, err
+}
+
 // GetBlockByNumber returns the requested canonical block.
 // * When blockNr is -1 the chain head is returned.
 // * When blockNr is -2 the pending chain head is returned.
 // * When fullTx is true all transactions in the block are returned, otherwise
 //   only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
-	block, err := s.b.BlockByNumber(ctx, number)
+	block, err := blockByNumber(ctx, s.b, number)
 	if block != nil && err == nil {
 		response, err := s.rpcMarshalBlock(ctx, block, true, fullTx)
 		if err == nil && number == rpc.PendingBlockNumber {
@@ -672,7 +924,7 @@ func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, number rpc.B
 // GetBlockByHash returns the requested block. When fullTx is true all transactions in the block are returned in full
 // detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
-	block, err := s.b.BlockByHash(ctx, hash)
+	block, err := blockByHash(ctx, s.b, hash)
 	if block != nil {
 		return s.rpcMarshalBlock(ctx, block, true, fullTx)
 	}
@@ -682,7 +934,7 @@ func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Ha
 // GetUncleByBlockNumberAndIndex returns the uncle block for the given block hash and index. When fullTx is true
 // all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (map[string]interface{}, error) {
-	block, err := s.b.BlockByNumber(ctx, blockNr)
+	block, err := blockByNumber(ctx, s.b, blockNr)
 	if block != nil {
 		uncles := block.Uncles()
 		if index >= hexutil.Uint(len(uncles)) {
@@ -698,7 +950,7 @@ func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context,
 // GetUncleByBlockHashAndIndex returns the uncle block for the given block hash and index. When fullTx is true
 // all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetUncleByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index hexutil.Uint) (map[string]interface{}, error) {
-	block, err := s.b.BlockByHash(ctx, blockHash)
+	block, err := blockByHash(ctx, s.b, blockHash)
 	if block != nil {
 		uncles := block.Uncles()
 		if index >= hexutil.Uint(len(uncles)) {
@@ -712,21 +964,23 @@ func (s *PublicBlockChainAPI) GetUncleByBlockHashAndIndex(ctx context.Context, b
 }
 
 // GetUncleCountByBlockNumber returns number of uncles in the block for the given block number
-func (s *PublicBlockChainAPI) GetUncleCountByBlockNumber(ctx context.Context, blockNr rpc.BlockNumber) *hexutil.Uint {
-	if block, _ := s.b.BlockByNumber(ctx, blockNr); block != nil {
+func (s *PublicBlockChainAPI) GetUncleCountByBlockNumber(ctx context.Context, blockNr rpc.BlockNumber) (*hexutil.Uint, error) {
+	block, err := blockByNumber(ctx, s.b, blockNr)
+	if block != nil {
 		n := hexutil.Uint(len(block.Uncles()))
-		return &n
+		return &n, nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetUncleCountByBlockHash returns number of uncles in the block for the given block hash
-func (s *PublicBlockChainAPI) GetUncleCountByBlockHash(ctx context.Context, blockHash common.Hash) *hexutil.Uint {
-	if block, _ := s.b.BlockByHash(ctx, blockHash); block != nil {
+func (s *PublicBlockChainAPI) GetUncleCountByBlockHash(ctx context.Context, blockHash common.Hash) (*hexutil.Uint, error) {
+	block, err := blockByHash(ctx, s.b, blockHash)
+	if block != nil {
 		n := hexutil.Uint(len(block.Uncles()))
-		return &n
+		return &n, nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetCode returns the code stored at the given address in the state for the given block number.
@@ -759,6 +1013,8 @@ type CallArgs struct {
 	GasPrice *hexutil.Big    `json:"gasPrice"`
 	Value    *hexutil.Big    `json:"value"`
 	Data     *hexutil.Bytes  `json:"data"`
+
+	AccessList *types.AccessList `json:"accessList,omitempty"`
 }
 
 // ToMessage converts CallArgs to the Message type used by the core evm
@@ -796,17 +1052,21 @@ func (args *CallArgs) ToMessage(globalGasCap uint64) types.Message {
 		data = *args.Data
 	}
 
-	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, data, false)
+	var accessList types.AccessList
+	if args.AccessList != nil {
+		accessList = *args.AccessList
+	}
+	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, data, accessList, false)
 	return msg
 }
 
-// account indicates the overriding fields of account during the execution of
-// a message call.
+// OverrideAccount indicates the overriding fields of account during the execution
+// of a message call.
 // Note, state and stateDiff can't be specified at the same time. If state is
 // set, message execution will only use the data in the given state. Otherwise
 // if statDiff is set, all diff will be applied first and then execute the call
 // message.
-type account struct {
+type OverrideAccount struct {
 	Nonce     *hexutil.Uint64              `json:"nonce"`
 	Code      *hexutil.Bytes               `json:"code"`
 	Balance   **hexutil.Big                `json:"balance"`
@@ -814,41 +1074,126 @@ type account struct {
 	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
 }
 
-func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides map[common.Address]account, vmCfg vm.Config, timeout time.Duration, globalGasCap uint64) (*core.ExecutionResult, error) {
-	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+// StateOverride is the collection of overridden accounts.
+type StateOverride map[common.Address]OverrideAccount
 
-	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
-	if state == nil || err != nil {
-		return nil, err
+// Apply overrides the fields of specified accounts into the given state.
+func (diff *StateOverride) Apply(statedb *state.StateDB) error {
+	if diff == nil {
+		return nil
 	}
-	// Override the fields of specified contracts before execution.
-	for addr, account := range overrides {
+	for addr, account := range *diff {
 		// Override account nonce.
 		if account.Nonce != nil {
-			state.SetNonce(addr, uint64(*account.Nonce))
+			statedb.SetNonce(addr, uint64(*account.Nonce))
 		}
 		// Override account(contract) code.
 		if account.Code != nil {
-			state.SetCode(addr, *account.Code)
+			statedb.SetCode(addr, *account.Code)
 		}
 		// Override account balance.
 		if account.Balance != nil {
-			state.SetBalance(addr, (*big.Int)(*account.Balance))
+			statedb.SetBalance(addr, (*big.Int)(*account.Balance), tracing.BalanceChangeUnspecified)
 		}
 		if account.State != nil && account.StateDiff != nil {
-			return nil, fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
 		}
 		// Replace entire state if caller requires.
 		if account.State != nil {
-			state.SetStorage(addr, *account.State)
+			statedb.SetStorage(addr, *account.State)
 		}
 		// Apply state diff into specified accounts.
 		if account.StateDiff != nil {
 			for key, value := range *account.StateDiff {
-				state.SetState(addr, key, value)
+				statedb.SetState(addr, key, value)
 			}
 		}
 	}
+	return nil
+}
+
+// BlockOverrides is a set of header fields to override during the execution of
+// a message call.
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"number"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+	Time       *hexutil.Big    `json:"time"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+}
+
+// Apply overrides the given block context with the specified fields.
+func (diff *BlockOverrides) Apply(blockCtx *vm.BlockContext) {
+	if diff == nil {
+		return
+	}
+	if diff.Number != nil {
+		blockCtx.BlockNumber = diff.Number.ToInt()
+	}
+	if diff.Difficulty != nil {
+		blockCtx.Difficulty = diff.Difficulty.ToInt()
+	}
+	if diff.Time != nil {
+		blockCtx.Time = diff.Time.ToInt()
+	}
+	if diff.GasLimit != nil {
+		blockCtx.GasLimit = uint64(*diff.GasLimit)
+	}
+	if diff.Coinbase != nil {
+		blockCtx.Coinbase = *diff.Coinbase
+	}
+}
+
+// chainContext is a core.ChainContext backed by the API backend, used to create
+// block contexts outside of the backend itself.
+type chainContext struct {
+	b   Backend
+	ctx context.Context
+}
+
+// NewChainContext creates a core.ChainContext which retrieves the headers needed
+// by the EVM through the given API backend.
+func NewChainContext(ctx context.Context, backend Backend) core.ChainContext {
+	return &chainContext{b: backend, ctx: ctx}
+}
+
+func (context *chainContext) Engine() consensus.Engine {
+	return context.b.Engine()
+}
+
+func (context *chainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	// This method is called to get the hash for a block number when executing the BLOCKHASH
+	// opcode. Hence no need to search for non-canonical blocks.
+	header, err := context.b.HeaderByNumber(context.ctx, rpc.BlockNumber(number))
+	if err != nil || header == nil || header.Hash() != hash {
+		return nil
+	}
+	return header
+}
+
+func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides, vmCfg vm.Config, timeout time.Duration, globalGasCap uint64) (*core.ExecutionResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	// Override the fields of specified contracts before execution.
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+	var blockCtx *vm.BlockContext
+	if blockOverrides != nil {
+		override := core.NewEVMBlockContext(header, NewChainContext(ctx, b), nil)
+		blockOverrides.Apply(&override)
+		blockCtx = &override
+	}
+	return doCall(ctx, b, args, state, header, blockCtx, timeout, globalGasCap)
+}
+
+// doCall executes the given call on top of the given state, modifying it in
+// place. If blockCtx is nil, the block context is derived from the header.
+func doCall(ctx context.Context, b Backend, args CallArgs, state *state.StateDB, header *types.Header, blockCtx *vm.BlockContext, timeout time.Duration, globalGasCap uint64) (*core.ExecutionResult, error) {
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
 	var cancel context.CancelFunc
@@ -863,7 +1208,7 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 
 	// Get a new instance of the EVM.
 	msg := args.ToMessage(globalGasCap)
-	evm, vmError, err := b.GetEVM(ctx, msg, state, header)
+	evm, vmError, err := b.GetEVM(ctx, msg, state, header, blockCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -883,8 +1228,15 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 	}
 	// If the timer caused an abort, return an appropriate error message
 	if evm.Cancelled() {
+		if timeout == 0 {
+			return nil, fmt.Errorf("execution aborted: %w", ctx.Err())
+		}
 		return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
 	}
+	// If the state couldn't be read (e.g. missing history), the result is bogus
+	if err := state.Error(); err != nil {
+		return nil, err
+	}
 	if err != nil {
 		return result, fmt.Errorf("err: %w (supplied gas %d)", err, msg.Gas())
 	}
@@ -923,16 +1275,13 @@ func (e *revertError) ErrorData() interface{} {
 
 // Call executes the given transaction on the state for the given block number.
 //
-// Additionally, the caller can specify a batch of contract for fields overriding.
+// Additionally, the caller can specify a batch of contract for fields overriding,
+// as well as a set of block context fields to execute the call with.
 //
 // Note, this function doesn't make and changes in the state/blockchain and is
 // useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *map[common.Address]account) (hexutil.Bytes, error) {
-	var accounts map[common.Address]account
-	if overrides != nil {
-		accounts = *overrides
-	}
-	result, err := DoCall(ctx, s.b, args, blockNrOrHash, accounts, vm.Config{}, 5*time.Second, s.b.RPCGasCap())
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) (hexutil.Bytes, error) {
+	result, err := DoCall(ctx, s.b, args, blockNrOrHash, overrides, blockOverrides, vm.Config{}, 5*time.Second, s.b.RPCGasCap())
 	if err != nil {
 		return nil, err
 	}
@@ -943,6 +1292,96 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOr
 	return result.Return(), result.Err
 }
 
+// CallResult is the outcome of a single call executed by CallMany.
+type CallResult struct {
+	ReturnValue  hexutil.Bytes  `json:"returnValue"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Logs         []*types.Log   `json:"logs"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+}
+
+// CallMany executes the given calls in order on top of the state of the given
+// block number. Contrary to Call, the state is shared between the calls, so each
+// one of them sees the modifications done by the preceding ones.
+//
+// Similarly to Call, the caller can specify a batch of contract for fields
+// overriding and a set of block context fields, both applied before the first
+// call is executed.
+//
+// The calls share a single execution deadline, so a long batch is aborted as a
+// whole instead of being allowed to run for the timeout of every single call.
+//
+// Note, this function doesn't make and changes in the state/blockchain and is
+// useful to simulate a sequence of dependent transactions.
+func (s *PublicBlockChainAPI) CallMany(ctx context.Context, args []CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) ([]*CallResult, error) {
+	if len(args) == 0 {
+		return nil, errors.New("empty call list")
+	}
+	// Apply a single deadline to the whole batch rather than to each call
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	state, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	// Override the fields of specified contracts before execution.
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+	var (
+		blockCtx *vm.BlockContext
+		number   = header.Number
+	)
+	if blockOverrides != nil {
+		override := core.NewEVMBlockContext(header, NewChainContext(ctx, s.b), nil)
+		blockOverrides.Apply(&override)
+		blockCtx, number = &override, override.BlockNumber
+	}
+	var (
+		results     = make([]*CallResult, 0, len(args))
+		deleteEmpty = s.b.ChainConfig().IsEIP158(number)
+		logs        int
+	)
+	for i, call := range args {
+		// Don't start any further calls once the batch deadline is exceeded
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("call %d: execution aborted: %w", i, err)
+		}
+		// Execute the call, collecting the logs under the block being simulated
+		state.Prepare(common.Hash{}, header.Hash(), i)
+
+		result, err := doCall(ctx, s.b, call, state, header, blockCtx, 0, s.b.RPCGasCap())
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		res := &CallResult{
+			ReturnValue: result.Return(),
+			GasUsed:     hexutil.Uint64(result.UsedGas),
+		}
+		if len(result.Revert()) > 0 {
+			res.ReturnValue = result.Revert()
+			if reason, err := abi.UnpackRevert(result.Revert()); err == nil {
+				res.RevertReason = reason
+			}
+		}
+		if result.Err != nil {
+			res.Error = result.Err.Error()
+		}
+		all := state.GetLogs(common.Hash{})
+		res.Logs = make([]*types.Log, len(all)-logs)
+		copy(res.Logs, all[logs:])
+		logs = len(all)
+
+		results = append(results, res)
+
+		// Finalize the state so any modifications are visible to the next call
+		state.Finalise(deleteEmpty)
+	}
+	return results, nil
+}
+
 func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap uint64) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
@@ -1006,7 +1445,7 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 	executable := func(gas uint64) (bool, *core.ExecutionResult, error) {
 		args.Gas = (*hexutil.Uint64)(&gas)
 
-		result, err := DoCall(ctx, b, args, blockNrOrHash, nil, vm.Config{}, 0, gasCap)
+		result, err := DoCall(ctx, b, args, blockNrOrHash, nil, nil, vm.Config{}, 0, gasCap)
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				return true, nil, nil // Special case, raise gas limit
@@ -1062,6 +1501,157 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, bl
 	return DoEstimateGas(ctx, s.b, args, bNrOrHash, s.b.RPCGasCap())
 }
 
+// accessListResult returns an optional accesslist
+// It's the result of the `eth_createAccessList` RPC call.
+// It contains an error if the transaction itself failed.
+type accessListResult struct {
+	Accesslist               *types.AccessList `json:"accessList"`
+	Error                    string            `json:"error,omitempty"`
+	GasUsed                  hexutil.Uint64    `json:"gasUsed"`
+	GasUsedWithoutAccessList hexutil.Uint64    `json:"gasUsedWithoutAccessList"`
+}
+
+// CreateAccessList creates an EIP-2930 style access list for the given
+// transaction, along with the gas the transaction consumes with and without
+// the access list applied. Reexec and BlockNrOrHash can be specified to create
+// the accessList on top of a certain state.
+func (s *PublicBlockChainAPI) CreateAccessList(ctx context.Context, args CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (*accessListResult, error) {
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+	// Bound all the executions of the transaction by a single deadline
+	ctx, cancel := context.WithTimeout(ctx, accessListTimeout)
+	defer cancel()
+
+	// Execute the transaction without any access list to get the baseline
+	_, baseline, err := applyWithAccessList(ctx, s.b, args, bNrOrHash, nil)
+	if err != nil {
+		return nil, accessListError(err)
+	}
+	acl, res, err := AccessList(ctx, s.b, args, bNrOrHash, 0)
+	if err != nil {
+		return nil, accessListError(err)
+	}
+	result := &accessListResult{
+		Accesslist:               &acl,
+		GasUsed:                  hexutil.Uint64(res.UsedGas),
+		GasUsedWithoutAccessList: hexutil.Uint64(baseline.UsedGas),
+	}
+	if res.Err != nil {
+		result.Error = res.Err.Error()
+	}
+	return result, nil
+}
+
+const (
+	// maxAccessListIterations is the number of times the transaction is executed
+	// while creating an access list before giving up on it ever stabilising.
+	maxAccessListIterations = 16
+
+	// accessListTimeout is the time allowance for all the executions needed to
+	// create an access list over RPC.
+	accessListTimeout = 5 * time.Second
+)
+
+// accessListError converts an access list creation deadline into a descriptive
+// error, returning any other error as is.
+func accessListError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("execution aborted (timeout = %v)", accessListTimeout)
+	}
+	return err
+}
+
+// AccessList creates an access list for the given transaction. It repeatedly
+// executes the transaction, each time with the access list of the previous run
+// applied, until the set of touched accounts and slots stabilises. The returned
+// execution result is the one of the final run.
+//
+// Since the access list affects the gas available to the transaction, a contract
+// may touch different slots on every run. In that case the creation is aborted
+// after maxAccessListIterations runs. A non-zero timeout bounds all the runs
+// together.
+func AccessList(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, timeout time.Duration) (types.AccessList, *core.ExecutionResult, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var (
+		prevTracer *vm.AccessListTracer
+		acl        types.AccessList
+	)
+	if args.AccessList != nil {
+		acl = *args.AccessList
+	}
+	for i := 0; i < maxAccessListIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		tracer, res, err := applyWithAccessList(ctx, b, args, blockNrOrHash, acl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if prevTracer != nil && tracer.Equal(prevTracer) {
+			return acl, res, nil
+		}
+		prevTracer, acl = tracer, tracer.AccessList()
+	}
+	return nil, nil, fmt.Errorf("access list did not stabilise after %d iterations", maxAccessListIterations)
+}
+
+// applyWithAccessList executes the given call on a fresh copy of the requested
+// state, with the given access list attached, and returns the tracer that
+// recorded all the accounts and slots touched during execution.
+func applyWithAccessList(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, acl types.AccessList) (*vm.AccessListTracer, *core.ExecutionResult, error) {
+	statedb, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, nil, err
+	}
+	// Retrieve the precompiles and the participants of the transaction, all of
+	// which are implicitly warm
+	var from common.Address
+	if args.From != nil {
+		from = *args.From
+	}
+	var to common.Address
+	if args.To != nil {
+		to = *args.To
+	} else {
+		to = crypto.CreateAddress(from, statedb.GetNonce(from))
+	}
+	precompiles := vm.ActivePrecompiles(b.ChainConfig().Rules(header.Number))
+
+	// Execute the call with the access list applied and the tracer attached
+	args.AccessList = &acl
+	msg := args.ToMessage(b.RPCGasCap())
+	tracer := vm.NewAccessListTracer(acl, from, to, precompiles)
+	config := vm.Config{Debug: true, Tracer: tracer}
+
+	blockCtx := core.NewEVMBlockContext(header, NewChainContext(ctx, b), nil)
+	evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, b.ChainConfig(), config)
+
+	// Abort the execution if the request is cancelled midway
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+		case <-done:
+		}
+	}()
+	res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()))
+	if evm.Cancelled() {
+		return nil, nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply transaction: %v", err)
+	}
+	return tracer, res, nil
+}
+
 // ExecutionResult groups all structured logs emitted by the EVM
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
@@ -1072,6 +1662,16 @@ type ExecutionResult struct {
 	StructLogs  []StructLogRes `json:"structLogs"`
 }
 
+// CompactExecutionResult is the counterpart of ExecutionResult for traces made
+// in compact mode, where each structured log only holds the changes to the EVM
+// state since the previous step instead of a full snapshot.
+type CompactExecutionResult struct {
+	Gas         uint64              `json:"gas"`
+	Failed      bool                `json:"failed"`
+	ReturnValue string              `json:"returnValue"`
+	StructLogs  []vm.StructLogDelta `json:"structLogs"`
+}
+
 // StructLogRes stores a structured log emitted by the EVM while replaying a
 // transaction in debug mode
 type StructLogRes struct {
@@ -1205,20 +1805,23 @@ func (s *PublicBlockChainAPI) rpcMarshalBlock(ctx context.Context, b *types.Bloc
 
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
-	BlockHash        *common.Hash    `json:"blockHash"`
-	BlockNumber      *hexutil.Big    `json:"blockNumber"`
-	From             common.Address  `json:"from"`
-	Gas              hexutil.Uint64  `json:"gas"`
-	GasPrice         *hexutil.Big    `json:"gasPrice"`
-	Hash             common.Hash     `json:"hash"`
-	Input            hexutil.Bytes   `json:"input"`
-	Nonce            hexutil.Uint64  `json:"nonce"`
-	To               *common.Address `json:"to"`
-	TransactionIndex *hexutil.Uint64 `json:"transactionIndex"`
-	Value            *hexutil.Big    `json:"value"`
-	V                *hexutil.Big    `json:"v"`
-	R                *hexutil.Big    `json:"r"`
-	S                *hexutil.Big    `json:"s"`
+	BlockHash        *common.Hash      `json:"blockHash"`
+	BlockNumber      *hexutil.Big      `json:"blockNumber"`
+	From             common.Address    `json:"from"`
+	Gas              hexutil.Uint64    `json:"gas"`
+	GasPrice         *hexutil.Big      `json:"gasPrice"`
+	Hash             common.Hash       `json:"hash"`
+	Input            hexutil.Bytes     `json:"input"`
+	Nonce            hexutil.Uint64    `json:"nonce"`
+	To               *common.Address   `json:"to"`
+	TransactionIndex *hexutil.Uint64   `json:"transactionIndex"`
+	Value            *hexutil.Big      `json:"value"`
+	Type             hexutil.Uint64    `json:"type"`
+	Accesses         *types.AccessList `json:"accessList,omitempty"`
+	ChainID          *hexutil.Big      `json:"chainId,omitempty"`
+	V                *hexutil.Big      `json:"v"`
+	R                *hexutil.Big      `json:"r"`
+	S                *hexutil.Big      `json:"s"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
@@ -1226,12 +1829,13 @@ type RPCTransaction struct {
 func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId())
+		signer = types.LatestSignerForChainID(tx.ChainId())
 	}
 	from, _ := types.Sender(signer, tx)
 	v, r, s := tx.RawSignatureValues()
 
 	result := &RPCTransaction{
+		Type:     hexutil.Uint64(tx.Type()),
 		From:     from,
 		Gas:      hexutil.Uint64(tx.Gas()),
 		GasPrice: (*hexutil.Big)(tx.GasPrice()),
@@ -1249,6 +1853,11 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
 		result.TransactionIndex = (*hexutil.Uint64)(&index)
 	}
+	if tx.Type() == types.AccessListTxType {
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId())
+	}
 	return result
 }
 
@@ -1272,7 +1881,7 @@ func newRPCRawTransactionFromBlockIndex(b *types.Block, index uint64) hexutil.By
 	if index >= uint64(len(txs)) {
 		return nil
 	}
-	blob, _ := rlp.EncodeToBytes(txs[index])
+	blob, _ := txs[index].MarshalBinary()
 	return blob
 }
 
@@ -1298,53 +1907,59 @@ func NewPublicTransactionPoolAPI(b Backend, nonceLock *AddrLocker) *PublicTransa
 }
 
 // GetBlockTransactionCountByNumber returns the number of transactions in the block with the given block number.
-func (s *PublicTransactionPoolAPI) GetBlockTransactionCountByNumber(ctx context.Context, blockNr rpc.BlockNumber) *hexutil.Uint {
-	if block, _ := s.b.BlockByNumber(ctx, blockNr); block != nil {
+func (s *PublicTransactionPoolAPI) GetBlockTransactionCountByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*hexutil.Uint, error) {
+	block, err := blockByNumber(ctx, s.b, blockNr)
+	if block != nil {
 		n := hexutil.Uint(len(block.Transactions()))
-		return &n
+		return &n, nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetBlockTransactionCountByHash returns the number of transactions in the block with the given hash.
-func (s *PublicTransactionPoolAPI) GetBlockTransactionCountByHash(ctx context.Context, blockHash common.Hash) *hexutil.Uint {
-	if block, _ := s.b.BlockByHash(ctx, blockHash); block != nil {
+func (s *PublicTransactionPoolAPI) GetBlockTransactionCountByHash(ctx context.Context, blockHash common.Hash) (*hexutil.Uint, error) {
+	block, err := blockByHash(ctx, s.b, blockHash)
+	if block != nil {
 		n := hexutil.Uint(len(block.Transactions()))
-		return &n
+		return &n, nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetTransactionByBlockNumberAndIndex returns the transaction for the given block number and index.
-func (s *PublicTransactionPoolAPI) GetTransactionByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) *RPCTransaction {
-	if block, _ := s.b.BlockByNumber(ctx, blockNr); block != nil {
-		return newRPCTransactionFromBlockIndex(block, uint64(index))
+func (s *PublicTransactionPoolAPI) GetTransactionByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (*RPCTransaction, error) {
+	block, err := blockByNumber(ctx, s.b, blockNr)
+	if block != nil {
+		return newRPCTransactionFromBlockIndex(block, uint64(index)), nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetTransactionByBlockHashAndIndex returns the transaction for the given block hash and index.
-func (s *PublicTransactionPoolAPI) GetTransactionByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index hexutil.Uint) *RPCTransaction {
-	if block, _ := s.b.BlockByHash(ctx, blockHash); block != nil {
-		return newRPCTransactionFromBlockIndex(block, uint64(index))
+func (s *PublicTransactionPoolAPI) GetTransactionByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index hexutil.Uint) (*RPCTransaction, error) {
+	block, err := blockByHash(ctx, s.b, blockHash)
+	if block != nil {
+		return newRPCTransactionFromBlockIndex(block, uint64(index)), nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetRawTransactionByBlockNumberAndIndex returns the bytes of the transaction for the given block number and index.
-func (s *PublicTransactionPoolAPI) GetRawTransactionByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) hexutil.Bytes {
-	if block, _ := s.b.BlockByNumber(ctx, blockNr); block != nil {
-		return newRPCRawTransactionFromBlockIndex(block, uint64(index))
+func (s *PublicTransactionPoolAPI) GetRawTransactionByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (hexutil.Bytes, error) {
+	block, err := blockByNumber(ctx, s.b, blockNr)
+	if block != nil {
+		return newRPCRawTransactionFromBlockIndex(block, uint64(index)), nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetRawTransactionByBlockHashAndIndex returns the bytes of the transaction for the given block hash and index.
-func (s *PublicTransactionPoolAPI) GetRawTransactionByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index hexutil.Uint) hexutil.Bytes {
-	if block, _ := s.b.BlockByHash(ctx, blockHash); block != nil {
-		return newRPCRawTransactionFromBlockIndex(block, uint64(index))
+func (s *PublicTransactionPoolAPI) GetRawTransactionByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index hexutil.Uint) (hexutil.Bytes, error) {
+	block, err := blockByHash(ctx, s.b, blockHash)
+	if block != nil {
+		return newRPCRawTransactionFromBlockIndex(block, uint64(index)), nil
 	}
-	return nil
+	return nil, err
 }
 
 // GetTransactionCount returns the number of transactions the given address has sent for the given block number
@@ -1380,9 +1995,17 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
 		return newRPCPendingTransaction(tx), nil
 	}
+	// Transaction unknown or its block pruned, return as such
+	return nil, checkTxHistoryPruned(s.b, hash)
+}
 
-	// Transaction unknown, return as such
-	return nil, nil
+// checkTxHistoryPruned returns a prunedHistoryError if the given transaction is
+// indexed, but the body of its block was pruned from the ancient store.
+func checkTxHistoryPruned(b Backend, hash common.Hash) error {
+	if number := rawdb.ReadTxLookupEntry(b.ChainDb(), hash); number != nil {
+		return checkHistoryPruned(b, *number)
+	}
+	return nil
 }
 
 // GetRawTransactionByHash returns the bytes of the transaction for the given hash.
@@ -1395,11 +2018,11 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 	if tx == nil {
 		if tx = s.b.GetPoolTransaction(hash); tx == nil {
 			// Transaction not found anywhere, abort
-			return nil, nil
+			return nil, checkTxHistoryPruned(s.b, hash)
 		}
 	}
-	// Serialize to RLP and return
-	return rlp.EncodeToBytes(tx)
+	// Serialize to its canonical encoding and return
+	return tx.MarshalBinary()
 }
 
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
@@ -1408,18 +2031,21 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if err != nil {
 		return nil, nil
 	}
+	if tx == nil {
+		return nil, checkTxHistoryPruned(s.b, hash)
+	}
 	receipts, err := s.b.GetReceipts(ctx, blockHash)
 	if err != nil {
 		return nil, err
 	}
 	if len(receipts) <= int(index) {
-		return nil, nil
+		return nil, checkHistoryPruned(s.b, blockNumber)
 	}
 	receipt := receipts[index]
 
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId())
+		signer = types.LatestSignerForChainID(tx.ChainId())
 	}
 	from, _ := types.Sender(signer, tx)
 
@@ -1435,6 +2061,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"contractAddress":   nil,
 		"logs":              receipt.Logs,
 		"logsBloom":         receipt.Bloom,
+		"type":              hexutil.Uint(tx.Type()),
 	}
 
 	// Assign receipt status or post state.
@@ -1478,6 +2105,10 @@ type SendTxArgs struct {
 	// newer name and should be preferred by clients.
 	Data  *hexutil.Bytes `json:"data"`
 	Input *hexutil.Bytes `json:"input"`
+
+	// For non-legacy transactions
+	AccessList *types.AccessList `json:"accessList,omitempty"`
+	ChainID    *hexutil.Big      `json:"chainId,omitempty"`
 }
 
 // setDefaults is a helper function that fills in default values for unspecified tx fields.
@@ -1514,6 +2145,10 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 			return errors.New(`contract creation without any data provided`)
 		}
 	}
+	// Default the chain id of access list transactions to the local one.
+	if args.AccessList != nil && args.ChainID == nil {
+		args.ChainID = (*hexutil.Big)(b.ChainConfig().ChainID)
+	}
 	// Estimate the gas usage if necessary.
 	if args.Gas == nil {
 		// For backwards-compatibility reason, we try both input and data
@@ -1523,11 +2158,12 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 			input = args.Data
 		}
 		callArgs := CallArgs{
-			From:     &args.From, // From shouldn't be nil
-			To:       args.To,
-			GasPrice: args.GasPrice,
-			Value:    args.Value,
-			Data:     input,
+			From:       &args.From, // From shouldn't be nil
+			To:         args.To,
+			GasPrice:   args.GasPrice,
+			Value:      args.Value,
+			Data:       input,
+			AccessList: args.AccessList,
 		}
 		pendingBlockNr := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
 		estimated, err := DoEstimateGas(ctx, b, callArgs, pendingBlockNr, b.RPCGasCap())
@@ -1547,10 +2183,29 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 	} else if args.Data != nil {
 		input = *args.Data
 	}
-	if args.To == nil {
-		return types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), uint64(*args.Gas), (*big.Int)(args.GasPrice), input)
+	var data types.TxData
+	if args.AccessList == nil {
+		data = &types.LegacyTx{
+			To:       args.To,
+			Nonce:    uint64(*args.Nonce),
+			Gas:      uint64(*args.Gas),
+			GasPrice: (*big.Int)(args.GasPrice),
+			Value:    (*big.Int)(args.Value),
+			Data:     input,
+		}
+	} else {
+		data = &types.AccessListTx{
+			To:         args.To,
+			ChainID:    (*big.Int)(args.ChainID),
+			Nonce:      uint64(*args.Nonce),
+			Gas:        uint64(*args.Gas),
+			GasPrice:   (*big.Int)(args.GasPrice),
+			Value:      (*big.Int)(args.Value),
+			Data:       input,
+			AccessList: *args.AccessList,
+		}
 	}
-	return types.NewTransaction(uint64(*args.Nonce), *args.To, (*big.Int)(args.Value), uint64(*args.Gas), (*big.Int)(args.GasPrice), input)
+	return types.NewTx(data)
 }
 
 // SubmitTransaction is a helper function that submits tx to txPool and logs a message.
@@ -1618,7 +2273,7 @@ func (s *PublicTransactionPoolAPI) FillTransaction(ctx context.Context, args Sen
 	}
 	// Assemble the transaction and obtain rlp
 	tx := args.toTransaction()
-	data, err := rlp.EncodeToBytes(tx)
+	data, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -1629,12 +2284,33 @@ func (s *PublicTransactionPoolAPI) FillTransaction(ctx context.Context, args Sen
 // The sender is responsible for signing the transaction and using the correct nonce.
 func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
 	tx := new(types.Transaction)
-	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+	if err := tx.UnmarshalBinary(encodedTx); err != nil {
 		return common.Hash{}, err
 	}
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// SendPrivateRawTransaction will add the signed transaction to the local transaction
+// pool without announcing it to the network, leaving it to be included by the local
+// miner only. If it isn't included within the pool's configured number of blocks,
+// the transaction is either dropped or broadcast publicly.
+func (s *PublicTransactionPoolAPI) SendPrivateRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(encodedTx); err != nil {
+		return common.Hash{}, err
+	}
+	// If the transaction fee cap is already specified, ensure the
+	// fee of the given transaction is _reasonable_.
+	if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.b.SendPrivateTx(ctx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted private transaction", "fullhash", tx.Hash().Hex(), "recipient", tx.To())
+	return tx.Hash(), nil
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
@@ -1690,7 +2366,7 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 	if err != nil {
 		return nil, err
 	}
-	data, err := rlp.EncodeToBytes(tx)
+	data, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -1714,7 +2390,7 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() ([]*RPCTransaction, err
 	for _, tx := range pending {
 		var signer types.Signer = types.HomesteadSigner{}
 		if tx.Protected() {
-			signer = types.NewEIP155Signer(tx.ChainId())
+			signer = types.LatestSignerForChainID(tx.ChainId())
 		}
 		from, _ := types.Sender(signer, tx)
 		if _, exists := accounts[from]; exists {
@@ -1755,7 +2431,7 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, sendArgs SendTxAr
 	for _, p := range pending {
 		var signer types.Signer = types.HomesteadSigner{}
 		if p.Protected() {
-			signer = types.NewEIP155Signer(p.ChainId())
+			signer = types.LatestSignerForChainID(p.ChainId())
 		}
 		wantSigHash := signer.Hash(matchTx)
 
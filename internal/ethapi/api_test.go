@@ -0,0 +1,1046 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBackend is a Backend implementation backed by an in-memory blockchain,
+// serving only the methods exercised by the tests.
+type testBackend struct {
+	db    ethdb.Database
+	chain *core.BlockChain
+	pool  *core.TxPool
+}
+
+// newTestBackend creates a chain with the given genesis allocation, extends it
+// with n blocks produced by the generator and returns an API backend on top.
+func newTestBackend(t *testing.T, n int, alloc core.GenesisAlloc, generator func(i int, b *core.BlockGen)) *testBackend {
+	var (
+		engine = ethash.NewFaker()
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc}
+	)
+	genesis := gspec.MustCommit(db)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, n, generator)
+
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieDirtyDisabled: true}, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	return &testBackend{db: db, chain: chain}
+}
+
+// newTxPoolTestBackend creates a chain with the given genesis allocation and an
+// empty transaction pool on top, returning an API backend serving both.
+func newTxPoolTestBackend(t *testing.T, alloc core.GenesisAlloc) *testBackend {
+	backend := newTestBackend(t, 0, alloc, func(i int, b *core.BlockGen) {})
+
+	config := core.DefaultTxPoolConfig
+	config.Journal = ""
+
+	backend.pool = core.NewTxPool(config, backend.chain.Config(), backend.chain)
+	t.Cleanup(backend.pool.Stop)
+
+	return backend
+}
+
+// newPrunedTestBackend creates a chain with the given genesis allocation and n
+// blocks produced by the generator, imports it straight into the ancient store
+// and prunes the bodies and receipts below tail, as a node configured with a
+// history tail would do on startup.
+func newPrunedTestBackend(t *testing.T, n int, tail uint64, alloc core.GenesisAlloc, generator func(i int, b *core.BlockGen)) *testBackend {
+	var (
+		engine = ethash.NewFaker()
+		gspec  = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc}
+		gendb  = rawdb.NewMemoryDatabase()
+	)
+	blocks, receipts := core.GenerateChain(gspec.Config, gspec.MustCommit(gendb), engine, gendb, n, generator)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	gspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, uint64(len(blocks))); err != nil {
+		t.Fatalf("failed to insert receipt %d: %v", n, err)
+	}
+	chain.Stop()
+
+	if err := db.PruneAncients(tail); err != nil {
+		t.Fatalf("failed to prune ancients: %v", err)
+	}
+	if chain, err = core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil); err != nil {
+		t.Fatalf("failed to reopen blockchain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	return &testBackend{db: db, chain: chain}
+}
+
+func (b *testBackend) Downloader() *downloader.Downloader             { return nil }
+func (b *testBackend) ProtocolVersion() int                           { return 0 }
+func (b *testBackend) SuggestPrice(context.Context) (*big.Int, error) { return big.NewInt(1), nil }
+func (b *testBackend) ChainDb() ethdb.Database                        { return b.db }
+func (b *testBackend) AccountManager() *accounts.Manager              { return nil }
+func (b *testBackend) ExtRPCEnabled() bool                            { return false }
+func (b *testBackend) RPCGasCap() uint64                              { return 25000000 }
+func (b *testBackend) RPCTxFeeCap() float64                           { return 1 }
+
+func (b *testBackend) SetHead(number uint64) { b.chain.SetHead(number) }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return b.chain.CurrentHeader(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *testBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
+	if number, ok := blockNrOrHash.Number(); ok {
+		return b.HeaderByNumber(ctx, number)
+	}
+	hash, _ := blockNrOrHash.Hash()
+	return b.HeaderByHash(ctx, hash)
+}
+
+func (b *testBackend) CurrentHeader() *types.Header { return b.chain.CurrentHeader() }
+func (b *testBackend) CurrentBlock() *types.Block   { return b.chain.CurrentBlock() }
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return b.chain.CurrentBlock(), nil
+	}
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+
+func (b *testBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
+	if number, ok := blockNrOrHash.Number(); ok {
+		return b.BlockByNumber(ctx, number)
+	}
+	hash, _ := blockNrOrHash.Hash()
+	return b.BlockByHash(ctx, hash)
+}
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header, _ := b.HeaderByNumber(ctx, number)
+	if header == nil {
+		return nil, nil, errors.New("header not found")
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *testBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	header, _ := b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if header == nil {
+		return nil, nil, errors.New("header not found")
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
+func (b *testBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
+	return b.chain.GetTdByHash(hash)
+}
+
+func (b *testBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, blockCtx *vm.BlockContext) (*vm.EVM, func() error, error) {
+	context := core.NewEVMBlockContext(header, b.chain, nil)
+	if blockCtx != nil {
+		context = *blockCtx
+	}
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.chain.Config(), vm.Config{}), func() error { return nil }, nil
+}
+
+func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return b.chain.SubscribeChainEvent(ch)
+}
+
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.chain.SubscribeChainHeadEvent(ch)
+}
+
+func (b *testBackend) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription {
+	return b.chain.SubscribeChainSideEvent(ch)
+}
+
+func (b *testBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
+	return errors.New("not supported")
+}
+
+func (b *testBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction) error {
+	return errors.New("not supported")
+}
+
+func (b *testBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(b.db, txHash)
+	return tx, blockHash, blockNumber, index, nil
+}
+
+func (b *testBackend) GetPoolTransactions() (types.Transactions, error)         { return nil, nil }
+func (b *testBackend) GetPoolTransaction(txHash common.Hash) *types.Transaction { return nil }
+
+func (b *testBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return 0, nil
+}
+
+func (b *testBackend) Stats() (pending int, queued int) { return 0, 0 }
+
+func (b *testBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	return b.pool.Content()
+}
+
+func (b *testBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	return b.pool.ContentFrom(addr)
+}
+
+func (b *testBackend) IsPrivateTx(hash common.Hash) bool {
+	return b.pool.IsPrivate(hash)
+}
+
+func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.pool.SubscribeNewTxsEvent(ch)
+}
+
+func (b *testBackend) BloomStatus() (uint64, uint64) { return 0, 0 }
+
+func (b *testBackend) GetLogs(ctx context.Context, blockHash common.Hash) ([][]*types.Log, error) {
+	return nil, nil
+}
+
+func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {}
+
+func (b *testBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return b.chain.SubscribeLogsEvent(ch)
+}
+
+func (b *testBackend) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return nil
+}
+
+func (b *testBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
+	return b.chain.SubscribeRemovedLogsEvent(ch)
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig { return b.chain.Config() }
+func (b *testBackend) Engine() consensus.Engine         { return b.chain.Engine() }
+
+var (
+	// storageCode returns the storage slots 0 and 1 of the called contract.
+	storageCode = common.FromHex("0x60005460005260015460205260406000f3")
+
+	// balanceCode returns the balance of the caller.
+	balanceCode = common.FromHex("0x333160005260206000f3")
+
+	// blockCode returns the number, timestamp, coinbase, difficulty and gas
+	// limit of the block being executed in.
+	blockCode = common.FromHex("0x436000524260205241604052446060524560805260a06000f3")
+)
+
+func newUint64(v uint64) *hexutil.Uint64 { return (*hexutil.Uint64)(&v) }
+
+func newBalance(v int64) **hexutil.Big {
+	b := (*hexutil.Big)(big.NewInt(v))
+	return &b
+}
+
+func TestStateOverrideApply(t *testing.T) {
+	var (
+		addr   = common.Address{0x01}
+		other  = common.Address{0x02}
+		slot0  = common.Hash{0x00}
+		slot1  = common.Hash{0x01}
+		code   = []byte{0x60, 0x00}
+		newVal = common.Hash{0xff}
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetState(addr, slot1, common.Hash{0x11})
+	statedb.SetState(other, slot1, common.Hash{0x11})
+
+	code2 := hexutil.Bytes(code)
+	override := StateOverride{
+		addr: OverrideAccount{
+			Nonce:   newUint64(7),
+			Code:    &code2,
+			Balance: newBalance(1000),
+			State:   &map[common.Hash]common.Hash{slot0: newVal},
+		},
+		other: OverrideAccount{
+			StateDiff: &map[common.Hash]common.Hash{slot0: newVal},
+		},
+	}
+	if err := override.Apply(statedb); err != nil {
+		t.Fatalf("failed to apply override: %v", err)
+	}
+	if nonce := statedb.GetNonce(addr); nonce != 7 {
+		t.Errorf("nonce mismatch: have %d, want 7", nonce)
+	}
+	if have := statedb.GetCode(addr); !bytes.Equal(have, code) {
+		t.Errorf("code mismatch: have %x, want %x", have, code)
+	}
+	if balance := statedb.GetBalance(addr); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 1000", balance)
+	}
+	// A full state override drops all other slots, a diff retains them
+	if have := statedb.GetState(addr, slot0); have != newVal {
+		t.Errorf("overridden slot mismatch: have %x, want %x", have, newVal)
+	}
+	if have := statedb.GetState(addr, slot1); have != (common.Hash{}) {
+		t.Errorf("replaced state retained slot: have %x", have)
+	}
+	if have := statedb.GetState(other, slot0); have != newVal {
+		t.Errorf("diffed slot mismatch: have %x, want %x", have, newVal)
+	}
+	if have := statedb.GetState(other, slot1); have != (common.Hash{0x11}) {
+		t.Errorf("diffed state lost slot: have %x", have)
+	}
+	// Specifying both a state and a diff for the same account is rejected
+	conflict := StateOverride{
+		addr: OverrideAccount{
+			State:     &map[common.Hash]common.Hash{},
+			StateDiff: &map[common.Hash]common.Hash{},
+		},
+	}
+	if err := conflict.Apply(statedb); err == nil {
+		t.Error("conflicting state and stateDiff accepted")
+	}
+	// A nil override is a noop
+	var nilOverride *StateOverride
+	if err := nilOverride.Apply(statedb); err != nil {
+		t.Errorf("nil override failed: %v", err)
+	}
+}
+
+func TestCallStateOverrides(t *testing.T) {
+	var (
+		contract = common.Address{0xc0}
+		empty    = common.Address{0xc1}
+		caller   = common.Address{0xca}
+	)
+	backend := newTestBackend(t, 1, core.GenesisAlloc{
+		contract: {
+			Balance: big.NewInt(0),
+			Code:    storageCode,
+			Storage: map[common.Hash]common.Hash{common.HexToHash("0x00"): {0x01}, common.HexToHash("0x01"): {0x02}},
+		},
+	}, nil)
+	api := NewPublicBlockChainAPI(backend)
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+
+	code := hexutil.Bytes(balanceCode)
+	tests := []struct {
+		to        common.Address
+		overrides StateOverride
+		want      []byte
+		fail      bool
+	}{
+		// No override, the genesis storage is returned
+		{
+			to:   contract,
+			want: append(common.Hash{0x01}.Bytes(), common.Hash{0x02}.Bytes()...),
+		},
+		// State diff overrides a single slot and retains the rest
+		{
+			to: contract,
+			overrides: StateOverride{contract: OverrideAccount{
+				StateDiff: &map[common.Hash]common.Hash{{0x00}: {0x05}},
+			}},
+			want: append(common.Hash{0x05}.Bytes(), common.Hash{0x02}.Bytes()...),
+		},
+		// Full state override drops every slot not specified
+		{
+			to: contract,
+			overrides: StateOverride{contract: OverrideAccount{
+				State: &map[common.Hash]common.Hash{{0x00}: {0x05}},
+			}},
+			want: append(common.Hash{0x05}.Bytes(), common.Hash{}.Bytes()...),
+		},
+		// Code and balance overrides on accounts not present in the state
+		{
+			to: empty,
+			overrides: StateOverride{
+				empty:  OverrideAccount{Code: &code},
+				caller: OverrideAccount{Balance: newBalance(0x1234)},
+			},
+			want: common.BigToHash(big.NewInt(0x1234)).Bytes(),
+		},
+		// State and state diff can't be specified together
+		{
+			to: contract,
+			overrides: StateOverride{contract: OverrideAccount{
+				State:     &map[common.Hash]common.Hash{},
+				StateDiff: &map[common.Hash]common.Hash{},
+			}},
+			fail: true,
+		},
+	}
+	for i, tt := range tests {
+		to := tt.to
+		overrides := tt.overrides
+		res, err := api.Call(context.Background(), CallArgs{From: &caller, To: &to}, latest, &overrides, nil)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: call failed: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(res, tt.want) {
+			t.Errorf("test %d: result mismatch: have %x, want %x", i, []byte(res), tt.want)
+		}
+	}
+}
+
+func TestCallBlockOverrides(t *testing.T) {
+	contract := common.Address{0xc0}
+	backend := newTestBackend(t, 2, core.GenesisAlloc{
+		contract: {Balance: big.NewInt(0), Code: blockCode},
+	}, nil)
+	api := NewPublicBlockChainAPI(backend)
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+
+	// Without overrides the context of the requested block is used
+	head := backend.CurrentHeader()
+	res, err := api.Call(context.Background(), CallArgs{To: &contract}, latest, nil, nil)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	want := blockContextWords(head.Number, new(big.Int).SetUint64(head.Time), head.Coinbase, head.Difficulty, head.GasLimit)
+	if !bytes.Equal(res, want) {
+		t.Fatalf("block context mismatch: have %x, want %x", []byte(res), want)
+	}
+	// With overrides every field should be replaced
+	var (
+		number     = big.NewInt(1000)
+		timestamp  = big.NewInt(2000)
+		coinbase   = common.Address{0xcb}
+		difficulty = big.NewInt(3000)
+		gasLimit   = uint64(4000000)
+	)
+	overrides := &BlockOverrides{
+		Number:     (*hexutil.Big)(number),
+		Time:       (*hexutil.Big)(timestamp),
+		Coinbase:   &coinbase,
+		Difficulty: (*hexutil.Big)(difficulty),
+		GasLimit:   newUint64(gasLimit),
+	}
+	res, err = api.Call(context.Background(), CallArgs{To: &contract}, latest, nil, overrides)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	want = blockContextWords(number, timestamp, coinbase, difficulty, gasLimit)
+	if !bytes.Equal(res, want) {
+		t.Fatalf("overridden block context mismatch: have %x, want %x", []byte(res), want)
+	}
+}
+
+// blockContextWords assembles the expected output of blockCode.
+func blockContextWords(number, time *big.Int, coinbase common.Address, difficulty *big.Int, gasLimit uint64) []byte {
+	var out []byte
+	out = append(out, common.BigToHash(number).Bytes()...)
+	out = append(out, common.BigToHash(time).Bytes()...)
+	out = append(out, common.BytesToHash(coinbase.Bytes()).Bytes()...)
+	out = append(out, common.BigToHash(difficulty).Bytes()...)
+	out = append(out, common.BigToHash(new(big.Int).SetUint64(gasLimit)).Bytes()...)
+	return out
+}
+
+func TestCallMany(t *testing.T) {
+	var (
+		counter  = common.Address{0xc0}
+		reverter = common.Address{0xc1}
+
+		// Increments storage slot 0 and returns the new value
+		counterCode = common.FromHex("0x6000546001018060005560005260206000f3")
+	)
+	// Reverts with the reason "boom", copying the abi encoded error from the
+	// tail of its own code
+	reason := common.FromHex("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"626f6f6d00000000000000000000000000000000000000000000000000000000")
+	reverterCode := append(common.FromHex("0x6064600c60003960646000fd"), reason...)
+
+	backend := newTestBackend(t, 1, core.GenesisAlloc{
+		counter:  {Balance: big.NewInt(0), Code: counterCode},
+		reverter: {Balance: big.NewInt(0), Code: reverterCode},
+	}, nil)
+	api := NewPublicBlockChainAPI(backend)
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+
+	calls := []CallArgs{{To: &counter}, {To: &counter}, {To: &reverter}, {To: &counter}}
+	results, err := api.CallMany(context.Background(), calls, latest, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to execute calls: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	// Every counter call should see the increments of the previous ones, the
+	// revert in between reported on its own without affecting the others
+	for i, want := range map[int]int64{0: 1, 1: 2, 3: 3} {
+		if results[i].Error != "" {
+			t.Errorf("call %d: unexpected error: %v", i, results[i].Error)
+		}
+		if have := new(big.Int).SetBytes(results[i].ReturnValue); have.Int64() != want {
+			t.Errorf("call %d: counter mismatch: have %v, want %d", i, have, want)
+		}
+	}
+	if results[2].Error != vm.ErrExecutionReverted.Error() {
+		t.Errorf("revert error mismatch: have %q, want %q", results[2].Error, vm.ErrExecutionReverted)
+	}
+	if results[2].RevertReason != "boom" {
+		t.Errorf("revert reason mismatch: have %q, want %q", results[2].RevertReason, "boom")
+	}
+	if !bytes.Equal(results[2].ReturnValue, reason) {
+		t.Errorf("revert data mismatch: have %x, want %x", []byte(results[2].ReturnValue), reason)
+	}
+	// The calls should not have modified the state of the chain
+	statedb, _ := backend.chain.State()
+	if value := statedb.GetState(counter, common.Hash{}); value != (common.Hash{}) {
+		t.Errorf("chain state modified: have %x", value)
+	}
+	// A batch exceeding its deadline should be aborted as a whole
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := api.CallMany(ctx, calls, latest, nil, nil); err == nil {
+		t.Error("cancelled batch succeeded")
+	}
+}
+
+func TestCreateAccessList(t *testing.T) {
+	var (
+		reader   = common.Address{0xc0}
+		diverger = common.Address{0xc1}
+		caller   = common.Address{0xca}
+	)
+	backend := newTestBackend(t, 1, core.GenesisAlloc{
+		caller: {Balance: big.NewInt(params.Ether)},
+		// Reads storage slot 1
+		reader: {Balance: big.NewInt(0), Code: common.FromHex("0x60015400")},
+		// Reads the storage slot at the remaining gas, which depends on the
+		// intrinsic gas of the access list itself
+		diverger: {Balance: big.NewInt(0), Code: common.FromHex("0x5a5400")},
+	}, nil)
+	api := NewPublicBlockChainAPI(backend)
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	gas := hexutil.Uint64(100000)
+
+	// A stable access list should be created with the slot read
+	res, err := api.CreateAccessList(context.Background(), CallArgs{From: &caller, To: &reader, Gas: &gas}, &latest)
+	if err != nil {
+		t.Fatalf("failed to create access list: %v", err)
+	}
+	want := types.AccessList{{Address: reader, StorageKeys: []common.Hash{common.HexToHash("0x01")}}}
+	if len(*res.Accesslist) != 1 || (*res.Accesslist)[0].Address != want[0].Address ||
+		len((*res.Accesslist)[0].StorageKeys) != 1 || (*res.Accesslist)[0].StorageKeys[0] != want[0].StorageKeys[0] {
+		t.Fatalf("access list mismatch: have %v, want %v", *res.Accesslist, want)
+	}
+	// An access list that never stabilises should be rejected
+	if _, err := api.CreateAccessList(context.Background(), CallArgs{From: &caller, To: &diverger, Gas: &gas}, &latest); err == nil {
+		t.Error("diverging access list created")
+	}
+	// A cancelled request should return the context error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := AccessList(ctx, backend, CallArgs{From: &caller, To: &reader, Gas: &gas}, latest, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled request error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	// A request running out of its time allowance should be aborted
+	if _, _, err := AccessList(context.Background(), backend, CallArgs{From: &caller, To: &reader, Gas: &gas}, latest, time.Nanosecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timed out request error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// Tests that the created access lists are sorted by address and storage slot,
+// irrelevant of the order they were accessed in.
+func TestCreateAccessListOrdering(t *testing.T) {
+	var (
+		toucher = common.Address{0xc0}
+		caller  = common.Address{0xca}
+	)
+	backend := newTestBackend(t, 1, core.GenesisAlloc{
+		caller: {Balance: big.NewInt(params.Ether)},
+		// Reads storage slots 5, 3, 9 and 1, then the balances of 0xbb, 0xaa and 0xcc
+		toucher: {Balance: big.NewInt(0), Code: common.FromHex("0x" +
+			"6005545060035450600954506001545060bb315060aa315060cc315000")},
+	}, nil)
+	api := NewPublicBlockChainAPI(backend)
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	gas := hexutil.Uint64(100000)
+
+	want := types.AccessList{
+		{Address: common.BytesToAddress([]byte{0xaa}), StorageKeys: []common.Hash{}},
+		{Address: common.BytesToAddress([]byte{0xbb}), StorageKeys: []common.Hash{}},
+		{Address: common.BytesToAddress([]byte{0xcc}), StorageKeys: []common.Hash{}},
+		{Address: toucher, StorageKeys: []common.Hash{
+			common.HexToHash("0x01"), common.HexToHash("0x03"), common.HexToHash("0x05"), common.HexToHash("0x09"),
+		}},
+	}
+	for i := 0; i < 10; i++ {
+		res, err := api.CreateAccessList(context.Background(), CallArgs{From: &caller, To: &toucher, Gas: &gas}, &latest)
+		if err != nil {
+			t.Fatalf("run %d: failed to create access list: %v", i, err)
+		}
+		if !reflect.DeepEqual(*res.Accesslist, want) {
+			t.Fatalf("run %d: access list mismatch: have %v, want %v", i, *res.Accesslist, want)
+		}
+	}
+}
+
+func TestPrunedHistory(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.HomesteadSigner{}
+		tail   = uint64(4)
+	)
+	// Every block but the genesis contains a single transfer, the nth block the
+	// one with nonce n-1
+	transfer := func(nonce uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{0xaa}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		return tx
+	}
+	backend := newPrunedTestBackend(t, 8, tail, core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}}, func(i int, b *core.BlockGen) {
+		b.AddTx(transfer(b.TxNonce(sender)))
+	})
+	var (
+		ctx     = context.Background()
+		chain   = NewPublicBlockChainAPI(backend)
+		txs     = NewPublicTransactionPoolAPI(backend, nil)
+		pruned  = backend.chain.GetHeaderByNumber(tail - 1)
+		present = backend.chain.GetHeaderByNumber(tail)
+	)
+	// checkPruned ensures that the error is a pruned history error for the block
+	// below the history tail.
+	checkPruned := func(method string, err error) {
+		t.Helper()
+
+		var perr *prunedHistoryError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: error mismatch: have %v, want pruned history", method, err)
+			return
+		}
+		if perr.number != pruned.Number.Uint64() {
+			t.Errorf("%s: pruned block mismatch: have %d, want %d", method, perr.number, pruned.Number)
+		}
+		if code := perr.ErrorCode(); code != 4444 {
+			t.Errorf("%s: error code mismatch: have %d, want %d", method, code, 4444)
+		}
+	}
+	number, hash := rpc.BlockNumber(pruned.Number.Int64()), pruned.Hash()
+
+	_, err := chain.GetBlockByNumber(ctx, number, true)
+	checkPruned("GetBlockByNumber", err)
+	_, err = chain.GetBlockByHash(ctx, hash, true)
+	checkPruned("GetBlockByHash", err)
+	_, err = chain.GetUncleCountByBlockNumber(ctx, number)
+	checkPruned("GetUncleCountByBlockNumber", err)
+	_, err = chain.GetUncleByBlockHashAndIndex(ctx, hash, 0)
+	checkPruned("GetUncleByBlockHashAndIndex", err)
+	_, err = txs.GetBlockTransactionCountByNumber(ctx, number)
+	checkPruned("GetBlockTransactionCountByNumber", err)
+	_, err = txs.GetTransactionByBlockHashAndIndex(ctx, hash, 0)
+	checkPruned("GetTransactionByBlockHashAndIndex", err)
+	_, err = txs.GetRawTransactionByBlockNumberAndIndex(ctx, number, 0)
+	checkPruned("GetRawTransactionByBlockNumberAndIndex", err)
+
+	prunedTx := transfer(tail - 2).Hash()
+	_, err = txs.GetTransactionByHash(ctx, prunedTx)
+	checkPruned("GetTransactionByHash", err)
+	_, err = txs.GetRawTransactionByHash(ctx, prunedTx)
+	checkPruned("GetRawTransactionByHash", err)
+	_, err = txs.GetTransactionReceipt(ctx, prunedTx)
+	checkPruned("GetTransactionReceipt", err)
+
+	// Blocks at and above the tail should be served as before
+	if block, err := chain.GetBlockByNumber(ctx, rpc.BlockNumber(present.Number.Int64()), true); err != nil || block == nil {
+		t.Fatalf("failed to retrieve block above the tail: %v", err)
+	}
+	if count, err := txs.GetBlockTransactionCountByHash(ctx, present.Hash()); err != nil || count == nil || *count != 1 {
+		t.Fatalf("transaction count mismatch above the tail: have %v, %v", count, err)
+	}
+	if receipt, err := txs.GetTransactionReceipt(ctx, transfer(tail-1).Hash()); err != nil || receipt == nil {
+		t.Fatalf("failed to retrieve receipt above the tail: %v", err)
+	}
+	// Unknown blocks and transactions should still be reported as missing
+	if tx, err := txs.GetTransactionByHash(ctx, common.Hash{0xff}); tx != nil || err != nil {
+		t.Fatalf("unknown transaction mismatch: have %v, %v", tx, err)
+	}
+	if block, err := chain.GetBlockByHash(ctx, common.Hash{0xff}, true); block != nil || err != nil {
+		t.Fatalf("unknown block mismatch: have %v, %v", block, err)
+	}
+	if block, err := chain.GetBlockByNumber(ctx, 100, true); block != nil || err != nil {
+		t.Fatalf("future block mismatch: have %v, %v", block, err)
+	}
+}
+
+// txPoolTester is a transaction pool populated with a fixed set of pending and
+// queued transactions from three senders, ordered by address.
+type txPoolTester struct {
+	backend *testBackend
+	keys    []*ecdsa.PrivateKey // Sender keys, sorted by address
+	senders []common.Address    // Sender addresses, sorted
+	r1, r2  common.Address      // Recipients of the transactions
+
+	// Transactions in pool order: pending [a0 a1 a2 b0 b1], queued [b3 c1]
+	a0, a1, a2, b0, b1, b3, c1 *types.Transaction
+}
+
+func newTxPoolTester(t *testing.T) *txPoolTester {
+	tester := &txPoolTester{r1: common.Address{0x01}, r2: common.Address{0x02}}
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		tester.keys = append(tester.keys, key)
+	}
+	sort.Slice(tester.keys, func(i, j int) bool {
+		ai, aj := crypto.PubkeyToAddress(tester.keys[i].PublicKey), crypto.PubkeyToAddress(tester.keys[j].PublicKey)
+		return bytes.Compare(ai[:], aj[:]) < 0
+	})
+	alloc := make(core.GenesisAlloc)
+	for _, key := range tester.keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		tester.senders = append(tester.senders, addr)
+		alloc[addr] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	tester.backend = newTxPoolTestBackend(t, alloc)
+
+	tester.a0 = tester.sign(0, 0, &tester.r1, 1)
+	tester.a1 = tester.sign(0, 1, &tester.r1, 2)
+	tester.a2 = tester.sign(0, 2, &tester.r1, 3)
+	tester.b0 = tester.sign(1, 0, &tester.r2, 5)
+	tester.b1 = tester.sign(1, 1, &tester.r2, 5)
+	tester.b3 = tester.sign(1, 3, &tester.r1, 5)
+	tester.c1 = tester.sign(2, 1, nil, 4)
+
+	return tester
+}
+
+// sign creates a transaction of the given sender, creating a contract if no
+// recipient is specified.
+func (tester *txPoolTester) sign(sender int, nonce uint64, to *common.Address, price int64) *types.Transaction {
+	var tx *types.Transaction
+	if to == nil {
+		tx = types.NewContractCreation(nonce, big.NewInt(0), 100000, big.NewInt(price), nil)
+	} else {
+		tx = types.NewTransaction(nonce, *to, big.NewInt(1), 100000, big.NewInt(price), nil)
+	}
+	tx, _ = types.SignTx(tx, types.LatestSigner(params.TestChainConfig), tester.keys[sender])
+	return tx
+}
+
+// fill adds all the transactions of the tester to its pool.
+func (tester *txPoolTester) fill(t *testing.T) {
+	txs := []*types.Transaction{tester.a0, tester.a1, tester.a2, tester.b0, tester.b1, tester.b3, tester.c1}
+	for i, err := range tester.backend.pool.AddRemotesSync(txs) {
+		if err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+}
+
+// Tests that the pool content of a single sender is returned, keyed by nonce.
+func TestTxPoolContentFrom(t *testing.T) {
+	tester := newTxPoolTester(t)
+	tester.fill(t)
+
+	api := NewPublicTxPoolAPI(tester.backend)
+	tests := []struct {
+		addr    common.Address
+		pending map[string]*types.Transaction
+		queued  map[string]*types.Transaction
+	}{
+		{tester.senders[0], map[string]*types.Transaction{"0": tester.a0, "1": tester.a1, "2": tester.a2}, map[string]*types.Transaction{}},
+		{tester.senders[1], map[string]*types.Transaction{"0": tester.b0, "1": tester.b1}, map[string]*types.Transaction{"3": tester.b3}},
+		{tester.senders[2], map[string]*types.Transaction{}, map[string]*types.Transaction{"1": tester.c1}},
+		{common.Address{0xff}, map[string]*types.Transaction{}, map[string]*types.Transaction{}},
+	}
+	for i, tt := range tests {
+		content := api.ContentFrom(tt.addr)
+		for status, want := range map[string]map[string]*types.Transaction{"pending": tt.pending, "queued": tt.queued} {
+			have := content[status]
+			if have == nil {
+				t.Errorf("test %d: missing %s section", i, status)
+				continue
+			}
+			if len(have) != len(want) {
+				t.Errorf("test %d: %s count mismatch: have %d, want %d", i, status, len(have), len(want))
+			}
+			for nonce, tx := range want {
+				if have[nonce] == nil || have[nonce].Hash != tx.Hash() {
+					t.Errorf("test %d: %s transaction %s mismatch: have %v, want %x", i, status, nonce, have[nonce], tx.Hash())
+				}
+			}
+		}
+	}
+}
+
+// Tests that pool queries filter by every field and paginate across the pending
+// and queued sections.
+func TestTxPoolQuery(t *testing.T) {
+	tester := newTxPoolTester(t)
+	tester.fill(t)
+
+	var (
+		api = NewPublicTxPoolAPI(tester.backend)
+
+		a, b = tester.senders[0], tester.senders[1]
+		all  = []*types.Transaction{tester.a0, tester.a1, tester.a2, tester.b0, tester.b1}
+	)
+	tests := []struct {
+		query   TxPoolQuery
+		pending []*types.Transaction
+		queued  []*types.Transaction
+		total   int
+	}{
+		// Filters on every field, separately and combined
+		{TxPoolQuery{}, all, []*types.Transaction{tester.b3, tester.c1}, 7},
+		{TxPoolQuery{Status: "pending"}, all, nil, 5},
+		{TxPoolQuery{Status: "queued"}, nil, []*types.Transaction{tester.b3, tester.c1}, 2},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{From: &b}}, []*types.Transaction{tester.b0, tester.b1}, []*types.Transaction{tester.b3}, 3},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{To: &tester.r1}}, []*types.Transaction{tester.a0, tester.a1, tester.a2}, []*types.Transaction{tester.b3}, 4},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{MinGasPrice: (*hexutil.Big)(big.NewInt(3))}}, []*types.Transaction{tester.a2, tester.b0, tester.b1}, []*types.Transaction{tester.b3, tester.c1}, 5},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{From: &a, MinGasPrice: (*hexutil.Big)(big.NewInt(2))}}, []*types.Transaction{tester.a1, tester.a2}, nil, 2},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{To: &tester.r1}, Status: "queued"}, nil, []*types.Transaction{tester.b3}, 1},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{From: &common.Address{0xff}}}, nil, nil, 0},
+
+		// Pagination within and across the pending and queued sections
+		{TxPoolQuery{Limit: 2}, []*types.Transaction{tester.a0, tester.a1}, nil, 7},
+		{TxPoolQuery{Offset: 4, Limit: 2}, []*types.Transaction{tester.b1}, []*types.Transaction{tester.b3}, 7},
+		{TxPoolQuery{Offset: 5, Limit: 1}, nil, []*types.Transaction{tester.b3}, 7},
+		{TxPoolQuery{Offset: 6, Limit: 5}, nil, []*types.Transaction{tester.c1}, 7},
+		{TxPoolQuery{Offset: 7}, nil, nil, 7},
+		{TxPoolQuery{Offset: 100}, nil, nil, 7},
+		{TxPoolQuery{TxPoolFilter: TxPoolFilter{From: &b}, Offset: 1, Limit: 1}, []*types.Transaction{tester.b1}, nil, 3},
+		{TxPoolQuery{Limit: maxTxPoolQueryLimit}, all, []*types.Transaction{tester.b3, tester.c1}, 7},
+	}
+	for i, tt := range tests {
+		result, err := api.Query(tt.query)
+		if err != nil {
+			t.Errorf("test %d: query failed: %v", i, err)
+			continue
+		}
+		if int(result.Total) != tt.total {
+			t.Errorf("test %d: total mismatch: have %d, want %d", i, result.Total, tt.total)
+		}
+		checkRPCTransactions(t, i, "pending", result.Pending, tt.pending)
+		checkRPCTransactions(t, i, "queued", result.Queued, tt.queued)
+	}
+	// Invalid queries should be rejected
+	if _, err := api.Query(TxPoolQuery{Status: "mined"}); err == nil {
+		t.Errorf("invalid status accepted")
+	}
+	if _, err := api.Query(TxPoolQuery{Limit: maxTxPoolQueryLimit + 1}); err == nil {
+		t.Errorf("limit above cap accepted")
+	}
+}
+
+// Tests that queries without a limit return pages of the default size.
+func TestTxPoolQueryDefaultLimit(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	backend := newTxPoolTestBackend(t, core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}})
+
+	txs := make([]*types.Transaction, defaultTxPoolQueryLimit+1)
+	for i := range txs {
+		txs[i], _ = types.SignTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), types.LatestSigner(params.TestChainConfig), key)
+	}
+	for i, err := range backend.pool.AddRemotesSync(txs) {
+		if err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	result, err := NewPublicTxPoolAPI(backend).Query(TxPoolQuery{})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if int(result.Total) != len(txs) {
+		t.Errorf("total mismatch: have %d, want %d", result.Total, len(txs))
+	}
+	checkRPCTransactions(t, 0, "pending", result.Pending, txs[:defaultTxPoolQueryLimit])
+}
+
+// checkRPCTransactions verifies that a list of returned transactions matches the
+// expected ones, in order.
+func checkRPCTransactions(t *testing.T, test int, section string, have []*RPCTransaction, want []*types.Transaction) {
+	t.Helper()
+
+	if have == nil {
+		t.Errorf("test %d: nil %s list", test, section)
+	}
+	if len(have) != len(want) {
+		t.Errorf("test %d: %s count mismatch: have %d, want %d", test, section, len(have), len(want))
+		return
+	}
+	for i, tx := range want {
+		if have[i].Hash != tx.Hash() {
+			t.Errorf("test %d: %s transaction %d mismatch: have %x, want %x", test, section, i, have[i].Hash, tx.Hash())
+		}
+	}
+}
+
+// Tests that the pending transaction subscription delivers the full transactions
+// matching its filter, but never the private ones.
+func TestTxPoolNewPendingTransactions(t *testing.T) {
+	tester := newTxPoolTester(t)
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("txpool", NewPublicTxPoolAPI(tester.backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var (
+		allCh    = make(chan *RPCTransaction, 16)
+		senderCh = make(chan *RPCTransaction, 16)
+		priceCh  = make(chan *RPCTransaction, 16)
+	)
+	allSub, err := client.Subscribe(context.Background(), "txpool", allCh, "newPendingTransactions")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer allSub.Unsubscribe()
+
+	senderSub, err := client.Subscribe(context.Background(), "txpool", senderCh, "newPendingTransactions", TxPoolFilter{From: &tester.senders[1]})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer senderSub.Unsubscribe()
+
+	priceSub, err := client.Subscribe(context.Background(), "txpool", priceCh, "newPendingTransactions", TxPoolFilter{To: &tester.r1, MinGasPrice: (*hexutil.Big)(big.NewInt(2))})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer priceSub.Unsubscribe()
+
+	// Submit a private transaction first, which must be withheld from all the
+	// subscriptions, and some public ones afterwards
+	if err := tester.backend.pool.AddPrivate(tester.a0); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	for _, tx := range []*types.Transaction{tester.b0, tester.a1, tester.a2, tester.b1} {
+		if err := tester.backend.pool.AddRemotesSync([]*types.Transaction{tx})[0]; err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	tests := []struct {
+		ch   chan *RPCTransaction
+		sub  *rpc.ClientSubscription
+		want []*types.Transaction
+	}{
+		{allCh, allSub, []*types.Transaction{tester.b0, tester.a1, tester.a2, tester.b1}},
+		{senderCh, senderSub, []*types.Transaction{tester.b0, tester.b1}},
+		{priceCh, priceSub, []*types.Transaction{tester.a1, tester.a2}},
+	}
+	for i, tt := range tests {
+		for j, want := range tt.want {
+			select {
+			case tx := <-tt.ch:
+				if tx.Hash != want.Hash() {
+					t.Errorf("subscription %d, notification %d: hash mismatch: have %x, want %x", i, j, tx.Hash, want.Hash())
+				}
+				if from, _ := types.Sender(types.LatestSigner(params.TestChainConfig), want); tx.From != from || uint64(tx.Nonce) != want.Nonce() {
+					t.Errorf("subscription %d, notification %d: transaction mismatch: have %x/%d, want %x/%d", i, j, tx.From, tx.Nonce, from, want.Nonce())
+				}
+			case err := <-tt.sub.Err():
+				t.Fatalf("subscription %d failed: %v", i, err)
+			case <-time.After(time.Second):
+				t.Fatalf("subscription %d, notification %d: timeout", i, j)
+			}
+		}
+	}
+	// Ensure no further notifications were delivered
+	time.Sleep(100 * time.Millisecond)
+	for i, tt := range tests {
+		select {
+		case tx := <-tt.ch:
+			t.Errorf("subscription %d: unexpected notification %x", i, tx.Hash)
+		default:
+		}
+	}
+}
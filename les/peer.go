@@ -30,7 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/les/flowcontrol"
 	lpc "github.com/ethereum/go-ethereum/les/lespay/client"
 	lps "github.com/ethereum/go-ethereum/les/lespay/server"
@@ -164,7 +164,7 @@ func (p *peerCommons) String() string {
 // Info gathers and returns a collection of metadata known about a peer.
 func (p *peerCommons) Info() *eth.PeerInfo {
 	return &eth.PeerInfo{
-		Version:    p.version,
+		Version:    uint(p.version),
 		Difficulty: p.Td(),
 		Head:       fmt.Sprintf("%x", p.Head()),
 	}
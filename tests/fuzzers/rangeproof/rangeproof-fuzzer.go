@@ -0,0 +1,252 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rangeproof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+type kv struct {
+	k, v []byte
+}
+
+type entrySlice []*kv
+
+func (p entrySlice) Len() int           { return len(p) }
+func (p entrySlice) Less(i, j int) bool { return bytes.Compare(p[i].k, p[j].k) < 0 }
+func (p entrySlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type fuzzer struct {
+	input     io.Reader
+	exhausted bool
+}
+
+func (f *fuzzer) randBytes(n int) []byte {
+	r := make([]byte, n)
+	if _, err := f.input.Read(r); err != nil {
+		f.exhausted = true
+	}
+	return r
+}
+
+func (f *fuzzer) readInt() uint64 {
+	var x uint64
+	if err := binary.Read(f.input, binary.LittleEndian, &x); err != nil {
+		f.exhausted = true
+	}
+	return x
+}
+
+// randomTrie creates a trie with some sequential fluff and n random entries,
+// returning the trie and its content sorted by key.
+func (f *fuzzer) randomTrie(n int) (*trie.Trie, entrySlice) {
+	var (
+		tr   = new(trie.Trie)
+		vals = make(map[string]*kv)
+	)
+	// Fill it with some fluff
+	size := f.readInt()
+	for i := byte(0); i < byte(size); i++ {
+		value := &kv{common.LeftPadBytes([]byte{i}, 32), []byte{i}}
+		value2 := &kv{common.LeftPadBytes([]byte{i + 10}, 32), []byte{i}}
+		tr.Update(value.k, value.v)
+		tr.Update(value2.k, value2.v)
+		vals[string(value.k)] = value
+		vals[string(value2.k)] = value2
+	}
+	if f.exhausted {
+		return nil, nil
+	}
+	// And now fill with some random
+	for i := 0; i < n; i++ {
+		k := f.randBytes(32)
+		v := f.randBytes(20)
+		if f.exhausted {
+			return nil, nil
+		}
+		value := &kv{k, v}
+		tr.Update(k, v)
+		vals[string(k)] = value
+	}
+	entries := make(entrySlice, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Sort(entries)
+	return tr, entries
+}
+
+// decKey returns the key preceding the given one, or nil if it underflows.
+func decKey(key []byte) []byte {
+	out := common.CopyBytes(key)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]--
+		if out[i] != 0xff {
+			return out
+		}
+	}
+	return nil
+}
+
+// incKey returns the key following the given one, or nil if it overflows.
+func incKey(key []byte) []byte {
+	out := common.CopyBytes(key)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]++
+		if out[i] != 0x00 {
+			return out
+		}
+	}
+	return nil
+}
+
+func (f *fuzzer) fuzz() int {
+	maxSize := 200
+	tr, entries := f.randomTrie(1 + int(f.readInt())%maxSize)
+	if f.exhausted {
+		return 0 // input too short
+	}
+	if len(entries) <= 1 {
+		return 0
+	}
+	var (
+		root = tr.Hash()
+		ok   = 0
+	)
+	for {
+		start := int(f.readInt() % uint64(len(entries)))
+		end := start + 1 + int(f.readInt()%uint64(len(entries)-start))
+		testcase := int(f.readInt() % uint64(9))
+		index := int(f.readInt() & 0xFFFFFFFF)
+		index2 := int(f.readInt() & 0xFFFFFFFF)
+		if f.exhausted {
+			break
+		}
+		var keys, vals [][]byte
+		for i := start; i < end; i++ {
+			keys = append(keys, common.CopyBytes(entries[i].k))
+			vals = append(vals, common.CopyBytes(entries[i].v))
+		}
+		var (
+			first, last = keys[0], keys[len(keys)-1]
+			modified    = true
+			hasMore     = end < len(entries)
+		)
+		switch testcase {
+		case 0:
+			// Modified key
+			key := f.randBytes(32)
+			modified = !bytes.Equal(keys[index%len(keys)], key)
+			keys[index%len(keys)] = key
+		case 1:
+			// Modified val
+			val := f.randBytes(20)
+			modified = !bytes.Equal(vals[index%len(vals)], val)
+			vals[index%len(vals)] = val
+		case 2:
+			// Gapped entry slice
+			index = index % len(keys)
+			keys = append(keys[:index], keys[index+1:]...)
+			vals = append(vals[:index], vals[index+1:]...)
+		case 3:
+			// Out of order
+			index1 := index % len(keys)
+			index2 := index2 % len(keys)
+			modified = index1 != index2
+			keys[index1], keys[index2] = keys[index2], keys[index1]
+			vals[index1], vals[index2] = vals[index2], vals[index1]
+		case 4:
+			// Set random key to nil
+			keys[index%len(keys)] = nil
+		case 5:
+			// Set random value to nil, deletion
+			vals[index%len(vals)] = nil
+		case 6:
+			// Unmodified range, proven with existent edges
+			modified = false
+		case 7:
+			// Unmodified range, proven with non-existent edges where possible
+			if prev := decKey(first); prev != nil && (start == 0 || bytes.Compare(prev, entries[start-1].k) > 0) {
+				first = prev
+			}
+			if next := incKey(last); next != nil && (end == len(entries) || bytes.Compare(next, entries[end].k) < 0) {
+				last = next
+			}
+			modified = false
+		case 8:
+			// Empty range, proven by a single non-existent edge
+			first = incKey(entries[end-1].k)
+			if first == nil || (end < len(entries) && bytes.Equal(first, entries[end].k)) {
+				continue
+			}
+			keys, vals, last = nil, nil, first
+			modified = hasMore // Empty range is only valid if nothing's on the right
+			hasMore = false
+		}
+		if f.exhausted {
+			break
+		}
+		proof := memorydb.New()
+		if err := tr.Prove(first, 0, proof); err != nil {
+			panic(fmt.Sprintf("Failed to prove the first node %v", err))
+		}
+		if err := tr.Prove(last, 0, proof); err != nil {
+			panic(fmt.Sprintf("Failed to prove the last node %v", err))
+		}
+		ok = 1
+
+		err, more := trie.VerifyRangeProof(root, first, last, keys, vals, proof)
+		switch {
+		case err != nil && more:
+			panic("err != nil && hasMore == true")
+		case err != nil && !modified:
+			panic(fmt.Sprintf("valid range proof rejected (case %d): %v", testcase, err))
+		case err == nil && modified:
+			panic(fmt.Sprintf("invalid range proof accepted (case %d)", testcase))
+		case err == nil && more != hasMore:
+			panic(fmt.Sprintf("continuation flag mismatch (case %d): have %v, want %v", testcase, more, hasMore))
+		}
+	}
+	return ok
+}
+
+// The function must return
+// 1 if the fuzzer should increase priority of the
+//    given input during subsequent fuzzing (for example, the input is lexically
+//    correct and was parsed successfully);
+// -1 if the input must not be added to corpus even if gives new coverage; and
+// 0  otherwise
+// other values are reserved for future use.
+func Fuzz(input []byte) int {
+	if len(input) < 100 {
+		return 0
+	}
+	r := bytes.NewReader(input)
+	f := fuzzer{
+		input:     r,
+		exhausted: false,
+	}
+	return f.fuzz()
+}